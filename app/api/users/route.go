@@ -1,10 +1,11 @@
 package users
 
 import (
+	"errors"
 	"goonairplanes/core"
 	"net/http"
-	"strconv"
 	"sync"
+	"time"
 )
 
 type User struct {
@@ -16,7 +17,7 @@ type User struct {
 
 func init() {
 	core.RegisterAPIHandler("/api/users", http.MethodGet, GetUsers)
-	core.RegisterAPIHandler("/api/users", http.MethodPost, CreateUser)
+	core.RegisterAPIHandler("/api/users", http.MethodPost, CreateUser, core.WithIdempotency(24*time.Hour))
 	core.RegisterAPIHandler("/api/users/[id]", http.MethodGet, GetUserByID)
 	core.RegisterAPIHandler("/api/users/[id]", http.MethodPut, UpdateUserByID)
 	core.RegisterAPIHandler("/api/users/[id]", http.MethodDelete, DeleteUserByID)
@@ -29,6 +30,24 @@ var mockUsers = []User{
 var nextUserID int64 = 3
 var userMutex sync.Mutex
 
+type userIDParams struct {
+	ID int64 `path:"id"`
+}
+
+type updateUserRequest struct {
+	User
+	ID int64 `path:"id" json:"-"`
+}
+
+func bindUserID(ctx *core.APIContext) (int64, bool) {
+	var params userIDParams
+	if err := ctx.Bind(&params); err != nil || params.ID <= 0 {
+		ctx.Error("Invalid user ID format", http.StatusBadRequest)
+		return 0, false
+	}
+	return params.ID, true
+}
+
 func GetUsers(ctx *core.APIContext) {
 	page, perPage := core.GetPaginationParams(ctx.Request, 10)
 
@@ -74,10 +93,8 @@ func CreateUser(ctx *core.APIContext) {
 }
 
 func GetUserByID(ctx *core.APIContext) {
-	idStr := ctx.Params["id"]
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil || id <= 0 {
-		ctx.Error("Invalid user ID format", http.StatusBadRequest)
+	id, ok := bindUserID(ctx)
+	if !ok {
 		return
 	}
 
@@ -100,19 +117,24 @@ func GetUserByID(ctx *core.APIContext) {
 }
 
 func UpdateUserByID(ctx *core.APIContext) {
-	idStr := ctx.Params["id"]
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil || id <= 0 {
-		ctx.Error("Invalid user ID format", http.StatusBadRequest)
+	var req updateUserRequest
+	if err := ctx.Bind(&req); err != nil {
+		status := http.StatusBadRequest
+		var bindErr *core.BindError
+		if errors.As(err, &bindErr) {
+			status = bindErr.Status()
+		}
+		ctx.Error("Invalid request: "+err.Error(), status)
 		return
 	}
-
-	var updatedData User
-	if err := ctx.ParseBody(&updatedData); err != nil {
-		ctx.Error("Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if req.ID <= 0 {
+		ctx.Error("Invalid user ID format", http.StatusBadRequest)
 		return
 	}
 
+	id := req.ID
+	updatedData := req.User
+
 	userMutex.Lock()
 	found := false
 	for i := range mockUsers {
@@ -139,10 +161,8 @@ func UpdateUserByID(ctx *core.APIContext) {
 }
 
 func DeleteUserByID(ctx *core.APIContext) {
-	idStr := ctx.Params["id"]
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil || id <= 0 {
-		ctx.Error("Invalid user ID format", http.StatusBadRequest)
+	id, ok := bindUserID(ctx)
+	if !ok {
 		return
 	}
 
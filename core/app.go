@@ -1,85 +1,110 @@
 package core
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
-type AppLogger struct {
-	InfoLog  *log.Logger
-	ErrorLog *log.Logger
-	WarnLog  *log.Logger
-}
-
 type GonAirApp struct {
 	Router      *Router
 	FileWatcher *FileWatcher
 	Config      *Config
 	Logger      *AppLogger
+
+	handler     http.Handler
+	handlerOnce sync.Once
+
+	server         *http.Server
+	redirectServer *http.Server
+	ctx            context.Context
+	cancel         context.CancelFunc
+	startHooks     []LifecycleHook
+	shutdownHooks  []LifecycleHook
+	lifecycleMutex sync.Mutex
+	shutdownOnce   sync.Once
+	shutdownErr    error
+
+	startedAt       time.Time
+	readinessChecks []namedHealthCheck
 }
 
 func NewApp() *GonAirApp {
-	logger := &AppLogger{
-		InfoLog:  log.New(os.Stdout, "✈️ \033[36mINFO\033[0m  ", log.Ldate|log.Ltime),
-		ErrorLog: log.New(os.Stderr, "✈️ \033[31mERROR\033[0m ", log.Ldate|log.Ltime),
-		WarnLog:  log.New(os.Stdout, "✈️ \033[33mWARN\033[0m  ", log.Ldate|log.Ltime),
-	}
+	return NewAppWithConfig(DefaultConfig())
+}
+
+// NewAppWithConfig creates an app that owns config; registries, caches and
+// error state are never shared with other apps in the same process.
+func NewAppWithConfig(config Config) *GonAirApp {
+	logger := newLoggerFromConfig(&config)
 
-	router := NewRouter(logger)
+	config.BasePath = normalizeBasePath(config.BasePath)
+	router := NewRouter(&config, logger)
+	ctx, cancel := context.WithCancel(context.Background())
 
 	return &GonAirApp{
-		Router: router,
-		Config: &AppConfig,
-		Logger: logger,
+		Router:    router,
+		Config:    &config,
+		Logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		startedAt: time.Now(),
 	}
 }
 
 func (app *GonAirApp) Init() error {
 	startTime := time.Now()
 
-	app.Logger.InfoLog.Printf("Initializing Go on Airplanes...")
+	app.Logger.Infof("Initializing Go on Airplanes...")
+
+	if err := app.Router.configErr; err != nil {
+		app.Logger.Errorf("Failed to initialize: %v", err)
+		return err
+	}
 
 	err := app.Router.InitRoutes()
 	if err != nil {
-		app.Logger.ErrorLog.Printf("Failed to initialize routes: %v", err)
+		app.Logger.Errorf("Failed to initialize routes: %v", err)
 		return fmt.Errorf("failed to initialize routes: %w", err)
 	}
-	app.Logger.InfoLog.Printf("Routes initialized successfully")
+	app.Logger.Infof("Routes initialized successfully")
 
-	if AppConfig.InMemoryJS {
-		app.Logger.InfoLog.Printf("Initializing JavaScript library cache...")
-		if err := FetchAndCacheJSLibraries(); err != nil {
-			app.Logger.WarnLog.Printf("Failed to cache JavaScript libraries: %v", err)
-			app.Logger.WarnLog.Printf("Falling back to CDN for JavaScript libraries")
+	if app.Config.InMemoryJS {
+		app.Logger.Infof("Initializing JavaScript library cache...")
+		if err := app.Router.Marley.FetchAndCacheJSLibraries(); err != nil {
+			app.Logger.Warnf("Failed to cache JavaScript libraries: %v", err)
+			app.Logger.Warnf("Falling back to CDN for JavaScript libraries")
 		} else {
-			app.Logger.InfoLog.Printf("JavaScript libraries cached successfully")
+			app.Logger.Infof("JavaScript libraries cached successfully")
 		}
 	}
 
 	configureMiddleware := app.getConfigureMiddlewareFunc()
 	if configureMiddleware != nil {
 		configureMiddleware(app)
-		app.Logger.InfoLog.Printf("Middleware configured successfully")
+		app.Logger.Infof("Middleware configured successfully")
 	}
 
 	if app.Config.DevMode && app.Config.LiveReload {
 		watcher, err := NewFileWatcher(app.Router, app.Logger)
 		if err != nil {
-			app.Logger.ErrorLog.Printf("Failed to create file watcher: %v", err)
+			app.Logger.Errorf("Failed to create file watcher: %v", err)
 			return fmt.Errorf("failed to create file watcher: %w", err)
 		}
-		app.Logger.InfoLog.Printf("File watcher created successfully")
+		app.Logger.Infof("File watcher created successfully")
 		app.FileWatcher = watcher
 	}
 
 	elapsedTime := time.Since(startTime)
-	app.Logger.InfoLog.Printf("Go on Airplanes initialized in %v", elapsedTime.Round(time.Millisecond))
+	app.Logger.Infof("Go on Airplanes initialized in %v", elapsedTime.Round(time.Millisecond))
 
 	return nil
 }
@@ -87,34 +112,46 @@ func (app *GonAirApp) Init() error {
 func (app *GonAirApp) getConfigureMiddlewareFunc() func(*GonAirApp) {
 	middlewareConfigPath := filepath.Join(app.Config.AppDir, "middleware.go")
 	if _, err := os.Stat(middlewareConfigPath); os.IsNotExist(err) {
-		app.Logger.WarnLog.Printf("Middleware configuration file not found at %s", middlewareConfigPath)
+		app.Logger.Warnf("Middleware configuration file not found at %s", middlewareConfigPath)
 		return nil
 	}
 
 	return func(app *GonAirApp) {
-		app.Router.Use(LoggingMiddleware(app.Logger))
 		app.Router.Use(RecoveryMiddleware(app.Logger))
 
-		if app.Config.EnableCORS {
-			app.Router.Use(CORSMiddleware(app.Config.AllowedOrigins))
-		}
-
 		if app.Config.SSGEnabled {
-			app.Router.Use(SSGMiddleware(app.Logger))
-			app.Logger.InfoLog.Printf("SSG enabled, static files will be generated in %s", app.Config.SSGDir)
+			app.Router.Use(SSGMiddleware(app.Config, app.Logger))
+			app.Logger.Infof("SSG enabled, static files will be generated in %s", app.Config.SSGDir)
 		}
 	}
 }
 
+// Start serves the app until SIGINT or SIGTERM, then drains in-flight requests
+// for up to Config.ShutdownTimeout and stops background workers.
 func (app *GonAirApp) Start() error {
+	if err := app.runStartHooks(); err != nil {
+		app.Logger.Errorf("Startup aborted: %v", err)
+		app.Shutdown(context.Background())
+		return err
+	}
+
 	if app.FileWatcher != nil {
 		app.FileWatcher.Start()
-		defer app.FileWatcher.Stop()
-		app.Logger.InfoLog.Printf("Live reload enabled - watching for file changes")
+		app.Logger.Infof("Live reload enabled - watching for file changes")
 	}
 
 	port := app.Config.Port
 
+	var certFile, keyFile string
+	if app.Config.TLSEnabled {
+		var err error
+		if certFile, keyFile, err = app.tlsFiles(); err != nil {
+			app.Logger.Errorf("TLS setup failed: %v", err)
+			app.Shutdown(context.Background())
+			return fmt.Errorf("tls setup failed: %w", err)
+		}
+	}
+
 	app.printBanner(port)
 
 	app.printErrorSummary()
@@ -128,125 +165,237 @@ func (app *GonAirApp) Start() error {
 		DisableCompression:  true,
 	}
 
-	mux := http.NewServeMux()
-
-	if app.Config.DevMode && app.FileWatcher != nil {
-
-		app.FileWatcher.RegisterSocketHandler(mux)
-	}
-
-	mux.Handle("/", app.Router)
+	handler := app.Handler()
 
-	server := &http.Server{
+	app.server = &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: handler,
 
 		ReadTimeout:       15 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
-		WriteTimeout:      15 * time.Second,
+		WriteTimeout:      app.Config.serverWriteTimeout(),
 		IdleTimeout:       60 * time.Second,
 
 		MaxHeaderBytes: 1 << 20,
 	}
 
-	app.Logger.InfoLog.Printf("Press Ctrl+C to stop the server")
+	if app.Config.TLSEnabled {
+		tlsConfig, err := app.tlsConfig()
+		if err != nil {
+			app.Shutdown(context.Background())
+			return fmt.Errorf("tls setup failed: %w", err)
+		}
+		app.server.TLSConfig = tlsConfig
+	}
+
+	stopResetSignal := app.watchResetSignal()
+	defer stopResetSignal()
+
+	app.Logger.Infof("Press Ctrl+C to stop the server")
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if app.Config.TLSEnabled {
+			serverErr <- app.server.ListenAndServeTLS(certFile, keyFile)
+			return
+		}
+		serverErr <- app.server.ListenAndServe()
+	}()
+
+	if app.Config.TLSEnabled && app.Config.TLSRedirectHTTP {
+		app.redirectServer = app.newRedirectServer()
+		app.Logger.Infof("Redirecting HTTP on port %s to HTTPS", app.Config.TLSRedirectPort)
+		go func() {
+			if err := app.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErr <- fmt.Errorf("http redirect listener: %w", err)
+			}
+		}()
+	}
 
-	err := server.ListenAndServe()
+	err := app.waitForShutdownSignal(serverErr)
 	if err != nil && err != http.ErrServerClosed {
-		app.Logger.ErrorLog.Printf("Server error: %v", err)
+		app.Logger.Errorf("Server error: %v", err)
+		app.Shutdown(context.Background())
 		return fmt.Errorf("server error: %w", err)
 	}
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), app.Config.ShutdownTimeout)
+	defer cancel()
+
+	return app.Shutdown(ctx)
 }
 
-func (app *GonAirApp) printErrorSummary() {
+// Handler returns the app as a plain http.Handler, so it can be mounted inside
+// an existing server. When Config.BasePath is set, requests outside it get a 404.
+func (app *GonAirApp) Handler() http.Handler {
+	app.handlerOnce.Do(func() {
+		app.handler = app.buildHandler()
+	})
+	return app.handler
+}
+
+func (app *GonAirApp) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.Handler().ServeHTTP(w, r)
+}
 
-	var templateErrorCount int
-	var templateErrors []string
+func (app *GonAirApp) buildHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	if app.Config.DevMode && app.FileWatcher != nil {
 
-	app.Router.Marley.mutex.RLock()
-	for routePath, err := range app.Router.Marley.TemplateErrors {
-		templateErrorCount++
-		templateErrors = append(templateErrors, fmt.Sprintf("  • %s: %v", routePath, err))
+		app.FileWatcher.RegisterSocketHandler(mux)
 	}
-	app.Router.Marley.mutex.RUnlock()
 
-	var pageErrorCount int
-	var pageErrors []string
+	if app.Config.DevMode {
+		mux.HandleFunc("/_goa/errors/reset", app.handleResetErrors)
+		mux.HandleFunc("/_goa/log/level", app.handleLogLevel)
+	}
 
-	pageErrorMap.Range(func(key, value interface{}) bool {
-		routePath := key.(string)
-		pageError := value.(*PageError)
+	if app.Config.HealthEnabled {
+		mux.HandleFunc(normalizePath(app.Config.HealthPath), app.handleHealthz)
+		mux.HandleFunc(normalizePath(app.Config.ReadyPath), app.handleReadyz)
+	}
 
-		app.Router.Marley.mutex.RLock()
-		_, alreadyReported := app.Router.Marley.TemplateErrors[routePath]
-		app.Router.Marley.mutex.RUnlock()
+	if app.Config.MetricsEnabled {
+		mux.Handle(normalizePath(app.Config.MetricsPath), app.Router.Metrics)
+	}
 
-		if !alreadyReported {
-			pageErrorCount++
-			errorDetails := pageError.Details
-			if len(errorDetails) > 100 {
-				errorDetails = errorDetails[:100] + "..."
-			}
-			pageErrors = append(pageErrors, fmt.Sprintf("  • %s: %s", routePath, errorDetails))
-		}
-		return true
-	})
+	if app.Config.CSPEnabled && app.Config.CSPReportPath != "" {
+		mux.HandleFunc(normalizePath(app.Config.CSPReportPath), app.Router.handleCSPReport)
+	}
+
+	for _, endpoint := range app.Router.SocketEndpoints() {
+		app.Logger.Infof("WebSocket endpoint registered: %s", endpoint.Path)
+	}
+
+	mux.Handle("/", app.Router)
+
+	var handler http.Handler = app.Router.serveSockets(mux)
+	if app.Config.CompressionEnabled {
+		handler = CompressionMiddleware(app.Config.compressionOptions())(handler)
+	}
+
+	if app.Config.BasePath != "" {
+		app.Logger.Infof("App mounted under base path %s", app.Config.BasePath)
+		return mountBasePath(app.Config.BasePath, handler)
+	}
+
+	return handler
+}
+
+func (app *GonAirApp) ResetErrors() {
+	app.Router.Errors.ClearAll()
+	cleared := app.Router.Marley.ClearRenderErrors()
+	app.Router.Marley.ClearRenderCache()
+
+	app.Logger.Infof("Error state reset: page and API errors cleared, %d failed pages reset", cleared)
+}
 
-	var apiErrorCount int
-	var apiErrors []string
+func (app *GonAirApp) handleResetErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		RenderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	apiErrorMap.Range(func(key, value interface{}) bool {
-		apiError := value.(*APIError)
+	app.ResetErrors()
+	RenderSuccess(w, map[string]string{"message": "Error state cleared"}, http.StatusOK)
+}
 
-		apiErrorCount++
-		errorMsg := apiError.ErrorMsg
-		if len(errorMsg) > 100 {
-			errorMsg = errorMsg[:100] + "..."
+// handleLogLevel reports the current log level on GET and changes it on POST
+// with a body such as {"level": "debug"}.
+func (app *GonAirApp) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body struct {
+			Level string `json:"level"`
 		}
-		apiErrors = append(apiErrors, fmt.Sprintf("  • %s %s: %s",
-			apiError.Method, apiError.Path, errorMsg))
-		return true
-	})
+		if err := ParseBody(r, &body); err != nil {
+			RenderError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		level, err := ParseLogLevel(body.Level)
+		if err != nil || body.Level == "" {
+			RenderError(w, "level must be debug, info, warn or error", http.StatusBadRequest)
+			return
+		}
+		app.Logger.SetLevel(level)
+		app.Logger.Info("Log level changed", "level", level)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		RenderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	if templateErrorCount > 0 || pageErrorCount > 0 || apiErrorCount > 0 {
-		fmt.Println()
-		app.Logger.WarnLog.Printf("┌─────────────────────────────────────────────────┐")
-		app.Logger.WarnLog.Printf("│               ERROR SUMMARY REPORT              │")
-		app.Logger.WarnLog.Printf("└─────────────────────────────────────────────────┘")
+	RenderSuccess(w, map[string]string{"level": app.Logger.Level().String()}, http.StatusOK)
+}
 
-		if templateErrorCount > 0 {
-			app.Logger.WarnLog.Printf("Template Loading Errors: %d", templateErrorCount)
-			for _, errMsg := range templateErrors {
-				app.Logger.WarnLog.Printf("%s", errMsg)
-			}
-			fmt.Println()
+func (app *GonAirApp) watchResetSignal() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			app.Logger.Infof("Received SIGHUP, clearing error state")
+			app.ResetErrors()
 		}
+	}()
 
-		if pageErrorCount > 0 {
-			app.Logger.WarnLog.Printf("Page Rendering Errors: %d", pageErrorCount)
-			for _, errMsg := range pageErrors {
-				app.Logger.WarnLog.Printf("%s", errMsg)
-			}
-			fmt.Println()
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
+
+func (app *GonAirApp) shutdownSockets(ctx context.Context) {
+	for _, endpoint := range app.Router.SocketEndpoints() {
+		if err := endpoint.Shutdown(ctx); err != nil {
+			app.Logger.Errorf("Error shutting down WebSocket endpoint %s: %v", endpoint.Path, err)
 		}
+	}
+}
 
-		if apiErrorCount > 0 {
-			app.Logger.WarnLog.Printf("API Endpoint Errors: %d", apiErrorCount)
-			for _, errMsg := range apiErrors {
-				app.Logger.WarnLog.Printf("%s", errMsg)
-			}
-			fmt.Println()
+func (app *GonAirApp) printErrorSummary() {
+	marley := app.Router.Marley
+
+	marley.mutex.RLock()
+	templateErrors := make(map[string]error, len(marley.TemplateErrors))
+	for routePath, err := range marley.TemplateErrors {
+		templateErrors[routePath] = err
+	}
+	marley.mutex.RUnlock()
+
+	var pageErrors []*PageError
+	for _, pageError := range app.Router.Errors.PageErrors() {
+		if _, alreadyReported := templateErrors[pageError.Path]; !alreadyReported {
+			pageErrors = append(pageErrors, pageError)
 		}
+	}
+
+	apiErrors := app.Router.Errors.APIErrors()
+
+	if len(templateErrors) == 0 && len(pageErrors) == 0 && len(apiErrors) == 0 {
+		app.Logger.Debug("No template, page or API errors detected")
+		return
+	}
+
+	app.Logger.Warn("Error summary",
+		"template_errors", len(templateErrors),
+		"page_errors", len(pageErrors),
+		"api_errors", len(apiErrors))
 
-		app.Logger.WarnLog.Printf("Page routes with errors will display the error page when accessed.")
-		app.Logger.WarnLog.Printf("API endpoints with errors will return error responses.")
-		app.Logger.WarnLog.Printf("Fix the issues and restart the server to resolve them.")
-		fmt.Println()
-	} else if app.Config.LogLevel == "debug" {
-		app.Logger.InfoLog.Printf("No template, page or API errors detected. All routes healthy!")
+	for _, routePath := range sortedKeys(templateErrors) {
+		app.Logger.Warn("Template loading error", "route", routePath, "error", templateErrors[routePath])
+	}
+	for _, pageError := range pageErrors {
+		app.Logger.Warn("Page rendering error", "route", pageError.Path, "error", truncateString(pageError.Details, 100))
 	}
+	for _, apiError := range apiErrors {
+		app.Logger.Warn("API endpoint error", "route", apiError.Path, "method", apiError.Method, "error", truncateString(apiError.ErrorMsg, 100))
+	}
+
+	app.Logger.Warn("Fix the issues and send SIGHUP (or POST /_goa/errors/reset in dev mode) to clear them")
 }
 
 func (app *GonAirApp) printBanner(port string) {
@@ -258,14 +407,21 @@ func (app *GonAirApp) printBanner(port string) {
 	╚██████╔╝╚██████╔╝    
 	╚═════╝  ╚═════╝      
 `
-	fmt.Print(banner)
-	app.Logger.InfoLog.Printf("Go on Airplanes ready for takeoff!")
-	app.Logger.InfoLog.Printf("Local:   http://localhost:%s", port)
+	if !app.Logger.isJSON() {
+		fmt.Print(banner)
+	}
+	app.Logger.Infof("Go on Airplanes ready for takeoff!")
+	scheme := "http"
+	if app.Config.TLSEnabled {
+		scheme = "https"
+	}
+
+	app.Logger.Infof("Local:   %s://localhost:%s%s/", scheme, port, app.Config.BasePath)
 
 	interfaces, _ := getNetworkInterfaces()
 	if len(interfaces) > 0 {
 		for _, ip := range interfaces {
-			app.Logger.InfoLog.Printf("Network: http://%s:%s", ip, port)
+			app.Logger.Infof("Network: %s://%s:%s%s/", scheme, ip, port, app.Config.BasePath)
 		}
 	}
 }
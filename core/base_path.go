@@ -0,0 +1,102 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// normalizeBasePath turns "portal", "/portal/" and "/portal" into "/portal";
+// an empty or root base path means the app is mounted at "/".
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		return ""
+	}
+	return "/" + basePath
+}
+
+// URL prefixes an app-relative path such as "/static/css/global.css" with BasePath.
+func (c *Config) URL(path string) string {
+	return prefixBasePath(c.BasePath, path)
+}
+
+func prefixBasePath(basePath string, path string) string {
+	if basePath == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return path
+	}
+	return basePath + path
+}
+
+// mountBasePath strips basePath from incoming requests so the router only sees
+// app-relative paths, and adds it back to redirects issued by handlers.
+func mountBasePath(basePath string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.Path
+		if path != basePath && !strings.HasPrefix(path, basePath+"/") {
+			http.NotFound(w, req)
+			return
+		}
+
+		stripped := new(http.Request)
+		*stripped = *req
+		stripped.URL = new(url.URL)
+		*stripped.URL = *req.URL
+
+		stripped.URL.Path = strings.TrimPrefix(path, basePath)
+		if stripped.URL.Path == "" {
+			stripped.URL.Path = "/"
+		}
+		if req.URL.RawPath != "" {
+			stripped.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, basePath)
+			if stripped.URL.RawPath == "" {
+				stripped.URL.RawPath = "/"
+			}
+		}
+
+		next.ServeHTTP(&basePathResponseWriter{ResponseWriter: w, basePath: basePath}, stripped)
+	})
+}
+
+type basePathResponseWriter struct {
+	http.ResponseWriter
+	basePath    string
+	wroteHeader bool
+}
+
+func (w *basePathResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if location := w.Header().Get("Location"); location != "" {
+			w.Header().Set("Location", prefixBasePath(w.basePath, location))
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *basePathResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *basePathResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *basePathResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (w *basePathResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,104 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func mountedApp(t *testing.T, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.BasePath = "portal/"
+	})}, opts...)
+	return newTestApp(t, opts...)
+}
+
+func TestBasePathRoutesOnlyUnderThePrefix(t *testing.T) {
+	app := mountedApp(t, withAPI("/api/ping", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success(ctx.Request.URL.Path, http.StatusOK)
+	}))
+
+	if app.App.Config.BasePath != "/portal" {
+		t.Errorf("BasePath = %q, want it normalized to /portal", app.App.Config.BasePath)
+	}
+
+	app.Get("/portal").AssertStatus(http.StatusOK).AssertText("h1", "Home")
+	app.Get("/portal/").AssertStatus(http.StatusOK).AssertText("h1", "Home")
+	app.Get("/portal/instance").AssertStatus(http.StatusOK)
+	app.Get("/portal/static/robots.txt").AssertStatus(http.StatusOK)
+
+	var path string
+	app.Get("/portal/api/ping").AssertStatus(http.StatusOK).Data(&path)
+	if path != "/api/ping" {
+		t.Errorf("handler saw path %q, want it without the prefix", path)
+	}
+
+	for _, outside := range []string{"/", "/instance", "/api/ping", "/portalx", "/static/robots.txt"} {
+		app.Get(outside).AssertStatus(http.StatusNotFound)
+	}
+}
+
+func TestBasePathPrefixesGeneratedLinks(t *testing.T) {
+	res := mountedApp(t).Get("/portal/links").AssertStatus(http.StatusOK)
+
+	links := map[string]string{
+		"a.home":     "/portal/",
+		"a.asset":    "/portal/static/robots.txt",
+		"a.external": "https://example.com/",
+	}
+	for selector, want := range links {
+		if href, _ := res.First(selector).Attr("href"); href != want {
+			t.Errorf("%s href = %q, want %q", selector, href, want)
+		}
+	}
+	res.AssertText("p.base", "/portal")
+
+	unmounted := newTestApp(t).Get("/links")
+	if href, _ := unmounted.First("a.home").Attr("href"); href != "/" {
+		t.Errorf("without a base path home href = %q", href)
+	}
+}
+
+func TestBasePathPrefixesRedirects(t *testing.T) {
+	app := mountedApp(t, goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/go/[where]", http.MethodGet, func(ctx *core.APIContext) {
+			target := "/dashboard"
+			if ctx.Params["where"] == "away" {
+				target = "https://example.com/"
+			}
+			http.Redirect(ctx.Writer, ctx.Request, target, http.StatusFound)
+		})
+	}))
+
+	app.Get("/portal/api/go/home").AssertStatus(http.StatusFound).AssertHeader("Location", "/portal/dashboard")
+	app.Get("/portal/api/go/away").AssertStatus(http.StatusFound).AssertHeader("Location", "https://example.com/")
+}
+
+func TestBasePathScopesSessionCookies(t *testing.T) {
+	app := mountedApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SessionEnabled = true
+	}), withAPI("/api/login", http.MethodPost, func(ctx *core.APIContext) {
+		ctx.Session().Set("user", "ada")
+		ctx.Success("ok", http.StatusOK)
+	}))
+
+	res := app.PostJSON("/portal/api/login", nil).AssertStatus(http.StatusOK)
+	cookies := (&http.Response{Header: res.Header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/portal" {
+		t.Errorf("cookies = %v, want one scoped to /portal", cookies)
+	}
+}
+
+func TestBasePathLiveReloadSocket(t *testing.T) {
+	app := mountedApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.DevMode = true
+	}))
+
+	if script := app.App.Router.Marley.GetWebSocketClientJS(); !strings.Contains(script, `'/portal/socket'`) {
+		t.Error("live reload script does not connect under the base path")
+	}
+}
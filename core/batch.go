@@ -0,0 +1,444 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const batchPath = "/api/_batch"
+
+// batchReservedHeaders can't be set by a batch item. Forwarding headers decide
+// the client's address behind a trusted proxy, so each item keeps the parent
+// request's values; hop-by-hop headers only describe the outer connection.
+var batchReservedHeaders = map[string]bool{
+	"Forwarded":           true,
+	"X-Forwarded-For":     true,
+	"X-Forwarded-Host":    true,
+	"X-Forwarded-Proto":   true,
+	"X-Real-Ip":           true,
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+}
+
+// batchItemOnlyHeaders are not inherited from the batch request: they name
+// one operation, so only an item's own headers may set them.
+var batchItemOnlyHeaders = map[string]bool{
+	IdempotencyKeyHeader:  true,
+	"If-Match":            true,
+	"If-None-Match":       true,
+	"If-Modified-Since":   true,
+	"If-Unmodified-Since": true,
+	"If-Range":            true,
+}
+
+var batchRefRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_\-]+)((?:\.[A-Za-z0-9_\-]+)*)\s*\}\}`)
+
+type BatchRequest struct {
+	Parallel bool               `json:"parallel"`
+	Requests []BatchRequestItem `json:"requests"`
+}
+
+type BatchRequestItem struct {
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+type BatchResponseItem struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    interface{}       `json:"body,omitempty"`
+}
+
+type batchItemState struct {
+	item     BatchRequestItem
+	deps     []int
+	done     chan struct{}
+	response BatchResponseItem
+	decoded  interface{}
+}
+
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (r *Router) serveBatch(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		RenderError(w, "Batch requests must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batch, err := parseBatchRequest(req)
+	if err != nil {
+		RenderError(w, "Invalid batch request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(batch.Requests) == 0 {
+		RenderError(w, "Batch request contains no items", http.StatusBadRequest)
+		return
+	}
+
+	maxItems := r.Config.BatchMaxItems
+	if maxItems > 0 && len(batch.Requests) > maxItems {
+		RenderError(w, fmt.Sprintf("Batch request exceeds the limit of %d items", maxItems), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	states, err := planBatch(batch.Requests)
+	if err != nil {
+		RenderError(w, "Invalid batch request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if batch.Parallel {
+		var wg sync.WaitGroup
+		for i := range states {
+			wg.Add(1)
+			go func(index int) {
+				defer wg.Done()
+				r.runBatchItem(req, states, index)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range states {
+			r.runBatchItem(req, states, i)
+		}
+	}
+
+	responses := make([]BatchResponseItem, len(states))
+	for i, state := range states {
+		responses[i] = state.response
+	}
+
+	RenderSuccess(w, responses, http.StatusOK)
+}
+
+func parseBatchRequest(req *http.Request) (*BatchRequest, error) {
+	var raw json.RawMessage
+	if err := ParseBody(req, &raw); err != nil {
+		return nil, err
+	}
+
+	batch := &BatchRequest{}
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &batch.Requests); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(trimmed, batch); err != nil {
+		return nil, err
+	}
+
+	if parallel, err := strconv.ParseBool(req.URL.Query().Get("parallel")); err == nil {
+		batch.Parallel = parallel
+	}
+
+	return batch, nil
+}
+
+// planBatch resolves each item's {{ref.field}} placeholders to the indexes of the
+// earlier items it depends on; references to later items are rejected.
+func planBatch(items []BatchRequestItem) ([]*batchItemState, error) {
+	states := make([]*batchItemState, len(items))
+	ids := make(map[string]int, len(items))
+
+	for i, item := range items {
+		if item.Method == "" {
+			item.Method = http.MethodGet
+		}
+		item.Method = strings.ToUpper(item.Method)
+
+		if !strings.HasPrefix(normalizePath(strings.SplitN(item.Path, "?", 2)[0]), "/api/") {
+			return nil, fmt.Errorf("item %d: path must start with /api/", i)
+		}
+		if normalizePath(strings.SplitN(item.Path, "?", 2)[0]) == batchPath {
+			return nil, fmt.Errorf("item %d: nested batch requests are not allowed", i)
+		}
+
+		state := &batchItemState{item: item, done: make(chan struct{})}
+
+		seen := make(map[int]bool)
+		refs := batchRefRegex.FindAllStringSubmatch(item.Path+string(item.Body), -1)
+		for _, ref := range refs {
+			dep, err := resolveBatchRef(ref[1], ids, i)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+			if !seen[dep] {
+				seen[dep] = true
+				state.deps = append(state.deps, dep)
+			}
+		}
+
+		if item.ID != "" {
+			if _, exists := ids[item.ID]; exists {
+				return nil, fmt.Errorf("item %d: duplicate id %q", i, item.ID)
+			}
+			ids[item.ID] = i
+		}
+
+		states[i] = state
+	}
+
+	return states, nil
+}
+
+func resolveBatchRef(ref string, ids map[string]int, current int) (int, error) {
+	if index, ok := ids[ref]; ok {
+		return index, nil
+	}
+	if index, err := strconv.Atoi(ref); err == nil {
+		if index < 0 || index >= current {
+			return 0, fmt.Errorf("reference %q must point to an earlier item", ref)
+		}
+		return index, nil
+	}
+	return 0, fmt.Errorf("unknown reference %q", ref)
+}
+
+func (r *Router) runBatchItem(parent *http.Request, states []*batchItemState, index int) {
+	state := states[index]
+	defer close(state.done)
+
+	state.response.ID = state.item.ID
+
+	for _, dep := range state.deps {
+		<-states[dep].done
+		if states[dep].response.Status >= http.StatusBadRequest {
+			state.response.Status = http.StatusFailedDependency
+			state.response.Body = map[string]string{"error": fmt.Sprintf("dependency %d failed", dep)}
+			return
+		}
+	}
+
+	path, body, err := substituteBatchRefs(state.item, states)
+	if err != nil {
+		state.response.Status = http.StatusBadRequest
+		state.response.Body = map[string]string{"error": err.Error()}
+		return
+	}
+
+	subReq, err := http.NewRequestWithContext(withBatchItem(parent.Context()), state.item.Method, path, bytes.NewReader(body))
+	if err != nil {
+		state.response.Status = http.StatusBadRequest
+		state.response.Body = map[string]string{"error": err.Error()}
+		return
+	}
+
+	for key, values := range parent.Header {
+		if strings.EqualFold(key, "Content-Length") || batchItemOnlyHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		subReq.Header[key] = append([]string(nil), values...)
+	}
+	if len(body) > 0 {
+		subReq.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range state.item.Headers {
+		if batchReservedHeaders[http.CanonicalHeaderKey(key)] {
+			continue
+		}
+		subReq.Header.Set(key, value)
+	}
+	subReq.RemoteAddr = parent.RemoteAddr
+	subReq.Host = parent.Host
+
+	recorder := &batchResponseWriter{header: make(http.Header)}
+	r.ServeHTTP(recorder, subReq)
+
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	state.response.Status = recorder.status
+
+	if location := recorder.header.Get("Location"); location != "" {
+		state.response.Headers = map[string]string{"Location": r.Config.URL(location)}
+	}
+
+	if recorder.body.Len() > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(recorder.body.Bytes(), &decoded); err == nil {
+			state.decoded = decoded
+			state.response.Body = decoded
+		} else {
+			state.response.Body = recorder.body.String()
+		}
+	}
+}
+
+type batchItemContextKey struct{}
+
+// withBatchItem marks a subrequest as part of a batch so ServeHTTP reuses the
+// parent's session and CSRF state instead of saving them into the item's
+// recorded response, where the cookies would be lost.
+func withBatchItem(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchItemContextKey{}, true)
+}
+
+func isBatchItem(ctx context.Context) bool {
+	item, _ := ctx.Value(batchItemContextKey{}).(bool)
+	return item
+}
+
+func substituteBatchRefs(item BatchRequestItem, states []*batchItemState) (string, []byte, error) {
+	var resolveErr error
+
+	path := batchRefRegex.ReplaceAllStringFunc(item.Path, func(match string) string {
+		value, err := lookupBatchRef(match, states)
+		if err != nil {
+			resolveErr = err
+			return match
+		}
+		return url.PathEscape(fmt.Sprint(value))
+	})
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+
+	if len(item.Body) == 0 {
+		return path, nil, nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(item.Body, &body); err != nil {
+		return "", nil, fmt.Errorf("invalid item body: %w", err)
+	}
+
+	body, resolveErr = substituteBatchValue(body, states)
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return path, encoded, nil
+}
+
+func substituteBatchValue(value interface{}, states []*batchItemState) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			resolved, err := substituteBatchValue(child, states)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []interface{}:
+		for i, child := range v {
+			resolved, err := substituteBatchValue(child, states)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	case string:
+		// A value that is only a reference keeps the referenced JSON type.
+		if match := batchRefRegex.FindString(v); match != "" && match == strings.TrimSpace(v) {
+			return lookupBatchRef(match, states)
+		}
+
+		var resolveErr error
+		replaced := batchRefRegex.ReplaceAllStringFunc(v, func(match string) string {
+			resolved, err := lookupBatchRef(match, states)
+			if err != nil {
+				resolveErr = err
+				return match
+			}
+			return fmt.Sprint(resolved)
+		})
+		return replaced, resolveErr
+	default:
+		return v, nil
+	}
+}
+
+func lookupBatchRef(match string, states []*batchItemState) (interface{}, error) {
+	parts := batchRefRegex.FindStringSubmatch(match)
+
+	index := -1
+	for i, state := range states {
+		if state.item.ID != "" && state.item.ID == parts[1] {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		parsed, err := strconv.Atoi(parts[1])
+		if err != nil || parsed < 0 || parsed >= len(states) {
+			return nil, fmt.Errorf("unknown reference %q", parts[1])
+		}
+		index = parsed
+	}
+
+	current := states[index].decoded
+	for _, key := range strings.Split(strings.TrimPrefix(parts[2], "."), ".") {
+		if key == "" {
+			continue
+		}
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("reference %s not found", strings.Trim(match, "{} "))
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, fmt.Errorf("reference %s not found", strings.Trim(match, "{} "))
+			}
+			current = node[i]
+		default:
+			return nil, fmt.Errorf("reference %s not found", strings.Trim(match, "{} "))
+		}
+	}
+
+	return current, nil
+}
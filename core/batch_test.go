@@ -0,0 +1,297 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type batchItem struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    struct {
+		Success bool                   `json:"success"`
+		Data    map[string]interface{} `json:"data"`
+		Error   string                 `json:"error"`
+	} `json:"body"`
+}
+
+func batchConfig(maxItems int) goatest.Option {
+	return goatest.WithConfig(func(c *core.Config) {
+		c.BatchEnabled = true
+		c.BatchMaxItems = maxItems
+	})
+}
+
+// orderHandlers registers a tiny order API for batch items to call.
+func orderHandlers(app *core.GonAirApp) {
+	app.Router.RegisterAPIHandler("/api/orders", http.MethodPost, func(ctx *core.APIContext) {
+		var input struct {
+			Item string `json:"item"`
+		}
+		if err := ctx.ParseBody(&input); err != nil || input.Item == "" {
+			ctx.Error("item is required", http.StatusBadRequest)
+			return
+		}
+		ctx.Writer.Header().Set("Location", "/api/orders/17")
+		ctx.Success(map[string]interface{}{"id": 17, "item": input.Item}, http.StatusCreated)
+	})
+	app.Router.RegisterAPIHandler("/api/orders/[id]", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success(map[string]interface{}{"id": ctx.Params["id"]}, http.StatusOK)
+	})
+	app.Router.RegisterAPIHandler("/api/receipts", http.MethodPost, func(ctx *core.APIContext) {
+		var input map[string]interface{}
+		ctx.ParseBody(&input)
+		ctx.Success(input, http.StatusCreated)
+	})
+}
+
+func sendBatch(app *goatest.App, path, body string) []batchItem {
+	var items []batchItem
+	app.Post(path, "application/json", strings.NewReader(body)).AssertStatus(http.StatusOK).Data(&items)
+	return items
+}
+
+func TestBatchResolvesReferences(t *testing.T) {
+	app := newTestApp(t, batchConfig(20), goatest.WithAPIHandlers(orderHandlers))
+
+	items := sendBatch(app, "/api/_batch", `{"requests":[
+		{"id":"order","method":"POST","path":"/api/orders","body":{"item":"tea"}},
+		{"method":"GET","path":"/api/orders/{{order.data.id}}"},
+		{"method":"POST","path":"/api/receipts","body":{"order":"{{order.data.id}}","label":"order {{0.data.item}}"}}
+	]}`)
+
+	if len(items) != 3 {
+		t.Fatalf("got %d items", len(items))
+	}
+	if items[0].ID != "order" || items[0].Status != http.StatusCreated {
+		t.Errorf("first item = %+v", items[0])
+	}
+	if !strings.HasSuffix(items[0].Headers["Location"], "/api/orders/17") {
+		t.Errorf("Location = %q", items[0].Headers["Location"])
+	}
+	if items[1].Body.Data["id"] != "17" {
+		t.Errorf("path reference resolved to %v", items[1].Body.Data["id"])
+	}
+	if items[2].Body.Data["order"] != float64(17) {
+		t.Errorf("a whole-value reference should keep its JSON type, got %#v", items[2].Body.Data["order"])
+	}
+	if items[2].Body.Data["label"] != "order tea" {
+		t.Errorf("label = %v", items[2].Body.Data["label"])
+	}
+}
+
+func TestBatchAcceptsABareArray(t *testing.T) {
+	app := newTestApp(t, batchConfig(20), goatest.WithAPIHandlers(orderHandlers))
+
+	items := sendBatch(app, "/api/_batch", `[{"path":"/api/orders/1"},{"path":"/api/orders/2"}]`)
+	if len(items) != 2 || items[0].Body.Data["id"] != "1" || items[1].Body.Data["id"] != "2" {
+		t.Errorf("items = %+v", items)
+	}
+}
+
+func TestBatchFailedDependency(t *testing.T) {
+	app := newTestApp(t, batchConfig(20), goatest.WithAPIHandlers(orderHandlers))
+
+	items := sendBatch(app, "/api/_batch", `[
+		{"id":"order","method":"POST","path":"/api/orders","body":{}},
+		{"path":"/api/orders/{{order.data.id}}"},
+		{"path":"/api/orders/9"}
+	]`)
+
+	if items[0].Status != http.StatusBadRequest {
+		t.Errorf("first status = %d", items[0].Status)
+	}
+	if items[1].Status != http.StatusFailedDependency {
+		t.Errorf("dependent status = %d, want 424", items[1].Status)
+	}
+	if items[2].Status != http.StatusOK {
+		t.Errorf("independent status = %d, want 200", items[2].Status)
+	}
+}
+
+func TestBatchRunsItemsInParallel(t *testing.T) {
+	var running, peak int32
+	app := newTestApp(t, batchConfig(20), withAPI("/api/slow", http.MethodGet, func(ctx *core.APIContext) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&peak)
+			if now <= seen || atomic.CompareAndSwapInt32(&peak, seen, now) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		ctx.Success(map[string]string{"slept": "50ms"}, http.StatusOK)
+	}))
+
+	body := `[{"path":"/api/slow"},{"path":"/api/slow"},{"path":"/api/slow"}]`
+	sendBatch(app, "/api/_batch", body)
+	if peak != 1 {
+		t.Errorf("sequential batch ran %d items at once", peak)
+	}
+
+	atomic.StoreInt32(&peak, 0)
+	sendBatch(app, "/api/_batch?parallel=true", body)
+	if peak < 2 {
+		t.Errorf("parallel batch never overlapped items, peak = %d", peak)
+	}
+}
+
+func TestBatchRejectsInvalidRequests(t *testing.T) {
+	app := newTestApp(t, batchConfig(2), goatest.WithAPIHandlers(orderHandlers))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"empty", `[]`, http.StatusBadRequest, "no items"},
+		{"too many", `[{"path":"/api/orders/1"},{"path":"/api/orders/2"},{"path":"/api/orders/3"}]`, http.StatusRequestEntityTooLarge, "limit of 2"},
+		{"nested", `[{"method":"POST","path":"/api/_batch"}]`, http.StatusBadRequest, "nested batch"},
+		{"page path", `[{"path":"/about"}]`, http.StatusBadRequest, "must start with /api/"},
+		{"forward reference", `[{"path":"/api/orders/{{1.data.id}}"},{"path":"/api/orders/2"}]`, http.StatusBadRequest, "earlier item"},
+		{"duplicate id", `[{"id":"a","path":"/api/orders/1"},{"id":"a","path":"/api/orders/2"}]`, http.StatusBadRequest, "duplicate id"},
+		{"malformed", `{"requests":`, http.StatusBadRequest, "Invalid batch request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := app.Post("/api/_batch", "application/json", strings.NewReader(tt.body)).
+				AssertStatus(tt.status).Data(nil)
+			if !strings.Contains(data.Error, tt.want) {
+				t.Errorf("error = %q, want it to contain %q", data.Error, tt.want)
+			}
+		})
+	}
+
+	app.Get("/api/_batch").AssertStatus(http.StatusMethodNotAllowed).AssertHeader("Allow", http.MethodPost)
+}
+
+func TestBatchDisabledByDefault(t *testing.T) {
+	app := newTestApp(t)
+	app.PostJSON("/api/_batch", []interface{}{}).AssertStatus(http.StatusNotFound)
+}
+
+func TestBatchItemsShareTheSession(t *testing.T) {
+	app := newTestApp(t, batchConfig(20), goatest.WithConfig(func(c *core.Config) {
+		c.SessionEnabled = true
+		c.SessionKeys = []string{"batch-test-session-key-0123456789"}
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/cart", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Session().Set("cart", "tea")
+			ctx.Success("added", http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/cart", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success(ctx.Session().GetString("cart"), http.StatusOK)
+		})
+	}))
+
+	res := app.Post("/api/_batch", "application/json", strings.NewReader(`[
+		{"method":"POST","path":"/api/cart"},
+		{"method":"GET","path":"/api/cart"}
+	]`)).AssertStatus(http.StatusOK)
+
+	var items []struct {
+		Headers map[string]string `json:"headers"`
+		Body    core.ResponseData `json:"body"`
+	}
+	res.Data(&items)
+	if items[1].Body.Data != "tea" {
+		t.Errorf("second item saw cart %v, want the first item's write", items[1].Body.Data)
+	}
+
+	cookies := (&http.Response{Header: res.Header}).Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("batch response set %d cookies, want the session cookie once", len(cookies))
+	}
+
+	var cart string
+	app.Request(http.MethodGet, "/api/cart", nil, "Cookie", cookies[0].Name+"="+cookies[0].Value).Data(&cart)
+	if cart != "tea" {
+		t.Errorf("a later request saw cart %q, want the batch's write to persist", cart)
+	}
+}
+
+func TestBatchItemsCannotOverrideForwardingHeaders(t *testing.T) {
+	app := newTestApp(t, batchConfig(20), goatest.WithConfig(func(c *core.Config) {
+		c.TrustedProxies = []string{"10.0.0.0/8"}
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		trusted, _ := core.ParseTrustedProxies(app.Config.TrustedProxies)
+		app.Router.RegisterAPIHandler("/api/whoami", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success(map[string]interface{}{
+				"ip":    core.ClientIP(ctx.Request, trusted),
+				"trace": ctx.Request.Header.Get("X-Trace"),
+			}, http.StatusOK)
+		})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/_batch", strings.NewReader(`[
+		{"method":"GET","path":"/api/whoami","headers":{"X-Forwarded-For":"198.51.100.7","X-Trace":"a"}},
+		{"method":"GET","path":"/api/whoami","headers":{"x-real-ip":"198.51.100.8","forwarded":"for=198.51.100.9"}}
+	]`))
+	req.RemoteAddr = "10.0.0.2:1000"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "203.0.113.5")
+
+	var items []batchItem
+	app.Do(req).AssertStatus(http.StatusOK).Data(&items)
+
+	if len(items) != 2 {
+		t.Fatalf("got %d items", len(items))
+	}
+	for i, item := range items {
+		if item.Body.Data["ip"] != "203.0.113.5" {
+			t.Errorf("item %d saw client %v, want the parent's forwarded address", i, item.Body.Data["ip"])
+		}
+	}
+	if items[0].Body.Data["trace"] != "a" {
+		t.Errorf("ordinary item header X-Trace = %v, want it passed through", items[0].Body.Data["trace"])
+	}
+}
+
+func TestBatchItemsDoNotInheritTheIdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	app := newTestApp(t, batchConfig(20), withAPI("/api/payments", http.MethodPost, func(ctx *core.APIContext) {
+		var input map[string]interface{}
+		ctx.ParseBody(&input)
+		calls.Add(1)
+		ctx.Success(input, http.StatusCreated)
+	}, core.WithIdempotency(time.Hour)))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/_batch", strings.NewReader(`{"requests":[
+		{"method":"POST","path":"/api/payments","body":{"amount":5}},
+		{"method":"POST","path":"/api/payments","body":{"amount":6}},
+		{"method":"POST","path":"/api/payments","body":{"amount":7},"headers":{"Idempotency-Key":"item-key"}},
+		{"method":"POST","path":"/api/payments","body":{"amount":7},"headers":{"Idempotency-Key":"item-key"}, "id":"replay"}
+	]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "batch-key")
+
+	var items []batchItem
+	app.Do(req).AssertStatus(http.StatusOK).Data(&items)
+
+	if len(items) != 4 {
+		t.Fatalf("got %d items", len(items))
+	}
+	for i, item := range items {
+		if item.Status != http.StatusCreated {
+			t.Errorf("item %d status = %d, want 201", i, item.Status)
+		}
+	}
+	for i, amount := range []float64{5, 6, 7, 7} {
+		if items[i].Body.Data["amount"] != amount {
+			t.Errorf("item %d = %+v, want its own result", i, items[i])
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("handler ran %d times, want 3: the item's own key replays, the batch's key is not inherited", calls.Load())
+	}
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultMultipartMemory = 32 << 20
+
+// defaultMaxBodyBytes caps JSON bodies read by Bind when Config.MaxBodyBytes
+// is not set.
+const defaultMaxBodyBytes = 1 << 20
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+var bindSources = []string{"form", "query", "header", "path"}
+
+type BindError struct {
+	Field  string
+	Source string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func (e *BindError) Error() string {
+	var tooLarge *http.MaxBytesError
+	if errors.As(e.Err, &tooLarge) {
+		return fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)
+	}
+	if e.Source == "json" {
+		return fmt.Sprintf("invalid JSON body: %v", e.Err)
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("invalid %s body: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("invalid value %q for %s parameter %q: %v", e.Value, e.Source, e.Key, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Status is the status to answer a failed bind with: 413 when the body was
+// over the size limit, 400 otherwise.
+func (e *BindError) Status() int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(e.Err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Bind binds the request into dst like the package-level Bind, with the body
+// capped at Config.MaxBodyBytes.
+func (ctx *APIContext) Bind(dst interface{}) error {
+	var limit int64
+	if ctx.Config != nil {
+		limit = ctx.Config.MaxBodyBytes
+	}
+	return bind(ctx.Writer, ctx.Request, ctx.Params, dst, limit)
+}
+
+// Bind fills dst from the JSON or form body first, then query, header and path
+// values, so a path parameter always wins over a field of the same name in the body.
+// JSON bodies over 1 MiB fail with a BindError whose Status is 413.
+func Bind(r *http.Request, params map[string]string, dst interface{}) error {
+	return bind(nil, r, params, dst, defaultMaxBodyBytes)
+}
+
+func bind(w http.ResponseWriter, r *http.Request, params map[string]string, dst interface{}, maxBody int64) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind destination must be a non-nil pointer to a struct")
+	}
+
+	if err := bindBody(w, r, dst, maxBody); err != nil {
+		return err
+	}
+
+	for _, source := range bindSources {
+		lookup := bindLookup(r, params, source)
+		if lookup == nil {
+			continue
+		}
+		if err := bindStruct(r, rv.Elem(), source, lookup); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func bindBody(w http.ResponseWriter, r *http.Request, dst interface{}, maxBody int64) error {
+	if r.Body == nil || r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return nil
+	}
+
+	contentType := strings.ToLower(r.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		if maxBody <= 0 {
+			maxBody = defaultMaxBodyBytes
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		r.Body.Close()
+		if err != nil {
+			return &BindError{Source: "json", Err: err}
+		}
+		if len(body) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(body, dst); err != nil {
+			return &BindError{Source: "json", Err: err}
+		}
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		if err := r.ParseMultipartForm(defaultMultipartMemory); err != nil {
+			return &BindError{Source: "form", Err: err}
+		}
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if err := r.ParseForm(); err != nil {
+			return &BindError{Source: "form", Err: err}
+		}
+	}
+
+	return nil
+}
+
+func bindLookup(r *http.Request, params map[string]string, source string) func(string) ([]string, bool) {
+	switch source {
+	case "path":
+		if len(params) == 0 {
+			return nil
+		}
+		return func(key string) ([]string, bool) {
+			value, ok := params[key]
+			return []string{value}, ok
+		}
+	case "query":
+		query := r.URL.Query()
+		return func(key string) ([]string, bool) {
+			values, ok := query[key]
+			return values, ok
+		}
+	case "header":
+		return func(key string) ([]string, bool) {
+			values := r.Header.Values(key)
+			return values, len(values) > 0
+		}
+	case "form":
+		if r.PostForm == nil && r.MultipartForm == nil {
+			return nil
+		}
+		return func(key string) ([]string, bool) {
+			if r.MultipartForm != nil {
+				if values, ok := r.MultipartForm.Value[key]; ok {
+					return values, true
+				}
+			}
+			values, ok := r.PostForm[key]
+			return values, ok
+		}
+	}
+	return nil
+}
+
+func bindStruct(r *http.Request, v reflect.Value, source string, lookup func(string) ([]string, bool)) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldValue := v.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		key, hasTag := field.Tag.Lookup(source)
+		if key == "-" {
+			continue
+		}
+
+		if !hasTag {
+			if field.Anonymous && fieldValue.Kind() == reflect.Struct && field.Type != timeType {
+				if err := bindStruct(r, fieldValue, source, lookup); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if key == "" {
+			key = field.Name
+		}
+
+		if source == "form" && isFileField(field.Type) {
+			if r.MultipartForm == nil {
+				continue
+			}
+			files := r.MultipartForm.File[key]
+			if len(files) == 0 {
+				continue
+			}
+			if field.Type.Kind() == reflect.Slice {
+				fieldValue.Set(reflect.ValueOf(files))
+			} else {
+				fieldValue.Set(reflect.ValueOf(files[0]))
+			}
+			continue
+		}
+
+		values, ok := lookup(key)
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		if err := setFieldValues(fieldValue, values, field.Tag.Get("format")); err != nil {
+			return &BindError{
+				Field:  field.Name,
+				Source: source,
+				Key:    key,
+				Value:  strings.Join(values, ","),
+				Err:    err,
+			}
+		}
+	}
+
+	return nil
+}
+
+func isFileField(t reflect.Type) bool {
+	if t == fileHeaderType {
+		return true
+	}
+	return t.Kind() == reflect.Slice && t.Elem() == fileHeaderType
+}
+
+func setFieldValues(v reflect.Value, values []string, format string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		// Comma-separated values are accepted as well as repeated keys.
+		if len(values) == 1 && strings.Contains(values[0], ",") {
+			values = strings.Split(values[0], ",")
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, raw := range values {
+			if err := setFieldValue(slice.Index(i), strings.TrimSpace(raw), format); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	return setFieldValue(v, values[0], format)
+}
+
+func setFieldValue(v reflect.Value, raw string, format string) error {
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setFieldValue(ptr.Elem(), raw, format); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		if format == "" {
+			format = time.RFC3339
+		}
+		parsed, err := time.Parse(format, raw)
+		if err != nil {
+			return fmt.Errorf("expected time in format %q", format)
+		}
+		v.Set(reflect.ValueOf(parsed))
+		return nil
+	case durationType:
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return errors.New("expected a duration such as 1m30s")
+		}
+		v.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected a boolean")
+		}
+		v.SetBool(parsed)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer (%s)", v.Kind())
+		}
+		v.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an unsigned integer (%s)", v.Kind())
+		}
+		v.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		v.SetFloat(parsed)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		v.SetBytes([]byte(raw))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package core_test
+
+import (
+	"bytes"
+	"errors"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type orderInput struct {
+	ID       int           `path:"id"`
+	Page     int           `query:"page"`
+	Tags     []string      `query:"tag"`
+	Verbose  *bool         `query:"verbose"`
+	TraceID  string        `header:"X-Trace-Id"`
+	Note     string        `json:"note" form:"note"`
+	Quantity int           `json:"quantity" form:"quantity"`
+	Since    time.Time     `query:"since" format:"2006-01-02"`
+	Wait     time.Duration `query:"wait"`
+	Ignored  string        `query:"-"`
+}
+
+func bindEcho(ctx *core.APIContext) {
+	var input orderInput
+	if err := ctx.Bind(&input); err != nil {
+		var bindErr *core.BindError
+		if errors.As(err, &bindErr) {
+			ctx.Error(bindErr.Error(), bindErr.Status())
+			return
+		}
+		ctx.Error(err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx.Success(input, http.StatusOK)
+}
+
+func TestBindCombinesSources(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/orders/[id]", http.MethodPost, bindEcho))
+
+	res := app.Request(http.MethodPost,
+		"/api/orders/42?page=3&tag=a&tag=b&verbose=true&since=2024-05-01&wait=1m30s&Ignored=x",
+		strings.NewReader(`{"note":"fragile","quantity":2,"ID":7}`),
+		"Content-Type", "application/json", "X-Trace-Id", "abc123")
+
+	var got orderInput
+	res.AssertStatus(http.StatusOK).Data(&got)
+
+	if got.ID != 42 {
+		t.Errorf("ID = %d, want the path value 42", got.ID)
+	}
+	if got.Page != 3 || strings.Join(got.Tags, ",") != "a,b" {
+		t.Errorf("query values = %d %v", got.Page, got.Tags)
+	}
+	if got.Verbose == nil || !*got.Verbose {
+		t.Errorf("Verbose = %v, want pointer to true", got.Verbose)
+	}
+	if got.TraceID != "abc123" {
+		t.Errorf("TraceID = %q", got.TraceID)
+	}
+	if got.Note != "fragile" || got.Quantity != 2 {
+		t.Errorf("JSON body = %q %d", got.Note, got.Quantity)
+	}
+	if !got.Since.Equal(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Since = %v", got.Since)
+	}
+	if got.Wait != 90*time.Second {
+		t.Errorf("Wait = %v", got.Wait)
+	}
+	if got.Ignored != "" {
+		t.Errorf("field tagged \"-\" was bound: %q", got.Ignored)
+	}
+}
+
+func TestBindCommaSeparatedSlice(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/orders/[id]", http.MethodGet, bindEcho))
+
+	var got orderInput
+	app.Get("/api/orders/1?tag=x,%20y,z").AssertStatus(http.StatusOK).Data(&got)
+	if strings.Join(got.Tags, "|") != "x|y|z" {
+		t.Errorf("Tags = %q", got.Tags)
+	}
+}
+
+func TestBindFormBody(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/orders/[id]", http.MethodPost, bindEcho))
+
+	var got orderInput
+	app.PostForm("/api/orders/5", map[string]string{"note": "by form", "quantity": "4"}).
+		AssertStatus(http.StatusOK).Data(&got)
+	if got.Note != "by form" || got.Quantity != 4 || got.ID != 5 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestBindMultipartFile(t *testing.T) {
+	type upload struct {
+		Title string                `form:"title"`
+		File  *multipart.FileHeader `form:"file"`
+	}
+	app := newTestApp(t, withAPI("/api/uploads", http.MethodPost, func(ctx *core.APIContext) {
+		var input upload
+		if err := ctx.Bind(&input); err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
+		if input.File == nil {
+			ctx.Error("no file", http.StatusBadRequest)
+			return
+		}
+		ctx.Success(map[string]interface{}{"title": input.Title, "file": input.File.Filename, "size": input.File.Size}, http.StatusOK)
+	}))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("title", "report")
+	part, _ := writer.CreateFormFile("file", "report.txt")
+	part.Write([]byte("hello"))
+	writer.Close()
+
+	var got map[string]interface{}
+	app.Post("/api/uploads", writer.FormDataContentType(), &body).AssertStatus(http.StatusOK).Data(&got)
+	if got["title"] != "report" || got["file"] != "report.txt" || got["size"] != float64(5) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/orders/[id]", http.MethodPost, bindEcho))
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"path", "/api/orders/abc", "application/json", `{}`, `invalid value "abc" for path parameter "id"`},
+		{"query", "/api/orders/1?page=two", "application/json", `{}`, `query parameter "page"`},
+		{"time format", "/api/orders/1?since=05/01/2024", "application/json", `{}`, `expected time in format "2006-01-02"`},
+		{"json", "/api/orders/1", "application/json", `{"quantity":"lots"}`, "invalid JSON body"},
+		{"form value", "/api/orders/1", "application/x-www-form-urlencoded", "quantity=lots", `form parameter "quantity"`},
+		{"form body", "/api/orders/1", "application/x-www-form-urlencoded", "note=%zz", "invalid form body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := app.Post(tt.path, tt.contentType, strings.NewReader(tt.body)).
+				AssertStatus(http.StatusBadRequest).Data(nil)
+			if !strings.Contains(data.Error, tt.want) {
+				t.Errorf("error = %q, want it to contain %q", data.Error, tt.want)
+			}
+			if strings.Contains(data.Error, `""`) {
+				t.Errorf("error names an empty parameter: %q", data.Error)
+			}
+		})
+	}
+}
+
+func TestBindLimitsJSONBody(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.MaxBodyBytes = 64
+	}), withAPI("/api/orders/[id]", http.MethodPost, bindEcho))
+
+	small := `{"note":"fragile"}`
+	app.Post("/api/orders/1", "application/json", strings.NewReader(small)).AssertStatus(http.StatusOK)
+
+	large := `{"note":"` + strings.Repeat("x", 100) + `"}`
+	data := app.Post("/api/orders/1", "application/json", strings.NewReader(large)).
+		AssertStatus(http.StatusRequestEntityTooLarge).Data(nil)
+	if !strings.Contains(data.Error, "exceeds 64 bytes") {
+		t.Errorf("error = %q", data.Error)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"note":"`+strings.Repeat("x", 2<<20)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	var input orderInput
+	var bindErr *core.BindError
+	if err := core.Bind(req, nil, &input); !errors.As(err, &bindErr) || bindErr.Status() != http.StatusRequestEntityTooLarge {
+		t.Errorf("Bind of a 2 MiB body = %v, want a 413 BindError", err)
+	}
+}
+
+func TestBindRejectsNonStructDestination(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var notStruct map[string]string
+	if err := core.Bind(req, nil, &notStruct); err == nil {
+		t.Error("Bind into a map succeeded")
+	}
+	var input orderInput
+	if err := core.Bind(req, nil, input); err == nil {
+		t.Error("Bind into a non-pointer succeeded")
+	}
+}
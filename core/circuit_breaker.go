@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type CircuitBreakerSettings struct {
+	ErrorThreshold   float64
+	MinRequests      int
+	Window           time.Duration
+	OpenDuration     time.Duration
+	HalfOpenRequests int
+}
+
+type CircuitBreaker struct {
+	settings       CircuitBreakerSettings
+	state          CircuitState
+	requests       int
+	failures       int
+	windowStart    time.Time
+	openedAt       time.Time
+	halfOpenFlight int
+	mutex          sync.Mutex
+}
+
+func circuitBreakerSettingsFromConfig(config *Config) CircuitBreakerSettings {
+	settings := CircuitBreakerSettings{
+		ErrorThreshold:   config.CircuitErrorThreshold,
+		MinRequests:      config.CircuitMinRequests,
+		Window:           config.CircuitWindow,
+		OpenDuration:     config.CircuitOpenDuration,
+		HalfOpenRequests: 1,
+	}
+
+	if settings.ErrorThreshold <= 0 || settings.ErrorThreshold > 1 {
+		settings.ErrorThreshold = 0.5
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = 5
+	}
+	if settings.Window <= 0 {
+		settings.Window = time.Minute
+	}
+	if settings.OpenDuration <= 0 {
+		settings.OpenDuration = 30 * time.Second
+	}
+
+	return settings
+}
+
+func NewCircuitBreaker(settings CircuitBreakerSettings) *CircuitBreaker {
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{
+		settings:    settings,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+	}
+}
+
+func (er *ErrorRegistry) CircuitBreaker(path string, method string) *CircuitBreaker {
+	key := fmt.Sprintf("%s:%s", method, path)
+	if value, exists := er.breakers.Load(key); exists {
+		return value.(*CircuitBreaker)
+	}
+	value, _ := er.breakers.LoadOrStore(key, NewCircuitBreaker(er.breakerSettings))
+	return value.(*CircuitBreaker)
+}
+
+// pageBreakerMethod keys page breakers apart from the API breakers of the
+// same path.
+const pageBreakerMethod = "PAGE"
+
+// PageCircuitBreaker returns the breaker guarding a page route.
+func (er *ErrorRegistry) PageCircuitBreaker(routePath string) *CircuitBreaker {
+	return er.CircuitBreaker(routePath, pageBreakerMethod)
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.currentState(time.Now())
+}
+
+// currentState moves an open breaker to half-open once its cool-down has elapsed.
+func (cb *CircuitBreaker) currentState(now time.Time) CircuitState {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.settings.OpenDuration {
+		cb.state = CircuitHalfOpen
+		cb.halfOpenFlight = 0
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := time.Now()
+	switch cb.currentState(now) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if cb.halfOpenFlight >= cb.settings.HalfOpenRequests {
+			return false
+		}
+		cb.halfOpenFlight++
+		return true
+	default:
+		if now.Sub(cb.windowStart) > cb.settings.Window {
+			cb.requests = 0
+			cb.failures = 0
+			cb.windowStart = now
+		}
+		return true
+	}
+}
+
+func (cb *CircuitBreaker) RetryAfter() time.Duration {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != CircuitOpen {
+		return 0
+	}
+	remaining := cb.settings.OpenDuration - time.Since(cb.openedAt)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordSuccess reports whether the call closed a half-open breaker.
+func (cb *CircuitBreaker) RecordSuccess() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.reset(time.Now())
+		return true
+	}
+
+	cb.requests++
+	return false
+}
+
+// RecordFailure reports whether the call tripped the breaker open.
+func (cb *CircuitBreaker) RecordFailure() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := time.Now()
+	if cb.state == CircuitHalfOpen {
+		cb.trip(now)
+		return true
+	}
+
+	cb.requests++
+	cb.failures++
+
+	if cb.state == CircuitClosed && cb.requests >= cb.settings.MinRequests &&
+		float64(cb.failures)/float64(cb.requests) >= cb.settings.ErrorThreshold {
+		cb.trip(now)
+		return true
+	}
+
+	return false
+}
+
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.reset(time.Now())
+}
+
+func (cb *CircuitBreaker) trip(now time.Time) {
+	cb.state = CircuitOpen
+	cb.openedAt = now
+	cb.halfOpenFlight = 0
+}
+
+func (cb *CircuitBreaker) reset(now time.Time) {
+	cb.state = CircuitClosed
+	cb.requests = 0
+	cb.failures = 0
+	cb.halfOpenFlight = 0
+	cb.windowStart = now
+}
@@ -0,0 +1,185 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testBreakerSettings() core.CircuitBreakerSettings {
+	return core.CircuitBreakerSettings{
+		ErrorThreshold: 0.5,
+		MinRequests:    4,
+		Window:         time.Minute,
+		OpenDuration:   30 * time.Millisecond,
+	}
+}
+
+func TestCircuitBreakerTripsAtThreshold(t *testing.T) {
+	cb := core.NewCircuitBreaker(testBreakerSettings())
+
+	cb.RecordSuccess()
+	cb.RecordSuccess()
+	if cb.RecordFailure() {
+		t.Fatal("tripped before MinRequests")
+	}
+	if !cb.RecordFailure() {
+		t.Fatal("did not trip at a 50% error rate over MinRequests")
+	}
+	if cb.State() != core.CircuitOpen || cb.Allow() {
+		t.Fatalf("state = %v, want open and rejecting", cb.State())
+	}
+	if retry := cb.RetryAfter(); retry <= 0 || retry > 30*time.Millisecond {
+		t.Errorf("RetryAfter = %v", retry)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	cb := core.NewCircuitBreaker(testBreakerSettings())
+	for i := 0; i < 4; i++ {
+		cb.RecordFailure()
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if cb.State() != core.CircuitHalfOpen {
+		t.Fatalf("state = %v after the cool-down, want half-open", cb.State())
+	}
+	if !cb.Allow() {
+		t.Fatal("half-open breaker rejected its probe")
+	}
+	if cb.Allow() {
+		t.Fatal("half-open breaker let a second request through")
+	}
+
+	if !cb.RecordFailure() || cb.State() != core.CircuitOpen {
+		t.Fatal("a failed probe should reopen the breaker")
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	cb.Allow()
+	if !cb.RecordSuccess() || cb.State() != core.CircuitClosed {
+		t.Fatal("a successful probe should close the breaker")
+	}
+	if cb.RetryAfter() != 0 {
+		t.Error("closed breaker reports a RetryAfter")
+	}
+}
+
+func TestCircuitBreakerReset(t *testing.T) {
+	cb := core.NewCircuitBreaker(testBreakerSettings())
+	for i := 0; i < 4; i++ {
+		cb.RecordFailure()
+	}
+	cb.Reset()
+	if cb.State() != core.CircuitClosed || !cb.Allow() {
+		t.Error("Reset did not close the breaker")
+	}
+}
+
+func breakerConfig(c *core.Config) {
+	c.CircuitMinRequests = 2
+	c.CircuitErrorThreshold = 0.5
+	c.CircuitOpenDuration = 50 * time.Millisecond
+}
+
+func TestAPICircuitOpensAndRecovers(t *testing.T) {
+	var failing atomic.Bool
+	var calls atomic.Int32
+	failing.Store(true)
+
+	app := newTestApp(t,
+		withAPI("/api/flaky", http.MethodGet, func(ctx *core.APIContext) {
+			calls.Add(1)
+			if failing.Load() {
+				ctx.Error("backend down", http.StatusInternalServerError)
+				return
+			}
+			ctx.Success("ok", http.StatusOK)
+		}),
+		goatest.WithConfig(breakerConfig),
+	)
+
+	app.Get("/api/flaky").AssertStatus(http.StatusInternalServerError)
+	app.Get("/api/flaky").AssertStatus(http.StatusInternalServerError)
+
+	res := app.Get("/api/flaky").AssertStatus(http.StatusServiceUnavailable)
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("open circuit response has no Retry-After")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2: an open circuit must not call it", calls.Load())
+	}
+
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+
+	app.Get("/api/flaky").AssertStatus(http.StatusOK)
+	app.Get("/api/flaky").AssertStatus(http.StatusOK)
+	if state := app.App.Router.Errors.CircuitBreaker("/api/flaky", http.MethodGet).State(); state != core.CircuitClosed {
+		t.Errorf("state = %v after recovery, want closed", state)
+	}
+}
+
+func TestAPICircuitOpensOnPanics(t *testing.T) {
+	app := newTestApp(t,
+		withAPI("/api/panics", http.MethodGet, func(ctx *core.APIContext) {
+			panic("boom")
+		}),
+		goatest.WithConfig(breakerConfig),
+	)
+
+	app.Get("/api/panics").AssertStatus(http.StatusInternalServerError)
+	app.Get("/api/panics").AssertStatus(http.StatusInternalServerError)
+	res := app.Get("/api/panics").AssertStatus(http.StatusServiceUnavailable)
+	if res.Header.Get("Retry-After") == "" {
+		t.Error("open circuit response has no Retry-After")
+	}
+	if data := res.Data(nil); data.Error != "Service temporarily unavailable" {
+		t.Errorf("open circuit error = %q, want a generic message outside dev mode", data.Error)
+	}
+}
+
+func TestAPICircuitShowsPanicInDevMode(t *testing.T) {
+	app := newTestApp(t,
+		withAPI("/api/panics", http.MethodGet, func(ctx *core.APIContext) {
+			panic("boom")
+		}),
+		goatest.WithConfig(breakerConfig),
+		goatest.WithConfig(func(c *core.Config) {
+			c.DevMode = true
+		}),
+	)
+
+	app.Get("/api/panics").AssertStatus(http.StatusInternalServerError)
+	app.Get("/api/panics").AssertStatus(http.StatusInternalServerError)
+	data := app.Get("/api/panics").AssertStatus(http.StatusServiceUnavailable).Data(nil)
+	if data.Error != "boom" {
+		t.Errorf("open circuit error = %q, want the recorded panic in dev mode", data.Error)
+	}
+}
+
+func TestPageCircuitOpensAndRecovers(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(breakerConfig))
+
+	app.Get("/flaky/fail").AssertStatus(http.StatusInternalServerError)
+	app.Get("/flaky/fail").AssertStatus(http.StatusInternalServerError)
+
+	res := app.Get("/flaky/ok")
+	if res.Header.Get("Retry-After") == "" {
+		t.Errorf("open page circuit served status %d without Retry-After", res.StatusCode)
+	}
+	res.AssertNoSelector("p.mode")
+
+	time.Sleep(60 * time.Millisecond)
+	app.Get("/flaky/ok").AssertStatus(http.StatusOK).AssertText("p.mode", "ok")
+	if app.App.Router.Errors.HasPageError("/flaky/[mode]") {
+		t.Error("recovered page still has a registered error")
+	}
+
+	if app.App.Router.Errors.CircuitBreaker("/flaky/[mode]", http.MethodGet) == app.App.Router.Errors.PageCircuitBreaker("/flaky/[mode]") {
+		t.Error("page and API breakers for the same path are shared")
+	}
+}
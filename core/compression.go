@@ -0,0 +1,431 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// DefaultCompressibleTypes lists the media types compressed when
+// CompressionOptions.ContentTypes is empty. Entries ending in "/*" match a
+// whole family.
+var DefaultCompressibleTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/manifest+json",
+	"image/svg+xml",
+}
+
+type CompressionOptions struct {
+	// Level is a compress/flate level; 0 means flate.DefaultCompression.
+	Level int
+
+	// MinSize is the smallest body, in bytes, worth compressing. Responses
+	// that are flushed before reaching it are compressed regardless, since
+	// their final size is unknown.
+	MinSize int
+
+	ContentTypes []string
+}
+
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// CompressionMiddleware compresses responses with gzip or deflate, whichever
+// the client prefers in Accept-Encoding. Responses that already carry a
+// Content-Encoding, partial content and upgrade requests pass through.
+func CompressionMiddleware(options CompressionOptions) MiddlewareFunc {
+	if options.Level == 0 {
+		options.Level = flate.DefaultCompression
+	}
+	if len(options.ContentTypes) == 0 {
+		options.ContentTypes = DefaultCompressibleTypes
+	}
+
+	level := options.Level
+	pools := map[string]*sync.Pool{
+		encodingGzip: {New: func() interface{} {
+			w, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+			return w
+		}},
+		encodingDeflate: {New: func() interface{} {
+			w, err := flate.NewWriter(io.Discard, level)
+			if err != nil {
+				w, _ = flate.NewWriter(io.Discard, flate.DefaultCompression)
+			}
+			return w
+		}},
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{
+				ResponseWriter: w,
+				options:        &options,
+				pools:          pools,
+				encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+				status:         http.StatusOK,
+				head:           r.Method == http.MethodHead,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// honouring q-values and "*", and returns "" when neither is acceptable.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	wildcard := -1.0
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	options  *CompressionOptions
+	pools    map[string]*sync.Pool
+	encoding string
+	head     bool
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     compressor
+}
+
+func (w *compressResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	w.status = code
+	w.wroteHeader = true
+
+	if w.head || !bodyAllowedForStatus(code) {
+		w.decide(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.options.MinSize {
+			return len(b), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		w.decide(true)
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close writes out anything still buffered and finishes the compressed stream.
+func (w *compressResponseWriter) Close() error {
+	if !w.decided {
+		if !w.wroteHeader {
+			return nil
+		}
+		if err := w.decide(len(w.buf) >= w.options.MinSize); err != nil {
+			return err
+		}
+	}
+
+	if w.encoder == nil {
+		return nil
+	}
+
+	err := w.encoder.Close()
+	w.encoder.Reset(io.Discard)
+	w.pools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// decide settles whether the response is compressed, sends the headers and
+// writes out the buffered body. bigEnough reports whether the body passed
+// MinSize or is being streamed.
+func (w *compressResponseWriter) decide(bigEnough bool) error {
+	w.decided = true
+	h := w.Header()
+
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	eligible := bodyAllowedForStatus(w.status) &&
+		w.status != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		h.Get("Content-Range") == "" &&
+		w.compressibleType(h.Get("Content-Type"))
+
+	if eligible {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if eligible && bigEnough && w.encoding != "" && !w.head {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		w.encoder = w.pools[w.encoding].Get().(compressor)
+		w.encoder.Reset(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buffered := w.buf
+	w.buf = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buffered)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buffered)
+	return err
+}
+
+func (w *compressResponseWriter) compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range w.options.ContentTypes {
+		allowed = strings.ToLower(allowed)
+		if family, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, family+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func bodyAllowedForStatus(status int) bool {
+	switch {
+	case status >= 100 && status < 200:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+func addVary(h http.Header, field string) {
+	for _, value := range h.Values("Vary") {
+		for _, existing := range strings.Split(value, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+// negotiatedEncoding returns the encoding CompressionMiddleware agreed with
+// the client for w, or "" when w is not being compressed. Handlers holding
+// precompressed bodies use it to send them as they are.
+func negotiatedEncoding(w http.ResponseWriter) string {
+	for {
+		switch rw := w.(type) {
+		case *compressResponseWriter:
+			return rw.encoding
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
+
+// writePrecompressed sends a gzip body that was compressed ahead of time.
+func writePrecompressed(w http.ResponseWriter, gzipped []byte) {
+	h := w.Header()
+	h.Set("Content-Encoding", encodingGzip)
+	h.Set("Content-Length", strconv.Itoa(len(gzipped)))
+	addVary(h, "Accept-Encoding")
+	w.Write(gzipped)
+}
+
+// servePrecompressedFile serves name.gz from dir in place of name when both
+// exist, as written for SSG pages or by a build step. It reports whether it
+// handled the request.
+func servePrecompressedFile(w http.ResponseWriter, r *http.Request, dir string, name string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	name = path.Clean("/" + name)
+	fullPath := filepath.Join(dir, filepath.FromSlash(name))
+
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	file, err := os.Open(fullPath + ".gz")
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	gzInfo, err := file.Stat()
+	if err != nil || gzInfo.ModTime().Before(info.ModTime()) {
+		return false
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(fullPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Encoding", encodingGzip)
+	addVary(h, "Accept-Encoding")
+	http.ServeContent(w, r, name, gzInfo.ModTime(), file)
+	return true
+}
+
+func gzipBytes(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *Config) compressionOptions() CompressionOptions {
+	return CompressionOptions{
+		Level:        c.CompressionLevel,
+		MinSize:      c.CompressionMinSize,
+		ContentTypes: c.CompressionContentTypes,
+	}
+}
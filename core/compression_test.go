@@ -0,0 +1,292 @@
+package core_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var reader io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("body is not gzip: %v", err)
+		}
+		reader = zr
+	case "deflate":
+		reader = flate.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("decompress %s: %v", encoding, err)
+	}
+	return string(plain)
+}
+
+// compressed serves handler behind CompressionMiddleware with a 100 byte
+// threshold and returns the recorded response.
+func compressed(t *testing.T, handler http.HandlerFunc, method, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	core.CompressionMiddleware(core.CompressionOptions{MinSize: 100})(handler).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressionNegotiatesEncoding(t *testing.T) {
+	body := strings.Repeat("<p>compress me</p>", 20)
+	page := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, body)
+	}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"gzip, deflate, br", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"*", "gzip"},
+		{"*;q=0.2, gzip;q=0", "deflate"},
+		{"br, identity", ""},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		rec := compressed(t, page, http.MethodGet, tt.accept)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want %q", tt.accept, got, tt.want)
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q", tt.accept, rec.Header().Get("Vary"))
+		}
+		if got := decompress(t, tt.want, rec.Body.Bytes()); got != body {
+			t.Errorf("Accept-Encoding %q: body did not round trip", tt.accept)
+		}
+	}
+}
+
+func TestCompressionSkipsIneligibleResponses(t *testing.T) {
+	large := strings.Repeat("x", 500)
+
+	tests := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+		vary    bool
+	}{
+		{"below the threshold", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"ok":true}`)
+		}, true},
+		{"type not in the allowlist", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, large)
+		}, false},
+		{"already encoded", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "br")
+			io.WriteString(w, large)
+		}, false},
+		{"partial content", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Range", "bytes 0-499/1000")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, large)
+		}, false},
+		{"no content", http.MethodDelete, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}, false},
+		{"head request", http.MethodHead, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusOK)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		rec := compressed(t, tt.handler, tt.method, "gzip")
+		if got := rec.Header().Get("Content-Encoding"); got == "gzip" {
+			t.Errorf("%s: response was compressed", tt.name)
+		}
+		if hasVary := rec.Header().Get("Vary") != ""; hasVary != tt.vary {
+			t.Errorf("%s: Vary = %q, want it set %v", tt.name, rec.Header().Get("Vary"), tt.vary)
+		}
+	}
+}
+
+func TestCompressionAdjustsHeaders(t *testing.T) {
+	rec := compressed(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Cookie, accept-encoding")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", "500")
+		w.Header().Set("Accept-Ranges", "bytes")
+		io.WriteString(w, strings.Repeat("plain text ", 50))
+	}, http.MethodGet, "gzip")
+
+	h := rec.Header()
+	if h.Get("Content-Encoding") != "gzip" || !strings.HasPrefix(h.Get("Content-Type"), "text/plain") {
+		t.Fatalf("headers = %v, want a sniffed text type compressed", h)
+	}
+	if h.Get("ETag") != `W/"v1"` {
+		t.Errorf("ETag = %q, want it weakened", h.Get("ETag"))
+	}
+	if h.Get("Content-Length") != "" || h.Get("Accept-Ranges") != "" {
+		t.Errorf("Content-Length %q and Accept-Ranges %q survived compression", h.Get("Content-Length"), h.Get("Accept-Ranges"))
+	}
+	if len(h.Values("Vary")) != 1 {
+		t.Errorf("Vary = %v, want the existing Accept-Encoding kept once", h.Values("Vary"))
+	}
+}
+
+func TestCompressionStreamsFlushedChunks(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(core.CompressionMiddleware(core.CompressionOptions{MinSize: 1024})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: first\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			io.WriteString(w, "data: second\n\n")
+		})))
+	defer server.Close()
+	defer close(release)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want a flushed stream compressed below MinSize", res.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := make(chan string, 1)
+	go func() {
+		first, _ := bufio.NewReader(zr).ReadString('\n')
+		line <- first
+	}()
+	select {
+	case first := <-line:
+		if first != "data: first\n" {
+			t.Errorf("first line = %q", first)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("flushed chunk never reached the client")
+	}
+}
+
+func TestAppCompressesResponses(t *testing.T) {
+	items := make([]string, 200)
+	for i := range items {
+		items[i] = "item"
+	}
+	app := newTestApp(t, withAPI("/api/items", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success(items, http.StatusOK)
+	}))
+
+	res := app.Request(http.MethodGet, "/api/items", nil, "Accept-Encoding", "gzip").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Encoding", "gzip").
+		AssertHeader("Vary", "Accept-Encoding")
+	if !strings.Contains(decompress(t, "gzip", res.Body), `"item","item"`) {
+		t.Error("compressed body did not decode to the handler's JSON")
+	}
+
+	app.Get("/api/items").AssertHeader("Content-Encoding", "")
+
+	disabled := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.CompressionEnabled = false
+	}), withAPI("/api/items", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success(items, http.StatusOK)
+	}))
+	disabled.Request(http.MethodGet, "/api/items", nil, "Accept-Encoding", "gzip").AssertHeader("Content-Encoding", "")
+}
+
+func TestPrecompressedStaticFiles(t *testing.T) {
+	dir := t.TempDir()
+	css := strings.Repeat("body { margin: 0 }\n", 100)
+	os.WriteFile(filepath.Join(dir, "app.css"), []byte(css), 0644)
+	os.WriteFile(filepath.Join(dir, "app.css.gz"), []byte("precompressed"), 0644)
+	os.WriteFile(filepath.Join(dir, "old.css"), []byte(css), 0644)
+	os.WriteFile(filepath.Join(dir, "old.css.gz"), []byte("stale"), 0644)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "old.css.gz"), past, past)
+
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.StaticDir = dir
+	}))
+
+	res := app.Request(http.MethodGet, "/static/app.css", nil, "Accept-Encoding", "gzip").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Encoding", "gzip").
+		AssertHeader("Vary", "Accept-Encoding")
+	if res.String() != "precompressed" || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/css") {
+		t.Errorf("served %q as %s, want the .gz file as CSS", res.String(), res.Header.Get("Content-Type"))
+	}
+
+	if plain := app.Get("/static/app.css"); plain.String() != css {
+		t.Error("client without gzip did not get the original file")
+	}
+
+	stale := app.Request(http.MethodGet, "/static/old.css", nil, "Accept-Encoding", "gzip")
+	if decompress(t, stale.Header.Get("Content-Encoding"), stale.Body) != css {
+		t.Error("a .gz older than its source was served")
+	}
+}
+
+func TestPrecompressedSSGPages(t *testing.T) {
+	ssgDir := t.TempDir()
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SSGEnabled = true
+		c.SSGCacheEnabled = true
+		c.SSGDir = ssgDir
+	}))
+
+	if _, err := os.Stat(filepath.Join(ssgDir, "docs.html.gz")); err != nil {
+		t.Errorf("no precompressed copy written next to the SSG page: %v", err)
+	}
+
+	res := app.Request(http.MethodGet, "/docs", nil, "Accept-Encoding", "gzip").
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-SSG-Cached", "true").
+		AssertHeader("Content-Encoding", "gzip")
+	if !strings.Contains(decompress(t, "gzip", res.Body), `<p class="intro">Pre-rendered when the app starts.</p>`) {
+		t.Error("precompressed SSG page did not decode to the page")
+	}
+
+	app.Get("/docs").
+		AssertHeader("X-SSG-Cached", "true").
+		AssertHeader("Content-Encoding", "").
+		AssertText("p.intro", "Pre-rendered")
+}
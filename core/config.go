@@ -1,29 +1,34 @@
 package core
 
+import "time"
+
 type Config struct {
-	AppDir         string
-	StaticDir      string
-	Port           string
-	DevMode        bool
-	LiveReload     bool
-	DefaultCDNs    bool
-	TailwindCDN    string
-	JQueryCDN      string
-	AlpineJSCDN    string
-	PetiteVueCDN   string
-	LayoutPath     string
-	ComponentDir   string
-	AppName        string
-	Version        string
-	LogLevel       string
-	TemplateCache  bool
-	EnableCORS     bool
-	AllowedOrigins []string
-	RateLimit      int
-	IsBuiltSystem  bool
-
-	InMemoryJS     bool
-	JSLibraryCache map[string]string
+	AppDir          string
+	StaticDir       string
+	Port            string
+	BasePath        string
+	ShutdownTimeout time.Duration
+	DevMode         bool
+	LiveReload      bool
+	DefaultCDNs     bool
+	TailwindCDN     string
+	JQueryCDN       string
+	AlpineJSCDN     string
+	PetiteVueCDN    string
+	LayoutPath      string
+	ComponentDir    string
+	AppName         string
+	Version         string
+	LogLevel        string
+	LogFormat       string
+	TemplateCache   bool
+	EnableCORS      bool
+	AllowedOrigins  []string
+	RateLimit       int
+	TrustedProxies  []string
+	IsBuiltSystem   bool
+
+	InMemoryJS bool
 
 	DefaultRenderMode string
 	SSGDir            string
@@ -31,32 +36,150 @@ type Config struct {
 	SSGCacheEnabled   bool
 
 	DefaultMetaTags map[string]string
+
+	CircuitErrorThreshold float64
+	CircuitMinRequests    int
+	CircuitWindow         time.Duration
+	CircuitOpenDuration   time.Duration
+
+	// RequestTimeout bounds how long a page or API handler may run before its
+	// request context is cancelled and TimeoutStatus (503, or 504) is sent.
+	// Routes override it with WithTimeout or a timeout: directive; zero
+	// disables it.
+	RequestTimeout time.Duration
+	TimeoutStatus  int
+
+	// MaxBodyBytes caps the JSON bodies APIContext.Bind reads; larger ones
+	// fail with a BindError whose Status is 413.
+	MaxBodyBytes int64
+
+	BatchEnabled  bool
+	BatchMaxItems int
+
+	TLSEnabled      bool
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSRedirectHTTP bool
+	TLSRedirectPort string
+	TLSDevCertDir   string
+
+	HealthEnabled bool
+	HealthPath    string
+	ReadyPath     string
+
+	MetricsEnabled bool
+	MetricsPath    string
+
+	// SessionKeys sign and encrypt session cookies; list the newest first and
+	// keep old keys until their cookies have expired.
+	SessionEnabled     bool
+	SessionStore       string
+	SessionDir         string
+	SessionCookieName  string
+	SessionKeys        []string
+	SessionEncrypt     bool
+	SessionIdleTimeout time.Duration
+	SessionMaxAge      time.Duration
+	SessionSameSite    string
+
+	TracingEnabled    bool
+	TracingExporter   string
+	TracingSampleRate float64
+
+	// JWTSecret verifies HS256 tokens and falls back to GOA_JWT_SECRET.
+	// JWTKeyFile holds a JWKS document or PEM public keys and doubles as the
+	// fallback when JWTJWKSURL cannot be fetched. JWTCookieName, when set, is
+	// read when a request has no Authorization header.
+	JWTEnabled     bool
+	JWTAlgorithms  []string
+	JWTSecret      string
+	JWTKeyFile     string
+	JWTJWKSURL     string
+	JWTJWKSRefresh time.Duration
+	JWTIssuer      string
+	JWTAudience    []string
+	JWTLeeway      time.Duration
+	JWTCookieName  string
+
+	// AuthLoginPath is where visitors are sent when a page declares
+	// <!--auth:required--> or <!--roles:...--> and they are not signed in.
+	// When empty they get a 401 error page instead.
+	AuthLoginPath string
+
+	// CSRFExempt lists paths whose unsafe requests skip CSRF checks; a
+	// trailing "*" matches a prefix.
+	CSRFEnabled bool
+	CSRFExempt  []string
+
+	// AllowedOrigins may hold patterns such as "https://*.example.com".
+	// Credentials are never allowed for origins that only match "*".
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// CSPDirectives replace DefaultCSPDirectives when set. CSPReportPath
+	// receives violation reports; leave it empty to disable reporting.
+	CSPEnabled    bool
+	CSPDirectives map[string]string
+	CSPReportOnly bool
+	CSPReportPath string
+
+	// Security headers sent with every response; empty values omit a header.
+	// HSTS is only sent over TLS. SecurityHeaderRoutes override them per path,
+	// for example to let a page be framed.
+	SecurityHeadersEnabled    bool
+	HSTSMaxAge                time.Duration
+	HSTSIncludeSubdomains     bool
+	HSTSPreload               bool
+	FrameAncestors            string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+	SecurityHeaderRoutes      []SecurityHeadersRoute
+
+	CompressionEnabled      bool
+	CompressionLevel        int
+	CompressionMinSize      int
+	CompressionContentTypes []string
+
+	// ServerTiming adds Server-Timing headers outside dev mode, where they are
+	// always sent.
+	ServerTiming bool
 }
 
+// AppConfig holds the defaults that NewApp copies into each app.
 var AppConfig = Config{
-	AppDir:         "app",
-	StaticDir:      "static",
-	Port:           "3000",
-	DevMode:        true,
-	LiveReload:     true,
-	DefaultCDNs:    true,
-	TailwindCDN:    "https://cdn.tailwindcss.com",
-	JQueryCDN:      "https://code.jquery.com/jquery-3.7.1.min.js",
-	AlpineJSCDN:    "https://cdn.jsdelivr.net/npm/alpinejs@3.14.9/dist/cdn.min.js",
-	PetiteVueCDN:   "https://unpkg.com/petite-vue@0.2.2/dist/petite-vue.iife.js",
-	LayoutPath:     "app/layout.html",
-	ComponentDir:   "app/components",
-	AppName:        "Go on Airplanes",
-	Version:        "0.5.4",
-	LogLevel:       "info",
-	TemplateCache:  true,
-	EnableCORS:     false,
-	AllowedOrigins: []string{"*"},
-	RateLimit:      100,
-	IsBuiltSystem:  false,
-
-	InMemoryJS:     true,
-	JSLibraryCache: make(map[string]string),
+	AppDir:          "app",
+	StaticDir:       "static",
+	Port:            "3000",
+	BasePath:        "",
+	ShutdownTimeout: 15 * time.Second,
+	DevMode:         true,
+	LiveReload:      true,
+	DefaultCDNs:     true,
+	TailwindCDN:     "https://cdn.tailwindcss.com",
+	JQueryCDN:       "https://code.jquery.com/jquery-3.7.1.min.js",
+	AlpineJSCDN:     "https://cdn.jsdelivr.net/npm/alpinejs@3.14.9/dist/cdn.min.js",
+	PetiteVueCDN:    "https://unpkg.com/petite-vue@0.2.2/dist/petite-vue.iife.js",
+	LayoutPath:      "app/layout.html",
+	ComponentDir:    "app/components",
+	AppName:         "Go on Airplanes",
+	Version:         "0.5.4",
+	LogLevel:        "info",
+	LogFormat:       "",
+	TemplateCache:   true,
+	EnableCORS:      false,
+	AllowedOrigins:  []string{"*"},
+	RateLimit:       100,
+	TrustedProxies:  []string{},
+	IsBuiltSystem:   false,
+
+	InMemoryJS: true,
 
 	DefaultRenderMode: "ssr",
 	SSGDir:            ".goa/cache",
@@ -70,4 +193,118 @@ var AppConfig = Config{
 		"og:type":      "website",
 		"twitter:card": "summary",
 	},
+
+	CircuitErrorThreshold: 0.5,
+	CircuitMinRequests:    5,
+	CircuitWindow:         time.Minute,
+	CircuitOpenDuration:   30 * time.Second,
+
+	RequestTimeout: 10 * time.Second,
+	TimeoutStatus:  503,
+
+	MaxBodyBytes: 1 << 20,
+
+	BatchEnabled:  false,
+	BatchMaxItems: 20,
+
+	TLSEnabled:      false,
+	TLSMinVersion:   "1.2",
+	TLSRedirectHTTP: false,
+	TLSRedirectPort: "80",
+	TLSDevCertDir:   ".goa/certs",
+
+	HealthEnabled: true,
+	HealthPath:    "/healthz",
+	ReadyPath:     "/readyz",
+
+	MetricsEnabled: false,
+	MetricsPath:    "/metrics",
+
+	TracingEnabled:    false,
+	TracingExporter:   "stdout",
+	TracingSampleRate: 1.0,
+
+	SessionEnabled:     false,
+	SessionStore:       SessionStoreCookie,
+	SessionDir:         ".goa/sessions",
+	SessionCookieName:  "goa_session",
+	SessionKeys:        []string{},
+	SessionEncrypt:     true,
+	SessionIdleTimeout: 30 * time.Minute,
+	SessionMaxAge:      24 * time.Hour,
+	SessionSameSite:    "lax",
+
+	JWTEnabled:     false,
+	JWTAlgorithms:  []string{"HS256", "RS256", "ES256"},
+	JWTJWKSRefresh: time.Hour,
+	JWTAudience:    []string{},
+	JWTLeeway:      time.Minute,
+
+	AuthLoginPath: "",
+
+	CSRFEnabled: false,
+	CSRFExempt:  []string{},
+
+	CORSAllowedMethods:   []string{},
+	CORSAllowedHeaders:   []string{},
+	CORSExposedHeaders:   []string{},
+	CORSAllowCredentials: false,
+	CORSMaxAge:           10 * time.Minute,
+
+	CSPEnabled:    false,
+	CSPReportOnly: false,
+	CSPReportPath: "/_goa/csp-report",
+
+	SecurityHeadersEnabled:    true,
+	HSTSMaxAge:                DefaultSecurityHeaders.HSTSMaxAge,
+	HSTSIncludeSubdomains:     DefaultSecurityHeaders.HSTSIncludeSubdomains,
+	HSTSPreload:               DefaultSecurityHeaders.HSTSPreload,
+	FrameAncestors:            DefaultSecurityHeaders.FrameAncestors,
+	ReferrerPolicy:            DefaultSecurityHeaders.ReferrerPolicy,
+	PermissionsPolicy:         DefaultSecurityHeaders.PermissionsPolicy,
+	CrossOriginOpenerPolicy:   DefaultSecurityHeaders.CrossOriginOpenerPolicy,
+	CrossOriginEmbedderPolicy: DefaultSecurityHeaders.CrossOriginEmbedderPolicy,
+	CrossOriginResourcePolicy: DefaultSecurityHeaders.CrossOriginResourcePolicy,
+	SecurityHeaderRoutes:      []SecurityHeadersRoute{},
+
+	CompressionEnabled: true,
+	CompressionMinSize: 1024,
+
+	ServerTiming: false,
+}
+
+// DefaultConfig returns a copy of AppConfig that can be modified without
+// affecting other apps.
+func DefaultConfig() Config {
+	return AppConfig.clone()
+}
+
+func (c Config) clone() Config {
+	clone := c
+
+	clone.AllowedOrigins = append([]string(nil), c.AllowedOrigins...)
+	clone.TrustedProxies = append([]string(nil), c.TrustedProxies...)
+	clone.CORSAllowedMethods = append([]string(nil), c.CORSAllowedMethods...)
+	clone.CORSAllowedHeaders = append([]string(nil), c.CORSAllowedHeaders...)
+	clone.CORSExposedHeaders = append([]string(nil), c.CORSExposedHeaders...)
+	clone.SessionKeys = append([]string(nil), c.SessionKeys...)
+	clone.JWTAlgorithms = append([]string(nil), c.JWTAlgorithms...)
+	clone.JWTAudience = append([]string(nil), c.JWTAudience...)
+	clone.CSRFExempt = append([]string(nil), c.CSRFExempt...)
+	clone.SecurityHeaderRoutes = append([]SecurityHeadersRoute(nil), c.SecurityHeaderRoutes...)
+	clone.CompressionContentTypes = append([]string(nil), c.CompressionContentTypes...)
+
+	clone.DefaultMetaTags = make(map[string]string, len(c.DefaultMetaTags))
+	for k, v := range c.DefaultMetaTags {
+		clone.DefaultMetaTags[k] = v
+	}
+
+	if c.CSPDirectives != nil {
+		clone.CSPDirectives = make(map[string]string, len(c.CSPDirectives))
+		for k, v := range c.CSPDirectives {
+			clone.CSPDirectives[k] = v
+		}
+	}
+
+	return clone
 }
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCORSHeaders = []string{"Content-Type", "Authorization", CSRFHeader, IdempotencyKeyHeader, RequestIDHeader}
+)
+
+type CORSOptions struct {
+	// AllowedOrigins lists exact origins, "*" for any origin, or patterns with
+	// one "*" such as "https://*.example.com" that match any subdomain.
+	AllowedOrigins []string
+
+	// AllowedMethods and AllowedHeaders default to DefaultCORSMethods and
+	// DefaultCORSHeaders. AllowedHeaders may be "*" to accept any header.
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+
+	// AllowCredentials lets browsers send cookies and HTTP auth. It is never
+	// granted to origins that only match "*".
+	AllowCredentials bool
+
+	// MaxAge is how long browsers may cache a preflight response; zero omits
+	// Access-Control-Max-Age.
+	MaxAge time.Duration
+}
+
+// CORSPolicy answers preflight requests and adds CORS headers to responses
+// for allowed origins.
+type CORSPolicy struct {
+	options    CORSOptions
+	anyOrigin  bool
+	anyHeader  bool
+	methods    string
+	exposed    string
+	allowedSet map[string]bool
+}
+
+func NewCORSPolicy(options CORSOptions) *CORSPolicy {
+	if len(options.AllowedMethods) == 0 {
+		options.AllowedMethods = DefaultCORSMethods
+	}
+	if len(options.AllowedHeaders) == 0 {
+		options.AllowedHeaders = DefaultCORSHeaders
+	}
+
+	p := &CORSPolicy{
+		options:    options,
+		methods:    strings.Join(options.AllowedMethods, ", "),
+		exposed:    strings.Join(options.ExposedHeaders, ", "),
+		allowedSet: make(map[string]bool, len(options.AllowedHeaders)),
+	}
+	for _, origin := range options.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+	}
+	for _, header := range options.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.allowedSet[http.CanonicalHeaderKey(header)] = true
+	}
+	return p
+}
+
+// WithCORS gives an API route its own CORS policy in place of the app's.
+func WithCORS(options CORSOptions) APIOption {
+	policy := NewCORSPolicy(options)
+	return func(o *APIRouteOptions) {
+		o.CORS = policy
+	}
+}
+
+// CORSMiddleware applies a policy allowing allowedOrigins with the default
+// methods and headers and no credentials. The router applies Config's CORS
+// settings itself; use this for handlers served outside it.
+func CORSMiddleware(allowedOrigins []string) MiddlewareFunc {
+	return NewCORSPolicy(CORSOptions{AllowedOrigins: allowedOrigins}).Middleware()
+}
+
+func (p *CORSPolicy) Middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				p.servePreflight(w, r)
+				return
+			}
+			p.apply(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isPreflight reports whether r is a CORS preflight rather than a plain
+// OPTIONS request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin and
+// whether credentials may be allowed, or "" when origin is not allowed.
+func (p *CORSPolicy) allowOrigin(origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+	for _, allowed := range p.options.AllowedOrigins {
+		if allowed != "*" && matchOrigin(allowed, origin) {
+			return origin, p.options.AllowCredentials
+		}
+	}
+	if p.anyOrigin {
+		return "*", false
+	}
+	return "", false
+}
+
+// matchOrigin compares origin with an exact origin or a pattern holding a
+// single "*" that stands for one or more subdomain labels.
+func matchOrigin(pattern string, origin string) bool {
+	prefix, suffix, wildcard := strings.Cut(strings.ToLower(pattern), "*")
+	origin = strings.ToLower(origin)
+	if !wildcard {
+		return prefix == origin
+	}
+
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	labels := origin[len(prefix) : len(origin)-len(suffix)]
+	for _, c := range labels {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return !strings.HasPrefix(labels, ".") && !strings.HasSuffix(labels, ".") && !strings.Contains(labels, "..")
+}
+
+// apply adds CORS headers for a simple or actual request.
+func (p *CORSPolicy) apply(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	addVary(h, "Origin")
+
+	allowed, credentials := p.allowOrigin(r.Header.Get("Origin"))
+	if allowed == "" {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", allowed)
+	if credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+}
+
+// servePreflight answers a preflight with 204. Disallowed origins, methods or
+// headers get no CORS headers, so the browser blocks the actual request.
+func (p *CORSPolicy) servePreflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	addVary(h, "Origin")
+	addVary(h, "Access-Control-Request-Method")
+	addVary(h, "Access-Control-Request-Headers")
+
+	allowed, credentials := p.allowOrigin(r.Header.Get("Origin"))
+	if allowed != "" && p.allowsMethod(r.Header.Get("Access-Control-Request-Method")) {
+		if requested, ok := p.allowsHeaders(r.Header.Get("Access-Control-Request-Headers")); ok {
+			h.Set("Access-Control-Allow-Origin", allowed)
+			h.Set("Access-Control-Allow-Methods", p.methods)
+			if requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if p.options.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.options.MaxAge.Seconds())))
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *CORSPolicy) allowsMethod(method string) bool {
+	for _, allowed := range p.options.AllowedMethods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks the requested header list and returns the value for
+// Access-Control-Allow-Headers. The list is echoed back rather than sent as
+// "*", which browsers ignore for credentialed requests.
+func (p *CORSPolicy) allowsHeaders(requested string) (string, bool) {
+	var headers []string
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !p.anyHeader && !p.allowedSet[http.CanonicalHeaderKey(header)] {
+			return "", false
+		}
+		headers = append(headers, header)
+	}
+	return strings.Join(headers, ", "), true
+}
+
+// corsOptions returns the app-wide CORS policy settings.
+func (c *Config) corsOptions() CORSOptions {
+	return CORSOptions{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.CORSAllowedMethods,
+		AllowedHeaders:   c.CORSAllowedHeaders,
+		ExposedHeaders:   c.CORSExposedHeaders,
+		AllowCredentials: c.CORSAllowCredentials,
+		MaxAge:           c.CORSMaxAge,
+	}
+}
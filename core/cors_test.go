@@ -0,0 +1,222 @@
+package core_test
+
+import (
+	"bytes"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func corsApp(t *testing.T, configure func(*core.Config), opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	ok := func(ctx *core.APIContext) {
+		ctx.Success("ok", http.StatusOK)
+	}
+	opts = append([]goatest.Option{
+		goatest.WithConfig(func(c *core.Config) {
+			c.EnableCORS = true
+			c.AllowedOrigins = []string{"https://app.example.com", "https://*.example.org"}
+			if configure != nil {
+				configure(c)
+			}
+		}),
+		goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+			app.Router.RegisterAPIHandler("/api/orders", http.MethodGet, ok)
+			app.Router.RegisterAPIHandler("/api/orders", http.MethodPost, ok)
+			app.Router.RegisterAPIHandler("/api/public", http.MethodGet, ok, core.WithCORS(core.CORSOptions{
+				AllowedOrigins: []string{"*"},
+				ExposedHeaders: []string{"X-Total-Count"},
+			}))
+		}),
+	}, opts...)
+	return newTestApp(t, opts...)
+}
+
+func preflight(app *goatest.App, path, origin, method, headers string) *goatest.Response {
+	pairs := []string{"Origin", origin, "Access-Control-Request-Method", method}
+	if headers != "" {
+		pairs = append(pairs, "Access-Control-Request-Headers", headers)
+	}
+	return app.Request(http.MethodOptions, path, nil, pairs...)
+}
+
+func TestCORSPreflight(t *testing.T) {
+	app := corsApp(t, func(c *core.Config) {
+		c.CORSAllowedMethods = []string{http.MethodGet, http.MethodPost}
+		c.CORSMaxAge = 90 * time.Second
+	})
+
+	res := preflight(app, "/api/orders", "https://app.example.com", http.MethodPost, "content-type, x-request-id").
+		AssertStatus(http.StatusNoContent).
+		AssertHeader("Access-Control-Allow-Origin", "https://app.example.com").
+		AssertHeader("Access-Control-Allow-Methods", "GET, POST").
+		AssertHeader("Access-Control-Allow-Headers", "content-type, x-request-id").
+		AssertHeader("Access-Control-Max-Age", "90").
+		AssertHeader("Access-Control-Allow-Credentials", "")
+	if vary := res.Header.Values("Vary"); len(vary) != 3 {
+		t.Errorf("Vary = %v, want Origin and the two request headers", vary)
+	}
+
+	denied := []struct {
+		name, origin, method, headers string
+	}{
+		{"unknown origin", "https://evil.example.net", http.MethodPost, ""},
+		{"method not allowed", "https://app.example.com", http.MethodDelete, ""},
+		{"header not allowed", "https://app.example.com", http.MethodPost, "X-Secret"},
+	}
+	for _, tt := range denied {
+		res := preflight(app, "/api/orders", tt.origin, tt.method, tt.headers).AssertStatus(http.StatusNoContent)
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q", tt.name, got)
+		}
+		if got := res.Header.Get("Access-Control-Allow-Methods"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q", tt.name, got)
+		}
+	}
+
+	// A plain OPTIONS request is not a preflight and gets no CORS answer.
+	plain := app.Request(http.MethodOptions, "/api/orders", nil, "Origin", "https://app.example.com")
+	if plain.StatusCode == http.StatusNoContent || plain.Header.Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("plain OPTIONS answered as a preflight with %d", plain.StatusCode)
+	}
+}
+
+func TestCORSActualRequests(t *testing.T) {
+	app := corsApp(t, func(c *core.Config) {
+		c.CORSAllowCredentials = true
+		c.CORSExposedHeaders = []string{core.RequestIDHeader}
+	})
+
+	app.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://app.example.com").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Access-Control-Allow-Origin", "https://app.example.com").
+		AssertHeader("Access-Control-Allow-Credentials", "true").
+		AssertHeader("Access-Control-Expose-Headers", core.RequestIDHeader).
+		AssertHeader("Vary", "Origin")
+
+	app.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://evil.example.net").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Access-Control-Allow-Origin", "").
+		AssertHeader("Access-Control-Allow-Credentials", "").
+		AssertHeader("Vary", "Origin")
+
+	app.Get("/api/orders").AssertHeader("Access-Control-Allow-Origin", "").AssertHeader("Vary", "Origin")
+
+	// Pages get the app policy as well.
+	app.Request(http.MethodGet, "/", nil, "Origin", "https://app.example.com").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Access-Control-Allow-Origin", "https://app.example.com")
+}
+
+func TestCORSOriginPatterns(t *testing.T) {
+	app := corsApp(t, nil)
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://shop.example.org", true},
+		{"https://eu.shop.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://shop.example.org.evil.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		got := app.Request(http.MethodGet, "/api/orders", nil, "Origin", tt.origin).Header.Get("Access-Control-Allow-Origin")
+		if (got != "") != tt.allowed {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want allowed %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestCORSWildcardNeverAllowsCredentials(t *testing.T) {
+	app := corsApp(t, func(c *core.Config) {
+		c.AllowedOrigins = []string{"*", "https://app.example.com"}
+		c.CORSAllowCredentials = true
+	})
+
+	app.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://anyone.example.net").
+		AssertHeader("Access-Control-Allow-Origin", "*").
+		AssertHeader("Access-Control-Allow-Credentials", "")
+	preflight(app, "/api/orders", "https://anyone.example.net", http.MethodPost, "").
+		AssertHeader("Access-Control-Allow-Origin", "*").
+		AssertHeader("Access-Control-Allow-Credentials", "")
+
+	app.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://app.example.com").
+		AssertHeader("Access-Control-Allow-Origin", "https://app.example.com").
+		AssertHeader("Access-Control-Allow-Credentials", "true")
+
+	// The warning is logged while the router is built, before goatest can
+	// redirect the app's log output.
+	var out bytes.Buffer
+	config := core.DefaultConfig()
+	config.EnableCORS = true
+	config.AllowedOrigins = []string{"*"}
+	config.CORSAllowCredentials = true
+	core.NewRouter(&config, core.NewLogger(&out, core.LevelWarn, core.LogFormatJSON))
+	if findRecord(logRecords(t, &out), `CORS credentials are not allowed for origins matched only by "*"`) == nil {
+		t.Errorf("no warning about credentials with \"*\" in %s", out.String())
+	}
+}
+
+func TestCORSPerRoutePolicy(t *testing.T) {
+	app := corsApp(t, nil)
+
+	app.Request(http.MethodGet, "/api/public", nil, "Origin", "https://anyone.example.net").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Access-Control-Allow-Origin", "*").
+		AssertHeader("Access-Control-Expose-Headers", "X-Total-Count")
+	preflight(app, "/api/public", "https://anyone.example.net", http.MethodGet, "").
+		AssertStatus(http.StatusNoContent).
+		AssertHeader("Access-Control-Allow-Origin", "*")
+
+	app.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://anyone.example.net").
+		AssertHeader("Access-Control-Allow-Origin", "")
+
+	// A route policy applies even when the app has CORS turned off.
+	off := corsApp(t, func(c *core.Config) {
+		c.EnableCORS = false
+	})
+	off.Request(http.MethodGet, "/api/public", nil, "Origin", "https://anyone.example.net").
+		AssertHeader("Access-Control-Allow-Origin", "*")
+	res := off.Request(http.MethodGet, "/api/orders", nil, "Origin", "https://app.example.com").
+		AssertHeader("Access-Control-Allow-Origin", "")
+	for _, vary := range res.Header.Values("Vary") {
+		if vary == "Origin" {
+			t.Error("Vary: Origin set with CORS off")
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	var called bool
+	handler := core.CORSMiddleware([]string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || called {
+		t.Errorf("preflight: status %d, handler called %v", rec.Code, called)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !called || rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("actual request: handler called %v, headers %v", called, rec.Header())
+	}
+}
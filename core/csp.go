@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	cspHeader           = "Content-Security-Policy"
+	cspReportOnlyHeader = "Content-Security-Policy-Report-Only"
+	cspReportGroup      = "csp-endpoint"
+)
+
+// cspNoncePlaceholder is what cspNonce renders and what injected scripts
+// carry. Like the CSRF placeholder it is swapped for the request's nonce when
+// the page is written, so cached pages get a fresh nonce, and it is random so
+// injected markup cannot name it to have a valid nonce filled in.
+var cspNoncePlaceholder = newPlaceholder("csp_nonce")
+
+// DefaultCSPDirectives allow same-origin resources only. script-src keeps
+// 'unsafe-eval' because Alpine and Petite-Vue compile their expressions at
+// runtime; drop it when using jQuery, vanilla JS or Alpine's CSP build.
+var DefaultCSPDirectives = map[string]string{
+	"default-src": "'self'",
+	"script-src":  "'self' 'unsafe-eval'",
+	"style-src":   "'self' 'unsafe-inline'",
+	"img-src":     "'self' data:",
+	"font-src":    "'self' data:",
+	"connect-src": "'self'",
+	"object-src":  "'none'",
+	"base-uri":    "'self'",
+	"form-action": "'self'",
+}
+
+type CSPOptions struct {
+	// Directives maps directive names to their sources. The request's nonce
+	// is added to script-src, or to default-src when script-src is absent.
+	// Defaults to DefaultCSPDirectives.
+	Directives map[string]string
+
+	// ReportOnly sends Content-Security-Policy-Report-Only, so violations are
+	// reported but not blocked.
+	ReportOnly bool
+
+	// ReportURL receives violation reports through report-uri and the
+	// Reporting API's report-to.
+	ReportURL string
+}
+
+// CSPPolicy builds the Content-Security-Policy header for each request
+// around a fresh nonce.
+type CSPPolicy struct {
+	headerName  string
+	beforeNonce string
+	afterNonce  string
+	reportURL   string
+}
+
+func NewCSPPolicy(options CSPOptions) *CSPPolicy {
+	directives := options.Directives
+	if len(directives) == 0 {
+		directives = DefaultCSPDirectives
+	}
+
+	nonceDirective := "script-src"
+	if _, ok := directives[nonceDirective]; !ok {
+		nonceDirective = "default-src"
+	}
+
+	names := make([]string, 0, len(directives))
+	for name := range directives {
+		if name != nonceDirective && name != "report-uri" && name != "report-to" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var before strings.Builder
+	before.WriteString(nonceDirective)
+	if sources := strings.TrimSpace(directives[nonceDirective]); sources != "" {
+		before.WriteString(" " + sources)
+	}
+	before.WriteString(" 'nonce-")
+
+	var after strings.Builder
+	after.WriteString("'")
+	for _, name := range names {
+		after.WriteString("; " + name)
+		if sources := strings.TrimSpace(directives[name]); sources != "" {
+			after.WriteString(" " + sources)
+		}
+	}
+	if options.ReportURL != "" {
+		after.WriteString("; report-uri " + options.ReportURL + "; report-to " + cspReportGroup)
+	}
+
+	headerName := cspHeader
+	if options.ReportOnly {
+		headerName = cspReportOnlyHeader
+	}
+
+	return &CSPPolicy{
+		headerName:  headerName,
+		beforeNonce: before.String(),
+		afterNonce:  after.String(),
+		reportURL:   options.ReportURL,
+	}
+}
+
+// cspOptions returns the app's CSP settings with the report endpoint made
+// absolute to the base path.
+func (c *Config) cspOptions() CSPOptions {
+	options := CSPOptions{
+		Directives: c.CSPDirectives,
+		ReportOnly: c.CSPReportOnly,
+	}
+	if c.CSPReportPath != "" {
+		options.ReportURL = c.URL(normalizePath(c.CSPReportPath))
+	}
+	return options
+}
+
+// start generates the request's nonce, sets the policy headers and returns
+// ctx carrying the nonce.
+func (p *CSPPolicy) start(ctx context.Context, w http.ResponseWriter) context.Context {
+	nonce := newCSPNonce()
+	w.Header().Set(p.headerName, p.beforeNonce+nonce+p.afterNonce)
+	if p.reportURL != "" {
+		w.Header().Set("Reporting-Endpoints", cspReportGroup+`="`+p.reportURL+`"`)
+	}
+	return withCSPNonce(ctx, nonce)
+}
+
+// CSPMiddleware sets a Content-Security-Policy with a per-request nonce for
+// handlers served outside the router, which applies Config's policy itself.
+func CSPMiddleware(options CSPOptions) MiddlewareFunc {
+	policy := NewCSPPolicy(options)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(policy.start(r.Context(), w)))
+		})
+	}
+}
+
+func newCSPNonce() string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic("csp: failed to generate nonce: " + err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+type cspNonceContextKey struct{}
+
+func withCSPNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, cspNonceContextKey{}, nonce)
+}
+
+// CSPNonce returns the request's script nonce, or "" when CSP is disabled.
+func CSPNonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceContextKey{}).(string)
+	return nonce
+}
+
+func (m *Marley) cspTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string {
+			if !m.Config.CSPEnabled {
+				return ""
+			}
+			return cspNoncePlaceholder
+		},
+	}
+}
+
+// scriptNonceAttribute returns the nonce attribute for scripts the framework
+// injects, or "" when CSP is disabled.
+func (m *Marley) scriptNonceAttribute() string {
+	if !m.Config.CSPEnabled {
+		return ""
+	}
+	return ` nonce="` + cspNoncePlaceholder + `"`
+}
+
+func fillCSPNonce(ctx context.Context, html string) string {
+	if !strings.Contains(html, cspNoncePlaceholder) {
+		return html
+	}
+	return strings.ReplaceAll(html, cspNoncePlaceholder, CSPNonce(ctx))
+}
+
+// fillPlaceholders swaps the request's CSRF token and CSP nonce into a
+// rendered page.
+func fillPlaceholders(ctx context.Context, w http.ResponseWriter, html string) string {
+	return fillCSPNonce(ctx, fillCSRFToken(ctx, w, html))
+}
+
+// stripPlaceholders blanks the placeholders in a page written to disk, where
+// they would be served as is and give the secret placeholder away.
+func stripPlaceholders(html string) string {
+	html = strings.ReplaceAll(html, csrfPlaceholder, "")
+	return strings.ReplaceAll(html, cspNoncePlaceholder, "")
+}
+
+func hasPlaceholders(html string) bool {
+	return strings.Contains(html, csrfPlaceholder) || strings.Contains(html, cspNoncePlaceholder)
+}
+
+// handleCSPReport logs violation reports sent by browsers, both the legacy
+// report-uri format and Reporting API batches.
+func (r *Router) handleCSPReport(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		RenderError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/csp-report", "application/reports+json", "application/json":
+	default:
+		RenderError(w, "Unsupported report type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, 64*1024))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var reports []map[string]interface{}
+	var legacy struct {
+		Report map[string]interface{} `json:"csp-report"`
+	}
+	if json.Unmarshal(body, &legacy) == nil && legacy.Report != nil {
+		reports = append(reports, legacy.Report)
+	} else {
+		var batch []struct {
+			Type string                 `json:"type"`
+			Body map[string]interface{} `json:"body"`
+		}
+		if json.Unmarshal(body, &batch) == nil {
+			for _, report := range batch {
+				if report.Type == "csp-violation" && report.Body != nil {
+					reports = append(reports, report.Body)
+				}
+			}
+		}
+	}
+
+	field := func(report map[string]interface{}, names ...string) string {
+		for _, name := range names {
+			if value, ok := report[name].(string); ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	for _, report := range reports {
+		r.Logger.Warn("CSP violation",
+			"document", field(report, "document-uri", "documentURL"),
+			"directive", field(report, "effective-directive", "effectiveDirective", "violated-directive"),
+			"blocked", field(report, "blocked-uri", "blockedURL"),
+			"disposition", field(report, "disposition"))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
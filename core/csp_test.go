@@ -0,0 +1,240 @@
+package core_test
+
+import (
+	"bytes"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func cspApp(t *testing.T, configure func(*core.Config), opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.CSPEnabled = true
+		if configure != nil {
+			configure(c)
+		}
+	})}, opts...)
+	return newTestApp(t, opts...)
+}
+
+// headerNonce returns the nonce from a policy's script source list.
+func headerNonce(t *testing.T, policy string) string {
+	t.Helper()
+
+	_, rest, ok := strings.Cut(policy, "'nonce-")
+	nonce, _, closed := strings.Cut(rest, "'")
+	if !ok || !closed || nonce == "" {
+		t.Fatalf("no nonce in policy %q", policy)
+	}
+	return nonce
+}
+
+// assertScriptsCarry checks that every script on the page has nonce.
+func assertScriptsCarry(t *testing.T, res *goatest.Response, nonce string) {
+	t.Helper()
+
+	scripts := res.Find("script")
+	if len(scripts) == 0 {
+		t.Fatalf("no scripts in %s", res.String())
+	}
+	for _, script := range scripts {
+		if got, _ := script.Attr("nonce"); got != nonce {
+			t.Errorf("script %s has nonce %q, want %q", script.HTML(), got, nonce)
+		}
+	}
+}
+
+// assertNoEnforcedNonce checks that only the security headers'
+// frame-ancestors policy is enforced.
+func assertNoEnforcedNonce(t *testing.T, res *goatest.Response) {
+	t.Helper()
+
+	for _, policy := range res.Header.Values("Content-Security-Policy") {
+		if strings.Contains(policy, "'nonce-") {
+			t.Errorf("enforced policy %q carries a nonce", policy)
+		}
+	}
+}
+
+func TestCSPNoncePerRequest(t *testing.T) {
+	app := cspApp(t, nil)
+
+	res := app.Get("/widgets").AssertStatus(http.StatusOK)
+	policy := res.Header.Get("Content-Security-Policy")
+	nonce := headerNonce(t, policy)
+	if !strings.HasPrefix(policy, "script-src 'self' 'unsafe-eval' 'nonce-"+nonce+"'; base-uri 'self'; ") {
+		t.Errorf("policy = %q, want the default directives with the nonce on script-src", policy)
+	}
+	if !strings.Contains(policy, "object-src 'none'") || !strings.Contains(policy, "report-uri /_goa/csp-report") {
+		t.Errorf("policy = %q, want object-src and the report endpoint", policy)
+	}
+	res.AssertHeader("Reporting-Endpoints", `csp-endpoint="/_goa/csp-report"`)
+
+	// The injected jQuery tag and the page's own script both carry it.
+	res.AssertCount("script", 2).AssertSelector("script#inline")
+	assertScriptsCarry(t, res, nonce)
+
+	next := app.Get("/widgets")
+	if again := headerNonce(t, next.Header.Get("Content-Security-Policy")); again == nonce {
+		t.Error("two requests shared a nonce")
+	}
+	headerNonce(t, app.Get("/api/missing").Header.Get("Content-Security-Policy"))
+}
+
+func TestCSPNonceOnCachedPages(t *testing.T) {
+	ssgDir := t.TempDir()
+	app := cspApp(t, func(c *core.Config) {
+		c.TemplateCache = true
+		c.SSGEnabled = true
+		c.SSGCacheEnabled = true
+		c.SSGDir = ssgDir
+	})
+
+	seen := map[string]bool{}
+	for _, path := range []string{"/widgets", "/widgets", "/docs", "/docs"} {
+		res := app.Get(path).AssertStatus(http.StatusOK)
+		nonce := headerNonce(t, res.Header.Get("Content-Security-Policy"))
+		if seen[nonce] {
+			t.Errorf("%s: nonce %q repeated from an earlier response", path, nonce)
+		}
+		seen[nonce] = true
+		assertScriptsCarry(t, res, nonce)
+	}
+
+	// The precompressed SSG copy holds the placeholder, so it is skipped.
+	res := app.Request(http.MethodGet, "/docs", nil, "Accept-Encoding", "gzip").AssertHeader("X-SSG-Cached", "true")
+	nonce := headerNonce(t, res.Header.Get("Content-Security-Policy"))
+	page := decompress(t, res.Header.Get("Content-Encoding"), res.Body)
+	if strings.Contains(page, "__goa_csp_nonce") || !strings.Contains(page, `nonce="`+nonce+`"`) {
+		t.Errorf("gzip client got a page without the request's nonce: %s", page)
+	}
+
+	// Files on disk may be served statically, so they must not reveal the
+	// placeholder.
+	written := 0
+	filepath.WalkDir(ssgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, _ := os.ReadFile(path)
+		if strings.HasSuffix(path, ".gz") {
+			content = []byte(decompress(t, "gzip", content))
+		}
+		if strings.Contains(string(content), "__goa_") {
+			t.Errorf("%s holds a placeholder", path)
+		}
+		written++
+		return nil
+	})
+	if written == 0 {
+		t.Error("no SSG files were written")
+	}
+}
+
+func TestCSPPlaceholderInPageDataIsNotFilled(t *testing.T) {
+	app := cspApp(t, nil)
+
+	// Injected markup naming the old fixed placeholder must not be handed the
+	// request's nonce.
+	const published = "__goa_csp_nonce_9b4d2a__"
+	res := app.Get("/flaky/" + published).AssertStatus(http.StatusOK)
+	headerNonce(t, res.Header.Get("Content-Security-Policy"))
+	if mode := res.First("p.mode"); mode == nil || mode.Text() != published {
+		t.Errorf("page data was rewritten: %s", res.String())
+	}
+}
+
+func TestCSPCustomDirectivesAndReportOnly(t *testing.T) {
+	app := cspApp(t, func(c *core.Config) {
+		c.CSPDirectives = map[string]string{
+			"default-src": "'self' https://cdn.example.com",
+			"img-src":     "*",
+			"report-uri":  "https://ignored.example.com",
+		}
+		c.CSPReportOnly = true
+		c.CSPReportPath = ""
+	})
+
+	res := app.Get("/widgets").AssertHeader("Reporting-Endpoints", "")
+	assertNoEnforcedNonce(t, res)
+	policy := res.Header.Get("Content-Security-Policy-Report-Only")
+	nonce := headerNonce(t, policy)
+	if want := "default-src 'self' https://cdn.example.com 'nonce-" + nonce + "'; img-src *"; policy != want {
+		t.Errorf("policy = %q, want %q", policy, want)
+	}
+	assertScriptsCarry(t, res, nonce)
+}
+
+func TestCSPReportEndpoint(t *testing.T) {
+	var out bytes.Buffer
+	app := cspApp(t, func(c *core.Config) {
+		c.LogLevel = "warn"
+	}, goatest.WithLogOutput(&out))
+
+	legacy := `{"csp-report":{"document-uri":"https://example.com/widgets","violated-directive":"script-src","blocked-uri":"inline"}}`
+	app.Request(http.MethodPost, "/_goa/csp-report", strings.NewReader(legacy), "Content-Type", "application/csp-report").
+		AssertStatus(http.StatusNoContent)
+	batch := `[{"type":"csp-violation","body":{"documentURL":"https://example.com/","effectiveDirective":"img-src","blockedURL":"https://evil.example.net/x.png","disposition":"report"}},{"type":"deprecation","body":{}}]`
+	app.Request(http.MethodPost, "/_goa/csp-report", strings.NewReader(batch), "Content-Type", "application/reports+json").
+		AssertStatus(http.StatusNoContent)
+
+	var violations []logRecord
+	for _, record := range logRecords(t, &out) {
+		if record["msg"] == "CSP violation" {
+			violations = append(violations, record)
+		}
+	}
+	if len(violations) != 2 {
+		t.Fatalf("logged %d violations, want 2: %s", len(violations), out.String())
+	}
+	if violations[0]["directive"] != "script-src" || violations[0]["blocked"] != "inline" {
+		t.Errorf("legacy report logged as %v", violations[0])
+	}
+	if violations[1]["directive"] != "img-src" || violations[1]["document"] != "https://example.com/" || violations[1]["disposition"] != "report" {
+		t.Errorf("Reporting API report logged as %v", violations[1])
+	}
+
+	app.Get("/_goa/csp-report").AssertStatus(http.StatusMethodNotAllowed).AssertHeader("Allow", http.MethodPost)
+	app.Request(http.MethodPost, "/_goa/csp-report", strings.NewReader(legacy), "Content-Type", "text/plain").
+		AssertStatus(http.StatusUnsupportedMediaType)
+}
+
+func TestCSPDisabled(t *testing.T) {
+	app := newTestApp(t)
+
+	res := app.Get("/widgets").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Security-Policy-Report-Only", "")
+	assertNoEnforcedNonce(t, res)
+	for _, script := range res.Find("script") {
+		if nonce, _ := script.Attr("nonce"); nonce != "" {
+			t.Errorf("script %s has nonce %q with CSP disabled", script.HTML(), nonce)
+		}
+	}
+	app.Request(http.MethodPost, "/_goa/csp-report", strings.NewReader("{}"), "Content-Type", "application/json").
+		AssertStatus(http.StatusNotFound)
+}
+
+func TestCSPMiddleware(t *testing.T) {
+	var nonce string
+	handler := core.CSPMiddleware(core.CSPOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = core.CSPNonce(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if nonce == "" || headerNonce(t, rec.Header().Get("Content-Security-Policy")) != nonce {
+		t.Errorf("handler saw nonce %q, policy %q", nonce, rec.Header().Get("Content-Security-Policy"))
+	}
+	if core.CSPNonce(httptest.NewRequest(http.MethodGet, "/", nil).Context()) != "" {
+		t.Error("nonce outside CSPMiddleware")
+	}
+}
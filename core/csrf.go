@@ -0,0 +1,271 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	CSRFHeader    = "X-CSRF-Token"
+	CSRFFormField = "csrf_token"
+
+	csrfSecretLength  = 32
+	csrfSessionKey    = "_csrf"
+	csrfCookieName    = "goa_csrf"
+	csrfSecureCookie  = "__Host-goa_csrf"
+	csrfRejectMessage = "CSRF token missing or invalid"
+)
+
+// csrfPlaceholder is what csrfField and csrfToken render. It is swapped for
+// the request's token when the page is written, so pages served from the
+// render and SSG caches still carry a fresh token. It is random per process:
+// page content that spelled out a known placeholder would otherwise have
+// every visitor's token filled in wherever it appears.
+var csrfPlaceholder = newPlaceholder("csrf_token")
+
+// newPlaceholder returns a marker for a per-request value that cannot be
+// guessed from the source or a served page.
+func newPlaceholder(name string) string {
+	b := make([]byte, 16)
+	randomID(b)
+	return "__goa_" + name + "_" + hex.EncodeToString(b) + "__"
+}
+
+// WithoutCSRF exempts an API route from CSRF checks, as for webhooks that
+// authenticate by signature instead of by cookie.
+func WithoutCSRF() APIOption {
+	return func(o *APIRouteOptions) {
+		o.SkipCSRF = true
+	}
+}
+
+// csrfState holds the request's CSRF secret. With sessions enabled the secret
+// lives in the session (synchronizer token); otherwise it is a double-submit
+// cookie that a handler cannot read from script.
+type csrfState struct {
+	request  *http.Request
+	secure   bool
+	sessions bool
+
+	mutex  sync.Mutex
+	secret []byte
+	isNew  bool
+	sealed bool
+}
+
+func (r *Router) newCSRFState(req *http.Request) *csrfState {
+	return &csrfState{
+		request:  req,
+		secure:   r.Config.TLSEnabled || !r.Config.DevMode,
+		sessions: r.Sessions != nil,
+	}
+}
+
+func (s *csrfState) cookieName() string {
+	if s.secure {
+		return csrfSecureCookie
+	}
+	return csrfCookieName
+}
+
+// storedSecret returns the secret the client already holds, or nil.
+func (s *csrfState) storedSecret() []byte {
+	var encoded string
+	if s.sessions {
+		encoded = SessionFromContext(s.request.Context()).GetString(csrfSessionKey)
+	} else if cookie, err := s.request.Cookie(s.cookieName()); err == nil {
+		encoded = cookie.Value
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != csrfSecretLength {
+		return nil
+	}
+	return secret
+}
+
+// token returns a masked token for the request, creating the secret if the
+// client has none yet. Masking with a fresh pad per call keeps the token
+// different on every response, which defeats compression side channels.
+func (s *csrfState) token() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.secret == nil {
+		s.secret = s.storedSecret()
+	}
+	if s.secret == nil && s.sealed {
+		return ""
+	}
+	if s.secret == nil {
+		s.secret = make([]byte, csrfSecretLength)
+		if _, err := rand.Read(s.secret); err != nil {
+			return ""
+		}
+		s.isNew = true
+		if s.sessions {
+			SessionFromContext(s.request.Context()).Set(csrfSessionKey, base64.RawURLEncoding.EncodeToString(s.secret))
+		}
+	}
+
+	pad := make([]byte, csrfSecretLength)
+	if _, err := rand.Read(pad); err != nil {
+		return ""
+	}
+	masked := make([]byte, 2*csrfSecretLength)
+	copy(masked, pad)
+	for i := range s.secret {
+		masked[csrfSecretLength+i] = pad[i] ^ s.secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// seal stops token from creating a secret once it can no longer be stored,
+// after the request timed out.
+func (s *csrfState) seal() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sealed = true
+}
+
+// commit sets the double-submit cookie when a new secret was handed out.
+func (s *csrfState) commit(w http.ResponseWriter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isNew || s.sessions {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    base64.RawURLEncoding.EncodeToString(s.secret),
+		Path:     "/",
+		Secure:   s.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// valid reports whether the request carries a token matching its secret, in
+// the X-CSRF-Token header or the csrf_token form field.
+func (s *csrfState) valid() bool {
+	secret := s.storedSecret()
+	if secret == nil {
+		return false
+	}
+
+	submitted := s.request.Header.Get(CSRFHeader)
+	if submitted == "" && isFormRequest(s.request) {
+		submitted = s.request.PostFormValue(CSRFFormField)
+	}
+
+	masked, err := base64.RawURLEncoding.DecodeString(submitted)
+	if err != nil || len(masked) != 2*csrfSecretLength {
+		return false
+	}
+
+	unmasked := make([]byte, csrfSecretLength)
+	for i := range unmasked {
+		unmasked[i] = masked[i] ^ masked[csrfSecretLength+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+func isFormRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// csrfExempt reports whether Config.CSRFExempt lists requestPath, either
+// exactly or through a pattern ending in "*".
+func (r *Router) csrfExempt(requestPath string) bool {
+	for _, pattern := range r.Config.CSRFExempt {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(requestPath, prefix) {
+				return true
+			}
+		} else if normalizePath(pattern) == requestPath {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCSRF reports whether req may proceed. Safe methods, exempt routes and
+// apps without CSRF protection always pass.
+func (r *Router) checkCSRF(req *http.Request, requestPath string, skip bool) bool {
+	state := csrfStateFromContext(req.Context())
+	if state == nil || skip || csrfSafeMethod(req.Method) || r.csrfExempt(requestPath) {
+		return true
+	}
+	return state.valid()
+}
+
+type csrfContextKey struct{}
+
+func withCSRF(ctx context.Context, state *csrfState) context.Context {
+	return context.WithValue(ctx, csrfContextKey{}, state)
+}
+
+func csrfStateFromContext(ctx context.Context) *csrfState {
+	state, _ := ctx.Value(csrfContextKey{}).(*csrfState)
+	return state
+}
+
+// CSRFToken returns a token for the request in ctx to send back in the
+// X-CSRF-Token header or csrf_token form field, or "" when CSRF protection is
+// disabled.
+func CSRFToken(ctx context.Context) string {
+	state := csrfStateFromContext(ctx)
+	if state == nil {
+		return ""
+	}
+	return state.token()
+}
+
+// csrfTemplateFuncs render placeholders that fillCSRFToken replaces.
+func csrfTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + CSRFFormField + `" value="` + csrfPlaceholder + `">`)
+		},
+		"csrfToken": func() string {
+			return csrfPlaceholder
+		},
+	}
+}
+
+// fillCSRFToken swaps the csrf placeholders in a rendered page for the
+// request's token. Pages carrying a token are marked uncacheable by shared
+// caches.
+func fillCSRFToken(ctx context.Context, w http.ResponseWriter, html string) string {
+	if !strings.Contains(html, csrfPlaceholder) {
+		return html
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	return strings.ReplaceAll(html, csrfPlaceholder, CSRFToken(ctx))
+}
@@ -0,0 +1,186 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func csrfApp(t *testing.T, configure func(*core.Config)) *goatest.App {
+	t.Helper()
+
+	ok := func(ctx *core.APIContext) {
+		ctx.Success("ok", http.StatusOK)
+	}
+	return newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.CSRFEnabled = true
+		if configure != nil {
+			configure(c)
+		}
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/orders", http.MethodPost, ok)
+		app.Router.RegisterAPIHandler("/api/orders", http.MethodGet, ok)
+		app.Router.RegisterAPIHandler("/api/hooks/stripe", http.MethodPost, ok, core.WithoutCSRF())
+		app.Router.RegisterAPIHandler("/api/hooks/github", http.MethodPost, ok)
+		app.Router.RegisterAPIHandler("/api/ingest", http.MethodPost, ok)
+		app.Router.RegisterAPIHandler("/api/token", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success(ctx.CSRFToken(), http.StatusOK)
+		})
+	}))
+}
+
+// csrfForm loads the contact page and returns its form token and the cookies
+// the client now holds.
+func csrfForm(t *testing.T, app *goatest.App) (string, string) {
+	t.Helper()
+
+	res := app.Get("/contact").AssertStatus(http.StatusOK)
+	field := res.First(`form input[type="hidden"][name="csrf_token"]`)
+	if field == nil {
+		t.Fatalf("no csrf field in %s", res.String())
+	}
+	token, _ := field.Attr("value")
+
+	var cookies []string
+	for _, cookie := range (&http.Response{Header: res.Header}).Cookies() {
+		cookies = append(cookies, cookie.Name+"="+cookie.Value)
+	}
+	return token, strings.Join(cookies, "; ")
+}
+
+func TestCSRFDoubleSubmitCookie(t *testing.T) {
+	app := csrfApp(t, nil)
+
+	res := app.Get("/contact").AssertStatus(http.StatusOK).AssertHeader("Cache-Control", "private, no-store")
+	meta, _ := res.First(`meta[name="csrf-token"]`).Attr("content")
+	field, _ := res.First(`input[name="csrf_token"]`).Attr("value")
+	if meta == "" || meta != field || strings.Contains(res.String(), "__goa_csrf") {
+		t.Fatalf("csrfToken %q and csrfField %q, want the same filled-in token", meta, field)
+	}
+	cookies := (&http.Response{Header: res.Header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "__Host-goa_csrf" || !cookies[0].Secure || !cookies[0].HttpOnly || cookies[0].Path != "/" {
+		t.Fatalf("cookies = %v, want one secure __Host- cookie", cookies)
+	}
+	if strings.Contains(meta, cookies[0].Value) {
+		t.Error("token exposes the secret unmasked")
+	}
+
+	token, cookie := csrfForm(t, app)
+	app.Request(http.MethodPost, "/api/orders", nil, "Cookie", cookie).
+		AssertStatus(http.StatusForbidden).
+		AssertContains("CSRF token missing or invalid")
+	app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, token).AssertStatus(http.StatusForbidden)
+	app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, token, "Cookie", cookie).AssertStatus(http.StatusOK)
+
+	otherToken, _ := csrfForm(t, app)
+	app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, otherToken, "Cookie", cookie).AssertStatus(http.StatusForbidden)
+
+	app.Get("/api/orders").AssertStatus(http.StatusOK)
+}
+
+func TestCSRFProtectsPageForms(t *testing.T) {
+	app := csrfApp(t, nil)
+	token, cookie := csrfForm(t, app)
+
+	post := func(form url.Values) *goatest.Response {
+		return app.Request(http.MethodPost, "/contact", strings.NewReader(form.Encode()),
+			"Content-Type", "application/x-www-form-urlencoded", "Cookie", cookie)
+	}
+	post(url.Values{"message": {"hi"}}).AssertStatus(http.StatusForbidden)
+	post(url.Values{"message": {"hi"}, core.CSRFFormField: {token}}).AssertStatus(http.StatusOK)
+}
+
+func TestCSRFTokensChangePerResponse(t *testing.T) {
+	app := csrfApp(t, func(c *core.Config) {
+		c.TemplateCache = true
+	})
+
+	token, cookie := csrfForm(t, app)
+	res := app.Request(http.MethodGet, "/contact", nil, "Cookie", cookie)
+	again, _ := res.First(`input[name="csrf_token"]`).Attr("value")
+	if again == token {
+		t.Error("the cached page repeated the same token")
+	}
+	if len(res.Header.Values("Set-Cookie")) != 0 {
+		t.Error("a client with a secret was given a new one")
+	}
+	for _, submitted := range []string{token, again} {
+		app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, submitted, "Cookie", cookie).AssertStatus(http.StatusOK)
+	}
+}
+
+func TestCSRFSynchronizerTokenInSession(t *testing.T) {
+	app := csrfApp(t, func(c *core.Config) {
+		c.SessionEnabled = true
+		c.SessionKeys = []string{sessionKey}
+	})
+
+	var token string
+	res := app.Get("/api/token")
+	res.Data(&token)
+	cookies := (&http.Response{Header: res.Header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "goa_session" {
+		t.Fatalf("cookies = %v, want the secret kept in the session", cookies)
+	}
+	session := "goa_session=" + cookies[0].Value
+
+	app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, token, "Cookie", session).AssertStatus(http.StatusOK)
+	app.Request(http.MethodPost, "/api/orders", nil, core.CSRFHeader, token).AssertStatus(http.StatusForbidden)
+}
+
+func TestCSRFExemptions(t *testing.T) {
+	app := csrfApp(t, func(c *core.Config) {
+		c.CSRFExempt = []string{"/api/hooks/*", "/api/ingest/"}
+	})
+
+	app.PostJSON("/api/hooks/stripe", nil).AssertStatus(http.StatusOK)
+	app.PostJSON("/api/hooks/github", nil).AssertStatus(http.StatusOK)
+	app.PostJSON("/api/ingest", nil).AssertStatus(http.StatusOK)
+	app.PostJSON("/api/orders", nil).AssertStatus(http.StatusForbidden)
+
+	strict := csrfApp(t, nil)
+	strict.PostJSON("/api/hooks/stripe", nil).AssertStatus(http.StatusOK)
+	strict.PostJSON("/api/hooks/github", nil).AssertStatus(http.StatusForbidden)
+}
+
+func TestCSRFDevModeCookie(t *testing.T) {
+	app := csrfApp(t, func(c *core.Config) {
+		c.DevMode = true
+	})
+
+	cookies := (&http.Response{Header: app.Get("/contact").Header}).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "goa_csrf" || cookies[0].Secure {
+		t.Errorf("cookies = %v, want a plain goa_csrf cookie over HTTP", cookies)
+	}
+}
+
+func TestCSRFPlaceholderInPageDataIsNotFilled(t *testing.T) {
+	app := csrfApp(t, nil)
+
+	// The placeholder used to be a fixed string; page content carrying it must
+	// not have the visitor's token filled in.
+	const published = "__goa_csrf_token_c2e7f1__"
+	res := app.Get("/flaky/" + published).AssertStatus(http.StatusOK)
+	if mode := res.First("p.mode"); mode == nil || mode.Text() != published {
+		t.Errorf("page data was rewritten: %s", res.String())
+	}
+}
+
+func TestCSRFDisabled(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/token", http.MethodPost, func(ctx *core.APIContext) {
+		ctx.Success(ctx.CSRFToken(), http.StatusOK)
+	}))
+
+	var token string
+	app.PostJSON("/api/token", nil).AssertStatus(http.StatusOK).Data(&token)
+	if token != "" {
+		t.Errorf("token = %q with CSRF disabled", token)
+	}
+	field, _ := app.Get("/contact").First(`input[name="csrf_token"]`).Attr("value")
+	if field != "" {
+		t.Errorf("csrfField = %q with CSRF disabled", field)
+	}
+}
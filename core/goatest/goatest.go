@@ -0,0 +1,200 @@
+// Package goatest boots a Go on Airplanes app in-process for tests, without
+// binding a port. Each harness owns its app, so tests may run in parallel.
+package goatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"goonairplanes/core"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type Option func(*options)
+
+type options struct {
+	configure     []func(*core.Config)
+	register      []func(*core.GonAirApp)
+	emptyRegistry bool
+	logOutput     io.Writer
+}
+
+type App struct {
+	T       testing.TB
+	App     *core.GonAirApp
+	Handler http.Handler
+
+	headers http.Header
+}
+
+func WithConfig(configure func(*core.Config)) Option {
+	return func(o *options) {
+		o.configure = append(o.configure, configure)
+	}
+}
+
+// WithAPIHandlers registers handlers on the harness app only, on top of (or,
+// with WithEmptyAPIRegistry, instead of) those registered from init().
+func WithAPIHandlers(register func(app *core.GonAirApp)) Option {
+	return func(o *options) {
+		o.register = append(o.register, register)
+	}
+}
+
+func WithEmptyAPIRegistry() Option {
+	return func(o *options) {
+		o.emptyRegistry = true
+	}
+}
+
+func WithLogOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.logOutput = w
+	}
+}
+
+func New(t testing.TB, appDir string, opts ...Option) *App {
+	t.Helper()
+
+	o := &options{logOutput: io.Discard}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	absAppDir, err := filepath.Abs(appDir)
+	if err != nil {
+		t.Fatalf("goatest: resolve app dir %s: %v", appDir, err)
+	}
+	if _, err := os.Stat(absAppDir); err != nil {
+		t.Fatalf("goatest: app dir %s: %v", appDir, err)
+	}
+
+	config := core.DefaultConfig()
+	config.AppDir = absAppDir
+	config.LayoutPath = filepath.Join(absAppDir, "layout.html")
+	config.ComponentDir = filepath.Join(absAppDir, "components")
+	config.StaticDir = filepath.Join(filepath.Dir(absAppDir), "static")
+	config.DevMode = false
+	config.LiveReload = false
+	config.IsBuiltSystem = true
+	config.InMemoryJS = false
+	config.TemplateCache = false
+	config.SSGEnabled = false
+	config.SSGCacheEnabled = false
+	config.LogLevel = "error"
+
+	for _, configure := range o.configure {
+		configure(&config)
+	}
+
+	app := core.NewAppWithConfig(config)
+	if o.emptyRegistry {
+		app.Router.API.Clear()
+	}
+	for _, register := range o.register {
+		register(app)
+	}
+
+	app.Logger.SetOutput(o.logOutput)
+
+	t.Cleanup(func() {
+		app.Shutdown(context.Background())
+	})
+
+	if err := app.Init(); err != nil {
+		t.Fatalf("goatest: initialize app: %v", err)
+	}
+
+	return &App{
+		T:       t,
+		App:     app,
+		Handler: app.Handler(),
+		headers: make(http.Header),
+	}
+}
+
+// SetHeader adds a header to every request issued through the harness.
+func (a *App) SetHeader(key, value string) {
+	a.headers.Set(key, value)
+}
+
+func (a *App) Do(req *http.Request) *Response {
+	a.T.Helper()
+
+	for key, values := range a.headers {
+		if _, exists := req.Header[key]; !exists {
+			req.Header[key] = values
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	a.Handler.ServeHTTP(recorder, req)
+
+	return newResponse(a.T, recorder.Result())
+}
+
+func (a *App) Request(method, path string, body io.Reader, headers ...string) *Response {
+	a.T.Helper()
+
+	req := httptest.NewRequest(method, path, body)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return a.Do(req)
+}
+
+func (a *App) Get(path string) *Response {
+	a.T.Helper()
+	return a.Request(http.MethodGet, path, nil)
+}
+
+func (a *App) Delete(path string) *Response {
+	a.T.Helper()
+	return a.Request(http.MethodDelete, path, nil)
+}
+
+func (a *App) Post(path, contentType string, body io.Reader) *Response {
+	a.T.Helper()
+	return a.Request(http.MethodPost, path, body, "Content-Type", contentType)
+}
+
+func (a *App) PostForm(path string, form map[string]string) *Response {
+	a.T.Helper()
+
+	values := make([]string, 0, len(form))
+	for key, value := range form {
+		values = append(values, urlEncode(key)+"="+urlEncode(value))
+	}
+	return a.Post(path, "application/x-www-form-urlencoded", strings.NewReader(strings.Join(values, "&")))
+}
+
+func (a *App) PostJSON(path string, v interface{}) *Response {
+	a.T.Helper()
+	return a.sendJSON(http.MethodPost, path, v)
+}
+
+func (a *App) PutJSON(path string, v interface{}) *Response {
+	a.T.Helper()
+	return a.sendJSON(http.MethodPut, path, v)
+}
+
+func (a *App) PatchJSON(path string, v interface{}) *Response {
+	a.T.Helper()
+	return a.sendJSON(http.MethodPatch, path, v)
+}
+
+func (a *App) sendJSON(method, path string, v interface{}) *Response {
+	a.T.Helper()
+
+	payload, err := json.Marshal(v)
+	if err != nil {
+		a.T.Fatalf("goatest: encode JSON body for %s %s: %v", method, path, err)
+	}
+	return a.Request(method, path, bytes.NewReader(payload), "Content-Type", "application/json")
+}
@@ -0,0 +1,167 @@
+package goatest
+
+import (
+	"goonairplanes/core"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const fixtureApp = "testdata/app"
+
+func init() {
+	core.RegisterAPIHandler("/api/fixture/init", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success("registered from init", http.StatusOK)
+	})
+}
+
+type echoed struct {
+	Method string `json:"method"`
+	Name   string `json:"name" form:"name"`
+	Header string `json:"header" header:"X-Test"`
+}
+
+// echoHandlers registers /api/echo, which reports what it received.
+func echoHandlers(app *core.GonAirApp) {
+	echo := func(ctx *core.APIContext) {
+		var received echoed
+		if err := ctx.Bind(&received); err != nil {
+			ctx.Error(err.Error(), http.StatusBadRequest)
+			return
+		}
+		received.Method = ctx.Request.Method
+		ctx.Success(received, http.StatusOK)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		app.Router.RegisterAPIHandler("/api/echo", method, echo)
+	}
+}
+
+func TestRequestHelpers(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(echoHandlers))
+
+	tests := []struct {
+		name   string
+		send   func() *Response
+		method string
+		body   bool
+	}{
+		{"Get", func() *Response { return app.Get("/api/echo") }, http.MethodGet, false},
+		{"Delete", func() *Response { return app.Delete("/api/echo") }, http.MethodDelete, false},
+		{"PostJSON", func() *Response { return app.PostJSON("/api/echo", map[string]string{"name": "ada"}) }, http.MethodPost, true},
+		{"PutJSON", func() *Response { return app.PutJSON("/api/echo", map[string]string{"name": "ada"}) }, http.MethodPut, true},
+		{"PatchJSON", func() *Response { return app.PatchJSON("/api/echo", map[string]string{"name": "ada"}) }, http.MethodPatch, true},
+		{"PostForm", func() *Response { return app.PostForm("/api/echo", map[string]string{"name": "ada"}) }, http.MethodPost, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received echoed
+			tt.send().AssertStatus(http.StatusOK).Data(&received)
+
+			if received.Method != tt.method {
+				t.Errorf("method = %q, want %q", received.Method, tt.method)
+			}
+			if tt.body && received.Name != "ada" {
+				t.Errorf("name = %q, want %q", received.Name, "ada")
+			}
+		})
+	}
+}
+
+func TestSetHeaderAppliesToEveryRequest(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(echoHandlers))
+	app.SetHeader("X-Test", "harness")
+
+	var received echoed
+	app.Get("/api/echo").Data(&received)
+	if received.Header != "harness" {
+		t.Errorf("header = %q, want %q", received.Header, "harness")
+	}
+
+	app.Request(http.MethodGet, "/api/echo", nil, "X-Test", "explicit").Data(&received)
+	if received.Header != "explicit" {
+		t.Errorf("a request's own header should win, got %q", received.Header)
+	}
+}
+
+func TestFixturePages(t *testing.T) {
+	app := New(t, fixtureApp)
+
+	app.Get("/").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "text/html; charset=utf-8").
+		AssertText("title", "Fixture Home").
+		AssertText("h1.title", "Welcome aboard").
+		AssertText("span.badge", "beta").
+		AssertCount("#links li", 3)
+
+	app.Get("/about").AssertStatus(http.StatusOK).AssertText("p.lead", "real pages")
+	app.Get("/posts/hello-world").AssertStatus(http.StatusOK).AssertText("article .slug", "hello-world")
+	app.Get("/static/css/site.css").AssertStatus(http.StatusOK).AssertContains("font-family")
+	app.Get("/missing").AssertStatus(http.StatusNotFound)
+}
+
+func TestAPIRegistryIsolation(t *testing.T) {
+	onlyA := WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/only-a", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success("a", http.StatusOK)
+		})
+	})
+	a := New(t, fixtureApp, onlyA)
+	b := New(t, fixtureApp)
+
+	a.Get("/api/only-a").AssertStatus(http.StatusOK)
+	b.Get("/api/only-a").AssertStatus(http.StatusNotFound)
+
+	a.Get("/api/fixture/init").AssertStatus(http.StatusOK)
+	b.Get("/api/fixture/init").AssertStatus(http.StatusOK)
+
+	empty := New(t, fixtureApp, WithEmptyAPIRegistry(), onlyA)
+	empty.Get("/api/fixture/init").AssertStatus(http.StatusNotFound)
+	empty.Get("/api/only-a").AssertStatus(http.StatusOK)
+}
+
+func TestConfigIsolation(t *testing.T) {
+	appName := core.AppConfig.AppName
+	proxies := strings.Join(core.AppConfig.TrustedProxies, ",")
+
+	a := New(t, fixtureApp, WithConfig(func(c *core.Config) {
+		c.AppName = "harness-a"
+		c.TrustedProxies = append(c.TrustedProxies, "10.0.0.0/8")
+		c.DefaultMetaTags["author"] = "harness-a"
+	}))
+	b := New(t, fixtureApp)
+
+	if a.App.Config.AppName != "harness-a" {
+		t.Errorf("harness config not applied: AppName = %q", a.App.Config.AppName)
+	}
+	if b.App.Config.AppName != appName {
+		t.Errorf("second harness saw the first one's AppName %q", b.App.Config.AppName)
+	}
+	if _, ok := b.App.Config.DefaultMetaTags["author"]; ok {
+		t.Error("second harness saw the first one's meta tag")
+	}
+	if core.AppConfig.AppName != appName || strings.Join(core.AppConfig.TrustedProxies, ",") != proxies {
+		t.Error("harness config leaked into core.AppConfig")
+	}
+	if _, ok := core.AppConfig.DefaultMetaTags["author"]; ok {
+		t.Error("harness meta tag leaked into core.AppConfig")
+	}
+}
+
+func TestParallelHarnesses(t *testing.T) {
+	for _, name := range []string{"one", "two", "three"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			app := New(t, fixtureApp, WithConfig(func(c *core.Config) {
+				c.AppName = name
+			}))
+			app.Get("/about").AssertStatus(http.StatusOK)
+			if app.App.Config.AppName != name {
+				t.Errorf("AppName = %q, want %q", app.App.Config.AppName, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package goatest
+
+import (
+	"encoding/json"
+	"goonairplanes/core"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+type Response struct {
+	T          testing.TB
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	document *html.Node
+}
+
+func newResponse(t testing.TB, res *http.Response) *Response {
+	t.Helper()
+
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatalf("goatest: read response body: %v", err)
+	}
+
+	return &Response{
+		T:          t,
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}
+}
+
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+func (r *Response) JSON(v interface{}) {
+	r.T.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.T.Fatalf("goatest: decode JSON response (status %d): %v\n%s", r.StatusCode, err, r.Body)
+	}
+}
+
+// Data decodes a core.ResponseData envelope and, when v is non-nil, its data field into v.
+func (r *Response) Data(v interface{}) core.ResponseData {
+	r.T.Helper()
+
+	var envelope struct {
+		core.ResponseData
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+	r.JSON(&envelope)
+
+	if v != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, v); err != nil {
+			r.T.Fatalf("goatest: decode response data: %v\n%s", err, envelope.Data)
+		}
+	}
+
+	response := envelope.ResponseData
+	if len(envelope.Data) > 0 {
+		var data interface{}
+		json.Unmarshal(envelope.Data, &data)
+		response.Data = data
+	}
+	return response
+}
+
+func (r *Response) AssertStatus(code int) *Response {
+	r.T.Helper()
+	if r.StatusCode != code {
+		r.T.Errorf("goatest: expected status %d, got %d\n%s", code, r.StatusCode, truncate(r.String(), 500))
+	}
+	return r
+}
+
+func (r *Response) AssertHeader(key, value string) *Response {
+	r.T.Helper()
+	if got := r.Header.Get(key); got != value {
+		r.T.Errorf("goatest: expected header %s=%q, got %q", key, value, got)
+	}
+	return r
+}
+
+func (r *Response) AssertContains(substr string) *Response {
+	r.T.Helper()
+	if !strings.Contains(r.String(), substr) {
+		r.T.Errorf("goatest: expected body to contain %q\n%s", substr, truncate(r.String(), 500))
+	}
+	return r
+}
+
+func (r *Response) AssertSuccess() *Response {
+	r.T.Helper()
+	if data := r.Data(nil); !data.Success {
+		r.T.Errorf("goatest: expected successful API response, got error %q (status %d)", data.Error, r.StatusCode)
+	}
+	return r
+}
+
+func (r *Response) Document() *html.Node {
+	r.T.Helper()
+
+	if r.document == nil {
+		document, err := html.Parse(strings.NewReader(r.String()))
+		if err != nil {
+			r.T.Fatalf("goatest: parse HTML response: %v", err)
+		}
+		r.document = document
+	}
+	return r.document
+}
+
+func (r *Response) Find(selector string) []*Node {
+	r.T.Helper()
+
+	nodes, err := Query(r.Document(), selector)
+	if err != nil {
+		r.T.Fatalf("goatest: %v", err)
+	}
+	return nodes
+}
+
+func (r *Response) First(selector string) *Node {
+	r.T.Helper()
+
+	nodes := r.Find(selector)
+	if len(nodes) == 0 {
+		r.T.Fatalf("goatest: no element matches %q", selector)
+	}
+	return nodes[0]
+}
+
+func (r *Response) AssertSelector(selector string) *Response {
+	r.T.Helper()
+	if len(r.Find(selector)) == 0 {
+		r.T.Errorf("goatest: expected an element matching %q", selector)
+	}
+	return r
+}
+
+func (r *Response) AssertNoSelector(selector string) *Response {
+	r.T.Helper()
+	if count := len(r.Find(selector)); count > 0 {
+		r.T.Errorf("goatest: expected no element matching %q, found %d", selector, count)
+	}
+	return r
+}
+
+func (r *Response) AssertCount(selector string, count int) *Response {
+	r.T.Helper()
+	if got := len(r.Find(selector)); got != count {
+		r.T.Errorf("goatest: expected %d elements matching %q, found %d", count, selector, got)
+	}
+	return r
+}
+
+func (r *Response) AssertText(selector, substr string) *Response {
+	r.T.Helper()
+
+	nodes := r.Find(selector)
+	if len(nodes) == 0 {
+		r.T.Errorf("goatest: expected an element matching %q", selector)
+		return r
+	}
+	for _, node := range nodes {
+		if strings.Contains(node.Text(), substr) {
+			return r
+		}
+	}
+	r.T.Errorf("goatest: no element matching %q contains text %q (first: %q)", selector, substr, nodes[0].Text())
+	return r
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "..."
+}
+
+func urlEncode(s string) string {
+	return url.QueryEscape(s)
+}
@@ -0,0 +1,92 @@
+package goatest
+
+import (
+	"goonairplanes/core"
+	"net/http"
+	"testing"
+)
+
+type widget struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func widgetHandlers(app *core.GonAirApp) {
+	app.Router.RegisterAPIHandler("/api/widgets/[id]", http.MethodGet, func(ctx *core.APIContext) {
+		if ctx.Params["id"] != "7" {
+			ctx.Error("widget not found", http.StatusNotFound)
+			return
+		}
+		ctx.Success(widget{ID: 7, Name: "sprocket"}, http.StatusOK)
+	})
+	app.Router.RegisterAPIHandler("/api/widgets", http.MethodGet, func(ctx *core.APIContext) {
+		core.RenderPaginated(ctx.Writer, []widget{{ID: 1, Name: "cog"}, {ID: 2, Name: "gear"}},
+			core.PaginationMeta{CurrentPage: 1, PerPage: 2, TotalItems: 5, TotalPages: 3, HasNextPage: true}, http.StatusOK)
+	})
+}
+
+func TestResponseDataDecodesSuccess(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(widgetHandlers))
+
+	var got widget
+	data := app.Get("/api/widgets/7").AssertStatus(http.StatusOK).AssertSuccess().Data(&got)
+
+	if !data.Success || data.Error != "" {
+		t.Errorf("envelope = %+v, want success without error", data)
+	}
+	if got != (widget{ID: 7, Name: "sprocket"}) {
+		t.Errorf("data = %+v", got)
+	}
+	if fields, ok := data.Data.(map[string]interface{}); !ok || fields["name"] != "sprocket" {
+		t.Errorf("envelope Data = %#v, want the decoded object", data.Data)
+	}
+}
+
+func TestResponseDataDecodesErrors(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(widgetHandlers))
+
+	var got widget
+	data := app.Get("/api/widgets/8").AssertStatus(http.StatusNotFound).Data(&got)
+
+	if data.Success {
+		t.Error("error response decoded as a success")
+	}
+	if data.Error != "widget not found" {
+		t.Errorf("Error = %q", data.Error)
+	}
+	if data.Data != nil || got != (widget{}) {
+		t.Errorf("error response carried data: %#v, %+v", data.Data, got)
+	}
+}
+
+func TestResponseDataKeepsMeta(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(widgetHandlers))
+
+	var got []widget
+	data := app.Get("/api/widgets").AssertSuccess().Data(&got)
+
+	if len(got) != 2 || got[1].Name != "gear" {
+		t.Errorf("data = %+v", got)
+	}
+	meta, ok := data.Meta.(map[string]interface{})
+	if !ok {
+		t.Fatalf("Meta = %#v, want an object", data.Meta)
+	}
+	if meta["total_items"] != float64(5) {
+		t.Errorf("meta total_items = %v, want 5", meta["total_items"])
+	}
+}
+
+func TestResponseJSONAndString(t *testing.T) {
+	app := New(t, fixtureApp, WithAPIHandlers(widgetHandlers))
+
+	res := app.Get("/api/widgets/7")
+	var raw map[string]interface{}
+	res.JSON(&raw)
+	if raw["success"] != true {
+		t.Errorf("raw envelope = %v", raw)
+	}
+	if res.String() != string(res.Body) {
+		t.Error("String() does not match Body")
+	}
+}
@@ -0,0 +1,265 @@
+package goatest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+type Node struct {
+	*html.Node
+}
+
+func (n *Node) Text() string {
+	var buffer strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			buffer.WriteString(node.Data)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n.Node)
+	return strings.Join(strings.Fields(buffer.String()), " ")
+}
+
+func (n *Node) Attr(name string) (string, bool) {
+	for _, attr := range n.Node.Attr {
+		if attr.Key == name {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func (n *Node) HTML() string {
+	var buffer bytes.Buffer
+	html.Render(&buffer, n.Node)
+	return buffer.String()
+}
+
+// Query supports type, universal, #id, .class and [attr], [attr=v], [attr~=v],
+// [attr^=v], [attr$=v], [attr*=v] selectors joined by descendant, child (>)
+// and group (,) combinators.
+func Query(root *html.Node, selector string) ([]*Node, error) {
+	var results []*Node
+	seen := make(map[*html.Node]bool)
+
+	for _, group := range strings.Split(selector, ",") {
+		steps, err := parseSelector(strings.TrimSpace(group))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+
+		walkElements(root, func(node *html.Node) {
+			if !seen[node] && matchSteps(node, steps, len(steps)-1) {
+				seen[node] = true
+				results = append(results, &Node{node})
+			}
+		})
+	}
+
+	return results, nil
+}
+
+type attrMatcher struct {
+	name     string
+	operator string
+	value    string
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatcher
+}
+
+type selectorStep struct {
+	compound compound
+	// child is true when this step must be the direct parent's child (">").
+	child bool
+}
+
+func parseSelector(selector string) ([]selectorStep, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	selector = strings.ReplaceAll(selector, ">", " > ")
+	tokens := strings.Fields(selector)
+
+	var steps []selectorStep
+	childNext := false
+	for _, token := range tokens {
+		if token == ">" {
+			if len(steps) == 0 || childNext {
+				return nil, fmt.Errorf("unexpected '>'")
+			}
+			childNext = true
+			continue
+		}
+
+		c, err := parseCompound(token)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, selectorStep{compound: c, child: childNext})
+		childNext = false
+	}
+
+	if childNext {
+		return nil, fmt.Errorf("selector ends with '>'")
+	}
+	return steps, nil
+}
+
+func parseCompound(token string) (compound, error) {
+	var c compound
+
+	i := 0
+	readIdent := func() string {
+		start := i
+		for i < len(token) && strings.IndexByte("#.[", token[i]) == -1 {
+			i++
+		}
+		return token[start:i]
+	}
+
+	if i < len(token) && strings.IndexByte("#.[", token[i]) == -1 {
+		c.tag = strings.ToLower(readIdent())
+		if c.tag == "*" {
+			c.tag = ""
+		}
+	}
+
+	for i < len(token) {
+		switch token[i] {
+		case '#':
+			i++
+			c.id = readIdent()
+		case '.':
+			i++
+			c.classes = append(c.classes, readIdent())
+		case '[':
+			end := strings.IndexByte(token[i:], ']')
+			if end == -1 {
+				return c, fmt.Errorf("unterminated attribute selector in %q", token)
+			}
+			attr, err := parseAttr(token[i+1 : i+end])
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, attr)
+			i += end + 1
+		default:
+			return c, fmt.Errorf("unexpected %q in %q", token[i], token)
+		}
+	}
+
+	return c, nil
+}
+
+func parseAttr(expr string) (attrMatcher, error) {
+	for _, operator := range []string{"~=", "^=", "$=", "*=", "="} {
+		if idx := strings.Index(expr, operator); idx > 0 {
+			value := strings.Trim(expr[idx+len(operator):], `"'`)
+			return attrMatcher{name: expr[:idx], operator: operator, value: value}, nil
+		}
+	}
+	if expr == "" {
+		return attrMatcher{}, fmt.Errorf("empty attribute selector")
+	}
+	return attrMatcher{name: expr}, nil
+}
+
+func walkElements(node *html.Node, visit func(*html.Node)) {
+	if node.Type == html.ElementNode {
+		visit(node)
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walkElements(child, visit)
+	}
+}
+
+func matchSteps(node *html.Node, steps []selectorStep, index int) bool {
+	if !matchCompound(node, steps[index].compound) {
+		return false
+	}
+	if index == 0 {
+		return true
+	}
+
+	if steps[index].child {
+		parent := node.Parent
+		return parent != nil && parent.Type == html.ElementNode && matchSteps(parent, steps, index-1)
+	}
+
+	for ancestor := node.Parent; ancestor != nil; ancestor = ancestor.Parent {
+		if ancestor.Type == html.ElementNode && matchSteps(ancestor, steps, index-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompound(node *html.Node, c compound) bool {
+	if c.tag != "" && node.Data != c.tag {
+		return false
+	}
+
+	wrapped := &Node{node}
+
+	if c.id != "" {
+		if id, _ := wrapped.Attr("id"); id != c.id {
+			return false
+		}
+	}
+
+	if len(c.classes) > 0 {
+		classAttr, _ := wrapped.Attr("class")
+		classes := strings.Fields(classAttr)
+		for _, want := range c.classes {
+			if !containsString(classes, want) {
+				return false
+			}
+		}
+	}
+
+	for _, attr := range c.attrs {
+		value, ok := wrapped.Attr(attr.name)
+		if !ok {
+			return false
+		}
+		switch attr.operator {
+		case "=":
+			ok = value == attr.value
+		case "~=":
+			ok = containsString(strings.Fields(value), attr.value)
+		case "^=":
+			ok = strings.HasPrefix(value, attr.value)
+		case "$=":
+			ok = strings.HasSuffix(value, attr.value)
+		case "*=":
+			ok = strings.Contains(value, attr.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package goatest
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+const selectorFixture = `<!DOCTYPE html>
+<html><body>
+<div id="main" class="page wide">
+  <h1 class="title">Heading</h1>
+  <ul class="nav">
+    <li class="item"><a href="/about" rel="nofollow">About</a></li>
+    <li class="item active"><a href="/posts/1" data-tags="go web">Post</a></li>
+    <li class="item"><a href="https://example.com/guide.pdf">Guide</a></li>
+  </ul>
+  <section><p>Nested <span>deep</span></p></section>
+</div>
+<p class="footer">Footer</p>
+</body></html>`
+
+func parseFixture(t *testing.T) *html.Node {
+	t.Helper()
+	document, err := html.Parse(strings.NewReader(selectorFixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestQuery(t *testing.T) {
+	document := parseFixture(t)
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{"h1", []string{"Heading"}},
+		{"#main > h1", []string{"Heading"}},
+		{".item.active", []string{"Post"}},
+		{"li.item", []string{"About", "Post", "Guide"}},
+		{"a[rel]", []string{"About"}},
+		{"a[href=/about]", []string{"About"}},
+		{`a[href="/posts/1"]`, []string{"Post"}},
+		{"a[data-tags~=web]", []string{"Post"}},
+		{"a[href^=https]", []string{"Guide"}},
+		{"a[href$=.pdf]", []string{"Guide"}},
+		{"a[href*=posts]", []string{"Post"}},
+		{"#main span", []string{"deep"}},
+		{"#main > span", nil},
+		{"section > p > span", []string{"deep"}},
+		{"div p", []string{"Nested deep"}},
+		{"h1, p.footer", []string{"Heading", "Footer"}},
+		{"h1, .title", []string{"Heading"}},
+		{"*.footer", []string{"Footer"}},
+		{"LI.active", []string{"Post"}},
+		{"table", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			nodes, err := Query(document, tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, node := range nodes {
+				got = append(got, node.Text())
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryRejectsInvalidSelectors(t *testing.T) {
+	document := parseFixture(t)
+
+	for _, selector := range []string{"", "> a", "ul >", "ul > > li", "a[href", "a[]", "h1, "} {
+		if _, err := Query(document, selector); err == nil {
+			t.Errorf("Query(%q) succeeded, want an error", selector)
+		}
+	}
+}
+
+func TestNodeHelpers(t *testing.T) {
+	nodes, err := Query(parseFixture(t), "li.active a")
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Query = %v, %v", nodes, err)
+	}
+	link := nodes[0]
+
+	if href, ok := link.Attr("href"); !ok || href != "/posts/1" {
+		t.Errorf("Attr(href) = %q, %v", href, ok)
+	}
+	if _, ok := link.Attr("target"); ok {
+		t.Error("Attr reported a missing attribute")
+	}
+	if got := link.HTML(); got != `<a href="/posts/1" data-tags="go web">Post</a>` {
+		t.Errorf("HTML() = %s", got)
+	}
+}
+
+func TestResponseSelectorAssertions(t *testing.T) {
+	app := New(t, fixtureApp)
+	res := app.Get("/")
+
+	res.AssertSelector("form[action=/api/echo]").
+		AssertNoSelector("table").
+		AssertCount("li.item", 3).
+		AssertText("li.active a", "First post")
+
+	if slug, _ := res.First("a[data-slug]").Attr("data-slug"); slug != "hello-world" {
+		t.Errorf("data-slug = %q", slug)
+	}
+	if len(res.Find("a[target=_blank]")) != 1 {
+		t.Error("expected one external link")
+	}
+}
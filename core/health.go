@@ -0,0 +1,211 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const readinessCheckTimeout = 5 * time.Second
+
+// HealthCheck reports an error when a dependency such as a database is unavailable.
+type HealthCheck func(ctx context.Context) error
+
+type namedHealthCheck struct {
+	name  string
+	check HealthCheck
+}
+
+type HealthReport struct {
+	Status    string                       `json:"status"`
+	Uptime    string                       `json:"uptime"`
+	Templates TemplateHealth               `json:"templates"`
+	Errors    ErrorHealth                  `json:"errors"`
+	SSG       SSGHealth                    `json:"ssg"`
+	Checks    map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+type TemplateHealth struct {
+	Loaded bool `json:"loaded"`
+	Count  int  `json:"count"`
+	Errors int  `json:"errors"`
+}
+
+type ErrorHealth struct {
+	Pages        int `json:"pages"`
+	APIs         int `json:"apis"`
+	OpenCircuits int `json:"open_circuits"`
+}
+
+type SSGHealth struct {
+	Enabled    bool `json:"enabled"`
+	Queued     int  `json:"queued"`
+	Processing int  `json:"processing"`
+}
+
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// AddReadinessCheck registers a check that must pass for /readyz to report ready.
+func (app *GonAirApp) AddReadinessCheck(name string, check HealthCheck) {
+	app.lifecycleMutex.Lock()
+	defer app.lifecycleMutex.Unlock()
+	app.readinessChecks = append(app.readinessChecks, namedHealthCheck{name: name, check: check})
+}
+
+func (app *GonAirApp) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	RenderJSON(w, map[string]string{
+		"status": "ok",
+		"uptime": time.Since(app.startedAt).Round(time.Second).String(),
+	}, http.StatusOK)
+}
+
+func (app *GonAirApp) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	report := app.Readiness(ctx)
+
+	status := http.StatusOK
+	if report.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	RenderJSON(w, report, status)
+}
+
+// Readiness is not ready while templates have not loaded, once shutdown has
+// begun, or when any registered readiness check fails. Template, page and API
+// errors are reported but only affect the routes they belong to.
+func (app *GonAirApp) Readiness(ctx context.Context) HealthReport {
+	marley := app.Router.Marley
+
+	marley.mutex.RLock()
+	templates := TemplateHealth{
+		Loaded: marley.templatesLoaded,
+		Count:  len(marley.Templates),
+		Errors: len(marley.TemplateErrors),
+	}
+	marley.mutex.RUnlock()
+
+	queued, processing := marley.SSGBacklog()
+
+	report := HealthReport{
+		Status:    "ready",
+		Uptime:    time.Since(app.startedAt).Round(time.Second).String(),
+		Templates: templates,
+		Errors: ErrorHealth{
+			Pages:        len(app.Router.Errors.PageErrors()),
+			APIs:         len(app.Router.Errors.APIErrors()),
+			OpenCircuits: app.Router.Errors.OpenCircuits(),
+		},
+		SSG: SSGHealth{
+			Enabled:    app.Config.SSGEnabled,
+			Queued:     queued,
+			Processing: processing,
+		},
+		Checks: app.runReadinessChecks(ctx),
+	}
+
+	if !templates.Loaded || app.ctx.Err() != nil {
+		report.Status = "not_ready"
+	}
+	for _, result := range report.Checks {
+		if result.Status != "ok" {
+			report.Status = "not_ready"
+		}
+	}
+
+	return report
+}
+
+func (app *GonAirApp) runReadinessChecks(ctx context.Context) map[string]HealthCheckResult {
+	app.lifecycleMutex.Lock()
+	checks := append([]namedHealthCheck(nil), app.readinessChecks...)
+	app.lifecycleMutex.Unlock()
+
+	if len(checks) == 0 {
+		return nil
+	}
+
+	results := make(map[string]HealthCheckResult, len(checks))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedHealthCheck) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := runHealthCheck(ctx, c.check)
+
+			result := HealthCheckResult{Status: "ok", Duration: time.Since(start).Round(time.Microsecond).String()}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+
+			mutex.Lock()
+			results[c.name] = result
+			mutex.Unlock()
+		}(c)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// runHealthCheck gives up when ctx expires even if the check ignores it.
+func runHealthCheck(ctx context.Context, check HealthCheck) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("check panicked: %v", rec)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (er *ErrorRegistry) OpenCircuits() int {
+	open := 0
+	er.breakers.Range(func(_, value interface{}) bool {
+		if value.(*CircuitBreaker).State() != CircuitClosed {
+			open++
+		}
+		return true
+	})
+	return open
+}
+
+func (m *Marley) SSGBacklog() (queued int, processing int) {
+	if m.ssgMutex == nil {
+		return 0, 0
+	}
+
+	m.ssgMutex.RLock()
+	defer m.ssgMutex.RUnlock()
+
+	for _, entry := range m.SSGCache {
+		if entry.Processing {
+			processing++
+		}
+	}
+	return len(m.ssgTaskChan), processing
+}
@@ -0,0 +1,140 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func readiness(t *testing.T, app *goatest.App, status int) core.HealthReport {
+	t.Helper()
+
+	var report core.HealthReport
+	app.Get("/readyz").
+		AssertStatus(status).
+		AssertHeader("Cache-Control", "no-store").
+		JSON(&report)
+	return report
+}
+
+func TestHealthzReportsLiveness(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.RateLimit = 1
+	}))
+
+	for i := 0; i < 3; i++ {
+		var body map[string]string
+		app.Get("/healthz").
+			AssertStatus(http.StatusOK).
+			AssertHeader("Cache-Control", "no-store").
+			JSON(&body)
+		if body["status"] != "ok" || body["uptime"] == "" {
+			t.Errorf("healthz = %v", body)
+		}
+	}
+}
+
+func TestReadyzReportsState(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(breakerConfig))
+
+	report := readiness(t, app, http.StatusOK)
+	if report.Status != "ready" || !report.Templates.Loaded || report.Templates.Count == 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if report.Checks != nil {
+		t.Errorf("checks = %v, want none registered", report.Checks)
+	}
+
+	// A broken page is reported but does not take the whole app out of rotation.
+	app.Get("/flaky/fail")
+	app.Get("/flaky/fail")
+	report = readiness(t, app, http.StatusOK)
+	if report.Errors.Pages != 1 || report.Errors.OpenCircuits != 1 {
+		t.Errorf("errors = %+v, want the failing page and its open circuit", report.Errors)
+	}
+}
+
+func TestReadyzRunsChecks(t *testing.T) {
+	app := newTestApp(t)
+
+	var dbErr error
+	app.App.AddReadinessCheck("db", func(ctx context.Context) error { return dbErr })
+	app.App.AddReadinessCheck("cache", func(ctx context.Context) error { return nil })
+
+	report := readiness(t, app, http.StatusOK)
+	if report.Checks["db"].Status != "ok" || report.Checks["cache"].Status != "ok" {
+		t.Errorf("checks = %+v", report.Checks)
+	}
+
+	dbErr = errors.New("connection refused")
+	report = readiness(t, app, http.StatusServiceUnavailable)
+	if report.Status != "not_ready" {
+		t.Errorf("status = %q", report.Status)
+	}
+	if got := report.Checks["db"]; got.Status != "fail" || got.Error != "connection refused" {
+		t.Errorf("db check = %+v", got)
+	}
+	if report.Checks["cache"].Status != "ok" {
+		t.Errorf("cache check = %+v", report.Checks["cache"])
+	}
+}
+
+func TestReadinessSurvivesBadChecks(t *testing.T) {
+	app := newTestApp(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	app.App.AddReadinessCheck("hangs", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	app.App.AddReadinessCheck("panics", func(ctx context.Context) error {
+		panic("driver bug")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	report := app.App.Readiness(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Readiness took %v, want it bounded by the context", elapsed)
+	}
+	if got := report.Checks["hangs"]; got.Status != "fail" || got.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("hanging check = %+v", got)
+	}
+	if got := report.Checks["panics"]; got.Status != "fail" || got.Error != "check panicked: driver bug" {
+		t.Errorf("panicking check = %+v", got)
+	}
+}
+
+func TestReadyzFailsOnceShutdownBegins(t *testing.T) {
+	app := newTestApp(t)
+
+	readiness(t, app, http.StatusOK)
+	app.App.Shutdown(context.Background())
+	if report := readiness(t, app, http.StatusServiceUnavailable); report.Status != "not_ready" {
+		t.Errorf("status = %q", report.Status)
+	}
+	app.Get("/healthz").AssertStatus(http.StatusOK)
+}
+
+func TestHealthPaths(t *testing.T) {
+	custom := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.HealthPath = "/internal/live"
+		c.ReadyPath = "/internal/ready/"
+	}))
+	custom.Get("/internal/live").AssertStatus(http.StatusOK)
+	custom.Get("/internal/ready").AssertStatus(http.StatusOK)
+	custom.Get("/healthz").AssertStatus(http.StatusNotFound)
+
+	disabled := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.HealthEnabled = false
+	}))
+	disabled.Get("/healthz").AssertStatus(http.StatusNotFound)
+	disabled.Get("/readyz").AssertStatus(http.StatusNotFound)
+}
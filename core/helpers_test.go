@@ -0,0 +1,29 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"testing"
+)
+
+// newTestApp boots testdata/app with only the API handlers the test
+// registers and no global rate limit, so tests can send as many requests as
+// they need.
+func newTestApp(t *testing.T, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	defaults := []goatest.Option{
+		goatest.WithEmptyAPIRegistry(),
+		goatest.WithConfig(func(c *core.Config) {
+			c.RateLimit = 0
+		}),
+	}
+	return goatest.New(t, "testdata/app", append(defaults, opts...)...)
+}
+
+// withAPI registers one API handler on the test app.
+func withAPI(path, method string, handler func(*core.APIContext), options ...core.APIOption) goatest.Option {
+	return goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler(path, method, handler, options...)
+	})
+}
@@ -0,0 +1,313 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// defaultIdempotencyMaxBody caps the request body read to fingerprint a
+// request when IdempotencyOptions.MaxBodyBytes is unset.
+const defaultIdempotencyMaxBody = 1 << 20
+
+var (
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is already in progress")
+	ErrIdempotencyMismatch   = errors.New("idempotency key was already used with a different request body")
+)
+
+type IdempotencyRecord struct {
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	Fingerprint string
+}
+
+// IdempotencyStore reserves a key with Begin, then either stores the finished
+// response with Complete or drops the reservation with Release.
+type IdempotencyStore interface {
+	Begin(key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	Complete(key string, record *IdempotencyRecord, ttl time.Duration) error
+	Release(key string) error
+}
+
+type IdempotencyOptions struct {
+	TTL       time.Duration
+	Required  bool
+	Store     IdempotencyStore
+	ClientKey func(r *http.Request) string
+	// MaxBodyBytes limits the request body, which is read in full to
+	// fingerprint the request. Larger bodies get 413. Defaults to 1 MiB.
+	MaxBodyBytes int64
+}
+
+type memoryIdempotencyEntry struct {
+	record      *IdempotencyRecord
+	fingerprint string
+	inFlight    bool
+	expiry      time.Time
+}
+
+type MemoryIdempotencyStore struct {
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries:   make(map[string]*memoryIdempotencyEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func WithIdempotency(ttl time.Duration) APIOption {
+	return WithIdempotencyOptions(IdempotencyOptions{TTL: ttl})
+}
+
+func WithIdempotencyOptions(options IdempotencyOptions) APIOption {
+	return func(o *APIRouteOptions) {
+		opts := options
+		o.Idempotency = &opts
+	}
+}
+
+func (s *MemoryIdempotencyStore) Begin(key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, entry := range s.entries {
+			if now.After(entry.expiry) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if entry, exists := s.entries[key]; exists && now.Before(entry.expiry) {
+		if entry.fingerprint != fingerprint {
+			return nil, ErrIdempotencyMismatch
+		}
+		if entry.inFlight {
+			return nil, ErrIdempotencyInProgress
+		}
+		return entry.record, nil
+	}
+
+	s.entries[key] = &memoryIdempotencyEntry{
+		fingerprint: fingerprint,
+		inFlight:    true,
+		expiry:      now.Add(ttl),
+	}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries[key] = &memoryIdempotencyEntry{
+		record:      record,
+		fingerprint: record.Fingerprint,
+		expiry:      time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+func (r *Router) serveIdempotent(ctx *APIContext, route *APIRoute, options *IdempotencyOptions) {
+	req := ctx.Request
+
+	if req.Method != http.MethodPost && req.Method != http.MethodPut && req.Method != http.MethodPatch {
+		route.Handler(ctx)
+		return
+	}
+
+	idempotencyKey := req.Header.Get(IdempotencyKeyHeader)
+	if idempotencyKey == "" {
+		if options.Required {
+			ctx.Error("Idempotency-Key header is required", http.StatusBadRequest)
+			return
+		}
+		route.Handler(ctx)
+		return
+	}
+
+	ttl := options.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	store := options.Store
+	if store == nil {
+		store = r.IdempotencyStore
+	}
+
+	clientKey := r.idempotencyClientKey
+	if options.ClientKey != nil {
+		clientKey = options.ClientKey
+	}
+
+	maxBody := options.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = defaultIdempotencyMaxBody
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(ctx.Writer, req.Body, maxBody))
+		req.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ctx.Error("Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			ctx.Error("Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	storeKey := hashIdempotencyParts(route.Method, route.Path, clientKey(req), idempotencyKey)
+	fingerprint := hashIdempotencyParts(req.URL.RequestURI(), string(body))
+
+	record, err := store.Begin(storeKey, fingerprint, ttl)
+	switch {
+	case errors.Is(err, ErrIdempotencyInProgress):
+		ctx.Error(err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrIdempotencyMismatch):
+		ctx.Error(err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		ctx.Error("Idempotency store unavailable", http.StatusServiceUnavailable)
+		return
+	case record != nil:
+		replayIdempotentResponse(ctx.Writer, record)
+		return
+	}
+
+	writer := ctx.Writer
+	before := writer.Header().Clone()
+	recorder := &idempotencyRecorder{ResponseWriter: writer}
+	ctx.Writer = recorder
+
+	completed := false
+	defer func() {
+		ctx.Writer = writer
+		if !completed {
+			store.Release(storeKey)
+		}
+	}()
+
+	route.Handler(ctx)
+
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	if recorder.status < http.StatusInternalServerError {
+		record := &IdempotencyRecord{
+			StatusCode:  recorder.status,
+			Header:      headerChanges(before, writer.Header()),
+			Body:        append([]byte(nil), recorder.body.Bytes()...),
+			Fingerprint: fingerprint,
+		}
+		if err := store.Complete(storeKey, record, ttl); err == nil {
+			completed = true
+		}
+	}
+
+	writer.WriteHeader(recorder.status)
+	writer.Write(recorder.body.Bytes())
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, record *IdempotencyRecord) {
+	header := w.Header()
+	for key, values := range record.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	header.Set("Idempotent-Replayed", "true")
+
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// headerChanges returns the headers the handler set or changed, leaving out
+// the ones the router had already written for this request, such as
+// X-Request-Id and the CORS and rate limit headers, so a replay carries its
+// own.
+func headerChanges(before, after http.Header) http.Header {
+	changed := make(http.Header)
+	for key, values := range after {
+		if previous, ok := before[key]; ok && equalHeaderValues(previous, values) {
+			continue
+		}
+		changed[key] = append([]string(nil), values...)
+	}
+	return changed
+}
+
+func equalHeaderValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Router) idempotencyClientKey(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		return "auth:" + auth
+	}
+	return "ip:" + ClientIP(req, r.trustedProxies)
+}
+
+func hashIdempotencyParts(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
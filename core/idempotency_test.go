@@ -0,0 +1,194 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chargeAPI registers POST /api/charges, which counts how often it runs.
+func chargeAPI(calls *int32, options core.IdempotencyOptions) goatest.Option {
+	return withAPI("/api/charges", http.MethodPost, func(ctx *core.APIContext) {
+		n := atomic.AddInt32(calls, 1)
+		ctx.Writer.Header().Set("Location", "/api/charges/1")
+		ctx.Success(map[string]int32{"charge": n}, http.StatusCreated)
+	}, core.WithIdempotencyOptions(options))
+}
+
+func postCharge(app *goatest.App, key, body string) *goatest.Response {
+	return app.Request(http.MethodPost, "/api/charges", strings.NewReader(body),
+		"Content-Type", "application/json", core.IdempotencyKeyHeader, key)
+}
+
+func TestIdempotencyReplaysTheStoredResponse(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{}))
+
+	first := postCharge(app, "k1", `{"amount":5}`).AssertStatus(http.StatusCreated)
+	replay := postCharge(app, "k1", `{"amount":5}`).
+		AssertStatus(http.StatusCreated).
+		AssertHeader("Idempotent-Replayed", "true").
+		AssertHeader("Location", "/api/charges/1")
+
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	if replay.String() != first.String() {
+		t.Errorf("replayed body = %s, want %s", replay.String(), first.String())
+	}
+	if first.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("first response marked as a replay")
+	}
+	firstID, replayID := first.Header.Get(core.RequestIDHeader), replay.Header.Get(core.RequestIDHeader)
+	if firstID == "" || replayID == "" || firstID == replayID {
+		t.Errorf("request ids = %q and %q, want a fresh one on replay", firstID, replayID)
+	}
+	if got := len(replay.Header.Values(core.RequestIDHeader)); got != 1 {
+		t.Errorf("replay carries %d request ids", got)
+	}
+
+	postCharge(app, "k2", `{"amount":5}`).AssertStatus(http.StatusCreated)
+	if calls != 2 {
+		t.Errorf("a new key should run the handler again, calls = %d", calls)
+	}
+}
+
+func TestIdempotencyRejectsADifferentBody(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{}))
+
+	postCharge(app, "k1", `{"amount":5}`).AssertStatus(http.StatusCreated)
+	data := postCharge(app, "k1", `{"amount":500}`).AssertStatus(http.StatusUnprocessableEntity).Data(nil)
+	if data.Error != core.ErrIdempotencyMismatch.Error() {
+		t.Errorf("error = %q", data.Error)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyRequiredKey(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{Required: true}))
+
+	app.PostJSON("/api/charges", map[string]int{"amount": 5}).AssertStatus(http.StatusBadRequest)
+	if calls != 0 {
+		t.Errorf("handler ran without a key")
+	}
+	postCharge(app, "k1", `{}`).AssertStatus(http.StatusCreated)
+}
+
+func TestIdempotencyWithoutKeyIsOptional(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{}))
+
+	app.PostJSON("/api/charges", nil).AssertStatus(http.StatusCreated)
+	app.PostJSON("/api/charges", nil).AssertStatus(http.StatusCreated)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestIdempotencyConflictWhileInProgress(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	app := newTestApp(t, withAPI("/api/slow", http.MethodPost, func(ctx *core.APIContext) {
+		close(entered)
+		<-release
+		ctx.Success("done", http.StatusOK)
+	}, core.WithIdempotency(time.Hour)))
+
+	send := func() *goatest.Response {
+		return app.Request(http.MethodPost, "/api/slow", strings.NewReader("{}"), core.IdempotencyKeyHeader, "k1")
+	}
+
+	done := make(chan *goatest.Response)
+	go func() { done <- send() }()
+	<-entered
+
+	send().AssertStatus(http.StatusConflict)
+	close(release)
+	(<-done).AssertStatus(http.StatusOK)
+	send().AssertStatus(http.StatusOK).AssertHeader("Idempotent-Replayed", "true")
+}
+
+func TestIdempotencyRejectsOversizedBodies(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{MaxBodyBytes: 16}))
+
+	data := postCharge(app, "k1", `{"note":"far more than sixteen bytes"}`).
+		AssertStatus(http.StatusRequestEntityTooLarge).Data(nil)
+	if data.Error != "Request body too large" {
+		t.Errorf("error = %q", data.Error)
+	}
+	if calls != 0 {
+		t.Error("handler ran for an oversized body")
+	}
+	postCharge(app, "k1", `{}`).AssertStatus(http.StatusCreated)
+}
+
+func TestIdempotencyServerErrorsAreNotStored(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, withAPI("/api/flaky", http.MethodPost, func(ctx *core.APIContext) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			ctx.Error("upstream down", http.StatusBadGateway)
+			return
+		}
+		ctx.Success("ok", http.StatusOK)
+	}, core.WithIdempotency(time.Hour)))
+
+	send := func() *goatest.Response {
+		return app.Request(http.MethodPost, "/api/flaky", strings.NewReader("{}"), core.IdempotencyKeyHeader, "k1")
+	}
+	send().AssertStatus(http.StatusBadGateway)
+	send().AssertStatus(http.StatusOK)
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want a retry after the 502", calls)
+	}
+}
+
+func TestIdempotencyKeysAreScopedPerClient(t *testing.T) {
+	var calls int32
+	app := newTestApp(t, chargeAPI(&calls, core.IdempotencyOptions{}), goatest.WithConfig(func(c *core.Config) {
+		c.TrustedProxies = []string{"10.0.0.0/8"}
+	}))
+
+	fromClient := func(remoteAddr, forwardedFor, auth string) *goatest.Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/charges", strings.NewReader("{}"))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(core.IdempotencyKeyHeader, "shared")
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		return app.Do(req)
+	}
+
+	fromClient("198.51.100.1:1000", "", "")
+	fromClient("198.51.100.1:2000", "", "").AssertHeader("Idempotent-Replayed", "true")
+	fromClient("198.51.100.2:1000", "", "").AssertHeader("Idempotent-Replayed", "")
+	if calls != 2 {
+		t.Fatalf("calls = %d, want one per client address", calls)
+	}
+
+	// Behind a trusted proxy the forwarded address identifies the client.
+	fromClient("10.0.0.1:80", "203.0.113.7", "")
+	fromClient("10.0.0.2:80", "203.0.113.7", "").AssertHeader("Idempotent-Replayed", "true")
+	fromClient("10.0.0.1:80", "203.0.113.8", "").AssertHeader("Idempotent-Replayed", "")
+	if calls != 4 {
+		t.Fatalf("calls = %d, want one per forwarded client", calls)
+	}
+
+	fromClient("198.51.100.1:1000", "", "Bearer a")
+	fromClient("198.51.100.9:1000", "", "Bearer a").AssertHeader("Idempotent-Replayed", "true")
+	if calls != 5 {
+		t.Errorf("calls = %d, want the credential to identify the client", calls)
+	}
+}
@@ -0,0 +1,67 @@
+package core_test
+
+import (
+	"fmt"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAppsRenderWithTheirOwnConfig(t *testing.T) {
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+				c.AppName = name
+				c.TemplateCache = true
+			}))
+
+			app.Get("/instance").AssertStatus(http.StatusOK).AssertText("p.app", name)
+			app.Get("/instance").
+				AssertHeader("X-Template-Cached", "true").
+				AssertText("p.app", name)
+		})
+	}
+}
+
+var lateRegistrations int32
+
+func TestAppsCopyTheDefaultRegistryWhenCreated(t *testing.T) {
+	// The default registry outlives the test, so each run registers a new path.
+	path := fmt.Sprintf("/api/instance/late-%d", atomic.AddInt32(&lateRegistrations, 1))
+	before := goatest.New(t, "testdata/app")
+
+	core.RegisterAPIHandler(path, http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success("registered", http.StatusOK)
+	})
+	after := goatest.New(t, "testdata/app")
+
+	after.Get(path).AssertStatus(http.StatusOK)
+	before.Get(path).AssertStatus(http.StatusNotFound)
+
+	after.App.Router.API.Clear()
+	after.Get(path).AssertStatus(http.StatusNotFound)
+	goatest.New(t, "testdata/app").Get(path).AssertStatus(http.StatusOK)
+}
+
+func TestAppsKeepTheirOwnErrorState(t *testing.T) {
+	tripped := newTestApp(t, goatest.WithConfig(breakerConfig))
+	healthy := newTestApp(t, goatest.WithConfig(breakerConfig))
+
+	tripped.Get("/flaky/fail").AssertStatus(http.StatusInternalServerError)
+	tripped.Get("/flaky/fail").AssertStatus(http.StatusInternalServerError)
+	if tripped.Get("/flaky/ok").Header.Get("Retry-After") == "" {
+		t.Fatal("page circuit did not open")
+	}
+
+	healthy.Get("/flaky/ok").AssertStatus(http.StatusOK).AssertText("p.mode", "ok")
+	if healthy.App.Router.Errors.HasPageError("/flaky/[mode]") {
+		t.Error("healthy app sees the other app's page error")
+	}
+
+	tripped.App.ResetErrors()
+	tripped.Get("/flaky/ok").AssertStatus(http.StatusOK)
+}
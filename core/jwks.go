@@ -0,0 +1,408 @@
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwksRetryInterval limits how often an unknown key id can trigger a fetch.
+const jwksRetryInterval = time.Minute
+
+type jwtKey struct {
+	id     string
+	secret []byte
+	public crypto.PublicKey
+}
+
+// algorithm returns the only signing algorithm the key may be used with, so a
+// token cannot pick, say, HS256 with an RSA public key as the secret.
+func (k jwtKey) algorithm() string {
+	switch key := k.public.(type) {
+	case *rsa.PublicKey:
+		return "RS256"
+	case *ecdsa.PublicKey:
+		if key.Curve == elliptic.P256() {
+			return "ES256"
+		}
+		return ""
+	}
+	if k.secret != nil {
+		return "HS256"
+	}
+	return ""
+}
+
+// KeySet holds the keys JWTs are verified with: HMAC secrets and RSA or P-256
+// public keys, loaded directly, from a JWKS or PEM file, or from a JWKS URL
+// that is refreshed periodically and whenever a token names an unknown key.
+// Remote fetches run outside the lock, one at a time, and replace the cached
+// keys only once they succeed.
+type KeySet struct {
+	mutex sync.RWMutex
+	local []jwtKey
+	keys  []jwtKey
+
+	url          string
+	fallbackFile string
+	refresh      time.Duration
+	client       *http.Client
+	fetched      time.Time
+	lastAttempt  time.Time
+	inFlight     *jwksFetch
+	logger       *AppLogger
+}
+
+// jwksFetch is a remote fetch in progress; done is closed once its result has
+// been applied and err is set.
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// AddSecret adds an HS256 secret. kid may be empty.
+func (ks *KeySet) AddSecret(kid string, secret []byte) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.local = append(ks.local, jwtKey{id: kid, secret: append([]byte(nil), secret...)})
+}
+
+// AddPublicKey adds an RSA or P-256 ECDSA public key. kid may be empty.
+func (ks *KeySet) AddPublicKey(kid string, key crypto.PublicKey) error {
+	k := jwtKey{id: kid, public: key}
+	if k.algorithm() == "" {
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.local = append(ks.local, k)
+	return nil
+}
+
+// LoadFile adds the keys in a JWKS document or PEM file.
+func (ks *KeySet) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseKeyFile(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse key file %s: %w", path, err)
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.local = append(ks.local, keys...)
+	return nil
+}
+
+// SetRemote fetches keys from a JWKS URL every refresh interval. Until the
+// first successful fetch, and whenever fetching fails with no keys cached,
+// fallbackFile (if set) is used instead.
+func (ks *KeySet) SetRemote(url string, fallbackFile string, refresh time.Duration) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	ks.url = url
+	ks.fallbackFile = fallbackFile
+	ks.refresh = refresh
+	ks.fetched = time.Time{}
+	ks.lastAttempt = time.Time{}
+	ks.inFlight = nil
+}
+
+// Refresh fetches the remote key set now, or waits for the fetch already in
+// progress.
+func (ks *KeySet) Refresh() error {
+	ks.mutex.Lock()
+	if ks.url == "" {
+		ks.mutex.Unlock()
+		return nil
+	}
+	fetch := ks.startFetchLocked()
+	ks.mutex.Unlock()
+
+	<-fetch.done
+	return fetch.err
+}
+
+// startFetchLocked starts a remote fetch in the background unless one is
+// already running, and returns it. The caller holds ks.mutex for writing.
+func (ks *KeySet) startFetchLocked() *jwksFetch {
+	if ks.inFlight != nil {
+		return ks.inFlight
+	}
+
+	fetch := &jwksFetch{done: make(chan struct{})}
+	ks.inFlight = fetch
+	ks.lastAttempt = time.Now()
+
+	url, fallbackFile, client := ks.url, ks.fallbackFile, ks.client
+	go func() {
+		defer close(fetch.done)
+
+		keys, err := fetchJWKS(client, url)
+		var fallback []jwtKey
+		if err != nil && fallbackFile != "" {
+			if content, fileErr := os.ReadFile(fallbackFile); fileErr == nil {
+				fallback, _ = parseKeyFile(content)
+			}
+		}
+
+		ks.mutex.Lock()
+		defer ks.mutex.Unlock()
+		if ks.inFlight == fetch {
+			ks.inFlight = nil
+		}
+		fetch.err = err
+
+		if ks.url != url {
+			return
+		}
+		if err == nil {
+			ks.keys = keys
+			ks.fetched = time.Now()
+			return
+		}
+		if ks.logger != nil {
+			ks.logger.Warn("Failed to fetch JWKS", "url", url, "error", err)
+		}
+		if len(ks.keys) == 0 && fallback != nil {
+			ks.keys = fallback
+		}
+	}()
+	return fetch
+}
+
+func fetchJWKS(client *http.Client, url string) ([]jwtKey, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(body, false)
+}
+
+// candidates returns the keys that may verify a token signed with alg under
+// kid. A stale remote set is refreshed in the background while the cached keys
+// keep serving; only a token whose key is missing waits for the fetch.
+func (ks *KeySet) candidates(kid string, alg string) []jwtKey {
+	ks.mutex.RLock()
+	keys := ks.match(kid, alg)
+	remote := ks.url != ""
+	stale := remote && (ks.fetched.IsZero() || time.Since(ks.fetched) > ks.refresh)
+	canRetry := ks.inFlight != nil || time.Since(ks.lastAttempt) > jwksRetryInterval
+	ks.mutex.RUnlock()
+
+	if !(stale || len(keys) == 0) || !remote || !canRetry {
+		return keys
+	}
+
+	ks.mutex.Lock()
+	var fetch *jwksFetch
+	if ks.url != "" && (ks.inFlight != nil || time.Since(ks.lastAttempt) > jwksRetryInterval) {
+		fetch = ks.startFetchLocked()
+	}
+	ks.mutex.Unlock()
+
+	if fetch == nil || len(keys) > 0 {
+		return keys
+	}
+
+	<-fetch.done
+	ks.mutex.RLock()
+	defer ks.mutex.RUnlock()
+	return ks.match(kid, alg)
+}
+
+func (ks *KeySet) match(kid string, alg string) []jwtKey {
+	var matched []jwtKey
+	for _, list := range [][]jwtKey{ks.local, ks.keys} {
+		for _, key := range list {
+			if key.algorithm() != alg {
+				continue
+			}
+			if kid != "" && key.id != "" && key.id != kid {
+				continue
+			}
+			matched = append(matched, key)
+		}
+	}
+	return matched
+}
+
+func parseKeyFile(content []byte) ([]jwtKey, error) {
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseJWKS(trimmed, true)
+	}
+	return parsePEMKeys(trimmed)
+}
+
+func parsePEMKeys(content []byte) ([]jwtKey, error) {
+	var keys []jwtKey
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+
+		var public crypto.PublicKey
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				public = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		key := jwtKey{public: public}
+		if key.algorithm() == "" {
+			return nil, fmt.Errorf("unsupported public key type %T", public)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+	return keys, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS reads a JWK Set, skipping encryption keys and key types it cannot
+// verify with. Symmetric "oct" keys are only read when allowSecrets is set:
+// a JWKS URL is public, so a secret served from one would let anyone sign.
+func parseJWKS(content []byte, allowSecrets bool) ([]jwtKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+
+	var keys []jwtKey
+	for _, raw := range set.Keys {
+		if raw.Use == "enc" || (raw.Kty == "oct" && !allowSecrets) {
+			continue
+		}
+
+		key, err := raw.key()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", raw.Kid, err)
+		}
+		if key.algorithm() == "" || (raw.Alg != "" && raw.Alg != key.algorithm()) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (j jwk) key() (jwtKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch j.Kty {
+	case "oct":
+		secret, err := decode(j.K)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		return jwtKey{id: j.Kid, secret: secret}, nil
+
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return jwtKey{}, errors.New("invalid RSA exponent")
+		}
+		return jwtKey{id: j.Kid, public: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+
+	case "EC":
+		if j.Crv != "P-256" {
+			return jwtKey{}, nil
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return jwtKey{}, err
+		}
+		if len(x) != 32 || len(y) != 32 {
+			return jwtKey{}, errors.New("invalid P-256 coordinates")
+		}
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return jwtKey{}, errors.New("point is not on the P-256 curve")
+		}
+		return jwtKey{id: j.Kid, public: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	}
+
+	return jwtKey{}, nil
+}
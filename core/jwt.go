@@ -0,0 +1,450 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenMalformed    = errors.New("token is malformed")
+	ErrTokenAlgorithm    = errors.New("token algorithm is not accepted")
+	ErrTokenUnknownKey   = errors.New("no key matches the token")
+	ErrTokenSignature    = errors.New("token signature is invalid")
+	ErrTokenExpired      = errors.New("token has expired")
+	ErrTokenNotYetValid  = errors.New("token is not valid yet")
+	ErrTokenIssuer       = errors.New("token issuer is not accepted")
+	ErrTokenAudience     = errors.New("token audience is not accepted")
+	DefaultJWTAlgorithms = []string{"HS256", "RS256", "ES256"}
+)
+
+// Claims are the verified claims of a JWT. Numbers are json.Number.
+type Claims map[string]interface{}
+
+func (c Claims) String(name string) string {
+	value, _ := c[name].(string)
+	return value
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+func (c Claims) Audience() []string {
+	return claimList(c["aud"], "")
+}
+
+// Roles returns the "roles" claim, a JSON array or a comma-separated string.
+func (c Claims) Roles() []string {
+	return claimList(c["roles"], ",")
+}
+
+// Scopes returns the OAuth scopes from the space-separated "scope" claim or
+// the "scp" list.
+func (c Claims) Scopes() []string {
+	if scopes := claimList(c["scope"], " "); len(scopes) > 0 {
+		return scopes
+	}
+	return claimList(c["scp"], " ")
+}
+
+func (c Claims) HasRole(role string) bool {
+	return containsString(c.Roles(), role)
+}
+
+func (c Claims) HasScope(scope string) bool {
+	return containsString(c.Scopes(), scope)
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	number, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+func (c Claims) ExpiresAt() time.Time {
+	t, _ := c.time("exp")
+	return t
+}
+
+// claimList reads a claim that may be a JSON array or a string split on sep.
+func claimList(value interface{}, sep string) []string {
+	switch v := value.(type) {
+	case string:
+		if sep == "" {
+			return []string{v}
+		}
+		var list []string
+		for _, item := range strings.Split(v, sep) {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+type JWTOptions struct {
+	// Algorithms limits the accepted "alg" values. Defaults to
+	// DefaultJWTAlgorithms.
+	Algorithms []string
+
+	// Issuer, when set, must equal the "iss" claim. Audience, when set, must
+	// share at least one value with the "aud" claim.
+	Issuer   string
+	Audience []string
+
+	// Leeway tolerates clock skew when checking "exp" and "nbf".
+	Leeway time.Duration
+}
+
+type JWTVerifier struct {
+	keys    *KeySet
+	options JWTOptions
+}
+
+func NewJWTVerifier(keys *KeySet, options JWTOptions) *JWTVerifier {
+	if len(options.Algorithms) == 0 {
+		options.Algorithms = DefaultJWTAlgorithms
+	}
+	return &JWTVerifier{keys: keys, options: options}
+}
+
+// newJWTVerifierFromConfig builds the router's verifier. The HS256 secret comes
+// from Config.JWTSecret or GOA_JWT_SECRET; public keys from Config.JWTKeyFile
+// and Config.JWTJWKSURL, with the key file as the URL's fallback.
+func newJWTVerifierFromConfig(config *Config, logger *AppLogger) (*JWTVerifier, error) {
+	keys := NewKeySet()
+	keys.logger = logger
+
+	secret := config.JWTSecret
+	if secret == "" {
+		secret = os.Getenv("GOA_JWT_SECRET")
+	}
+	if secret != "" {
+		keys.AddSecret("", []byte(secret))
+	}
+
+	if config.JWTJWKSURL != "" {
+		keys.SetRemote(config.JWTJWKSURL, config.JWTKeyFile, config.JWTJWKSRefresh)
+		keys.Refresh()
+	} else if config.JWTKeyFile != "" {
+		if err := keys.LoadFile(config.JWTKeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if secret == "" && config.JWTKeyFile == "" && config.JWTJWKSURL == "" {
+		return nil, errors.New("no JWT secret, key file or JWKS URL configured")
+	}
+
+	return NewJWTVerifier(keys, JWTOptions{
+		Algorithms: config.JWTAlgorithms,
+		Issuer:     config.JWTIssuer,
+		Audience:   config.JWTAudience,
+		Leeway:     config.JWTLeeway,
+	}), nil
+}
+
+// Verify checks token's signature and its exp, nbf, iss and aud claims and
+// returns its claims.
+func (v *JWTVerifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	if !containsString(v.options.Algorithms, header.Alg) {
+		return nil, ErrTokenAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	keys := v.keys.candidates(header.Kid, header.Alg)
+	if len(keys) == 0 {
+		return nil, ErrTokenUnknownKey
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if verifySignature(header.Alg, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var claims Claims
+	if err := decoder.Decode(&claims); err != nil || claims == nil {
+		return nil, ErrTokenMalformed
+	}
+
+	if err := v.validate(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *JWTVerifier) validate(claims Claims, now time.Time) error {
+	if _, present := claims["exp"]; present {
+		exp, ok := claims.time("exp")
+		if !ok {
+			return ErrTokenMalformed
+		}
+		if !now.Before(exp.Add(v.options.Leeway)) {
+			return ErrTokenExpired
+		}
+	}
+
+	if _, present := claims["nbf"]; present {
+		nbf, ok := claims.time("nbf")
+		if !ok {
+			return ErrTokenMalformed
+		}
+		if now.Add(v.options.Leeway).Before(nbf) {
+			return ErrTokenNotYetValid
+		}
+	}
+
+	if v.options.Issuer != "" && claims.Issuer() != v.options.Issuer {
+		return ErrTokenIssuer
+	}
+
+	if len(v.options.Audience) > 0 {
+		accepted := false
+		for _, aud := range claims.Audience() {
+			if containsString(v.options.Audience, aud) {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return ErrTokenAudience
+		}
+	}
+
+	return nil
+}
+
+func verifySignature(alg string, key jwtKey, signed []byte, signature []byte) bool {
+	if key.algorithm() != alg {
+		return false
+	}
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case "RS256":
+		return rsa.VerifyPKCS1v15(key.public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(key.public.(*ecdsa.PublicKey), digest[:], r, s)
+	}
+	return false
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer" header or,
+// when cookieName is set, from that cookie.
+func bearerToken(r *http.Request, cookieName string) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if cookieName != "" {
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// Middleware verifies the bearer token, if any, and stores its claims in the
+// request context. Invalid tokens are rejected with 401; requests without one
+// pass through anonymously.
+func (v *JWTVerifier) Middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r, "")
+			if token == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := v.Verify(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+type claimsContextKey struct{}
+
+func WithClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the verified claims of the request's token, or nil
+// for anonymous requests.
+func ClaimsFromContext(ctx context.Context) Claims {
+	claims, _ := ctx.Value(claimsContextKey{}).(Claims)
+	return claims
+}
+
+// AuthRule restricts a route to authenticated users. A user needs at least
+// one of Roles, if any are listed, and every one of Scopes.
+type AuthRule struct {
+	Roles  []string
+	Scopes []string
+}
+
+func WithAuth() APIOption {
+	return func(o *APIRouteOptions) {
+		if o.Auth == nil {
+			o.Auth = &AuthRule{}
+		}
+	}
+}
+
+func WithRoles(roles ...string) APIOption {
+	return func(o *APIRouteOptions) {
+		if o.Auth == nil {
+			o.Auth = &AuthRule{}
+		}
+		o.Auth.Roles = append(o.Auth.Roles, roles...)
+	}
+}
+
+func WithScopes(scopes ...string) APIOption {
+	return func(o *APIRouteOptions) {
+		if o.Auth == nil {
+			o.Auth = &AuthRule{}
+		}
+		o.Auth.Scopes = append(o.Auth.Scopes, scopes...)
+	}
+}
+
+// allows reports whether claims satisfy the rule, and which scopes they lack.
+func (rule *AuthRule) allows(claims Claims) (bool, []string) {
+	if claims == nil {
+		return false, nil
+	}
+
+	if len(rule.Roles) > 0 {
+		hasRole := false
+		for _, role := range rule.Roles {
+			if claims.HasRole(role) {
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			return false, nil
+		}
+	}
+
+	var missing []string
+	for _, scope := range rule.Scopes {
+		if !claims.HasScope(scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return len(missing) == 0, missing
+}
+
+// authorize checks req against rule and returns the status to reject it with,
+// or 0. tokenErr is why the request's token, if it had one, was refused.
+func authorize(w http.ResponseWriter, req *http.Request, rule *AuthRule, tokenErr error) int {
+	claims := ClaimsFromContext(req.Context())
+	if claims == nil {
+		if tokenErr != nil {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, tokenErr.Error()))
+		} else {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		return http.StatusUnauthorized
+	}
+
+	ok, missing := rule.allows(claims)
+	if ok {
+		return 0
+	}
+	if len(missing) > 0 {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(rule.Scopes, " ")))
+	}
+	return http.StatusForbidden
+}
@@ -0,0 +1,523 @@
+package core_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const jwtSecret = "jwt-secret-0123456789abcdef0123456789"
+
+// signJWT builds a compact JWT. key is a []byte secret for HS256, or an RSA or
+// P-256 private key.
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	encode := func(v interface{}) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func claimsFor(subject string, extra ...interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": subject,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		claims[extra[i].(string)] = extra[i+1]
+	}
+	return claims
+}
+
+func TestJWTVerifiesEachAlgorithm(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	keys := core.NewKeySet()
+	keys.AddSecret("", []byte(jwtSecret))
+	if err := keys.AddPublicKey("rsa", &rsaKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.AddPublicKey("ec", &ecKey.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err := keys.AddPublicKey("p384", &p384.PublicKey); err == nil {
+		t.Error("a P-384 key was accepted for ES256")
+	}
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{})
+
+	tokens := map[string]string{
+		"HS256": signJWT(t, "HS256", "", []byte(jwtSecret), claimsFor("hs")),
+		"RS256": signJWT(t, "RS256", "rsa", rsaKey, claimsFor("rs")),
+		"ES256": signJWT(t, "ES256", "ec", ecKey, claimsFor("es")),
+	}
+	for alg, token := range tokens {
+		claims, err := verifier.Verify(token)
+		if err != nil || claims.Subject() != strings.ToLower(alg[:2]) {
+			t.Errorf("%s: Verify = %v, %v", alg, claims, err)
+		}
+
+		tampered := token[:strings.LastIndex(token, ".")] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 64))
+		if _, err := verifier.Verify(tampered); err != core.ErrTokenSignature {
+			t.Errorf("%s: tampered signature = %v", alg, err)
+		}
+	}
+
+	// A token cannot choose HS256 and use the RSA public key as its secret.
+	publicDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	rsaOnly := core.NewKeySet()
+	rsaOnly.AddPublicKey("rsa", &rsaKey.PublicKey)
+	confused := signJWT(t, "HS256", "rsa", publicDER, claimsFor("mallory"))
+	if _, err := core.NewJWTVerifier(rsaOnly, core.JWTOptions{}).Verify(confused); err != core.ErrTokenUnknownKey {
+		t.Errorf("algorithm confusion = %v, want ErrTokenUnknownKey", err)
+	}
+
+	rs256Only := core.NewJWTVerifier(keys, core.JWTOptions{Algorithms: []string{"RS256"}})
+	if _, err := rs256Only.Verify(tokens["HS256"]); err != core.ErrTokenAlgorithm {
+		t.Errorf("disallowed algorithm = %v", err)
+	}
+	unsigned := strings.Join(strings.Split(signJWT(t, "none", "", nil, claimsFor("x")), ".")[:2], ".") + "."
+	if _, err := verifier.Verify(unsigned); err != core.ErrTokenAlgorithm {
+		t.Errorf("alg none = %v", err)
+	}
+}
+
+func TestJWTValidatesClaims(t *testing.T) {
+	keys := core.NewKeySet()
+	keys.AddSecret("", []byte(jwtSecret))
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{
+		Issuer:   "https://auth.example.com",
+		Audience: []string{"shop", "admin"},
+		Leeway:   30 * time.Second,
+	})
+
+	now := time.Now().Unix()
+	valid := map[string]interface{}{"iss": "https://auth.example.com", "aud": "shop", "exp": now + 60}
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := map[string]interface{}{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   error
+	}{
+		{"valid", valid, nil},
+		{"no expiry", with("exp", nil), nil},
+		{"expired", with("exp", now-60), core.ErrTokenExpired},
+		{"expired within leeway", with("exp", now-10), nil},
+		{"not yet valid", with("nbf", now+60), core.ErrTokenNotYetValid},
+		{"nbf within leeway", with("nbf", now+10), nil},
+		{"fractional exp", with("exp", float64(now)+60.5), nil},
+		{"exp not a number", with("exp", "tomorrow"), core.ErrTokenMalformed},
+		{"wrong issuer", with("iss", "https://evil.example.com"), core.ErrTokenIssuer},
+		{"missing issuer", with("iss", nil), core.ErrTokenIssuer},
+		{"audience list", with("aud", []string{"billing", "admin"}), nil},
+		{"wrong audience", with("aud", "billing"), core.ErrTokenAudience},
+		{"missing audience", with("aud", nil), core.ErrTokenAudience},
+	}
+
+	for _, tt := range tests {
+		if _, err := verifier.Verify(signJWT(t, "HS256", "", []byte(jwtSecret), tt.claims)); err != tt.want {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	for _, garbage := range []string{"", "a.b", "a.b.c", "!!.e30.sig"} {
+		if _, err := verifier.Verify(garbage); err != core.ErrTokenMalformed {
+			t.Errorf("Verify(%q) = %v, want ErrTokenMalformed", garbage, err)
+		}
+	}
+}
+
+func TestJWTKeyIDSelectsKey(t *testing.T) {
+	keys := core.NewKeySet()
+	keys.AddSecret("2023", []byte(jwtSecret))
+	keys.AddSecret("2024", []byte(strings.ToUpper(jwtSecret)))
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{})
+
+	current := []byte(strings.ToUpper(jwtSecret))
+	if _, err := verifier.Verify(signJWT(t, "HS256", "2024", current, claimsFor("a"))); err != nil {
+		t.Errorf("token with kid 2024 = %v", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "HS256", "", current, claimsFor("a"))); err != nil {
+		t.Errorf("token without kid = %v, want every key tried", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "HS256", "2023", current, claimsFor("a"))); err != core.ErrTokenSignature {
+		t.Errorf("token naming the wrong kid = %v", err)
+	}
+}
+
+func jwkFor(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+
+	raw, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWTKeyFiles(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	dir := t.TempDir()
+
+	jwksPath := filepath.Join(dir, "jwks.json")
+	encryption := jwkFor("enc", &rsaKey.PublicKey)
+	encryption["use"] = "enc"
+	writeJWKS(t, jwksPath, jwkFor("sig", &rsaKey.PublicKey), encryption)
+
+	ecDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	pemPath := filepath.Join(dir, "keys.pem")
+	os.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecDER}), 0644)
+
+	keys := core.NewKeySet()
+	for _, path := range []string{jwksPath, pemPath} {
+		if err := keys.LoadFile(path); err != nil {
+			t.Fatalf("LoadFile(%s) = %v", path, err)
+		}
+	}
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{})
+
+	if _, err := verifier.Verify(signJWT(t, "RS256", "sig", rsaKey, claimsFor("a"))); err != nil {
+		t.Errorf("JWKS key = %v", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "RS256", "enc", rsaKey, claimsFor("a"))); err != core.ErrTokenSignature && err != core.ErrTokenUnknownKey {
+		t.Errorf("encryption key used for signatures: %v", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "ES256", "", ecKey, claimsFor("a"))); err != nil {
+		t.Errorf("PEM key = %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "empty.pem"), []byte("nothing here"), 0644)
+	if err := keys.LoadFile(filepath.Join(dir, "empty.pem")); err == nil {
+		t.Error("a file without keys loaded")
+	}
+}
+
+// jwksServer serves a JWKS document that the test can swap, counting fetches.
+type jwksServer struct {
+	*httptest.Server
+	document atomic.Value
+	fetches  int32
+	gate     chan struct{}
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]string) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{}
+	s.set(keys...)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.fetches, 1)
+		if s.gate != nil {
+			<-s.gate
+		}
+		w.Write(s.document.Load().([]byte))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(keys ...map[string]string) {
+	raw, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	s.document.Store(raw)
+}
+
+func TestJWKSURL(t *testing.T) {
+	first, _ := rsa.GenerateKey(rand.Reader, 2048)
+	second, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor("k1", &first.PublicKey))
+
+	keys := core.NewKeySet()
+	keys.SetRemote(server.URL, "", time.Hour)
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{})
+
+	if _, err := verifier.Verify(signJWT(t, "RS256", "k1", first, claimsFor("a"))); err != nil {
+		t.Fatalf("first token = %v", err)
+	}
+	verifier.Verify(signJWT(t, "RS256", "k1", first, claimsFor("a")))
+	if fetches := atomic.LoadInt32(&server.fetches); fetches != 1 {
+		t.Errorf("fetched %d times, want the key set cached", fetches)
+	}
+
+	server.set(jwkFor("k2", &second.PublicKey))
+	if err := keys.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "RS256", "k2", second, claimsFor("a"))); err != nil {
+		t.Errorf("rotated key = %v", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "RS256", "k1", first, claimsFor("a"))); err == nil {
+		t.Error("a key dropped from the JWKS still verifies")
+	}
+}
+
+func TestJWKSURLIgnoresSecrets(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	secret := map[string]string{"kty": "oct", "kid": "shared", "alg": "HS256", "k": base64.RawURLEncoding.EncodeToString([]byte(jwtSecret))}
+	server := newJWKSServer(t, secret, jwkFor("k1", &rsaKey.PublicKey))
+
+	keys := core.NewKeySet()
+	keys.SetRemote(server.URL, "", time.Hour)
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{Algorithms: []string{"HS256", "RS256"}})
+
+	if _, err := verifier.Verify(signJWT(t, "RS256", "k1", rsaKey, claimsFor("a"))); err != nil {
+		t.Fatalf("RS256 token = %v", err)
+	}
+	if _, err := verifier.Verify(signJWT(t, "HS256", "shared", []byte(jwtSecret), claimsFor("a"))); err == nil {
+		t.Error("a token signed with a secret published in a remote JWKS verified")
+	}
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, file, secret)
+	local := core.NewKeySet()
+	if err := local.LoadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.NewJWTVerifier(local, core.JWTOptions{Algorithms: []string{"HS256"}}).Verify(signJWT(t, "HS256", "shared", []byte(jwtSecret), claimsFor("a"))); err != nil {
+		t.Errorf("a secret from a local key file = %v", err)
+	}
+}
+
+func TestJWTWithoutKeysFailsInit(t *testing.T) {
+	t.Setenv("GOA_JWT_SECRET", "")
+	config := core.DefaultConfig()
+	config.AppDir = "testdata/app"
+	config.JWTEnabled = true
+
+	app := core.NewAppWithConfig(config)
+	app.Logger.SetOutput(io.Discard)
+	defer app.Shutdown(context.Background())
+
+	if err := app.Init(); err == nil || !strings.Contains(err.Error(), "JWT") {
+		t.Fatalf("Init with JWT enabled and no keys = %v, want a configuration error", err)
+	}
+}
+
+func TestJWKSURLFallsBackToFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	fallback := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, fallback, jwkFor("k1", &rsaKey.PublicKey))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	keys := core.NewKeySet()
+	keys.SetRemote(server.URL, fallback, time.Hour)
+	if err := keys.Refresh(); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("Refresh = %v, want the fetch error", err)
+	}
+	if _, err := core.NewJWTVerifier(keys, core.JWTOptions{}).Verify(signJWT(t, "RS256", "k1", rsaKey, claimsFor("a"))); err != nil {
+		t.Errorf("token after failed fetch = %v, want the fallback file used", err)
+	}
+}
+
+func TestJWKSFetchDoesNotBlockVerification(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, jwkFor("k1", &rsaKey.PublicKey))
+	server.gate = make(chan struct{})
+
+	keys := core.NewKeySet()
+	keys.AddSecret("", []byte(jwtSecret))
+	keys.SetRemote(server.URL, "", time.Hour)
+	verifier := core.NewJWTVerifier(keys, core.JWTOptions{})
+
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- keys.Refresh() }()
+	for atomic.LoadInt32(&server.fetches) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The fetch is stuck in flight; tokens with a cached key and writers to the
+	// key set must not wait for it.
+	done := make(chan error, 1)
+	go func() {
+		keys.AddSecret("extra", []byte(jwtSecret))
+		_, err := verifier.Verify(signJWT(t, "HS256", "", []byte(jwtSecret), claimsFor("a")))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Verify during fetch = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("verification waited for the JWKS fetch")
+	}
+
+	close(server.gate)
+	if err := <-refreshed; err != nil {
+		t.Errorf("Refresh = %v", err)
+	}
+}
+
+func jwtApp(t *testing.T, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	whoami := func(ctx *core.APIContext) {
+		ctx.Success(ctx.User().Subject(), http.StatusOK)
+	}
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.JWTEnabled = true
+		c.JWTSecret = jwtSecret
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/public", http.MethodGet, whoami)
+		app.Router.RegisterAPIHandler("/api/me", http.MethodGet, whoami, core.WithAuth())
+		app.Router.RegisterAPIHandler("/api/admin", http.MethodGet, whoami, core.WithRoles("admin", "owner"))
+		app.Router.RegisterAPIHandler("/api/orders", http.MethodPost, whoami, core.WithScopes("orders:read", "orders:write"))
+	})}, opts...)
+	return newTestApp(t, opts...)
+}
+
+func bearer(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	return "Bearer " + signJWT(t, "HS256", "", []byte(jwtSecret), claims)
+}
+
+func TestJWTProtectsRoutes(t *testing.T) {
+	app := jwtApp(t)
+
+	var subject string
+	app.Get("/api/public").AssertStatus(http.StatusOK)
+	app.Request(http.MethodGet, "/api/public", nil, "Authorization", "Bearer junk").AssertStatus(http.StatusOK)
+
+	app.Get("/api/me").AssertStatus(http.StatusUnauthorized).AssertHeader("WWW-Authenticate", "Bearer")
+	app.Request(http.MethodGet, "/api/me", nil, "Authorization", bearer(t, claimsFor("ada", "exp", time.Now().Add(-time.Hour).Unix()))).
+		AssertStatus(http.StatusUnauthorized).
+		AssertHeader("WWW-Authenticate", `Bearer error="invalid_token", error_description="token has expired"`)
+	app.Request(http.MethodGet, "/api/me", nil, "Authorization", bearer(t, claimsFor("ada"))).
+		AssertStatus(http.StatusOK).
+		Data(&subject)
+	if subject != "ada" {
+		t.Errorf("ctx.User().Subject() = %q", subject)
+	}
+
+	app.Request(http.MethodGet, "/api/admin", nil, "Authorization", bearer(t, claimsFor("ada", "roles", []string{"viewer"}))).
+		AssertStatus(http.StatusForbidden)
+	app.Request(http.MethodGet, "/api/admin", nil, "Authorization", bearer(t, claimsFor("ada", "roles", "viewer, owner"))).
+		AssertStatus(http.StatusOK)
+
+	app.Request(http.MethodPost, "/api/orders", nil, "Authorization", bearer(t, claimsFor("ada", "scope", "orders:read"))).
+		AssertStatus(http.StatusForbidden).
+		AssertHeader("WWW-Authenticate", `Bearer error="insufficient_scope", scope="orders:read orders:write"`)
+	app.Request(http.MethodPost, "/api/orders", nil, "Authorization", bearer(t, claimsFor("ada", "scp", []string{"orders:write", "orders:read"}))).
+		AssertStatus(http.StatusOK)
+}
+
+func TestJWTFromCookieAndTemplates(t *testing.T) {
+	app := jwtApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.JWTCookieName = "auth"
+	}))
+	token := signJWT(t, "HS256", "", []byte(jwtSecret), claimsFor("grace"))
+
+	app.Request(http.MethodGet, "/api/me", nil, "Cookie", "auth="+token).AssertStatus(http.StatusOK)
+	app.Request(http.MethodGet, "/account", nil, "Authorization", "Bearer "+token).AssertText("p.user", "grace")
+	if text := app.Get("/account").First("p.user").Text(); text != "" {
+		t.Errorf("anonymous page shows user %q", text)
+	}
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	keys := core.NewKeySet()
+	keys.AddSecret("", []byte(jwtSecret))
+	handler := core.NewJWTVerifier(keys, core.JWTOptions{}).Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user=" + core.ClaimsFromContext(r.Context()).Subject()))
+	}))
+
+	tests := []struct {
+		authorization string
+		status        int
+		body          string
+	}{
+		{"", http.StatusOK, "user="},
+		{bearer(t, claimsFor("ada")), http.StatusOK, "user=ada"},
+		{"Bearer not-a-token", http.StatusUnauthorized, "Unauthorized\n"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("Authorization %q = %d %q, want %d %q", tt.authorization, rec.Code, rec.Body.String(), tt.status, tt.body)
+		}
+	}
+}
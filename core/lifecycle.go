@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// LifecycleHook runs when the app starts or shuts down. OnStart hooks receive a
+// context that is cancelled as soon as shutdown begins; OnShutdown hooks receive
+// the drain context and should return before it expires.
+type LifecycleHook func(ctx context.Context) error
+
+func (app *GonAirApp) OnStart(hook LifecycleHook) {
+	app.lifecycleMutex.Lock()
+	defer app.lifecycleMutex.Unlock()
+	app.startHooks = append(app.startHooks, hook)
+}
+
+func (app *GonAirApp) OnShutdown(hook LifecycleHook) {
+	app.lifecycleMutex.Lock()
+	defer app.lifecycleMutex.Unlock()
+	app.shutdownHooks = append(app.shutdownHooks, hook)
+}
+
+// Context is cancelled when the app begins shutting down.
+func (app *GonAirApp) Context() context.Context {
+	return app.ctx
+}
+
+func (app *GonAirApp) runStartHooks() error {
+	app.lifecycleMutex.Lock()
+	hooks := append([]LifecycleHook(nil), app.startHooks...)
+	app.lifecycleMutex.Unlock()
+
+	for i, hook := range hooks {
+		if err := hook(app.ctx); err != nil {
+			return fmt.Errorf("start hook %d failed: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// waitForShutdownSignal blocks until SIGINT/SIGTERM arrives or the server
+// stops on its own, and reports the server's error, if any.
+func (app *GonAirApp) waitForShutdownSignal(serverErr <-chan error) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		app.Logger.Infof("Received %s, shutting down (drain timeout %v)...", sig, app.Config.ShutdownTimeout)
+		return nil
+	case err := <-serverErr:
+		return err
+	}
+}
+
+// Shutdown stops the app in order: the HTTP server stops accepting connections
+// and drains in-flight requests, WebSocket endpoints and the file watcher close,
+// the SSG and metadata workers stop, and finally OnShutdown hooks run in reverse
+// registration order. It is safe to call more than once; later calls return the
+// first call's result.
+func (app *GonAirApp) Shutdown(ctx context.Context) error {
+	app.shutdownOnce.Do(func() {
+		app.shutdownErr = app.shutdown(ctx)
+	})
+	return app.shutdownErr
+}
+
+func (app *GonAirApp) shutdown(ctx context.Context) error {
+	var errs []error
+
+	app.cancel()
+
+	if app.server != nil {
+		if err := app.server.Shutdown(ctx); err != nil {
+			app.Logger.Errorf("HTTP server did not drain cleanly: %v", err)
+			errs = append(errs, fmt.Errorf("http server shutdown: %w", err))
+		} else {
+			app.Logger.Infof("HTTP server drained")
+		}
+	}
+
+	if app.redirectServer != nil {
+		if err := app.redirectServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("http redirect listener shutdown: %w", err))
+		}
+	}
+
+	app.shutdownSockets(ctx)
+
+	if app.FileWatcher != nil {
+		app.FileWatcher.Stop()
+	}
+
+	app.Router.Marley.Stop()
+	app.Logger.Infof("Background workers stopped")
+
+	app.lifecycleMutex.Lock()
+	hooks := append([]LifecycleHook(nil), app.shutdownHooks...)
+	app.lifecycleMutex.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			app.Logger.Errorf("Shutdown hook failed: %v", err)
+			errs = append(errs, err)
+		}
+	}
+
+	if err := app.Router.Tracer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("trace exporter shutdown: %w", err))
+	}
+
+	app.Logger.Infof("Go on Airplanes stopped")
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClient has its own transport because Start replaces http.DefaultTransport.
+// Without keep-alives it never leaves a spare, unused connection open, which
+// server.Shutdown would wait on for several seconds before closing.
+var testClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 5 * time.Second}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+// startApp runs app.Start in the background and waits until it serves
+// requests. The returned channel yields Start's result.
+func startApp(t *testing.T, app *goatest.App) (string, <-chan error) {
+	t.Helper()
+
+	port := freePort(t)
+	app.App.Config.Port = port
+	baseURL := "http://127.0.0.1:" + port
+
+	done := make(chan error, 1)
+	go func() { done <- app.App.Start() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		res, err := testClient.Get(baseURL + "/")
+		if err == nil {
+			res.Body.Close()
+			return baseURL, done
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("Start returned before serving: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server never came up: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestShutdownRunsHooksInReverseOrder(t *testing.T) {
+	app := newTestApp(t)
+
+	var mutex sync.Mutex
+	var order []string
+	record := func(name string, err error) core.LifecycleHook {
+		return func(ctx context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return err
+		}
+	}
+	closeErr := errors.New("pool already closed")
+	app.App.OnShutdown(record("db", nil))
+	app.App.OnShutdown(record("cache", closeErr))
+	app.App.OnShutdown(record("queue", nil))
+
+	if app.App.Context().Err() != nil {
+		t.Fatal("app context cancelled before shutdown")
+	}
+
+	err := app.App.Shutdown(context.Background())
+	if !errors.Is(err, closeErr) {
+		t.Errorf("Shutdown error = %v, want it to include the hook error", err)
+	}
+	if strings.Join(order, ",") != "queue,cache,db" {
+		t.Errorf("hooks ran as %v, want reverse registration order", order)
+	}
+	if app.App.Context().Err() == nil {
+		t.Error("app context still live after shutdown")
+	}
+
+	if again := app.App.Shutdown(context.Background()); again != err {
+		t.Errorf("second Shutdown = %v, want the first result", again)
+	}
+	if len(order) != 3 {
+		t.Errorf("hooks ran %d times, want once each", len(order))
+	}
+}
+
+func TestStartHookFailureAbortsStartup(t *testing.T) {
+	app := newTestApp(t)
+
+	dbDown := errors.New("database unreachable")
+	var started []string
+	var shutdownRan bool
+	app.App.OnStart(func(ctx context.Context) error {
+		started = append(started, "first")
+		return nil
+	})
+	app.App.OnStart(func(ctx context.Context) error {
+		started = append(started, "second")
+		return dbDown
+	})
+	app.App.OnStart(func(ctx context.Context) error {
+		started = append(started, "third")
+		return nil
+	})
+	app.App.OnShutdown(func(ctx context.Context) error {
+		shutdownRan = true
+		return nil
+	})
+
+	app.App.Config.Port = freePort(t)
+	err := app.App.Start()
+	if !errors.Is(err, dbDown) {
+		t.Fatalf("Start = %v, want the hook error", err)
+	}
+	if strings.Join(started, ",") != "first,second" {
+		t.Errorf("start hooks ran as %v, want them to stop at the failure", started)
+	}
+	if !shutdownRan {
+		t.Error("a failed start did not run shutdown hooks")
+	}
+}
@@ -0,0 +1,99 @@
+//go:build unix
+
+package core_test
+
+import (
+	"context"
+	"goonairplanes/core"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalDrainsInFlightRequests(t *testing.T) {
+	// Keep SIGTERM from killing the test binary whether or not Start has
+	// registered its own handler yet.
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	entered := make(chan struct{})
+	app := newTestApp(t, withAPI("/api/slow", http.MethodGet, func(ctx *core.APIContext) {
+		close(entered)
+		time.Sleep(200 * time.Millisecond)
+		ctx.Success("finished", http.StatusOK)
+	}))
+
+	var startCtx context.Context
+	app.App.OnStart(func(ctx context.Context) error {
+		startCtx = ctx
+		return nil
+	})
+	hookRan := make(chan struct{})
+	app.App.OnShutdown(func(ctx context.Context) error {
+		close(hookRan)
+		return nil
+	})
+
+	baseURL, done := startApp(t, app)
+
+	type result struct {
+		status int
+		body   string
+		err    error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		res, err := testClient.Get(baseURL + "/api/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		slow <- result{status: res.StatusCode, body: string(body)}
+	}()
+	<-entered
+
+	var startErr error
+	deadline := time.After(5 * time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+wait:
+	for {
+		select {
+		case startErr = <-done:
+			break wait
+		case <-ticker.C:
+			// Start may not have been listening for the first signal yet.
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		case <-deadline:
+			t.Fatal("Start did not return after SIGTERM")
+		}
+	}
+
+	if startErr != nil {
+		t.Errorf("Start = %v, want a clean shutdown", startErr)
+	}
+	got := <-slow
+	if got.err != nil || got.status != http.StatusOK || !strings.Contains(got.body, "finished") {
+		t.Errorf("in-flight request = %+v, want it to finish", got)
+	}
+	select {
+	case <-hookRan:
+	default:
+		t.Error("OnShutdown hook did not run")
+	}
+	if startCtx == nil || startCtx.Err() == nil {
+		t.Error("OnStart context was not cancelled by shutdown")
+	}
+	if _, err := testClient.Get(baseURL + "/"); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
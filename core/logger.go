@@ -0,0 +1,402 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+type LogLevel int32
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+func ParseLogLevel(level string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", level)
+	}
+}
+
+// AppLogger is a leveled, structured logger. Messages carry key/value fields
+// and are written as text lines in development or as one JSON object per line
+// in production. Loggers derived with With share the level and output of the
+// logger they came from, so SetLevel affects every request logger at once.
+type AppLogger struct {
+	// Deprecated: use Info, Warn and Error (or Infof, Warnf and Errorf). These
+	// remain for existing code and write through the structured logger.
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	WarnLog  *log.Logger
+
+	sink   *logSink
+	fields []interface{}
+}
+
+type logSink struct {
+	level  atomic.Int32
+	mutex  sync.Mutex
+	out    io.Writer
+	json   bool
+	colour bool
+}
+
+// NewLogger creates a logger writing to out at level. format is LogFormatText
+// or LogFormatJSON.
+func NewLogger(out io.Writer, level LogLevel, format string) *AppLogger {
+	sink := &logSink{
+		out:    out,
+		json:   format == LogFormatJSON,
+		colour: format != LogFormatJSON && isTerminal(out),
+	}
+	sink.level.Store(int32(level))
+
+	return newAppLogger(sink, nil)
+}
+
+// newLoggerFromConfig picks the level from config.LogLevel and the format from
+// config.LogFormat, defaulting to text in dev mode and JSON otherwise.
+func newLoggerFromConfig(config *Config) *AppLogger {
+	format := config.LogFormat
+	if format == "" {
+		format = LogFormatJSON
+		if config.DevMode {
+			format = LogFormatText
+		}
+	}
+
+	level, err := ParseLogLevel(config.LogLevel)
+	logger := NewLogger(os.Stdout, level, format)
+	if err != nil {
+		logger.Warn("Invalid log level, using info", "error", err)
+	}
+
+	return logger
+}
+
+func newAppLogger(sink *logSink, fields []interface{}) *AppLogger {
+	l := &AppLogger{sink: sink, fields: fields}
+	l.InfoLog = log.New(levelWriter{logger: l, level: LevelInfo}, "", 0)
+	l.WarnLog = log.New(levelWriter{logger: l, level: LevelWarn}, "", 0)
+	l.ErrorLog = log.New(levelWriter{logger: l, level: LevelError}, "", 0)
+	return l
+}
+
+// With returns a logger that adds the given key/value pairs to every message.
+func (l *AppLogger) With(keyvals ...interface{}) *AppLogger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+	return newAppLogger(l.sink, fields)
+}
+
+func (l *AppLogger) SetLevel(level LogLevel) {
+	l.sink.level.Store(int32(level))
+}
+
+func (l *AppLogger) Level() LogLevel {
+	return LogLevel(l.sink.level.Load())
+}
+
+func (l *AppLogger) Enabled(level LogLevel) bool {
+	return level >= l.Level()
+}
+
+func (l *AppLogger) isJSON() bool {
+	return l.sink.json
+}
+
+func (l *AppLogger) SetOutput(out io.Writer) {
+	l.sink.mutex.Lock()
+	defer l.sink.mutex.Unlock()
+	l.sink.out = out
+	l.sink.colour = !l.sink.json && isTerminal(out)
+}
+
+func (l *AppLogger) Debug(msg string, keyvals ...interface{}) {
+	l.Log(LevelDebug, msg, keyvals...)
+}
+
+func (l *AppLogger) Info(msg string, keyvals ...interface{}) {
+	l.Log(LevelInfo, msg, keyvals...)
+}
+
+func (l *AppLogger) Warn(msg string, keyvals ...interface{}) {
+	l.Log(LevelWarn, msg, keyvals...)
+}
+
+func (l *AppLogger) Error(msg string, keyvals ...interface{}) {
+	l.Log(LevelError, msg, keyvals...)
+}
+
+func (l *AppLogger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, format, args...)
+}
+
+func (l *AppLogger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, format, args...)
+}
+
+func (l *AppLogger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, format, args...)
+}
+
+func (l *AppLogger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, format, args...)
+}
+
+func (l *AppLogger) logf(level LogLevel, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, fmt.Sprintf(format, args...), nil)
+}
+
+// Log writes msg at level with the logger's fields followed by keyvals.
+func (l *AppLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.write(level, msg, keyvals)
+}
+
+func (l *AppLogger) write(level LogLevel, msg string, keyvals []interface{}) {
+	now := time.Now()
+
+	l.sink.mutex.Lock()
+	defer l.sink.mutex.Unlock()
+
+	var buf bytes.Buffer
+	if l.sink.json {
+		writeJSONRecord(&buf, now, level, msg, l.fields, keyvals)
+	} else {
+		writeTextRecord(&buf, now, level, msg, l.fields, keyvals, l.sink.colour)
+	}
+	buf.WriteByte('\n')
+
+	l.sink.out.Write(buf.Bytes())
+}
+
+func writeJSONRecord(buf *bytes.Buffer, now time.Time, level LogLevel, msg string, fields, keyvals []interface{}) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, now.UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, msg)
+
+	eachField(fields, keyvals, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONValue(buf, key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, logValue(value))
+	})
+
+	buf.WriteByte('}')
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
+
+var levelColours = map[LogLevel]string{
+	LevelDebug: "\033[90m",
+	LevelInfo:  "\033[36m",
+	LevelWarn:  "\033[33m",
+	LevelError: "\033[31m",
+}
+
+func writeTextRecord(buf *bytes.Buffer, now time.Time, level LogLevel, msg string, fields, keyvals []interface{}, colour bool) {
+	buf.WriteString(now.Format("2006-01-02 15:04:05"))
+	buf.WriteByte(' ')
+
+	levelName := fmt.Sprintf("%-5s", strings.ToUpper(level.String()))
+	if colour {
+		buf.WriteString(levelColours[level] + levelName + "\033[0m")
+	} else {
+		buf.WriteString(levelName)
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+
+	eachField(fields, keyvals, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(quoteTextValue(fmt.Sprint(logValue(value))))
+	})
+}
+
+func quoteTextValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if unicode.IsSpace(r) || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// eachField walks the logger's fields and then keyvals as key/value pairs. A
+// key without a value, or a value in a key position, is reported under
+// "!BADKEY" rather than dropped.
+func eachField(fields, keyvals []interface{}, fn func(key string, value interface{})) {
+	for _, list := range [][]interface{}{fields, keyvals} {
+		for i := 0; i < len(list); i++ {
+			key, ok := list[i].(string)
+			if !ok || i+1 >= len(list) {
+				fn("!BADKEY", list[i])
+				continue
+			}
+			fn(key, list[i+1])
+			i++
+		}
+	}
+}
+
+func logValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// levelWriter adapts the deprecated *log.Logger fields to the structured logger.
+type levelWriter struct {
+	logger *AppLogger
+	level  LogLevel
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	w.logger.Log(w.level, strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type loggerContextKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *AppLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the request logger stored in ctx, or nil.
+func LoggerFromContext(ctx context.Context) *AppLogger {
+	logger, _ := ctx.Value(loggerContextKey{}).(*AppLogger)
+	return logger
+}
+
+// requestLogger prefers the request-scoped logger over fallback.
+func requestLogger(fallback *AppLogger, r *http.Request) *AppLogger {
+	if logger := LoggerFromContext(r.Context()); logger != nil {
+		return logger
+	}
+	return fallback
+}
+
+// RequestIDHeader carries the request id. An incoming value is reused so ids
+// can be correlated across services; otherwise a new one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDContextKey struct{}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the id of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDFromHeader accepts a client-supplied id of up to 128 printable ASCII
+// characters and generates a new one otherwise.
+func requestIDFromHeader(header string) string {
+	if header != "" && len(header) <= 128 {
+		valid := true
+		for i := 0; i < len(header); i++ {
+			if header[i] < 0x21 || header[i] > 0x7e {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return header
+		}
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,206 @@
+package core_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type logRecord map[string]interface{}
+
+// loggedApp captures the app's JSON log output at info level.
+func loggedApp(t *testing.T, out *bytes.Buffer, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	opts = append([]goatest.Option{
+		goatest.WithLogOutput(out),
+		goatest.WithConfig(func(c *core.Config) {
+			c.LogLevel = "info"
+		}),
+	}, opts...)
+	return newTestApp(t, opts...)
+}
+
+func logRecords(t *testing.T, out *bytes.Buffer) []logRecord {
+	t.Helper()
+
+	var records []logRecord
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record logRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func findRecord(records []logRecord, msg string) logRecord {
+	for _, record := range records {
+		if record["msg"] == msg {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestRequestLogLines(t *testing.T) {
+	var out bytes.Buffer
+	app := loggedApp(t, &out, goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/orders/[id]", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Logger().Info("Loading order", "order", ctx.Params["id"])
+			ctx.Success("ok", http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/broken", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Error("boom", http.StatusInternalServerError)
+		})
+	}))
+
+	tests := []struct {
+		path   string
+		route  string
+		status float64
+		level  string
+	}{
+		{"/api/orders/7", "/api/orders/[id]", 200, "info"},
+		{"/api/missing", "unmatched", 404, "warn"},
+		{"/api/broken", "/api/broken", 500, "error"},
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		id := app.Get(tt.path).Header.Get(core.RequestIDHeader)
+
+		handled := findRecord(logRecords(t, &out), "Request handled")
+		if handled == nil {
+			t.Fatalf("%s: no request log line in %s", tt.path, out.String())
+		}
+		if handled["request_id"] != id || id == "" {
+			t.Errorf("%s: request_id = %v, response header %q", tt.path, handled["request_id"], id)
+		}
+		if handled["route"] != tt.route || handled["path"] != tt.path || handled["method"] != "GET" {
+			t.Errorf("%s: route/path/method = %v %v %v", tt.path, handled["route"], handled["path"], handled["method"])
+		}
+		if handled["status"] != tt.status || handled["level"] != tt.level {
+			t.Errorf("%s: status %v at %v, want %v at %s", tt.path, handled["status"], handled["level"], tt.status, tt.level)
+		}
+		if _, ok := handled["duration_ms"].(float64); !ok {
+			t.Errorf("%s: duration_ms = %#v", tt.path, handled["duration_ms"])
+		}
+		if _, ok := handled["time"].(string); !ok {
+			t.Errorf("%s: record has no time", tt.path)
+		}
+	}
+
+	out.Reset()
+	app.Get("/api/orders/9")
+	loading := findRecord(logRecords(t, &out), "Loading order")
+	if loading == nil || loading["order"] != "9" || loading["request_id"] == nil {
+		t.Errorf("handler log line = %v, want it to carry the request fields", loading)
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	app := newTestApp(t)
+
+	app.Request(http.MethodGet, "/", nil, core.RequestIDHeader, "upstream-42").
+		AssertHeader(core.RequestIDHeader, "upstream-42")
+
+	generated := app.Request(http.MethodGet, "/", nil, core.RequestIDHeader, "has spaces").Header.Get(core.RequestIDHeader)
+	if generated == "" || generated == "has spaces" {
+		t.Errorf("invalid incoming id was kept: %q", generated)
+	}
+	if again := app.Get("/").Header.Get(core.RequestIDHeader); again == generated {
+		t.Error("two requests got the same generated id")
+	}
+}
+
+func TestLogLevelChangesAtRuntime(t *testing.T) {
+	var out bytes.Buffer
+	app := loggedApp(t, &out, goatest.WithConfig(func(c *core.Config) {
+		c.DevMode = true
+		c.LogFormat = core.LogFormatJSON
+	}), withAPI("/api/work", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Logger().Debug("Detail")
+		ctx.Success("ok", http.StatusOK)
+	}))
+
+	app.Get("/api/work")
+	if findRecord(logRecords(t, &out), "Detail") != nil {
+		t.Fatal("debug line written at info level")
+	}
+
+	var level map[string]string
+	app.Get("/_goa/log/level").AssertStatus(http.StatusOK).Data(&level)
+	if level["level"] != "info" {
+		t.Errorf("level = %v", level)
+	}
+	app.PostJSON("/_goa/log/level", map[string]string{"level": "shout"}).AssertStatus(http.StatusBadRequest)
+	app.PostJSON("/_goa/log/level", map[string]string{"level": "debug"}).AssertStatus(http.StatusOK).Data(&level)
+	if level["level"] != "debug" {
+		t.Errorf("level after change = %v", level)
+	}
+
+	out.Reset()
+	app.Get("/api/work")
+	if findRecord(logRecords(t, &out), "Detail") == nil {
+		t.Error("request loggers did not pick up the new level")
+	}
+}
+
+func TestLogLevelEndpointOnlyInDevMode(t *testing.T) {
+	newTestApp(t).Get("/_goa/log/level").AssertStatus(http.StatusNotFound)
+}
+
+func TestTextLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := core.NewLogger(&out, core.LevelDebug, core.LogFormatText).With("component", "jobs")
+
+	logger.Info("Job finished", "name", "nightly report", "ok", true, "orphan")
+	line := strings.TrimSpace(out.String())
+
+	if !strings.Contains(line, ` INFO  Job finished component=jobs name="nightly report" ok=true !BADKEY=orphan`) {
+		t.Errorf("line = %q", line)
+	}
+	if strings.Contains(line, "\033[") {
+		t.Error("colour codes written to a non-terminal")
+	}
+}
+
+func TestDeprecatedLoggersWriteStructuredRecords(t *testing.T) {
+	var out bytes.Buffer
+	logger := core.NewLogger(&out, core.LevelInfo, core.LogFormatJSON)
+
+	logger.InfoLog.Printf("legacy %d", 1)
+	logger.WarnLog.Println("careful")
+
+	records := logRecords(t, &out)
+	if len(records) != 2 || records[0]["msg"] != "legacy 1" || records[1]["level"] != "warn" || records[1]["msg"] != "careful" {
+		t.Errorf("records = %v", records)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]core.LogLevel{
+		"":        core.LevelInfo,
+		"debug":   core.LevelDebug,
+		" INFO ":  core.LevelInfo,
+		"warning": core.LevelWarn,
+		"Error":   core.LevelError,
+	}
+	for input, want := range tests {
+		if got, err := core.ParseLogLevel(input); err != nil || got != want {
+			t.Errorf("ParseLogLevel(%q) = %v, %v; want %v", input, got, err, want)
+		}
+	}
+	if _, err := core.ParseLogLevel("verbose"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
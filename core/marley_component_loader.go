@@ -10,7 +10,7 @@ import (
 
 func (m *Marley) loadComponents() error {
 	componentCache := make(map[string]string)
-	componentDir := AppConfig.ComponentDir
+	componentDir := m.Config.ComponentDir
 
 	err := filepath.Walk(componentDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
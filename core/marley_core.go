@@ -14,10 +14,14 @@ type Marley struct {
 	PageMetadata    map[string]*PageMetadata
 	LayoutMetadata  *PageMetadata
 	TemplateErrors  map[string]error
+	templatesLoaded bool
+	renderErrors    map[string]struct{}
 	mutex           sync.RWMutex
 	cacheExpiry     time.Time
 	cacheTTL        time.Duration
 	Logger          *AppLogger
+	Config          *Config
+	Errors          *ErrorRegistry
 	BundledAssets   map[string][]string
 	BundleMode      bool
 
@@ -26,40 +30,83 @@ type Marley struct {
 	ssgMutex      *sync.RWMutex
 	ssgTaskChan   chan SSGTask
 	ssgWorkerPool chan struct{}
+	ssgInit       sync.Once
+	ssgStop       chan struct{}
+	ssgWorkers    sync.WaitGroup
+	stopOnce      sync.Once
+
+	renderCache   sync.Map
+	metadataCache *MetadataCache
+	jsLibraries   *jsLibraryCache
+	metrics       *frameworkMetrics
 }
 
-func NewMarley(logger *AppLogger) *Marley {
+func NewMarley(config *Config, logger *AppLogger, errors *ErrorRegistry) *Marley {
 	m := &Marley{
 		Templates:       make(map[string]*template.Template),
 		PageMetadata:    make(map[string]*PageMetadata),
 		TemplateErrors:  make(map[string]error),
+		renderErrors:    make(map[string]struct{}),
 		SSGCache:        make(map[string]SSGCacheEntry),
-		SSGCacheDir:     AppConfig.SSGDir,
+		SSGCacheDir:     config.SSGDir,
 		ComponentsCache: make(map[string]string),
 		BundledAssets:   make(map[string][]string),
 		cacheTTL:        15 * time.Minute,
 		mutex:           sync.RWMutex{},
 		ssgMutex:        &sync.RWMutex{},
+		ssgStop:         make(chan struct{}),
+		ssgTaskChan:     make(chan SSGTask, 100),
 		Logger:          logger,
+		Config:          config,
+		Errors:          errors,
 		BundleMode:      false,
+		metadataCache:   NewMetadataCache(8, 30*time.Minute),
+		jsLibraries:     newJSLibraryCache(),
 	}
 
-	if AppConfig.InMemoryJS {
-		logger.InfoLog.Printf("Pre-initializing JavaScript libraries...")
-		if err := FetchAndCacheJSLibraries(); err != nil {
-			logger.WarnLog.Printf("Failed to pre-cache JavaScript libraries: %v", err)
+	if config.InMemoryJS {
+		logger.Infof("Pre-initializing JavaScript libraries...")
+		if err := m.FetchAndCacheJSLibraries(); err != nil {
+			logger.Warnf("Failed to pre-cache JavaScript libraries: %v", err)
 		}
 	}
 
 	return m
 }
 
+// Stop shuts down the SSG workers, letting in-flight pages finish, and then the
+// metadata extraction workers.
+func (m *Marley) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.ssgStop)
+		m.ssgWorkers.Wait()
+		m.metadataCache.Stop()
+	})
+}
+
+// templateFuncs are available to every page, layout and component template.
+func (m *Marley) templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"url": m.Config.URL,
+		"basePath": func() string {
+			return m.Config.BasePath
+		},
+	}
+	for name, fn := range csrfTemplateFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range m.cspTemplateFuncs() {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
 func (m *Marley) SetCacheTTL(duration time.Duration) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.cacheTTL = duration
 	m.cacheExpiry = time.Time{}
-	m.Logger.InfoLog.Printf("Template cache TTL set to %v", duration)
+	m.Logger.Infof("Template cache TTL set to %v", duration)
 }
 
 func (m *Marley) InvalidateCache() {
@@ -71,10 +118,37 @@ func (m *Marley) InvalidateCache() {
 	m.SSGCache = make(map[string]SSGCacheEntry)
 	m.ssgMutex.Unlock()
 
-	renderCache = &sync.Map{}
+	m.ClearRenderCache()
+	m.metadataCache.Clear()
 
 	m.Templates = make(map[string]*template.Template)
 	m.ComponentsCache = make(map[string]string)
 
-	m.Logger.InfoLog.Printf("All caches invalidated: template, render, SSG and component caches cleared")
+	m.Logger.Infof("All caches invalidated: template, render, SSG and component caches cleared")
+}
+
+// recordRenderError notes a page that failed while rendering. Unlike a load
+// error it does not disable the template: the page's circuit breaker decides
+// when to try it again.
+func (m *Marley) recordRenderError(route string, err error) {
+	m.mutex.Lock()
+	m.renderErrors[route] = struct{}{}
+	m.mutex.Unlock()
+}
+
+func (m *Marley) ClearRenderErrors() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cleared := len(m.renderErrors)
+	m.renderErrors = make(map[string]struct{})
+
+	return cleared
+}
+
+func (m *Marley) ClearRenderCache() {
+	m.renderCache.Range(func(key, _ interface{}) bool {
+		m.renderCache.Delete(key)
+		return true
+	})
 }
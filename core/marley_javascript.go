@@ -6,38 +6,39 @@ import (
 )
 
 
-func injectJavaScriptLibraries(html, jsLibrary string) string {
+func (m *Marley) injectJavaScriptLibraries(html, jsLibrary string) string {
 	if jsLibrary == "vanilla" {
-		if !AppConfig.DevMode {
+		if !m.Config.DevMode {
 			return html
 		}
 	}
 
-	scriptContent, inMemory, cdnURL := GetJSLibraryContent(jsLibrary)
+	scriptContent, inMemory, cdnURL := m.GetJSLibraryContent(jsLibrary)
+	nonce := m.scriptNonceAttribute()
 
 	var scriptTag string
 	if jsLibrary == "alpine" {
 		if inMemory {
-			scriptTag = fmt.Sprintf("<script defer>%s</script>", scriptContent)
+			scriptTag = fmt.Sprintf("<script%s defer>%s</script>", nonce, scriptContent)
 		} else {
-			scriptTag = fmt.Sprintf("<script defer src=\"%s\"></script>", cdnURL)
+			scriptTag = fmt.Sprintf("<script%s defer src=\"%s\"></script>", nonce, cdnURL)
 		}
 	} else if jsLibrary == "jquery" {
 		if inMemory {
-			scriptTag = fmt.Sprintf("<script>%s</script>", scriptContent)
+			scriptTag = fmt.Sprintf("<script%s>%s</script>", nonce, scriptContent)
 		} else {
-			scriptTag = fmt.Sprintf("<script src=\"%s\"></script>", cdnURL)
+			scriptTag = fmt.Sprintf("<script%s src=\"%s\"></script>", nonce, cdnURL)
 		}
 	} else if jsLibrary == "pvue" {
 		if inMemory {
-			scriptTag = fmt.Sprintf("<script defer>%s</script>", scriptContent)
+			scriptTag = fmt.Sprintf("<script%s defer>%s</script>", nonce, scriptContent)
 		} else {
-			scriptTag = fmt.Sprintf("<script defer src=\"%s\"></script>", cdnURL)
+			scriptTag = fmt.Sprintf("<script%s defer src=\"%s\"></script>", nonce, cdnURL)
 		}
 	}
 
-	if AppConfig.DevMode {
-		wsClientJS := GetWebSocketClientJS()
+	if m.Config.DevMode {
+		wsClientJS := m.GetWebSocketClientJS()
 		if scriptTag != "" {
 			scriptTag = scriptTag + "\n" + wsClientJS
 		} else {
@@ -12,27 +12,30 @@ type MetadataCache struct {
 	ttl      time.Duration
 	mutex    sync.RWMutex
 	extractC chan extractRequest
+	done     chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
 }
 
 
 type extractRequest struct {
+	config   *Config
 	content  string
 	filePath string
 	result   chan *PageMetadata
 }
 
 
-var metadataCache = NewMetadataCache(8, 30*time.Minute)
-
-
 func NewMetadataCache(workers int, ttl time.Duration) *MetadataCache {
 	mc := &MetadataCache{
 		cache:    make(map[string]*PageMetadata),
 		expiry:   make(map[string]time.Time),
 		ttl:      ttl,
 		extractC: make(chan extractRequest, workers*2),
+		done:     make(chan struct{}),
 	}
 
+	mc.workers.Add(workers + 1)
 	for i := 0; i < workers; i++ {
 		go mc.worker()
 	}
@@ -44,18 +47,52 @@ func NewMetadataCache(workers int, ttl time.Duration) *MetadataCache {
 
 
 func (mc *MetadataCache) worker() {
-	for req := range mc.extractC {
-		metadata := extractPageMetadataInternal(req.content, req.filePath)
-		req.result <- metadata
+	defer mc.workers.Done()
+
+	for {
+		select {
+		case req := <-mc.extractC:
+			req.result <- extractPageMetadataInternal(req.config, req.content, req.filePath)
+		case <-mc.done:
+			return
+		}
+	}
+}
+
+
+// Extract hands large pages to the worker pool and falls back to extracting
+// inline once the cache has been stopped.
+func (mc *MetadataCache) Extract(config *Config, content, filePath string) *PageMetadata {
+	resultChan := make(chan *PageMetadata, 1)
+
+	select {
+	case mc.extractC <- extractRequest{config: config, content: content, filePath: filePath, result: resultChan}:
+	case <-mc.done:
+		return extractPageMetadataInternal(config, content, filePath)
+	}
+
+	select {
+	case metadata := <-resultChan:
+		return metadata
+	case <-mc.done:
+		return extractPageMetadataInternal(config, content, filePath)
 	}
 }
 
 
 func (mc *MetadataCache) cleanExpired(interval time.Duration) {
+	defer mc.workers.Done()
+
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-mc.done:
+			return
+		}
+
 		now := time.Now()
 		mc.mutex.Lock()
 		for key, expiry := range mc.expiry {
@@ -93,3 +130,28 @@ func (mc *MetadataCache) Set(key string, metadata *PageMetadata) {
 	mc.cache[key] = metadata
 	mc.expiry[key] = time.Now().Add(mc.ttl)
 }
+
+
+func (mc *MetadataCache) Len() int {
+	mc.mutex.RLock()
+	defer mc.mutex.RUnlock()
+	return len(mc.cache)
+}
+
+
+func (mc *MetadataCache) Clear() {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.cache = make(map[string]*PageMetadata)
+	mc.expiry = make(map[string]time.Time)
+}
+
+
+// Stop terminates the extraction workers and the expiry ticker and waits for them to exit.
+func (mc *MetadataCache) Stop() {
+	mc.stopOnce.Do(func() {
+		close(mc.done)
+	})
+	mc.workers.Wait()
+}
@@ -2,19 +2,20 @@ package core
 
 import (
 	"strings"
+	"time"
 )
 
 
-func extractPageMetadataInternal(content, _ string) *PageMetadata {
+func extractPageMetadataInternal(config *Config, content, _ string) *PageMetadata {
 	metadata := &PageMetadata{
 		Title:       defaultTitle,
-		Description: AppConfig.DefaultMetaTags["description"],
-		MetaTags:    make(map[string]string, len(AppConfig.DefaultMetaTags)+4),
-		RenderMode:  AppConfig.DefaultRenderMode,
+		Description: config.DefaultMetaTags["description"],
+		MetaTags:    make(map[string]string, len(config.DefaultMetaTags)+4),
+		RenderMode:  config.DefaultRenderMode,
 		JSLibrary:   defaultJSLibrary,
 	}
 
-	for k, v := range AppConfig.DefaultMetaTags {
+	for k, v := range config.DefaultMetaTags {
 		metadata.MetaTags[k] = v
 	}
 
@@ -99,32 +100,64 @@ func extractPageMetadataInternal(content, _ string) *PageMetadata {
 		}
 	}
 
+	if match := htmlCommentAuthRegex.FindStringSubmatch(content); len(match) > 1 {
+		if strings.ToLower(strings.TrimSpace(match[1])) == "required" {
+			metadata.Auth = &AuthRule{}
+		}
+	} else if match := authRegex.FindStringSubmatch(content); len(match) > 1 {
+		if strings.ToLower(match[1]) == "required" {
+			metadata.Auth = &AuthRule{}
+		}
+	}
+
+	rolesMatch := htmlCommentRolesRegex.FindStringSubmatch(content)
+	if len(rolesMatch) < 2 {
+		rolesMatch = rolesRegex.FindStringSubmatch(content)
+	}
+	if len(rolesMatch) > 1 {
+		if roles := claimList(strings.TrimSuffix(strings.TrimSpace(rolesMatch[1]), "-"), ","); len(roles) > 0 {
+			metadata.Auth = &AuthRule{Roles: roles}
+		}
+	}
+
+	timeoutMatch := htmlCommentTimeoutRegex.FindStringSubmatch(content)
+	if len(timeoutMatch) < 2 {
+		timeoutMatch = timeoutRegex.FindStringSubmatch(content)
+	}
+	if len(timeoutMatch) > 1 {
+		value := strings.ToLower(strings.TrimSpace(timeoutMatch[1]))
+		if value == "off" || value == "none" {
+			metadata.Timeout = -1
+		} else if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			metadata.Timeout = timeout
+		}
+	}
+
+	// SSG output is served publicly from the static directory, so protected
+	// pages are always rendered per request.
+	if metadata.Auth != nil && metadata.RenderMode == "ssg" {
+		metadata.RenderMode = "ssr"
+	}
+
 	return metadata
 }
 
 
-func extractPageMetadata(content, filePath string) *PageMetadata {
+func (m *Marley) extractPageMetadata(content, filePath string) *PageMetadata {
 	cacheKey := filePath
 
-	if metadata, found := metadataCache.Get(cacheKey); found {
+	if metadata, found := m.metadataCache.Get(cacheKey); found {
 		return metadata
 	}
 
 	if len(content) < 1024 {
-		metadata := extractPageMetadataInternal(content, filePath)
-		metadataCache.Set(cacheKey, metadata)
+		metadata := extractPageMetadataInternal(m.Config, content, filePath)
+		m.metadataCache.Set(cacheKey, metadata)
 		return metadata
 	}
 
-	resultChan := make(chan *PageMetadata, 1)
-	metadataCache.extractC <- extractRequest{
-		content:  content,
-		filePath: filePath,
-		result:   resultChan,
-	}
-
-	metadata := <-resultChan
-	metadataCache.Set(cacheKey, metadata)
+	metadata := m.metadataCache.Extract(m.Config, content, filePath)
+	m.metadataCache.Set(cacheKey, metadata)
 
 	return metadata
 }
@@ -138,12 +171,18 @@ func processPageContent(content string, _ *PageMetadata) string {
 	content = metaTagRegex.ReplaceAllString(content, "")
 	content = renderModeRegex.ReplaceAllString(content, "")
 	content = jsLibraryRegex.ReplaceAllString(content, "")
+	content = authRegex.ReplaceAllString(content, "")
+	content = rolesRegex.ReplaceAllString(content, "")
+	content = timeoutRegex.ReplaceAllString(content, "")
 
 	content = htmlCommentTitleRegex.ReplaceAllString(content, "")
 	content = htmlCommentDescRegex.ReplaceAllString(content, "")
 	content = htmlCommentMetaTagRegex.ReplaceAllString(content, "")
 	content = htmlCommentRenderModeRegex.ReplaceAllString(content, "")
 	content = htmlCommentJSLibraryRegex.ReplaceAllString(content, "")
+	content = htmlCommentAuthRegex.ReplaceAllString(content, "")
+	content = htmlCommentRolesRegex.ReplaceAllString(content, "")
+	content = htmlCommentTimeoutRegex.ReplaceAllString(content, "")
 
 	content = strings.TrimLeft(content, "\r\n")
 
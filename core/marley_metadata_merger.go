@@ -4,19 +4,19 @@ package core
 func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *PageMetadata {
 	cacheKey := "merge:" + routePath
 
-	if metadata, found := metadataCache.Get(cacheKey); found {
+	if metadata, found := m.metadataCache.Get(cacheKey); found {
 		return metadata
 	}
 
 	result := &PageMetadata{
 		Title:       defaultTitle,
-		Description: AppConfig.DefaultMetaTags["description"],
-		MetaTags:    make(map[string]string, len(AppConfig.DefaultMetaTags)+4),
-		RenderMode:  AppConfig.DefaultRenderMode,
+		Description: m.Config.DefaultMetaTags["description"],
+		MetaTags:    make(map[string]string, len(m.Config.DefaultMetaTags)+4),
+		RenderMode:  m.Config.DefaultRenderMode,
 		JSLibrary:   defaultJSLibrary,
 	}
 
-	for k, v := range AppConfig.DefaultMetaTags {
+	for k, v := range m.Config.DefaultMetaTags {
 		if k != "description" && k != "og:description" && k != "og:title" {
 			result.MetaTags[k] = v
 		}
@@ -27,7 +27,7 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 			result.Title = m.LayoutMetadata.Title
 		}
 
-		if m.LayoutMetadata.Description != AppConfig.DefaultMetaTags["description"] {
+		if m.LayoutMetadata.Description != m.Config.DefaultMetaTags["description"] {
 			result.Description = m.LayoutMetadata.Description
 		}
 
@@ -37,7 +37,7 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 			}
 		}
 
-		if m.LayoutMetadata.RenderMode != AppConfig.DefaultRenderMode {
+		if m.LayoutMetadata.RenderMode != m.Config.DefaultRenderMode {
 			result.RenderMode = m.LayoutMetadata.RenderMode
 		}
 
@@ -50,7 +50,7 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 		result.Title = pageMetadata.Title
 	}
 
-	if pageMetadata.Description != AppConfig.DefaultMetaTags["description"] {
+	if pageMetadata.Description != m.Config.DefaultMetaTags["description"] {
 		result.Description = pageMetadata.Description
 	}
 
@@ -60,7 +60,7 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 		}
 	}
 
-	if pageMetadata.RenderMode != AppConfig.DefaultRenderMode {
+	if pageMetadata.RenderMode != m.Config.DefaultRenderMode {
 		result.RenderMode = pageMetadata.RenderMode
 	}
 
@@ -68,6 +68,12 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 		result.JSLibrary = pageMetadata.JSLibrary
 	}
 
+	result.Auth = pageMetadata.Auth
+	result.Timeout = pageMetadata.Timeout
+	if result.Auth != nil && result.RenderMode == "ssg" {
+		result.RenderMode = "ssr"
+	}
+
 	result.MetaTags["og:title"] = result.Title
 
 	if result.Description != "" {
@@ -75,16 +81,14 @@ func (m *Marley) mergeMetadata(routePath string, pageMetadata *PageMetadata) *Pa
 		result.MetaTags["og:description"] = result.Description
 	}
 
-	if AppConfig.LogLevel == "debug" {
-		m.Logger.InfoLog.Printf("Merged metadata for %s: Title='%s', Description='%s...', Mode='%s', JS='%s'",
-			routePath,
-			result.Title,
-			truncateString(result.Description, 30),
-			result.RenderMode,
-			result.JSLibrary)
-	}
+	m.Logger.Debug("Merged metadata",
+		"route", routePath,
+		"title", result.Title,
+		"description", truncateString(result.Description, 30),
+		"mode", result.RenderMode,
+		"js", result.JSLibrary)
 
-	metadataCache.Set(cacheKey, result)
+	m.metadataCache.Set(cacheKey, result)
 
 	return result
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"regexp"
+	"time"
 )
 
 
@@ -11,6 +12,15 @@ type PageMetadata struct {
 	MetaTags    map[string]string
 	RenderMode  string
 	JSLibrary   string
+
+	// Auth is set by the auth:required and roles: directives; nil pages are
+	// public.
+	Auth *AuthRule
+
+	// Timeout is set by the timeout: directive, such as timeout:30s, and
+	// overrides Config.RequestTimeout. timeout:off makes it negative, which
+	// disables it.
+	Timeout time.Duration
 }
 
 
@@ -21,6 +31,9 @@ var (
 	titleRegex      = regexp.MustCompile(`<!--title:([^-]+)-->`)
 	descRegex       = regexp.MustCompile(`<!--description:([^-]+)-->`)
 	jsLibraryRegex  = regexp.MustCompile(`<!--js:\s*([a-zA-Z]+)\s*-->`)
+	authRegex       = regexp.MustCompile(`<!--auth:\s*([a-zA-Z]+)\s*-->`)
+	rolesRegex      = regexp.MustCompile(`<!--roles:([a-zA-Z0-9_.:,\-\s]+)-->`)
+	timeoutRegex    = regexp.MustCompile(`<!--timeout:\s*([a-zA-Z0-9.]+)\s*-->`)
 
 	
 	htmlCommentMetaTagRegex    = regexp.MustCompile(`<!---meta:([a-zA-Z0-9_:,\-\s]+)(?:-->|--->)`)
@@ -28,6 +41,9 @@ var (
 	htmlCommentTitleRegex      = regexp.MustCompile(`<!---title:([^-]+)(?:-->|--->)`)
 	htmlCommentDescRegex       = regexp.MustCompile(`<!---description:([^-]+)(?:-->|--->)`)
 	htmlCommentJSLibraryRegex  = regexp.MustCompile(`<!---js:\s*([a-zA-Z]+)\s*(?:-->|--->)`)
+	htmlCommentAuthRegex       = regexp.MustCompile(`<!---auth:\s*([a-zA-Z]+)\s*(?:-->|--->)`)
+	htmlCommentRolesRegex      = regexp.MustCompile(`<!---roles:([a-zA-Z0-9_.:,\-\s]+)(?:-->|--->)`)
+	htmlCommentTimeoutRegex    = regexp.MustCompile(`<!---timeout:\s*([a-zA-Z0-9.]+)\s*(?:-->|--->)`)
 
 	
 	defaultTitle      = "Go on Airplanes"
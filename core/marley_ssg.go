@@ -1,17 +1,18 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 )
 
 type SSGCacheEntry struct {
 	Content    string
+	Gzipped    []byte
 	Expiry     time.Time
 	Processing bool
 }
@@ -25,38 +26,52 @@ type SSGTask struct {
 
 type SSGResult struct {
 	Content string
+	Gzipped []byte
 	Error   error
 }
 
 func (m *Marley) initSSGSystem() {
-	if m.ssgMutex == nil {
-		m.ssgMutex = &sync.RWMutex{}
-	}
+	m.ssgInit.Do(func() {
+		if !m.Config.SSGEnabled {
+			return
+		}
 
-	if m.ssgWorkerPool == nil && AppConfig.SSGEnabled {
-		m.ssgTaskChan = make(chan SSGTask, 100)
 		m.ssgWorkerPool = make(chan struct{}, 4)
 
+		m.ssgWorkers.Add(4)
 		for i := 0; i < 4; i++ {
 			go m.ssgWorker()
 		}
-	}
+	})
 }
 
 func (m *Marley) ssgWorker() {
-	for task := range m.ssgTaskChan {
+	defer m.ssgWorkers.Done()
+
+	for {
+		var task SSGTask
+		select {
+		case task = <-m.ssgTaskChan:
+		case <-m.ssgStop:
+			return
+		}
+
 		m.ssgWorkerPool <- struct{}{}
-		content, err := m.processSSGTask(task.RoutePath, task.Template, task.Metadata)
+		content, gzipped, err := m.processSSGTask(task.RoutePath, task.Template, task.Metadata)
 		<-m.ssgWorkerPool
 
 		task.ResultChan <- &SSGResult{
 			Content: content,
+			Gzipped: gzipped,
 			Error:   err,
 		}
 	}
 }
 
-func (m *Marley) processSSGTask(routePath string, tmpl *template.Template, metadata *PageMetadata) (string, error) {
+// processSSGTask renders a page to memory and, with the SSG cache enabled, to
+// disk. When compression is on it also returns a gzipped copy, written next to
+// the HTML file as .html.gz, so clients accepting gzip get it as is.
+func (m *Marley) processSSGTask(routePath string, tmpl *template.Template, metadata *PageMetadata) (string, []byte, error) {
 	finalMetadata := m.mergeMetadata(routePath, metadata)
 
 	relativePath := strings.TrimPrefix(routePath, "/")
@@ -69,11 +84,13 @@ func (m *Marley) processSSGTask(routePath string, tmpl *template.Template, metad
 	now := time.Now()
 	templateData := map[string]interface{}{
 		"Metadata":    finalMetadata,
-		"Config":      &AppConfig,
+		"Config":      m.Config,
 		"BuildTime":   now.Format(time.RFC1123),
 		"ServerTime":  now.Format(time.RFC1123),
 		"CurrentTime": now,
 		"Route":       routePath,
+		"Session":     (*Session)(nil),
+		"User":        Claims(nil),
 	}
 
 	if m.BundleMode {
@@ -82,39 +99,62 @@ func (m *Marley) processSSGTask(routePath string, tmpl *template.Template, metad
 
 	err := tmpl.ExecuteTemplate(&buffer, "layout", templateData)
 	if err != nil {
-		return "", fmt.Errorf("failed to render template to memory: %w", err)
+		return "", nil, fmt.Errorf("failed to render template to memory: %w", err)
 	}
 
 	content := buffer.String()
 
 	
-	content = injectJavaScriptLibraries(content, finalMetadata.JSLibrary)
+	content = m.injectJavaScriptLibraries(content, finalMetadata.JSLibrary)
+
+	var gzipped []byte
+	if m.Config.CompressionEnabled {
+		gzipped, err = gzipBytes([]byte(content))
+		if err != nil {
+			m.Logger.Warnf("Failed to precompress SSG content for %s: %v", routePath, err)
+			gzipped = nil
+		}
+	}
 
-	if AppConfig.SSGCacheEnabled {
+	if m.Config.SSGCacheEnabled {
 		cacheDir := m.SSGCacheDir
 		fullPath := filepath.Join(cacheDir, relativePath+".html")
 
+		diskContent, diskGzipped := content, gzipped
+		if hasPlaceholders(content) {
+			diskContent = stripPlaceholders(content)
+			if gzipped != nil {
+				diskGzipped, _ = gzipBytes([]byte(diskContent))
+			}
+		}
+
 		dirPath := filepath.Dir(fullPath)
 		if err := os.MkdirAll(dirPath, 0755); err != nil {
-			m.Logger.WarnLog.Printf("Failed to create cache directory: %v", err)
+			m.Logger.Warnf("Failed to create cache directory: %v", err)
 		} else {
-			err = os.WriteFile(fullPath, []byte(content), 0644)
+			err = os.WriteFile(fullPath, []byte(diskContent), 0644)
 			if err != nil {
-				m.Logger.WarnLog.Printf("Failed to write to cache file: %v", err)
+				m.Logger.Warnf("Failed to write to cache file: %v", err)
 			} else {
-				m.Logger.InfoLog.Printf("Cached SSG content to disk: %s", fullPath)
+				m.Logger.Infof("Cached SSG content to disk: %s", fullPath)
+			}
+
+			if diskGzipped != nil {
+				if err := os.WriteFile(fullPath+".gz", diskGzipped, 0644); err != nil {
+					m.Logger.Warnf("Failed to write precompressed cache file: %v", err)
+				}
 			}
 		}
 	}
 
-	m.Logger.InfoLog.Printf("Generated SSG content for: %s (mode: %s, size: %d bytes)",
+	m.Logger.Infof("Generated SSG content for: %s (mode: %s, size: %d bytes)",
 		routePath, finalMetadata.RenderMode, buffer.Len())
 
-	return content, nil
+	return content, gzipped, nil
 }
 
-func (m *Marley) generateStaticFile(routePath string, tmpl *template.Template, metadata *PageMetadata) error {
-	if !AppConfig.SSGEnabled {
+func (m *Marley) generateStaticFile(ctx context.Context, routePath string, tmpl *template.Template, metadata *PageMetadata) (err error) {
+	if !m.Config.SSGEnabled {
 		return nil
 	}
 
@@ -144,6 +184,13 @@ func (m *Marley) generateStaticFile(routePath string, tmpl *template.Template, m
 	}
 	m.ssgMutex.Unlock()
 
+	_, span := StartSpan(ctx, "ssg.generate")
+	span.SetAttribute("template", routePath)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
 	resultChan := make(chan *SSGResult, 1)
 	task := SSGTask{
 		RoutePath:  routePath,
@@ -152,9 +199,22 @@ func (m *Marley) generateStaticFile(routePath string, tmpl *template.Template, m
 		ResultChan: resultChan,
 	}
 
-	m.ssgTaskChan <- task
+	var result *SSGResult
+	select {
+	case m.ssgTaskChan <- task:
+		select {
+		case result = <-resultChan:
+		case <-m.ssgStop:
+		}
+	case <-m.ssgStop:
+	}
 
-	result := <-resultChan
+	if result == nil {
+		m.ssgMutex.Lock()
+		delete(m.SSGCache, routePath)
+		m.ssgMutex.Unlock()
+		return nil
+	}
 
 	if result.Error != nil {
 		m.ssgMutex.Lock()
@@ -166,6 +226,7 @@ func (m *Marley) generateStaticFile(routePath string, tmpl *template.Template, m
 	m.ssgMutex.Lock()
 	m.SSGCache[routePath] = SSGCacheEntry{
 		Content:    result.Content,
+		Gzipped:    result.Gzipped,
 		Processing: false,
 		Expiry:     time.Now().Add(30 * time.Minute),
 	}
@@ -190,6 +251,23 @@ func (m *Marley) GetCachedSSGContent(routePath string) string {
 	return entry.Content
 }
 
+// cachedSSGGzip returns the precompressed copy of a cached SSG page, if any.
+func (m *Marley) cachedSSGGzip(routePath string) []byte {
+	if m.ssgMutex == nil {
+		return nil
+	}
+
+	m.ssgMutex.RLock()
+	defer m.ssgMutex.RUnlock()
+
+	entry, exists := m.SSGCache[routePath]
+	if !exists || entry.Processing || time.Now().After(entry.Expiry) {
+		return nil
+	}
+
+	return entry.Gzipped
+}
+
 func (m *Marley) CleanExpiredSSGCache() {
 	if m.ssgMutex == nil {
 		return
@@ -217,12 +295,12 @@ func (m *Marley) bundleAssets() error {
 
 	for ext, assetType := range assetTypes {
 		bundleName := fmt.Sprintf("bundle.%s", assetType)
-		bundlePath := filepath.Join(AppConfig.StaticDir, bundleName)
+		bundlePath := filepath.Join(m.Config.StaticDir, bundleName)
 
 		var bundleContent strings.Builder
 		assetFiles := make([]string, 0)
 
-		err := filepath.Walk(AppConfig.StaticDir, func(path string, info os.FileInfo, err error) error {
+		err := filepath.Walk(m.Config.StaticDir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
@@ -247,7 +325,7 @@ func (m *Marley) bundleAssets() error {
 				return fmt.Errorf("failed to read asset file %s: %w", assetPath, err)
 			}
 
-			relPath, _ := filepath.Rel(AppConfig.StaticDir, assetPath)
+			relPath, _ := filepath.Rel(m.Config.StaticDir, assetPath)
 			bundleContent.WriteString(fmt.Sprintf("/* %s */\n", relPath))
 			bundleContent.Write(content)
 			bundleContent.WriteString("\n\n")
@@ -258,8 +336,8 @@ func (m *Marley) bundleAssets() error {
 			return fmt.Errorf("failed to write bundle file %s: %w", bundlePath, err)
 		}
 
-		m.BundledAssets[assetType] = []string{fmt.Sprintf("/static/%s", bundleName)}
-		m.Logger.InfoLog.Printf("Created %s bundle with %d files", assetType, len(assetFiles))
+		m.BundledAssets[assetType] = []string{m.Config.URL(fmt.Sprintf("/static/%s", bundleName))}
+		m.Logger.Infof("Created %s bundle with %d files", assetType, len(assetFiles))
 	}
 
 	return nil
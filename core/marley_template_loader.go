@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -16,12 +17,12 @@ func (m *Marley) LoadTemplates() error {
 	defer m.mutex.Unlock()
 
 	now := time.Now()
-	if !m.cacheExpiry.IsZero() && now.Before(m.cacheExpiry) && AppConfig.TemplateCache {
+	if !m.cacheExpiry.IsZero() && now.Before(m.cacheExpiry) && m.Config.TemplateCache {
 		return nil
 	}
 
 	startTime := time.Now()
-	m.Logger.InfoLog.Printf("Loading templates...")
+	m.Logger.Infof("Loading templates...")
 
 	var wg sync.WaitGroup
 	errorCh := make(chan error, 2)
@@ -51,7 +52,7 @@ func (m *Marley) LoadTemplates() error {
 	layoutErrCh := make(chan error, 1)
 
 	go func() {
-		layoutContent, err := os.ReadFile(AppConfig.LayoutPath)
+		layoutContent, err := os.ReadFile(m.Config.LayoutPath)
 		if err != nil {
 			layoutErrCh <- fmt.Errorf("failed to load layout template: %w", err)
 			return
@@ -63,7 +64,7 @@ func (m *Marley) LoadTemplates() error {
 
 	select {
 	case err := <-errorCh:
-		m.Logger.ErrorLog.Printf("Failed to load components: %v", err)
+		m.Logger.Errorf("Failed to load components: %v", err)
 		return err
 	default:
 	}
@@ -71,13 +72,13 @@ func (m *Marley) LoadTemplates() error {
 	var layoutContent []byte
 	select {
 	case err := <-layoutErrCh:
-		m.Logger.ErrorLog.Printf("Failed to load layout template: %v", err)
+		m.Logger.Errorf("Failed to load layout template: %v", err)
 		return err
 	case layoutContent = <-layoutCh:
-		m.Logger.InfoLog.Printf("Layout template loaded successfully")
+		m.Logger.Infof("Layout template loaded successfully")
 
-		m.LayoutMetadata = extractPageMetadata(string(layoutContent), "layout")
-		m.Logger.InfoLog.Printf("Layout metadata extracted: %s", m.LayoutMetadata.Title)
+		m.LayoutMetadata = m.extractPageMetadata(string(layoutContent), "layout")
+		m.Logger.Infof("Layout metadata extracted: %s", m.LayoutMetadata.Title)
 	}
 
 	var (
@@ -85,16 +86,16 @@ func (m *Marley) LoadTemplates() error {
 		mu            sync.Mutex
 	)
 
-	err := filepath.Walk(AppConfig.AppDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(m.Config.AppDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if !info.IsDir() && filepath.Ext(path) == ".html" &&
-			path != AppConfig.LayoutPath &&
-			!strings.HasPrefix(path, AppConfig.ComponentDir) {
+			path != m.Config.LayoutPath &&
+			!strings.HasPrefix(path, m.Config.ComponentDir) {
 
-			routePath := getRoutePathFromFile(path, AppConfig.AppDir)
+			routePath := getRoutePathFromFile(path, m.Config.AppDir)
 
 			if routePath == "layout" {
 				return nil
@@ -112,7 +113,7 @@ func (m *Marley) LoadTemplates() error {
 		return nil
 	})
 	if err != nil {
-		m.Logger.ErrorLog.Printf("Failed to scan template directories: %v", err)
+		m.Logger.Errorf("Failed to scan template directories: %v", err)
 		return err
 	}
 
@@ -141,22 +142,22 @@ func (m *Marley) LoadTemplates() error {
 				templateErrors[result.path] = result.err
 				templateErrorsMutex.Unlock()
 
-				RegisterPageError(result.path, result.err, http.StatusInternalServerError)
+				m.Errors.RegisterPageError(result.path, result.err, http.StatusInternalServerError)
 
-				m.Logger.ErrorLog.Printf("Failed to load template %s: %v", result.path, result.err)
+				m.Logger.Errorf("Failed to load template %s: %v", result.path, result.err)
 				continue
 			}
 
 			templates[result.path] = result.tmpl
 			pageMetadata[result.path] = result.metadata
 
-			ClearPageError(result.path)
+			m.Errors.ClearPageError(result.path)
 
-			if AppConfig.SSGEnabled && result.metadata.RenderMode == "ssg" {
-				if err := m.generateStaticFile(result.path, result.tmpl, result.metadata); err != nil {
-					m.Logger.WarnLog.Printf("Failed to generate static file for %s: %v", result.path, err)
+			if m.Config.SSGEnabled && result.metadata.RenderMode == "ssg" {
+				if err := m.generateStaticFile(context.Background(), result.path, result.tmpl, result.metadata); err != nil {
+					m.Logger.Warnf("Failed to generate static file for %s: %v", result.path, err)
 				} else {
-					m.Logger.InfoLog.Printf("Generated static file for %s", result.path)
+					m.Logger.Infof("Generated static file for %s", result.path)
 				}
 			}
 		}
@@ -170,7 +171,7 @@ func (m *Marley) LoadTemplates() error {
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			routePath := getRoutePathFromFile(p, AppConfig.AppDir)
+			routePath := getRoutePathFromFile(p, m.Config.AppDir)
 
 			defer func() {
 				if r := recover(); r != nil {
@@ -195,11 +196,11 @@ func (m *Marley) LoadTemplates() error {
 				return
 			}
 
-			metadata := extractPageMetadata(string(pageContent), routePath)
+			metadata := m.extractPageMetadata(string(pageContent), routePath)
 
 			processedContent := processPageContent(string(pageContent), metadata)
 
-			tmpl := template.New("layout")
+			tmpl := template.New("layout").Funcs(m.templateFuncs())
 
 			_, err = tmpl.Parse(string(layoutContent))
 			if err != nil {
@@ -243,7 +244,7 @@ func (m *Marley) LoadTemplates() error {
 				err      error
 			}{routePath, tmpl, metadata, nil}
 
-			m.Logger.InfoLog.Printf("Template loaded: %s → %s (mode: %s)", p, routePath, metadata.RenderMode)
+			m.Logger.Infof("Template loaded: %s → %s (mode: %s)", p, routePath, metadata.RenderMode)
 		}(path)
 	}
 
@@ -253,23 +254,25 @@ func (m *Marley) LoadTemplates() error {
 	collectorWg.Wait()
 
 	m.TemplateErrors = templateErrors
+	m.renderErrors = make(map[string]struct{})
 
 	if len(templateErrors) > 0 {
-		m.Logger.WarnLog.Printf("%d templates failed to load", len(templateErrors))
+		m.Logger.Warnf("%d templates failed to load", len(templateErrors))
 		for path, err := range templateErrors {
-			m.Logger.WarnLog.Printf("  - %s: %v", path, err)
+			m.Logger.Warnf("  - %s: %v", path, err)
 		}
 	}
 
 	m.Templates = templates
 	m.PageMetadata = pageMetadata
+	m.templatesLoaded = true
 
-	if AppConfig.TemplateCache {
+	if m.Config.TemplateCache {
 		m.cacheExpiry = now.Add(m.cacheTTL)
 	}
 
 	elapsedTime := time.Since(startTime)
-	m.Logger.InfoLog.Printf("Templates loaded successfully in %v (%d templates, %d failed)",
+	m.Logger.Infof("Templates loaded successfully in %v (%d templates, %d failed)",
 		elapsedTime.Round(time.Millisecond), len(templates), len(templateErrors))
 
 	return nil
@@ -1,17 +1,31 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 )
 
-var renderCache = &sync.Map{}
-
 func (m *Marley) RenderTemplate(w http.ResponseWriter, route string, data interface{}) error {
+	return m.RenderTemplateContext(context.Background(), w, route, data)
+}
+
+// RenderTemplateContext renders like RenderTemplate inside a span that is a
+// child of the span in ctx.
+func (m *Marley) RenderTemplateContext(ctx context.Context, w http.ResponseWriter, route string, data interface{}) (err error) {
+	ctx, span := StartSpan(ctx, "render.template")
+	span.SetAttribute("template", route)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	timing := ServerTimingFromContext(ctx)
+	stopDataTiming := timing.Start("data")
+
 	startTime := time.Now()
 	m.mutex.RLock()
 	tmpl, ok := m.Templates[route]
@@ -21,66 +35,89 @@ func (m *Marley) RenderTemplate(w http.ResponseWriter, route string, data interf
 	m.mutex.RUnlock()
 
 	if hasError {
-		m.Logger.ErrorLog.Printf("Attempted to render template with known errors: %s: %v", route, templateErr)
+		m.Logger.Errorf("Attempted to render template with known errors: %s: %v", route, templateErr)
 
-		if !HasPageError(route) {
-			RegisterPageError(route, templateErr, http.StatusInternalServerError)
+		if !m.Errors.HasPageError(route) {
+			m.Errors.RegisterPageError(route, templateErr, http.StatusInternalServerError)
 		}
 		return fmt.Errorf("template has loading errors: %w", templateErr)
 	}
 
 	if !ok {
 		err := fmt.Errorf("template not found: %s", route)
-		RegisterPageError(route, err, http.StatusNotFound)
+		m.Errors.RegisterPageError(route, err, http.StatusNotFound)
 		return err
 	}
 
 	if !metaOk {
 		metadata = &PageMetadata{
 			Title:       defaultTitle,
-			Description: AppConfig.DefaultMetaTags["description"],
+			Description: m.Config.DefaultMetaTags["description"],
 			MetaTags:    make(map[string]string),
-			RenderMode:  AppConfig.DefaultRenderMode,
+			RenderMode:  m.Config.DefaultRenderMode,
 			JSLibrary:   defaultJSLibrary,
 		}
 	}
 
 	finalMetadata := m.mergeMetadata(route, metadata)
 
-	if cachedContent := m.GetCachedSSGContent(route); cachedContent != "" {
+	cachedContent := m.GetCachedSSGContent(route)
+	if finalMetadata.RenderMode == "ssg" && m.Config.SSGEnabled {
+		m.metrics.ssgCacheLookup(cachedContent != "")
+	}
+	if cachedContent != "" {
+		span.SetAttribute("cache", "ssg")
+		stopDataTiming()
+		timing.Mark("cache", "hit-ssg")
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Header().Set("X-SSG-Cached", "true")
-		io.WriteString(w, cachedContent)
+		if negotiatedEncoding(w) == encodingGzip && !hasPlaceholders(cachedContent) {
+			if gzipped := m.cachedSSGGzip(route); gzipped != nil {
+				writePrecompressed(w, gzipped)
+				return nil
+			}
+		}
+		io.WriteString(w, fillPlaceholders(ctx, w, cachedContent))
 		return nil
 	}
 
+	// Pages rendered for a signed-in user may show their claims, so they
+	// neither come from nor go into the render cache.
+	user := ClaimsFromContext(ctx)
 	cacheKey := "rendered:" + route
-	if cachedHTML, found := renderCache.Load(cacheKey); found {
+	if cachedHTML, found := m.renderCache.Load(cacheKey); found && user == nil {
 		if renderedHTML, ok := cachedHTML.(string); ok {
+			m.metrics.renderCacheLookup(true)
+			span.SetAttribute("cache", "render")
+			stopDataTiming()
+			timing.Mark("cache", "hit-render")
 			w.Header().Set("Content-Type", "text/html; charset=utf-8")
 			w.Header().Set("X-Template-Cached", "true")
-			io.WriteString(w, renderedHTML)
+			io.WriteString(w, fillPlaceholders(ctx, w, renderedHTML))
 			return nil
 		}
 	}
-
-	if AppConfig.LogLevel != "error" {
-		m.Logger.InfoLog.Printf("Rendering template %s with mode: %s, title: %s, js: %s",
-			route, finalMetadata.RenderMode, finalMetadata.Title, finalMetadata.JSLibrary)
+	if m.Config.TemplateCache {
+		m.metrics.renderCacheLookup(false)
 	}
 
+	m.Logger.Debug("Rendering template",
+		"route", route, "mode", finalMetadata.RenderMode, "title", finalMetadata.Title, "js", finalMetadata.JSLibrary)
+
 	var buffer strings.Builder
 	buffer.Grow(16 * 1024)
 
 	now := time.Now()
 	templateData := map[string]interface{}{
 		"Metadata":    finalMetadata,
-		"Config":      &AppConfig,
+		"Config":      m.Config,
 		"BuildTime":   now.Format(time.RFC1123),
 		"ServerTime":  now.Format(time.RFC1123),
 		"CurrentTime": now,
 		"Route":       route,
 		"Data":        data,
+		"Session":     SessionFromContext(ctx),
+		"User":        user,
 	}
 
 	if m.BundleMode {
@@ -89,52 +126,58 @@ func (m *Marley) RenderTemplate(w http.ResponseWriter, route string, data interf
 
 	defer func() {
 		if r := recover(); r != nil {
-			m.Logger.ErrorLog.Printf("Panic during template execution: %v", r)
-			err := fmt.Errorf("template execution panic: %v", r)
+			m.Logger.Errorf("Panic during template execution: %v", r)
+			err = fmt.Errorf("template execution panic: %v", r)
 
-			m.mutex.Lock()
-			m.TemplateErrors[route] = err
-			m.mutex.Unlock()
+			m.recordRenderError(route, err)
 
-			RegisterPageError(route, err, http.StatusInternalServerError)
+			m.Errors.RegisterPageError(route, err, http.StatusInternalServerError)
 		}
 	}()
 
-	err := tmpl.ExecuteTemplate(&buffer, "layout", templateData)
+	stopDataTiming()
+	timing.Mark("cache", "miss")
+
+	executeStart := time.Now()
+	err = tmpl.ExecuteTemplate(&buffer, "layout", templateData)
+	executeTime := time.Since(executeStart)
+	m.metrics.observeRender(route, executeTime)
+	timing.Add("template", executeTime, route)
 	if err != nil {
-		m.Logger.ErrorLog.Printf("Error executing template %s: %v", route, err)
+		m.Logger.Errorf("Error executing template %s: %v", route, err)
 
-		m.mutex.Lock()
-		m.TemplateErrors[route] = err
-		m.mutex.Unlock()
+		m.recordRenderError(route, err)
 
-		RegisterPageError(route, err, http.StatusInternalServerError)
+		m.Errors.RegisterPageError(route, err, http.StatusInternalServerError)
 
 		return fmt.Errorf("error rendering template: %w", err)
 	}
 
 	renderedHTML := buffer.String()
 
-	renderedHTML = injectJavaScriptLibraries(renderedHTML, finalMetadata.JSLibrary)
+	stopJSTiming := timing.Start("js")
+	renderedHTML = m.injectJavaScriptLibraries(renderedHTML, finalMetadata.JSLibrary)
+	stopJSTiming()
 
-	if AppConfig.TemplateCache && len(renderedHTML) < 64*1024 {
-		renderCache.Store(cacheKey, renderedHTML)
+	if m.Config.TemplateCache && len(renderedHTML) < 64*1024 && !sessionUsed(ctx) && user == nil {
+		m.renderCache.Store(cacheKey, renderedHTML)
 	}
 
-	if finalMetadata.RenderMode == "ssg" && AppConfig.SSGEnabled {
+	if finalMetadata.RenderMode == "ssg" && m.Config.SSGEnabled {
+		ssgCtx := detachedSpanContext(ctx)
 		go func() {
-			if err := m.generateStaticFile(route, tmpl, metadata); err != nil {
-				m.Logger.WarnLog.Printf("Failed to generate static file for %s: %v", route, err)
+			if err := m.generateStaticFile(ssgCtx, route, tmpl, metadata); err != nil {
+				m.Logger.Warnf("Failed to generate static file for %s: %v", route, err)
 			}
 		}()
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	io.WriteString(w, renderedHTML)
+	io.WriteString(w, fillPlaceholders(ctx, w, renderedHTML))
 
 	renderTime := time.Since(startTime)
-	if renderTime > 5*time.Millisecond && AppConfig.LogLevel == "debug" {
-		m.Logger.InfoLog.Printf("Slow template render: %s took %v", route, renderTime)
+	if renderTime > 5*time.Millisecond {
+		m.Logger.Debug("Slow template render", "route", route, "duration", renderTime)
 	}
 
 	return nil
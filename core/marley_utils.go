@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"html/template"
 	"io"
 	"net/http"
 	"path/filepath"
@@ -10,16 +11,23 @@ import (
 	"time"
 )
 
-var jsLibrariesLoaded sync.Once
-var jsLibraryMutex sync.RWMutex
+type jsLibraryCache struct {
+	loaded  sync.Once
+	mutex   sync.RWMutex
+	content map[string]string
+}
+
+func newJSLibraryCache() *jsLibraryCache {
+	return &jsLibraryCache{content: make(map[string]string)}
+}
 
-func GetWebSocketClientJS() string {
-	if !AppConfig.DevMode {
+func (m *Marley) GetWebSocketClientJS() string {
+	if !m.Config.DevMode {
 		return ""
 	}
 
 	return `
-<script>
+<script` + m.scriptNonceAttribute() + `>
 (function() {
   console.log("[LiveReload] Initializing WebSocket live reload...");
   
@@ -38,7 +46,7 @@ func GetWebSocketClientJS() string {
       }
       
       const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
-      const wsUrl = protocol + '//' + location.host + '/socket';
+      const wsUrl = protocol + '//' + location.host + '` + template.JSEscapeString(m.Config.URL("/socket")) + `';
       
       console.log("[LiveReload] Connecting to WebSocket server at:", wsUrl);
       
@@ -132,19 +140,19 @@ func GetWebSocketClientJS() string {
 `
 }
 
-func FetchAndCacheJSLibraries() error {
-	if !AppConfig.InMemoryJS {
+func (m *Marley) FetchAndCacheJSLibraries() error {
+	if !m.Config.InMemoryJS {
 		return nil
 	}
 
 	var loadErr error
-	jsLibrariesLoaded.Do(func() {
+	m.jsLibraries.loaded.Do(func() {
 		var wg sync.WaitGroup
 
 		libraries := map[string]string{
-			"jquery": AppConfig.JQueryCDN,
-			"alpine": AppConfig.AlpineJSCDN,
-			"pvue":   AppConfig.PetiteVueCDN,
+			"jquery": m.Config.JQueryCDN,
+			"alpine": m.Config.AlpineJSCDN,
+			"pvue":   m.Config.PetiteVueCDN,
 		}
 
 		errCh := make(chan error, len(libraries))
@@ -175,9 +183,9 @@ func FetchAndCacheJSLibraries() error {
 					return
 				}
 
-				jsLibraryMutex.Lock()
-				AppConfig.JSLibraryCache[libName] = string(content)
-				jsLibraryMutex.Unlock()
+				m.jsLibraries.mutex.Lock()
+				m.jsLibraries.content[libName] = string(content)
+				m.jsLibraries.mutex.Unlock()
 			}(lib, url)
 		}
 
@@ -195,35 +203,35 @@ func FetchAndCacheJSLibraries() error {
 	return loadErr
 }
 
-func GetJSLibraryContent(library string) (string, bool, string) {
-	if !AppConfig.InMemoryJS {
+func (m *Marley) GetJSLibraryContent(library string) (string, bool, string) {
+	if !m.Config.InMemoryJS {
 		switch library {
 		case "alpine":
-			return "", false, AppConfig.AlpineJSCDN
+			return "", false, m.Config.AlpineJSCDN
 		case "jquery":
-			return "", false, AppConfig.JQueryCDN
+			return "", false, m.Config.JQueryCDN
 		case "pvue":
-			return "", false, AppConfig.PetiteVueCDN
+			return "", false, m.Config.PetiteVueCDN
 		default:
 			return "", false, ""
 		}
 	}
 
-	jsLibraryMutex.RLock()
-	defer jsLibraryMutex.RUnlock()
+	m.jsLibraries.mutex.RLock()
+	defer m.jsLibraries.mutex.RUnlock()
 
-	content, exists := AppConfig.JSLibraryCache[library]
+	content, exists := m.jsLibraries.content[library]
 	if exists {
 		return content, true, ""
 	}
 
 	switch library {
 	case "alpine":
-		return "", false, AppConfig.AlpineJSCDN
+		return "", false, m.Config.AlpineJSCDN
 	case "jquery":
-		return "", false, AppConfig.JQueryCDN
+		return "", false, m.Config.JQueryCDN
 	case "pvue":
-		return "", false, AppConfig.PetiteVueCDN
+		return "", false, m.Config.PetiteVueCDN
 	default:
 		return "", false, ""
 	}
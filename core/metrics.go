@@ -0,0 +1,428 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are histogram buckets in seconds suited to request and render latencies.
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type metricCollector interface {
+	metricName() string
+	writeMetric(w *bufio.Writer)
+}
+
+// MetricsRegistry holds an app's metrics and renders them in the Prometheus
+// text exposition format. Registering two metrics with the same name panics.
+type MetricsRegistry struct {
+	collectors   map[string]metricCollector
+	beforeScrape []func()
+	mutex        sync.RWMutex
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		collectors: make(map[string]metricCollector),
+	}
+}
+
+func (mr *MetricsRegistry) register(c metricCollector) {
+	name := c.metricName()
+	if !metricNameRegex.MatchString(name) {
+		panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+	}
+
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+
+	if _, exists := mr.collectors[name]; exists {
+		panic(fmt.Sprintf("metrics: metric %q already registered", name))
+	}
+	mr.collectors[name] = c
+}
+
+func (mr *MetricsRegistry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{metricFamily: newMetricFamily(name, help, labels)}
+	mr.register(c)
+	return c
+}
+
+func (mr *MetricsRegistry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{metricFamily: newMetricFamily(name, help, labels)}
+	mr.register(g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time.
+func (mr *MetricsRegistry) NewGaugeFunc(name, help string, fn func() float64) {
+	mr.register(&gaugeFunc{name: name, help: help, collect: func() []metricSample {
+		return []metricSample{{value: fn()}}
+	}})
+}
+
+// newCounterFunc registers a counter whose value is read from fn at scrape
+// time, for totals the runtime already keeps.
+func (mr *MetricsRegistry) newCounterFunc(name, help string, fn func() float64) {
+	mr.register(&gaugeFunc{name: name, help: help, kind: "counter", collect: func() []metricSample {
+		return []metricSample{{value: fn()}}
+	}})
+}
+
+// onScrape runs fn at the start of every scrape, before any metric is
+// written, so several func metrics can share one expensive read.
+func (mr *MetricsRegistry) onScrape(fn func()) {
+	mr.mutex.Lock()
+	defer mr.mutex.Unlock()
+	mr.beforeScrape = append(mr.beforeScrape, fn)
+}
+
+// newLabeledGaugeFunc registers a gauge with one label whose series are read
+// from fn at scrape time.
+func (mr *MetricsRegistry) newLabeledGaugeFunc(name, help, label string, fn func() map[string]float64) {
+	mr.register(&gaugeFunc{name: name, help: help, collect: func() []metricSample {
+		values := fn()
+		samples := make([]metricSample, 0, len(values))
+		for labelValue, value := range values {
+			samples = append(samples, metricSample{labels: formatLabels([]string{label}, []string{labelValue}), value: value})
+		}
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		return samples
+	}})
+}
+
+// NewHistogram registers a histogram; nil buckets means DefaultLatencyBuckets.
+func (mr *MetricsRegistry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{metricFamily: newMetricFamily(name, help, labels), buckets: buckets}
+	mr.register(h)
+	return h
+}
+
+func (mr *MetricsRegistry) WriteTo(out io.Writer) (int64, error) {
+	mr.mutex.RLock()
+	collectors := make([]metricCollector, 0, len(mr.collectors))
+	for _, c := range mr.collectors {
+		collectors = append(collectors, c)
+	}
+	beforeScrape := mr.beforeScrape
+	mr.mutex.RUnlock()
+
+	for _, fn := range beforeScrape {
+		fn()
+	}
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].metricName() < collectors[j].metricName()
+	})
+
+	counter := &countingWriter{w: out}
+	w := bufio.NewWriter(counter)
+	for _, c := range collectors {
+		c.writeMetric(w)
+	}
+	err := w.Flush()
+	return counter.n, err
+}
+
+func (mr *MetricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	mr.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type metricFamily struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+}
+
+func newMetricFamily(name, help string, labels []string) metricFamily {
+	return metricFamily{name: name, help: help, labels: append([]string(nil), labels...)}
+}
+
+func (f *metricFamily) metricName() string {
+	return f.name
+}
+
+func (f *metricFamily) seriesKey(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *metricFamily) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, kind)
+}
+
+type Counter struct {
+	metricFamily
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels string
+	value  float64
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := c.seriesKey(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.series == nil {
+		c.series = make(map[string]*counterSeries)
+	}
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labels: formatLabels(c.labels, labelValues)}
+		c.series[key] = s
+	}
+	s.value += value
+}
+
+func (c *Counter) value(labelValues ...string) float64 {
+	key := c.seriesKey(labelValues)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if s, ok := c.series[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *Counter) writeMetric(w *bufio.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.writeHeader(w, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, s.labels, formatFloat(s.value))
+	}
+}
+
+type Gauge struct {
+	metricFamily
+	series map[string]*counterSeries
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(s *counterSeries) { s.value = value })
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.update(labelValues, func(s *counterSeries) { s.value += value })
+}
+
+func (g *Gauge) update(labelValues []string, apply func(*counterSeries)) {
+	key := g.seriesKey(labelValues)
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.series == nil {
+		g.series = make(map[string]*counterSeries)
+	}
+	s, ok := g.series[key]
+	if !ok {
+		s = &counterSeries{labels: formatLabels(g.labels, labelValues)}
+		g.series[key] = s
+	}
+	apply(s)
+}
+
+func (g *Gauge) writeMetric(w *bufio.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.writeHeader(w, "gauge")
+	for _, key := range sortedKeys(g.series) {
+		s := g.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", g.name, s.labels, formatFloat(s.value))
+	}
+}
+
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+// gaugeFunc is a gauge, or a counter when kind says so, whose samples are
+// collected at scrape time.
+type gaugeFunc struct {
+	name    string
+	help    string
+	kind    string
+	collect func() []metricSample
+}
+
+func (g *gaugeFunc) metricName() string {
+	return g.name
+}
+
+func (g *gaugeFunc) writeMetric(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	kind := g.kind
+	if kind == "" {
+		kind = "gauge"
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", g.name, kind)
+	for _, sample := range g.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, sample.labels, formatFloat(sample.value))
+	}
+}
+
+type Histogram struct {
+	metricFamily
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.seriesKey(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.series == nil {
+		h.series = make(map[string]*histogramSeries)
+	}
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) writeMetric(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w, "histogram")
+
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			labels := formatLabels(bucketLabels, append(append([]string(nil), s.labelValues...), formatFloat(upper)))
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels, s.counts[i])
+		}
+		infLabels := formatLabels(bucketLabels, append(append([]string(nil), s.labelValues...), "+Inf"))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, infLabels, s.count)
+
+		labels := formatLabels(h.labels, s.labelValues)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
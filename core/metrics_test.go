@@ -0,0 +1,184 @@
+package core_test
+
+import (
+	"bytes"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func metricsApp(t *testing.T, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.MetricsEnabled = true
+	})}, opts...)
+	return newTestApp(t, opts...)
+}
+
+// scrape fetches /metrics and indexes each sample line by its series.
+func scrape(t *testing.T, app *goatest.App) (map[string]float64, string) {
+	t.Helper()
+
+	res := app.Get("/metrics").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "text/plain; version=0.0.4; charset=utf-8").
+		AssertHeader("Cache-Control", "no-store")
+
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(strings.TrimSpace(res.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		split := strings.LastIndex(line, " ")
+		value, err := strconv.ParseFloat(line[split+1:], 64)
+		if split < 0 || err != nil {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		samples[line[:split]] = value
+	}
+	return samples, res.String()
+}
+
+func TestMetricsDisabledByDefault(t *testing.T) {
+	newTestApp(t).Get("/metrics").AssertStatus(http.StatusNotFound)
+}
+
+func TestMetricsCountRequestsByRoutePattern(t *testing.T) {
+	app := metricsApp(t, withAPI("/api/items/[id]", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success(ctx.Params["id"], http.StatusOK)
+	}))
+
+	app.Get("/api/items/1")
+	app.Get("/api/items/2")
+	app.Get("/instance")
+	app.Get("/no/such/page")
+
+	samples, _ := scrape(t, app)
+	expect := map[string]float64{
+		`goa_http_requests_total{route="/api/items/[id]",method="GET",status="200"}`:                            2,
+		`goa_http_requests_total{route="/instance",method="GET",status="200"}`:                                  1,
+		`goa_http_requests_total{route="unmatched",method="GET",status="404"}`:                                  1,
+		`goa_http_request_duration_seconds_count{route="/api/items/[id]",method="GET",status="200"}`:            2,
+		`goa_http_request_duration_seconds_bucket{route="/api/items/[id]",method="GET",status="200",le="+Inf"}`: 2,
+	}
+	for series, want := range expect {
+		if got, ok := samples[series]; !ok || got != want {
+			t.Errorf("%s = %v (present %v), want %v", series, got, ok, want)
+		}
+	}
+	for series := range samples {
+		if strings.Contains(series, `route="/api/items/1"`) || strings.Contains(series, "/no/such/page") {
+			t.Errorf("raw request path leaked into a label: %s", series)
+		}
+	}
+}
+
+func TestMetricsRenderCache(t *testing.T) {
+	app := metricsApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.TemplateCache = true
+	}))
+
+	app.Get("/instance")
+	app.Get("/instance")
+	app.Get("/instance")
+
+	samples, _ := scrape(t, app)
+	if samples[`goa_render_cache_lookups_total{result="miss"}`] != 1 || samples[`goa_render_cache_lookups_total{result="hit"}`] != 2 {
+		t.Errorf("render cache lookups = %v misses, %v hits",
+			samples[`goa_render_cache_lookups_total{result="miss"}`], samples[`goa_render_cache_lookups_total{result="hit"}`])
+	}
+	if ratio := samples["goa_render_cache_hit_ratio"]; ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("hit ratio = %v, want 2/3", ratio)
+	}
+	if _, ok := samples[`goa_template_render_duration_seconds_count{route="/instance"}`]; !ok {
+		t.Error("no render duration recorded")
+	}
+}
+
+func TestMetricsTypes(t *testing.T) {
+	_, body := scrape(t, metricsApp(t))
+
+	types := map[string]string{
+		"goa_http_requests_total":            "counter",
+		"goa_http_request_duration_seconds":  "histogram",
+		"go_goroutines":                      "gauge",
+		"go_memstats_alloc_bytes":            "gauge",
+		"go_memstats_gc_cycles_total":        "counter",
+		"go_memstats_gc_pause_seconds_total": "counter",
+		"goa_websocket_connections":          "gauge",
+	}
+	for name, kind := range types {
+		if !strings.Contains(body, "# TYPE "+name+" "+kind+"\n") {
+			t.Errorf("%s is not declared as a %s", name, kind)
+		}
+	}
+}
+
+func TestCustomMetrics(t *testing.T) {
+	var signups *core.Counter
+	app := metricsApp(t, goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		signups = app.Router.Metrics.NewCounter("shop_signups_total", "Signups by plan.", "plan")
+		app.Router.RegisterAPIHandler("/api/signup", http.MethodPost, func(ctx *core.APIContext) {
+			signups.Inc(ctx.Request.URL.Query().Get("plan"))
+			ctx.Success("ok", http.StatusCreated)
+		})
+	}))
+
+	app.PostJSON(`/api/signup?plan=pro`, nil)
+	app.PostJSON(`/api/signup?plan=pro`, nil)
+	app.PostJSON(`/api/signup?plan=say+%22hi%22`, nil)
+
+	samples, body := scrape(t, app)
+	if samples[`shop_signups_total{plan="pro"}`] != 2 {
+		t.Errorf("pro signups = %v", samples[`shop_signups_total{plan="pro"}`])
+	}
+	if samples[`shop_signups_total{plan="say \"hi\""}`] != 1 {
+		t.Errorf("label value was not escaped:\n%s", body)
+	}
+	if !strings.Contains(body, "# HELP shop_signups_total Signups by plan.\n") {
+		t.Error("custom metric has no HELP line")
+	}
+}
+
+func TestMetricsRegistryRejectsBadNames(t *testing.T) {
+	registry := core.NewMetricsRegistry()
+	registry.NewGauge("queue_depth", "Jobs waiting.")
+
+	for _, name := range []string{"queue_depth", "2fast", "has-dash"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q did not panic", name)
+				}
+			}()
+			registry.NewCounter(name, "")
+		}()
+	}
+}
+
+func TestMetricsHistogramBuckets(t *testing.T) {
+	registry := core.NewMetricsRegistry()
+	latency := registry.NewHistogram("job_seconds", "Job latency.", []float64{1, 0.1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var out bytes.Buffer
+	registry.WriteTo(&out)
+	want := strings.Join([]string{
+		"# HELP job_seconds Job latency.",
+		"# TYPE job_seconds histogram",
+		`job_seconds_bucket{le="0.1"} 1`,
+		`job_seconds_bucket{le="1"} 2`,
+		`job_seconds_bucket{le="+Inf"} 3`,
+		"job_seconds_sum 5.55",
+		"job_seconds_count 3",
+	}, "\n") + "\n"
+	if out.String() != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -37,7 +38,7 @@ func LoggingMiddleware(logger *AppLogger) MiddlewareFunc {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			next.ServeHTTP(w, r)
-			logger.InfoLog.Printf("%s %s %s %v", r.Method, r.URL.Path, r.RemoteAddr, time.Since(start))
+			requestLogger(logger, r).Info("Request", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "duration", time.Since(start))
 		})
 	}
 }
@@ -47,7 +48,7 @@ func RecoveryMiddleware(logger *AppLogger) MiddlewareFunc {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
-					logger.ErrorLog.Printf("Panic recovered: %v", err)
+					requestLogger(logger, r).Error("Panic recovered", "panic", fmt.Sprint(err))
 					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				}
 			}()
@@ -69,65 +70,10 @@ func AuthMiddleware(validateToken func(string) bool) MiddlewareFunc {
 	}
 }
 
-func CORSMiddleware(allowedOrigins []string) MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			origin := r.Header.Get("Origin")
-			for _, allowed := range allowedOrigins {
-				if allowed == "*" || allowed == origin {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-					w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-					w.Header().Set("Access-Control-Allow-Credentials", "true")
-					break
-				}
-			}
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
+// RateLimitMiddleware allows each client IP requestsPerMinute requests per
+// minute. Use Router.RateLimit to honour trusted proxies or set custom keys.
 func RateLimitMiddleware(requestsPerMinute int) MiddlewareFunc {
-	type client struct {
-		requests int
-		lastTime time.Time
-	}
-
-	clients := make(map[string]*client)
-	ticker := time.NewTicker(time.Minute)
-
-	go func() {
-		for range ticker.C {
-			for ip := range clients {
-				clients[ip].requests = 0
-			}
-		}
-	}()
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip := r.RemoteAddr
-			c, exists := clients[ip]
-			if !exists {
-				c = &client{requests: 0, lastTime: time.Now()}
-				clients[ip] = c
-			}
-
-			if c.requests >= requestsPerMinute {
-				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
-				return
-			}
-
-			c.requests++
-			next.ServeHTTP(w, r)
-		})
-	}
+	return NewRateLimiter(RateLimitOptions{Requests: requestsPerMinute, Window: time.Minute}).Middleware()
 }
 
 func ContextMiddleware(key interface{}, value interface{}) MiddlewareFunc {
@@ -139,48 +85,35 @@ func ContextMiddleware(key interface{}, value interface{}) MiddlewareFunc {
 	}
 }
 
-func SecureHeadersMiddleware() MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("X-Content-Type-Options", "nosniff")
-			w.Header().Set("X-Frame-Options", "DENY")
-			w.Header().Set("X-XSS-Protection", "1; mode=block")
-			w.Header().Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
-
-func SSGMiddleware(logger *AppLogger) MiddlewareFunc {
+func SSGMiddleware(config *Config, logger *AppLogger) MiddlewareFunc {
 	
-	if AppConfig.SSGEnabled {
+	if config.SSGEnabled {
 		
-		if !strings.HasPrefix(AppConfig.SSGDir, AppConfig.StaticDir) {
-			logger.WarnLog.Printf("SSG directory should be under the static directory. Current configuration: %s, Static: %s",
-				AppConfig.SSGDir, AppConfig.StaticDir)
+		if !strings.HasPrefix(config.SSGDir, config.StaticDir) {
+			logger.Warnf("SSG directory should be under the static directory. Current configuration: %s, Static: %s",
+				config.SSGDir, config.StaticDir)
 
 			
-			AppConfig.SSGDir = filepath.Join(AppConfig.StaticDir, "generated")
-			logger.InfoLog.Printf("Auto-corrected SSG directory to: %s", AppConfig.SSGDir)
+			config.SSGDir = filepath.Join(config.StaticDir, "generated")
+			logger.Infof("Auto-corrected SSG directory to: %s", config.SSGDir)
 		}
 
 		
-		if err := os.MkdirAll(AppConfig.SSGDir, 0755); err != nil {
-			logger.ErrorLog.Printf("Failed to create SSG directory: %v", err)
+		if err := os.MkdirAll(config.SSGDir, 0755); err != nil {
+			logger.Errorf("Failed to create SSG directory: %v", err)
 		} else {
-			logger.InfoLog.Printf("SSG directory created/verified at: %s", AppConfig.SSGDir)
+			logger.Infof("SSG directory created/verified at: %s", config.SSGDir)
 
 			
-			staticGenPath := filepath.Join(AppConfig.StaticDir, "generated")
-			if AppConfig.SSGDir != staticGenPath {
+			staticGenPath := filepath.Join(config.StaticDir, "generated")
+			if config.SSGDir != staticGenPath {
 				if err := os.MkdirAll(staticGenPath, 0755); err != nil {
-					logger.ErrorLog.Printf("Failed to create static generated directory: %v", err)
+					logger.Errorf("Failed to create static generated directory: %v", err)
 				}
 
 				
-				if AppConfig.SSGDir != staticGenPath {
-					logger.InfoLog.Printf("Ensuring SSG directory is accessible via static route")
+				if config.SSGDir != staticGenPath {
+					logger.Infof("Ensuring SSG directory is accessible via static route")
 				}
 			}
 		}
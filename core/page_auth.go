@@ -0,0 +1,60 @@
+package core
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// pageAuthRule returns the access rule declared by a page's auth:required or
+// roles: directive, or nil for public pages.
+func (m *Marley) pageAuthRule(routePath string) *AuthRule {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if metadata, ok := m.PageMetadata[routePath]; ok {
+		return metadata.Auth
+	}
+	return nil
+}
+
+// authorizePage enforces a page's access rule and reports whether rendering
+// may go on. Anonymous visitors are sent to Config.AuthLoginPath with the page
+// they asked for in "next", or shown a 401 page when no login page is set;
+// signed-in users without a required role get a 403 page.
+func (r *Router) authorizePage(w http.ResponseWriter, req *http.Request, pagePath string, rule *AuthRule, tokenErr error) bool {
+	status := authorize(w, req, rule, tokenErr)
+	if status == 0 {
+		return true
+	}
+
+	LoggerFromContext(req.Context()).Debug("Page request not authorized", "route", pagePath, "status", status)
+
+	// The login path and "next" are app-relative; mountBasePath prefixes the
+	// Location header when the app is served under a base path.
+	loginPath := r.Config.AuthLoginPath
+	loginRoute, _, _ := strings.Cut(loginPath, "?")
+	if status == http.StatusUnauthorized && loginPath != "" && normalizePath(loginRoute) != normalizePath(req.URL.Path) {
+		w.Header().Del("WWW-Authenticate")
+
+		separator := "?"
+		if strings.Contains(loginPath, "?") {
+			separator = "&"
+		}
+		target := loginPath + separator + "next=" + url.QueryEscape(req.URL.RequestURI())
+
+		redirectStatus := http.StatusFound
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			redirectStatus = http.StatusSeeOther
+		}
+		http.Redirect(w, req, target, redirectStatus)
+		return false
+	}
+
+	message := "You need to sign in to view this page"
+	if status == http.StatusForbidden {
+		message = "You do not have access to this page"
+	}
+	r.serveErrorPage(w, req, status, message)
+	return false
+}
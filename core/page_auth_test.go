@@ -0,0 +1,110 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pageAuthApp(t *testing.T, configure func(*core.Config)) *goatest.App {
+	t.Helper()
+
+	return newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.JWTEnabled = true
+		c.JWTSecret = jwtSecret
+		if configure != nil {
+			configure(c)
+		}
+	}))
+}
+
+func TestProtectedPageRedirectsToLogin(t *testing.T) {
+	app := pageAuthApp(t, func(c *core.Config) {
+		c.AuthLoginPath = "/login?from=app"
+	})
+
+	app.Get("/dashboard?tab=1").
+		AssertStatus(http.StatusFound).
+		AssertHeader("Location", "/login?from=app&next=%2Fdashboard%3Ftab%3D1").
+		AssertHeader("WWW-Authenticate", "")
+	app.PostForm("/dashboard", map[string]string{"a": "b"}).AssertStatus(http.StatusSeeOther)
+	app.Request(http.MethodGet, "/dashboard", nil, "Authorization", "Bearer expired.or.forged").
+		AssertStatus(http.StatusFound)
+
+	app.Request(http.MethodGet, "/dashboard", nil, "Authorization", bearer(t, claimsFor("ada"))).
+		AssertStatus(http.StatusOK).
+		AssertText("p.user", "ada")
+
+	app.Get("/").AssertStatus(http.StatusOK)
+}
+
+func TestProtectedPageWithoutLoginPath(t *testing.T) {
+	app := pageAuthApp(t, nil)
+
+	res := app.Get("/dashboard").
+		AssertStatus(http.StatusUnauthorized).
+		AssertHeader("WWW-Authenticate", "Bearer").
+		AssertContains("You need to sign in to view this page")
+	if strings.Contains(res.String(), "<h1>Dashboard</h1>") {
+		t.Error("protected content rendered for an anonymous visitor")
+	}
+
+	// A login page that is itself protected must not redirect to itself.
+	loop := pageAuthApp(t, func(c *core.Config) {
+		c.AuthLoginPath = "/dashboard"
+	})
+	loop.Get("/dashboard").AssertStatus(http.StatusUnauthorized)
+}
+
+func TestPageRolesDirective(t *testing.T) {
+	app := pageAuthApp(t, func(c *core.Config) {
+		c.AuthLoginPath = "/login"
+	})
+
+	app.Get("/admin").AssertStatus(http.StatusFound)
+	app.Request(http.MethodGet, "/admin", nil, "Authorization", bearer(t, claimsFor("ada", "roles", []string{"viewer"}))).
+		AssertStatus(http.StatusForbidden).
+		AssertContains("You do not have access to this page")
+	app.Request(http.MethodGet, "/admin", nil, "Authorization", bearer(t, claimsFor("ada", "roles", "editor"))).
+		AssertStatus(http.StatusOK).
+		AssertText("h1", "Admin")
+}
+
+func TestProtectedPagesAreNeverShared(t *testing.T) {
+	ssgDir := t.TempDir()
+	app := pageAuthApp(t, func(c *core.Config) {
+		c.TemplateCache = true
+		c.SSGEnabled = true
+		c.SSGCacheEnabled = true
+		c.SSGDir = ssgDir
+	})
+
+	app.Request(http.MethodGet, "/dashboard", nil, "Authorization", bearer(t, claimsFor("ada"))).AssertStatus(http.StatusOK)
+	app.Get("/dashboard").AssertStatus(http.StatusUnauthorized)
+
+	// The render:ssg directive is ignored on a protected page.
+	app.Get("/reports").AssertStatus(http.StatusUnauthorized)
+	app.Request(http.MethodGet, "/reports", nil, "Authorization", bearer(t, claimsFor("ada"))).
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-SSG-Cached", "").
+		AssertText("h1", "Reports")
+	if _, err := os.Stat(filepath.Join(ssgDir, "reports.html")); !os.IsNotExist(err) {
+		t.Errorf("protected page written to the public SSG output: %v", err)
+	}
+}
+
+func TestProtectedPageLoginRedirectUnderBasePath(t *testing.T) {
+	app := mountedApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.JWTEnabled = true
+		c.JWTSecret = jwtSecret
+		c.AuthLoginPath = "/login"
+	}))
+
+	app.Get("/portal/dashboard").
+		AssertStatus(http.StatusFound).
+		AssertHeader("Location", "/portal/login?next=%2Fdashboard")
+}
@@ -35,13 +35,22 @@ type APIError struct {
 }
 
 
-var pageErrorMap = sync.Map{}
+type ErrorRegistry struct {
+	pages           sync.Map
+	apis            sync.Map
+	breakers        sync.Map
+	breakerSettings CircuitBreakerSettings
+}
 
 
-var apiErrorMap = sync.Map{}
+func NewErrorRegistry(config *Config) *ErrorRegistry {
+	return &ErrorRegistry{
+		breakerSettings: circuitBreakerSettingsFromConfig(config),
+	}
+}
 
 
-func RegisterPageError(routePath string, err error, code int) *PageError {
+func (er *ErrorRegistry) RegisterPageError(routePath string, err error, code int) *PageError {
 	if err == nil {
 		return nil
 	}
@@ -60,13 +69,13 @@ func RegisterPageError(routePath string, err error, code int) *PageError {
 		Original: err,
 	}
 
-	
-	pageErrorMap.Store(routePath, pe)
+
+	er.pages.Store(routePath, pe)
 	return pe
 }
 
 
-func RegisterAPIError(path string, method string, err error, code int) *APIError {
+func (er *ErrorRegistry) RegisterAPIError(path string, method string, err error, code int) *APIError {
 	if err == nil {
 		return nil
 	}
@@ -81,15 +90,15 @@ func RegisterAPIError(path string, method string, err error, code int) *APIError
 		Original: err,
 	}
 
-	
+
 	key := fmt.Sprintf("%s:%s", method, path)
-	apiErrorMap.Store(key, apiErr)
+	er.apis.Store(key, apiErr)
 	return apiErr
 }
 
 
-func GetPageError(routePath string) *PageError {
-	if value, exists := pageErrorMap.Load(routePath); exists {
+func (er *ErrorRegistry) GetPageError(routePath string) *PageError {
+	if value, exists := er.pages.Load(routePath); exists {
 		if pe, ok := value.(*PageError); ok {
 			return pe
 		}
@@ -98,9 +107,9 @@ func GetPageError(routePath string) *PageError {
 }
 
 
-func GetAPIError(path string, method string) *APIError {
+func (er *ErrorRegistry) GetAPIError(path string, method string) *APIError {
 	key := fmt.Sprintf("%s:%s", method, path)
-	if value, exists := apiErrorMap.Load(key); exists {
+	if value, exists := er.apis.Load(key); exists {
 		if apiErr, ok := value.(*APIError); ok {
 			return apiErr
 		}
@@ -109,32 +118,73 @@ func GetAPIError(path string, method string) *APIError {
 }
 
 
-func ClearPageError(routePath string) {
-	pageErrorMap.Delete(routePath)
+func (er *ErrorRegistry) ClearPageError(routePath string) {
+	er.pages.Delete(routePath)
+	if value, exists := er.breakers.Load(fmt.Sprintf("%s:%s", pageBreakerMethod, routePath)); exists {
+		value.(*CircuitBreaker).Reset()
+	}
 }
 
 
-func ClearAPIError(path string, method string) {
+func (er *ErrorRegistry) ClearAPIError(path string, method string) {
 	key := fmt.Sprintf("%s:%s", method, path)
-	apiErrorMap.Delete(key)
+	er.apis.Delete(key)
+}
+
+
+func (er *ErrorRegistry) ClearAll() {
+	er.pages.Range(func(key, _ interface{}) bool {
+		er.pages.Delete(key)
+		return true
+	})
+
+	er.apis.Range(func(key, _ interface{}) bool {
+		er.apis.Delete(key)
+		return true
+	})
+
+	er.breakers.Range(func(_, value interface{}) bool {
+		value.(*CircuitBreaker).Reset()
+		return true
+	})
 }
 
 
-func HasPageError(routePath string) bool {
-	_, exists := pageErrorMap.Load(routePath)
+func (er *ErrorRegistry) HasPageError(routePath string) bool {
+	_, exists := er.pages.Load(routePath)
 	return exists
 }
 
 
-func HasAPIError(path string, method string) bool {
+func (er *ErrorRegistry) HasAPIError(path string, method string) bool {
 	key := fmt.Sprintf("%s:%s", method, path)
-	_, exists := apiErrorMap.Load(key)
+	_, exists := er.apis.Load(key)
 	return exists
 }
 
 
+func (er *ErrorRegistry) PageErrors() []*PageError {
+	var pageErrors []*PageError
+	er.pages.Range(func(_, value interface{}) bool {
+		pageErrors = append(pageErrors, value.(*PageError))
+		return true
+	})
+	return pageErrors
+}
+
+
+func (er *ErrorRegistry) APIErrors() []*APIError {
+	var apiErrors []*APIError
+	er.apis.Range(func(_, value interface{}) bool {
+		apiErrors = append(apiErrors, value.(*APIError))
+		return true
+	})
+	return apiErrors
+}
+
+
 func (r *Router) RenderErrorPage(w http.ResponseWriter, req *http.Request, routePath string) {
-	pageError := GetPageError(routePath)
+	pageError := r.Errors.GetPageError(routePath)
 	if pageError == nil {
 		pageError = &PageError{
 			Title:   "Unknown Error",
@@ -145,29 +195,29 @@ func (r *Router) RenderErrorPage(w http.ResponseWriter, req *http.Request, route
 		}
 	}
 
-	
+
 	errorTemplatePath := filepath.Join("core", "page", "error.html")
 	errorTemplate, err := template.ParseFiles(errorTemplatePath)
 
 	if err != nil {
-		r.Logger.ErrorLog.Printf("Failed to parse error template: %v", err)
+		r.Logger.Errorf("Failed to parse error template: %v", err)
 		r.renderFallbackErrorPage(w, pageError)
 		return
 	}
 
-	
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(pageError.Code)
 
-	
+
 	err = errorTemplate.Execute(w, map[string]interface{}{
 		"Error":  pageError,
-		"Config": &AppConfig,
+		"Config": r.Config,
 		"Route":  routePath,
 	})
 
 	if err != nil {
-		r.Logger.ErrorLog.Printf("Failed to execute error template: %v", err)
+		r.Logger.Errorf("Failed to execute error template: %v", err)
 		r.renderFallbackErrorPage(w, pageError)
 	}
 }
@@ -177,13 +227,13 @@ func (r *Router) renderFallbackErrorPage(w http.ResponseWriter, pageError *PageE
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(pageError.Code)
 
-	
+
 	detailsSection := ""
 	if pageError.Details != "" {
 		detailsSection = fmt.Sprintf("<pre>%s</pre>", pageError.Details)
 	}
 
-	
+
 	errorHTML := fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
@@ -203,7 +253,7 @@ func (r *Router) renderFallbackErrorPage(w http.ResponseWriter, pageError *PageE
         <p><strong>Time:</strong> %s</p>
     </div>
     %s
-    <p><a href="/">Return to Home</a></p>
+    <p><a href="%s">Return to Home</a></p>
 </body>
 </html>`,
 		pageError.Title,
@@ -211,6 +261,7 @@ func (r *Router) renderFallbackErrorPage(w http.ResponseWriter, pageError *PageE
 		pageError.Path,
 		pageError.Time,
 		detailsSection,
+		template.HTMLEscapeString(r.Config.URL("/")),
 	)
 
 	io.WriteString(w, errorHTML)
@@ -0,0 +1,325 @@
+package core
+
+import (
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateLimitShards = 32
+
+// RateLimitOptions configure a token bucket per client: each client may burst
+// up to Requests and regains Requests tokens evenly over Window.
+type RateLimitOptions struct {
+	Requests int
+	Window   time.Duration
+
+	// Key identifies the client. Defaults to the client IP, honouring
+	// X-Forwarded-For only from TrustedProxies.
+	Key func(r *http.Request) string
+
+	// KeyLimit overrides Requests for particular keys, e.g. a higher quota for
+	// an API key. Returning 0 keeps the default.
+	KeyLimit func(key string) int
+
+	// TrustedProxies lists proxy IPs or CIDRs whose X-Forwarded-For header is
+	// believed. Routes registered with WithRateLimit default to
+	// Config.TrustedProxies.
+	TrustedProxies []string
+}
+
+// RateLimitResult describes a client's bucket after a request was counted.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type RateLimiter struct {
+	options        RateLimitOptions
+	trustedProxies []*net.IPNet
+	shards         [rateLimitShards]rateLimitShard
+}
+
+type rateLimitShard struct {
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func WithRateLimit(requests int, window time.Duration) APIOption {
+	return WithRateLimitOptions(RateLimitOptions{Requests: requests, Window: window})
+}
+
+func WithRateLimitOptions(options RateLimitOptions) APIOption {
+	return func(o *APIRouteOptions) {
+		opts := options
+		o.RateLimit = &opts
+	}
+}
+
+// NewRateLimiter creates a limiter. Invalid TrustedProxies entries are ignored.
+func NewRateLimiter(options RateLimitOptions) *RateLimiter {
+	if options.Window <= 0 {
+		options.Window = time.Minute
+	}
+
+	trusted, _ := ParseTrustedProxies(options.TrustedProxies)
+
+	rl := &RateLimiter{options: options, trustedProxies: trusted}
+	for i := range rl.shards {
+		rl.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	return rl
+}
+
+// Middleware rejects requests over the limit with 429 and adds RateLimit-*
+// headers to every response.
+func (rl *RateLimiter) Middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !rl.serve(w, r) {
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// serve counts r against its client's bucket and sets the rate limit headers.
+// It reports whether the request may proceed.
+func (rl *RateLimiter) serve(w http.ResponseWriter, r *http.Request) bool {
+	result := rl.Allow(rl.key(r))
+	setRateLimitHeaders(w.Header(), result, rl.options.Window)
+	return result.Allowed
+}
+
+func (rl *RateLimiter) key(r *http.Request) string {
+	if rl.options.Key != nil {
+		return rl.options.Key(r)
+	}
+	return ClientIP(r, rl.trustedProxies)
+}
+
+func (rl *RateLimiter) limitFor(key string) int {
+	if rl.options.KeyLimit != nil {
+		if limit := rl.options.KeyLimit(key); limit > 0 {
+			return limit
+		}
+	}
+	return rl.options.Requests
+}
+
+// Allow takes a token from key's bucket if one is available.
+func (rl *RateLimiter) Allow(key string) RateLimitResult {
+	limit := rl.limitFor(key)
+	if limit <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+
+	capacity := float64(limit)
+	perToken := rl.options.Window / time.Duration(limit)
+	if perToken <= 0 {
+		perToken = time.Nanosecond
+	}
+	now := time.Now()
+
+	shard := &rl.shards[shardFor(key)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if now.Sub(shard.lastSweep) > rl.options.Window {
+		shard.sweep(now, rl.options.Window)
+	}
+
+	bucket, ok := shard.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		shard.buckets[key] = bucket
+	} else {
+		refill := float64(now.Sub(bucket.last)) / float64(perToken)
+		bucket.tokens = math.Min(capacity, bucket.tokens+refill)
+		bucket.last = now
+	}
+
+	result := RateLimitResult{Limit: limit}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(bucket.tokens)
+	result.Reset = time.Duration((capacity - bucket.tokens) * float64(perToken))
+	return result
+}
+
+// sweep drops buckets idle long enough to have refilled completely; a missing
+// bucket behaves exactly like a full one.
+func (s *rateLimitShard) sweep(now time.Time, window time.Duration) {
+	for key, bucket := range s.buckets {
+		if now.Sub(bucket.last) >= window {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func shardFor(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % rateLimitShards)
+}
+
+func setRateLimitHeaders(h http.Header, result RateLimitResult, window time.Duration) {
+	if result.Limit <= 0 {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(result.Limit)+";w="+strconv.Itoa(ceilSeconds(window)))
+
+	if !result.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ParseTrustedProxies parses IPs and CIDRs, returning the valid ones and an
+// error naming the first invalid entry.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	var firstErr error
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				if firstErr == nil {
+					firstErr = &net.ParseError{Type: "IP address", Text: entry}
+				}
+				continue
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, firstErr
+}
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// only believed when the direct peer is a trusted proxy, and is then read right
+// to left, skipping further trusted proxies, so clients cannot spoof it.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+
+	if len(trustedProxies) == 0 || !ipTrusted(net.ParseIP(peer), trustedProxies) {
+		return peer
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		candidate := strings.TrimSpace(forwarded[i])
+		ip := net.ParseIP(candidate)
+		if ip == nil {
+			break
+		}
+		if !ipTrusted(ip, trustedProxies) {
+			return ip.String()
+		}
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+	return peer
+}
+
+func ipTrusted(ip net.IP, trustedProxies []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rateLimiterFor returns the router's limiter for a route registered with
+// WithRateLimit, creating it on first use so each app counts separately.
+func (r *Router) rateLimiterFor(route *APIRoute) *RateLimiter {
+	key := route.Method + " " + route.Path
+	if limiter, ok := r.rateLimiters.Load(key); ok {
+		return limiter.(*RateLimiter)
+	}
+
+	options := *route.Options.RateLimit
+	if options.TrustedProxies == nil {
+		options.TrustedProxies = r.Config.TrustedProxies
+	}
+
+	limiter, _ := r.rateLimiters.LoadOrStore(key, NewRateLimiter(options))
+	return limiter.(*RateLimiter)
+}
+
+// allowRequest counts req against route's own limiter, or against the app-wide
+// RateLimiter when route is nil or has none, and reports whether it may
+// proceed. A batch is not counted itself; its items are, one by one.
+func (r *Router) allowRequest(w http.ResponseWriter, req *http.Request, route *APIRoute) bool {
+	if route != nil && route.Options.RateLimit != nil {
+		return r.rateLimiterFor(route).serve(w, req)
+	}
+	if r.RateLimiter == nil {
+		return true
+	}
+	return r.RateLimiter.serve(w, req)
+}
+
+// RateLimit returns middleware limiting every request it wraps, using
+// Config.TrustedProxies unless options name their own.
+func (r *Router) RateLimit(options RateLimitOptions) MiddlewareFunc {
+	if options.TrustedProxies == nil {
+		options.TrustedProxies = r.Config.TrustedProxies
+	}
+	return NewRateLimiter(options).Middleware()
+}
@@ -0,0 +1,225 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// getFrom sends a GET as if it came from remoteAddr, with optional header
+// name/value pairs.
+func getFrom(app *goatest.App, path, remoteAddr string, headers ...string) *goatest.Response {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Add(headers[i], headers[i+1])
+	}
+	return app.Do(req)
+}
+
+func TestGlobalRateLimit(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.RateLimit = 3
+	}))
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		// Each connection has its own port, but the client is the IP.
+		getFrom(app, "/", "203.0.113.5:"+strconv.Itoa(5000+i)).
+			AssertStatus(http.StatusOK).
+			AssertHeader("RateLimit-Limit", "3").
+			AssertHeader("RateLimit-Remaining", remaining).
+			AssertHeader("RateLimit-Policy", "3;w=60")
+	}
+
+	getFrom(app, "/", "203.0.113.5:5000").
+		AssertStatus(http.StatusTooManyRequests).
+		AssertHeader("RateLimit-Remaining", "0").
+		AssertHeader("Retry-After", "20")
+	getFrom(app, "/api/missing", "203.0.113.5:5000").AssertStatus(http.StatusTooManyRequests)
+
+	getFrom(app, "/", "198.51.100.7:4000").AssertStatus(http.StatusOK)
+	app.Get("/healthz").AssertStatus(http.StatusOK)
+}
+
+func TestRouteRateLimitOverridesGlobal(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.RateLimit = 100
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/login", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Success("ok", http.StatusOK)
+		}, core.WithRateLimit(2, time.Hour))
+		app.Router.RegisterAPIHandler("/api/login", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success("ok", http.StatusOK)
+		})
+	}))
+
+	app.PostJSON("/api/login", nil).AssertStatus(http.StatusOK).AssertHeader("RateLimit-Limit", "2")
+	app.PostJSON("/api/login", nil).AssertStatus(http.StatusOK)
+	app.PostJSON("/api/login", nil).
+		AssertStatus(http.StatusTooManyRequests).
+		AssertHeader("RateLimit-Policy", "2;w=3600").
+		AssertHeader("Retry-After", "1800").
+		AssertContains("Too many requests")
+
+	app.Get("/api/login").AssertStatus(http.StatusOK).AssertHeader("RateLimit-Limit", "100")
+
+	// Each app keeps its own buckets for the same route.
+	other := newTestApp(t, withAPI("/api/login", http.MethodPost, func(ctx *core.APIContext) {
+		ctx.Success("ok", http.StatusOK)
+	}, core.WithRateLimit(2, time.Hour)))
+	other.PostJSON("/api/login", nil).AssertStatus(http.StatusOK)
+}
+
+func TestRateLimitKeysAndKeyLimits(t *testing.T) {
+	app := newTestApp(t, withAPI("/api/search", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success("ok", http.StatusOK)
+	}, core.WithRateLimitOptions(core.RateLimitOptions{
+		Requests: 1,
+		Window:   time.Minute,
+		Key:      func(r *http.Request) string { return r.Header.Get("X-API-Key") },
+		KeyLimit: func(key string) int {
+			if key == "premium" {
+				return 3
+			}
+			return 0
+		},
+	})))
+
+	search := func(key string) *goatest.Response {
+		return app.Request(http.MethodGet, "/api/search", nil, "X-API-Key", key)
+	}
+
+	search("free").AssertStatus(http.StatusOK)
+	search("free").AssertStatus(http.StatusTooManyRequests)
+	for i := 0; i < 3; i++ {
+		search("premium").AssertStatus(http.StatusOK).AssertHeader("RateLimit-Limit", "3")
+	}
+	search("premium").AssertStatus(http.StatusTooManyRequests)
+}
+
+func TestRateLimitHonoursTrustedProxies(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.RateLimit = 1
+		c.TrustedProxies = []string{"10.0.0.0/8"}
+	}))
+
+	getFrom(app, "/", "10.0.0.2:1000", "X-Forwarded-For", "203.0.113.5").AssertStatus(http.StatusOK)
+	getFrom(app, "/", "10.0.0.3:1000", "X-Forwarded-For", "198.51.100.7").AssertStatus(http.StatusOK)
+	getFrom(app, "/", "10.0.0.2:1000", "X-Forwarded-For", "203.0.113.5").AssertStatus(http.StatusTooManyRequests)
+
+	// An untrusted peer cannot pick a fresh identity per request.
+	getFrom(app, "/", "192.0.2.9:1000", "X-Forwarded-For", "203.0.113.50").AssertStatus(http.StatusOK)
+	getFrom(app, "/", "192.0.2.9:1000", "X-Forwarded-For", "203.0.113.51").AssertStatus(http.StatusTooManyRequests)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := core.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.5:5123", nil, "", "203.0.113.5"},
+		{"untrusted peer forwarding", "203.0.113.5:5123", []string{"198.51.100.7"}, "", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:80", []string{"198.51.100.7"}, "", "198.51.100.7"},
+		{"spoofed leftmost entry", "10.1.2.3:80", []string{"1.1.1.1, 198.51.100.7"}, "", "198.51.100.7"},
+		{"chain of proxies", "10.1.2.3:80", []string{"198.51.100.7, 192.0.2.1", "10.9.9.9"}, "", "198.51.100.7"},
+		{"garbage stops the walk", "10.1.2.3:80", []string{"198.51.100.7, bogus"}, "", "10.1.2.3"},
+		{"real ip fallback", "10.1.2.3:80", nil, "198.51.100.8", "198.51.100.8"},
+		{"ipv6 proxy", "[2001:db8::1]:443", []string{"2001:db9::5"}, "", "2001:db9::5"},
+		{"no port", "203.0.113.5", nil, "", "203.0.113.5"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, value := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := core.ClientIP(req, trusted); got != tt.want {
+			t.Errorf("%s: ClientIP = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesReportsInvalidEntries(t *testing.T) {
+	networks, err := core.ParseTrustedProxies([]string{"10.0.0.1", "not-an-ip", "300.0.0.0/8", " 172.16.0.0/12 "})
+	if err == nil {
+		t.Error("invalid entries accepted silently")
+	}
+	if len(networks) != 2 {
+		t.Errorf("kept %d networks, want the 2 valid ones", len(networks))
+	}
+}
+
+func TestRateLimiterRefillsOverWindow(t *testing.T) {
+	limiter := core.NewRateLimiter(core.RateLimitOptions{Requests: 2, Window: 100 * time.Millisecond})
+
+	limiter.Allow("client")
+	limiter.Allow("client")
+	denied := limiter.Allow("client")
+	if denied.Allowed || denied.RetryAfter <= 0 || denied.RetryAfter > 50*time.Millisecond {
+		t.Fatalf("third request = %+v, want denied until one token refills", denied)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !limiter.Allow("client").Allowed {
+		t.Error("token did not refill after Window/Requests")
+	}
+	if limiter.Allow("client").Allowed {
+		t.Error("refill exceeded the elapsed time")
+	}
+}
+
+func TestRateLimiterIsSafeForConcurrentUse(t *testing.T) {
+	limiter := core.NewRateLimiter(core.RateLimitOptions{Requests: 50, Window: time.Hour})
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			limiter.Allow([]string{"a", "b"}[i%2])
+			if limiter.Allow("shared").Allowed {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if allowed != 50 {
+		t.Errorf("allowed %d requests from one client, want exactly 50", allowed)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limited := core.RateLimitMiddleware(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for i, want := range []int{http.StatusNoContent, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.5:" + strconv.Itoa(5000+i)
+		limited.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("request %d = %d, want %d", i+1, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+
+	// beforeHeader runs once, just before the status line and headers are sent.
+	beforeHeader []func()
+}
+
+func newStatusResponseWriter(w http.ResponseWriter) *statusResponseWriter {
+	return &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+		w.runBeforeHeader()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.runBeforeHeader()
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// onBeforeHeader registers fn to run just before the headers are sent, after
+// any functions registered earlier.
+func (w *statusResponseWriter) onBeforeHeader(fn func()) {
+	w.beforeHeader = append(w.beforeHeader, fn)
+}
+
+func (w *statusResponseWriter) runBeforeHeader() {
+	hooks := w.beforeHeader
+	w.beforeHeader = nil
+	for _, fn := range hooks {
+		fn()
+	}
+}
+
+func (w *statusResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *statusResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.runBeforeHeader()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
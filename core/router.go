@@ -1,12 +1,17 @@
 package core
 
 import (
+	"context"
 	"fmt"
+	"html/template"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,20 +19,131 @@ import (
 
 var paramRegex = regexp.MustCompile(`\[([^/\]]+)\]`)
 
-var apiRegistry = make(map[string]map[string]func(*APIContext))
-var apiRegistryMutex sync.RWMutex
+type APIRoute struct {
+	Path    string
+	Method  string
+	Handler func(*APIContext)
+	Options APIRouteOptions
+}
+
+type APIRouteOptions struct {
+	Idempotency *IdempotencyOptions
+	RateLimit   *RateLimitOptions
+	SkipCSRF    bool
+	Auth        *AuthRule
+	CORS        *CORSPolicy
+
+	// Timeout overrides Config.RequestTimeout; negative disables it.
+	Timeout time.Duration
+}
+
+type APIOption func(*APIRouteOptions)
+
+type APIRegistry struct {
+	routes map[string]map[string]*APIRoute
+	mutex  sync.RWMutex
+}
+
+// defaultAPIRegistry collects handlers registered from init() functions and is
+// copied into every Router when it is created.
+var defaultAPIRegistry = NewAPIRegistry()
+
+func NewAPIRegistry() *APIRegistry {
+	return &APIRegistry{
+		routes: make(map[string]map[string]*APIRoute),
+	}
+}
+
+func RegisterAPIHandler(path string, method string, handler func(*APIContext), options ...APIOption) {
+	defaultAPIRegistry.Register(path, method, handler, options...)
+}
 
-func RegisterAPIHandler(path string, method string, handler func(*APIContext)) {
-	apiRegistryMutex.Lock()
-	defer apiRegistryMutex.Unlock()
+func (ar *APIRegistry) Register(path string, method string, handler func(*APIContext), options ...APIOption) {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
 
 	path = normalizePath(path)
 
-	if _, ok := apiRegistry[path]; !ok {
-		apiRegistry[path] = make(map[string]func(*APIContext))
+	route := &APIRoute{
+		Path:    path,
+		Method:  method,
+		Handler: handler,
+	}
+	for _, option := range options {
+		option(&route.Options)
+	}
+
+	if _, ok := ar.routes[path]; !ok {
+		ar.routes[path] = make(map[string]*APIRoute)
+	}
+	ar.routes[path][method] = route
+}
+
+// Match returns the route registered for the request, the registered path it
+// matched and the extracted path parameters.
+func (ar *APIRegistry) Match(method string, requestPath string) (*APIRoute, string, map[string]string) {
+	ar.mutex.RLock()
+	defer ar.mutex.RUnlock()
+
+	var matchedRoute *APIRoute
+	var matchedParams map[string]string
+	var matchedPath string
+
+	for registeredPath, methodMap := range ar.routes {
+		params, ok := matchPath(registeredPath, requestPath)
+		if ok {
+			if route, methodExists := methodMap[method]; methodExists {
+				matchedRoute = route
+				matchedParams = params
+				matchedPath = registeredPath
+			} else if route, anyMethodExists := methodMap["*"]; anyMethodExists {
+				matchedRoute = route
+				matchedParams = params
+				matchedPath = registeredPath
+			}
+		}
+	}
+
+	return matchedRoute, matchedPath, matchedParams
+}
+
+func (ar *APIRegistry) Routes() []*APIRoute {
+	ar.mutex.RLock()
+	defer ar.mutex.RUnlock()
+
+	var routes []*APIRoute
+	for _, methodMap := range ar.routes {
+		for _, route := range methodMap {
+			routes = append(routes, route)
+		}
 	}
-	apiRegistry[path][method] = handler
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
 
+func (ar *APIRegistry) Clone() *APIRegistry {
+	ar.mutex.RLock()
+	defer ar.mutex.RUnlock()
+
+	clone := NewAPIRegistry()
+	for path, methodMap := range ar.routes {
+		clone.routes[path] = make(map[string]*APIRoute, len(methodMap))
+		for method, route := range methodMap {
+			clone.routes[path][method] = route
+		}
+	}
+	return clone
+}
+
+func (ar *APIRegistry) Clear() {
+	ar.mutex.Lock()
+	defer ar.mutex.Unlock()
+	ar.routes = make(map[string]map[string]*APIRoute)
 }
 
 type Route struct {
@@ -45,8 +161,30 @@ type Router struct {
 	Marley           *Marley
 	StaticDir        string
 	Logger           *AppLogger
+	Config           *Config
+	Errors           *ErrorRegistry
+	API              *APIRegistry
+	IdempotencyStore IdempotencyStore
 	GlobalMiddleware *MiddlewareChain
+	Metrics          *MetricsRegistry
+	Tracer           *Tracer
+	Sessions         *SessionManager
+	Auth             *JWTVerifier
+	CORS             *CORSPolicy
+	CSP              *CSPPolicy
+	SecurityHeaders  *SecurityHeaders
+	RateLimiter      *RateLimiter
 	mutex            sync.RWMutex
+	metrics          *frameworkMetrics
+	rateLimiters     sync.Map
+	trustedProxies   []*net.IPNet
+
+	// configErr is the first configuration error found while building the
+	// router that must stop the app from starting; Init returns it.
+	configErr error
+
+	sockets      map[string]*SocketEndpoint
+	socketsMutex sync.RWMutex
 }
 
 type RouteContext struct {
@@ -63,6 +201,9 @@ type APIContext struct {
 	Writer  http.ResponseWriter
 	Params  map[string]string
 	Config  *Config
+
+	router *Router
+	logger *AppLogger
 }
 
 func (ctx *APIContext) Success(data interface{}, statusCode int) {
@@ -81,14 +222,149 @@ func (ctx *APIContext) QueryParams() map[string]interface{} {
 	return ParseJSONParams(ctx.Request)
 }
 
-func NewRouter(logger *AppLogger) *Router {
-	return &Router{
+// Socket returns the app's WebSocket endpoint registered at path, or nil.
+func (ctx *APIContext) Socket(path string) *SocketEndpoint {
+	if ctx.router == nil {
+		return nil
+	}
+	return ctx.router.Socket(path)
+}
+
+// Logger returns the request's logger, which tags every message with the
+// request id and route pattern.
+func (ctx *APIContext) Logger() *AppLogger {
+	if ctx.logger != nil {
+		return ctx.logger
+	}
+	if logger := LoggerFromContext(ctx.Request.Context()); logger != nil {
+		return logger
+	}
+	return ctx.router.Logger
+}
+
+// TraceContext returns the current span context. Pass it to Inject to continue
+// the trace on outbound requests.
+func (ctx *APIContext) TraceContext() SpanContext {
+	return SpanContextFromContext(ctx.Request.Context())
+}
+
+// Span returns the API handler's span, or nil when tracing is disabled.
+func (ctx *APIContext) Span() *Span {
+	return SpanFromContext(ctx.Request.Context())
+}
+
+// Session returns the visitor's session, or nil when sessions are disabled.
+// A nil session reads as empty and ignores writes.
+func (ctx *APIContext) Session() *Session {
+	return SessionFromContext(ctx.Request.Context())
+}
+
+// Context returns the request's context, which is cancelled when the route's
+// timeout passes or the client goes away. Pass it to database and HTTP calls
+// so they stop with the request.
+func (ctx *APIContext) Context() context.Context {
+	return ctx.Request.Context()
+}
+
+// User returns the claims of the request's verified JWT, or nil for anonymous
+// requests.
+func (ctx *APIContext) User() Claims {
+	return ClaimsFromContext(ctx.Request.Context())
+}
+
+// CSRFToken returns a token for the client to send back in the X-CSRF-Token
+// header, or "" when CSRF protection is disabled.
+func (ctx *APIContext) CSRFToken() string {
+	return CSRFToken(ctx.Request.Context())
+}
+
+// Metrics returns the app's metrics registry for registering custom metrics.
+func (ctx *APIContext) Metrics() *MetricsRegistry {
+	if ctx.router == nil {
+		return nil
+	}
+	return ctx.router.Metrics
+}
+
+func NewRouter(config *Config, logger *AppLogger) *Router {
+	errors := NewErrorRegistry(config)
+
+	r := &Router{
 		Routes:           []Route{},
-		Marley:           NewMarley(logger),
-		StaticDir:        AppConfig.StaticDir,
+		Marley:           NewMarley(config, logger, errors),
+		StaticDir:        config.StaticDir,
 		Logger:           logger,
+		Config:           config,
+		Errors:           errors,
+		API:              defaultAPIRegistry.Clone(),
+		IdempotencyStore: NewMemoryIdempotencyStore(),
 		GlobalMiddleware: NewMiddlewareChain(),
+		Metrics:          NewMetricsRegistry(),
+		Tracer:           newTracerFromConfig(config, logger),
+		sockets:          make(map[string]*SocketEndpoint),
+	}
+	r.registerRouterMetrics()
+
+	if config.SessionEnabled {
+		sessions, err := newSessionManagerFromConfig(config, logger)
+		if err != nil {
+			r.configErr = fmt.Errorf("invalid session configuration: %w", err)
+		} else {
+			r.Sessions = sessions
+		}
+	}
+
+	if config.JWTEnabled {
+		verifier, err := newJWTVerifierFromConfig(config, logger)
+		if err != nil {
+			if r.configErr == nil {
+				r.configErr = fmt.Errorf("invalid JWT configuration: %w", err)
+			}
+		} else {
+			r.Auth = verifier
+		}
 	}
+
+	if config.EnableCORS {
+		r.CORS = NewCORSPolicy(config.corsOptions())
+		for _, origin := range config.AllowedOrigins {
+			if origin == "*" && config.CORSAllowCredentials {
+				logger.Warn("CORS credentials are not allowed for origins matched only by \"*\"")
+			}
+		}
+	}
+
+	if config.RateLimit > 0 {
+		r.RateLimiter = NewRateLimiter(RateLimitOptions{
+			Requests:       config.RateLimit,
+			Window:         time.Minute,
+			TrustedProxies: config.TrustedProxies,
+		})
+	}
+
+	if config.CSPEnabled {
+		r.CSP = NewCSPPolicy(config.cspOptions())
+	}
+
+	if config.SecurityHeadersEnabled {
+		r.SecurityHeaders = NewSecurityHeaders(config.securityHeadersOptions(), config.SecurityHeaderRoutes...)
+	}
+
+	trusted, err := ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		logger.Warn("Ignoring invalid trusted proxy", "error", err)
+	}
+	r.trustedProxies = trusted
+
+	for path, handlers := range defaultSocketHandlers() {
+		r.sockets[path] = newSocketEndpoint(path, handlers, r)
+	}
+
+	return r
+}
+
+func (r *Router) RegisterAPIHandler(path string, method string, handler func(*APIContext), options ...APIOption) {
+	r.API.Register(path, method, handler, options...)
 }
 
 func (r *Router) Use(middleware MiddlewareFunc) {
@@ -124,11 +400,122 @@ func (r *Router) AddRoute(path string, handler http.HandlerFunc, middleware ...M
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	startTime := time.Now()
 	requestPath := normalizePath(req.URL.Path)
+	responseWriter := newStatusResponseWriter(w)
+	routeLabel := ""
+
+	requestCtx := req.Context()
+	if remote, ok := ParseTraceparent(req.Header.Get(TraceparentHeader)); ok {
+		requestCtx = ContextWithRemoteSpanContext(requestCtx, remote)
+	}
+	requestCtx, span := r.Tracer.Start(requestCtx, req.Method+" "+requestPath)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.RequestURI())
+
+	requestID := requestIDFromHeader(req.Header.Get(RequestIDHeader))
+	responseWriter.Header().Set(RequestIDHeader, requestID)
+	span.SetAttribute("request_id", requestID)
+
+	logger := r.Logger.With("request_id", requestID)
+	if sc := SpanContextFromContext(requestCtx); sc.IsValid() {
+		logger = logger.With("trace_id", sc.TraceID.String())
+	}
+	requestCtx = WithLogger(withRequestID(requestCtx, requestID), logger)
+
+	if r.Config.serverTimingEnabled() {
+		timing := newServerTiming()
+		requestCtx = withServerTiming(requestCtx, timing)
+		responseWriter.onBeforeHeader(func() {
+			responseWriter.Header().Set("Server-Timing", timing.header())
+		})
+	}
+
+	// Batch items share the batch request's session and CSRF state from the
+	// context, which the outer request saves and commits once.
+	batchItem := isBatchItem(requestCtx)
+
+	if r.Sessions != nil && !batchItem {
+		session := r.Sessions.session(req)
+		requestCtx = withSession(requestCtx, session)
+		responseWriter.onBeforeHeader(func() {
+			if err := r.Sessions.Save(responseWriter, session); err != nil {
+				logger.Error("Failed to save session", "error", err)
+			}
+		})
+	}
+
+	var tokenErr error
+	if r.Auth != nil {
+		if token := bearerToken(req, r.Config.JWTCookieName); token != "" {
+			claims, err := r.Auth.Verify(token)
+			if err != nil {
+				tokenErr = err
+				logger.Debug("Rejected bearer token", "error", err)
+			} else {
+				requestCtx = WithClaims(requestCtx, claims)
+				if subject := claims.Subject(); subject != "" {
+					logger = logger.With("user", subject)
+					requestCtx = WithLogger(requestCtx, logger)
+				}
+			}
+		}
+	}
+
+	var csrf *csrfState
+	if r.Config.CSRFEnabled && !batchItem {
+		csrf = r.newCSRFState(req)
+		requestCtx = withCSRF(requestCtx, csrf)
+		responseWriter.onBeforeHeader(func() {
+			csrf.commit(responseWriter)
+		})
+	}
+
+	if r.CSP != nil {
+		requestCtx = r.CSP.start(requestCtx, responseWriter)
+	}
+	if r.SecurityHeaders != nil {
+		r.SecurityHeaders.apply(responseWriter, req, requestPath)
+	}
+
+	req = req.WithContext(requestCtx)
+	if csrf != nil {
+		csrf.request = req
+	}
 
 	finalHandler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, matchSpan := StartSpan(req.Context(), "route.match")
+		stopMatchTiming := ServerTimingFromContext(req.Context()).Start("match")
+		matched := func(route string) {
+			stopMatchTiming()
+			routeLabel = route
+			matchSpan.SetAttribute("http.route", route)
+			matchSpan.End()
+		}
+
+		isAPI := strings.HasPrefix(requestPath, "/api") && !(r.Config.BatchEnabled && requestPath == batchPath)
+		if isPreflight(req) {
+			policy, route := r.CORS, ""
+			if isAPI {
+				if apiRoute, apiPath, _ := r.API.Match(req.Header.Get("Access-Control-Request-Method"), requestPath); apiRoute != nil {
+					route = apiPath
+					if apiRoute.Options.CORS != nil {
+						policy = apiRoute.Options.CORS
+					}
+				}
+			}
+			if policy != nil {
+				matched(route)
+				policy.servePreflight(w, req)
+				return
+			}
+		}
+		if !isAPI && r.CORS != nil {
+			r.CORS.apply(w, req)
+		}
+
 		if strings.HasPrefix(requestPath, "/static") {
 			for _, route := range r.Routes {
 				if route.IsStatic {
+					matched("/static")
 					route.Handler.ServeHTTP(w, req)
 					return
 				}
@@ -136,73 +523,174 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 
 		if strings.HasPrefix(requestPath, "/api") {
-			apiRegistryMutex.RLock()
-			var matchedHandler func(*APIContext)
-			var matchedParams map[string]string
-			var matchedPath string
-
-			for registeredPath, methodMap := range apiRegistry {
-				params, ok := matchPath(registeredPath, requestPath)
-				if ok {
-					matchedPath = registeredPath
-					if handler, methodExists := methodMap[req.Method]; methodExists {
-						matchedHandler = handler
-						matchedParams = params
-					} else if handler, anyMethodExists := methodMap["*"]; anyMethodExists {
-						matchedHandler = handler
-						matchedParams = params
-					}
+			if r.Config.BatchEnabled && requestPath == batchPath {
+				matched(batchPath)
+				if !r.checkCSRF(req, requestPath, false) {
+					RenderError(w, csrfRejectMessage, http.StatusForbidden)
+					return
 				}
+				r.serveBatch(w, req)
+				return
 			}
-			apiRegistryMutex.RUnlock()
 
-			if HasAPIError(matchedPath, req.Method) {
-				apiErr := GetAPIError(matchedPath, req.Method)
-				r.Logger.WarnLog.Printf("API endpoint has known error: %s %s: %s",
-					req.Method, matchedPath, apiErr.ErrorMsg)
+			matchedRoute, matchedPath, matchedParams := r.API.Match(req.Method, requestPath)
 
-				RenderError(w, apiErr.ErrorMsg, apiErr.Code)
-				return
-			}
+			if matchedRoute != nil {
+				matched(matchedPath)
 
-			if matchedHandler != nil {
+				if policy := matchedRoute.Options.CORS; policy != nil {
+					policy.apply(w, req)
+				} else if r.CORS != nil {
+					r.CORS.apply(w, req)
+				}
 
-				ctx := &APIContext{
-					Request: req,
-					Writer:  w,
-					Params:  matchedParams,
-					Config:  &AppConfig,
+				if !r.allowRequest(w, req, matchedRoute) {
+					logger.Debug("API rate limit exceeded", "method", req.Method, "route", matchedPath)
+					RenderError(w, "Too many requests", http.StatusTooManyRequests)
+					return
 				}
 
-				func() {
+				if rule := matchedRoute.Options.Auth; rule != nil {
+					if status := authorize(w, req, rule, tokenErr); status != 0 {
+						logger.Debug("API request not authorized", "method", req.Method, "route", matchedPath, "status", status)
+						RenderError(w, http.StatusText(status), status)
+						return
+					}
+				}
+
+				if !r.checkCSRF(req, requestPath, matchedRoute.Options.SkipCSRF) {
+					logger.Warn("CSRF check failed", "method", req.Method, "route", matchedPath)
+					RenderError(w, csrfRejectMessage, http.StatusForbidden)
+					return
+				}
+
+				breaker := r.Errors.CircuitBreaker(matchedPath, req.Method)
+
+				if !breaker.Allow() {
+					// The recorded failure may be a panic message, so clients
+					// only see it in dev mode; it is always logged.
+					errMsg := "Service temporarily unavailable"
+					var lastErr string
+					if apiErr := r.Errors.GetAPIError(matchedPath, req.Method); apiErr != nil {
+						lastErr = apiErr.ErrorMsg
+						if r.Config.DevMode {
+							errMsg = apiErr.ErrorMsg
+						}
+					}
+					logger.Warn("API circuit open", "method", req.Method, "route", matchedPath, "error", lastErr)
+
+					if retryAfter := breaker.RetryAfter(); retryAfter > 0 {
+						w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+					}
+					RenderError(w, errMsg, http.StatusServiceUnavailable)
+					return
+				}
+
+				handlerCtx, handlerSpan := StartSpan(req.Context(), "api.handler")
+				handlerSpan.SetAttribute("http.route", matchedPath)
+				handlerSpan.SetAttribute("http.method", req.Method)
+
+				var sw *statusResponseWriter
+				panicked := false
+				serve := func(w http.ResponseWriter, req *http.Request) {
+					sw = newStatusResponseWriter(w)
+					ctx := &APIContext{
+						Request: req,
+						Writer:  sw,
+						Params:  matchedParams,
+						Config:  r.Config,
+						router:  r,
+						logger:  logger.With("route", matchedPath),
+					}
+
 					defer func() {
 						if rec := recover(); rec != nil {
-							errMsg := fmt.Sprintf("API handler panic: %v", rec)
-							r.Logger.ErrorLog.Printf("%s %s - %s", req.Method, matchedPath, errMsg)
+							panicked = true
+							handlerSpan.RecordError(fmt.Errorf("panic: %v", rec))
+							logger.Error("API handler panic", "method", req.Method, "route", matchedPath, "panic", fmt.Sprint(rec))
 
-							RegisterAPIError(matchedPath, req.Method, fmt.Errorf("%v", rec), http.StatusInternalServerError)
+							r.Errors.RegisterAPIError(matchedPath, req.Method, fmt.Errorf("%v", rec), http.StatusInternalServerError)
 
 							RenderError(w, "Internal Server Error", http.StatusInternalServerError)
 						}
 					}()
 
-					matchedHandler(ctx)
-				}()
+					if matchedRoute.Options.Idempotency != nil {
+						r.serveIdempotent(ctx, matchedRoute, matchedRoute.Options.Idempotency)
+						return
+					}
+
+					matchedRoute.Handler(ctx)
+				}
+
+				var abandoned error
+				timeout := r.Config.routeTimeout(matchedRoute.Options.Timeout)
+				r.extendWriteDeadline(w, timeout)
+				if timeout > 0 {
+					timeoutStatus := r.Config.timeoutStatus()
+					abandoned = serveWithTimeout(w, req.WithContext(handlerCtx), timeout, serve, func(w http.ResponseWriter) {
+						RenderError(w, "Request timed out", timeoutStatus)
+					})
+					if abandoned == context.DeadlineExceeded {
+						logger.Warn("API request timed out", "method", req.Method, "route", matchedPath, "timeout", timeout)
+					}
+				} else {
+					serve(w, req.WithContext(handlerCtx))
+				}
+
+				// An abandoned handler may still be running, so its writer and
+				// panic flag are only read once it has returned. Its outcome is
+				// unknown and counts as a failure, which also releases a
+				// half-open circuit's probe slot.
+				if abandoned != nil {
+					handlerSpan.RecordError(abandoned)
+					handlerSpan.End()
+					if breaker.RecordFailure() {
+						logger.Warn("API circuit opened", "method", req.Method, "route", matchedPath)
+					}
+					return
+				}
+
+				failed := panicked
+				handlerSpan.SetAttribute("http.status_code", sw.Status())
+				if !failed && sw.Status() >= http.StatusInternalServerError {
+					handlerSpan.RecordError(fmt.Errorf("handler responded %d", sw.Status()))
+				}
+				handlerSpan.End()
+
+				if failed || sw.Status() >= http.StatusInternalServerError {
+					if breaker.RecordFailure() {
+						logger.Warn("API circuit opened", "method", req.Method, "route", matchedPath)
+					}
+				} else if breaker.RecordSuccess() {
+					r.Errors.ClearAPIError(matchedPath, req.Method)
+					logger.Info("API circuit closed, endpoint recovered", "method", req.Method, "route", matchedPath)
+				}
 				return
 			}
 
+			matched("")
+			if r.CORS != nil {
+				r.CORS.apply(w, req)
+			}
+			if !r.allowRequest(w, req, nil) {
+				RenderError(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
 			RenderError(w, "API endpoint not found or method not allowed", http.StatusNotFound)
 			return
 		}
 
 		var pageHandler http.HandlerFunc
 		var pageMiddleware *MiddlewareChain
+		pagePath := ""
 
 		for _, route := range r.Routes {
 			if !route.IsParam && !route.IsStatic {
 				if requestPath == route.Path {
 					pageHandler = route.Handler
 					pageMiddleware = route.Middleware
+					pagePath = route.Path
 					break
 				}
 			}
@@ -214,18 +702,49 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 					if route.Pattern.MatchString(requestPath) {
 						pageHandler = route.Handler
 						pageMiddleware = route.Middleware
+						pagePath = route.Path
 						break
 					}
 				}
 			}
 		}
 
+		matched(pagePath)
+
+		if !r.allowRequest(w, req, nil) {
+			logger.Debug("Rate limit exceeded", "route", pagePath)
+			r.serveErrorPage(w, req, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
 		if pageHandler != nil {
+			if rule := r.Marley.pageAuthRule(pagePath); rule != nil && !r.authorizePage(w, req, pagePath, rule, tokenErr) {
+				return
+			}
+			if !r.checkCSRF(req, requestPath, false) {
+				logger.Warn("CSRF check failed", "method", req.Method, "route", pagePath)
+				r.serveErrorPage(w, req, http.StatusForbidden, csrfRejectMessage)
+				return
+			}
 			if pageMiddleware == nil {
 				pageMiddleware = NewMiddlewareChain()
 			}
-			finalPageRouteHandler := pageMiddleware.Then(pageHandler)
-			finalPageRouteHandler.ServeHTTP(w, req)
+			timeout := r.pageTimeout(pagePath)
+			r.extendWriteDeadline(w, timeout)
+			if timeout == 0 {
+				serveWithMiddleware(pageMiddleware, "middleware.route", pageHandler, w, req)
+				return
+			}
+
+			timeoutStatus := r.Config.timeoutStatus()
+			abandoned := serveWithTimeout(w, req, timeout, func(w http.ResponseWriter, req *http.Request) {
+				serveWithMiddleware(pageMiddleware, "middleware.route", pageHandler, w, req)
+			}, func(w http.ResponseWriter) {
+				r.serveErrorPage(w, req, timeoutStatus, "The page took too long to respond")
+			})
+			if abandoned == context.DeadlineExceeded {
+				logger.Warn("Page request timed out", "method", req.Method, "route", pagePath, "timeout", timeout)
+			}
 			return
 		}
 
@@ -233,25 +752,39 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	})
 
 	if r.GlobalMiddleware != nil {
-		r.GlobalMiddleware.Then(finalHandler).ServeHTTP(w, req)
+		serveWithMiddleware(r.GlobalMiddleware, "middleware", finalHandler, responseWriter, req)
 	} else {
-		finalHandler.ServeHTTP(w, req)
+		finalHandler.ServeHTTP(responseWriter, req)
 	}
 
-	if AppConfig.LogLevel != "error" {
-		go r.logRequest(req, http.StatusOK, time.Since(startTime))
+	if !responseWriter.wroteHeader {
+		responseWriter.runBeforeHeader()
 	}
+
+	status := responseWriter.Status()
+	span.SetName(req.Method + " " + labelOrUnmatched(routeLabel))
+	span.SetAttribute("http.route", labelOrUnmatched(routeLabel))
+	span.SetAttribute("http.status_code", status)
+	if status >= http.StatusInternalServerError {
+		span.RecordError(fmt.Errorf("responded %d", status))
+	}
+	span.End()
+
+	duration := time.Since(startTime)
+	r.metrics.observeRequest(routeLabel, req.Method, responseWriter.Status(), duration)
+
+	logRequest(logger, req, routeLabel, responseWriter.Status(), duration)
 }
 
 func (r *Router) InitRoutes() error {
 	startTime := time.Now()
-	r.Logger.InfoLog.Printf("Initializing routes...")
+	r.Logger.Infof("Initializing routes...")
 
 	r.Routes = []Route{}
 
 	err := r.Marley.LoadTemplates()
 	if err != nil {
-		r.Logger.ErrorLog.Printf("Failed to load templates: %v", err)
+		r.Logger.Errorf("Failed to load templates: %v", err)
 		return fmt.Errorf("failed to load templates: %w", err)
 	}
 
@@ -282,48 +815,44 @@ func (r *Router) InitRoutes() error {
 			Middleware: NewMiddlewareChain(),
 		})
 
-		r.Logger.InfoLog.Printf("Page route registered: %s (params: %v)", routePath, paramNames)
+		r.Logger.Infof("Page route registered: %s (params: %v)", routePath, paramNames)
 		pageRouteCount++
 	}
 
 	apiRouteCount := r.discoverAndLogAPIRoutes()
 
 	elapsedTime := time.Since(startTime)
-	r.Logger.InfoLog.Printf("Routes initialized: %d page routes discovered, %d API routes discovered in %v. API handlers registered via init().",
+	r.Logger.Infof("Routes initialized: %d page routes discovered, %d API routes discovered in %v. API handlers registered via init().",
 		pageRouteCount, apiRouteCount, elapsedTime.Round(time.Millisecond))
 
-	apiRegistryMutex.RLock()
-	r.Logger.InfoLog.Printf("--- Registered API Handlers ---")
-	for path, methodMap := range apiRegistry {
-		for method := range methodMap {
-			r.Logger.InfoLog.Printf("  %s %s", method, path)
-		}
+	r.Logger.Infof("--- Registered API Handlers ---")
+	for _, route := range r.API.Routes() {
+		r.Logger.Infof("  %s %s", route.Method, route.Path)
 	}
-	r.Logger.InfoLog.Printf("-----------------------------")
-	apiRegistryMutex.RUnlock()
+	r.Logger.Infof("-----------------------------")
 
 	return nil
 }
 
 func (r *Router) discoverAndLogAPIRoutes() int {
-	apiBasePath := filepath.Join(AppConfig.AppDir, "api")
+	apiBasePath := filepath.Join(r.Config.AppDir, "api")
 	discoveredCount := 0
 
 	if _, err := os.Stat(apiBasePath); os.IsNotExist(err) {
-		r.Logger.InfoLog.Printf("No 'api' directory found in '%s'. Skipping API route discovery.", AppConfig.AppDir)
+		r.Logger.Infof("No 'api' directory found in '%s'. Skipping API route discovery.", r.Config.AppDir)
 		return 0
 	}
 
 	filepath.Walk(apiBasePath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			r.Logger.WarnLog.Printf("Error accessing path %q: %v", path, err)
+			r.Logger.Warnf("Error accessing path %q: %v", path, err)
 			return err
 		}
 
 		if !info.IsDir() && info.Name() == "route.go" {
 			relPath, err := filepath.Rel(apiBasePath, filepath.Dir(path))
 			if err != nil {
-				r.Logger.WarnLog.Printf("Could not get relative path for %s: %v", path, err)
+				r.Logger.Warnf("Could not get relative path for %s: %v", path, err)
 				return nil
 			}
 
@@ -341,7 +870,7 @@ func (r *Router) discoverAndLogAPIRoutes() int {
 
 			apiRoutePath = normalizePath(apiRoutePath)
 
-			r.Logger.InfoLog.Printf("Discovered potential API route file for: %s", apiRoutePath)
+			r.Logger.Infof("Discovered potential API route file for: %s", apiRoutePath)
 			discoveredCount++
 		}
 		return nil
@@ -356,38 +885,53 @@ func (r *Router) AddStaticRoute() {
 		Path: "/static/",
 		Handler: func(w http.ResponseWriter, req *http.Request) {
 			if _, err := os.Stat(r.StaticDir); os.IsNotExist(err) {
-				r.Logger.ErrorLog.Printf("Static directory '%s' not found", r.StaticDir)
+				r.Logger.Errorf("Static directory '%s' not found", r.StaticDir)
 				http.NotFound(w, req)
 				return
 			}
+			if negotiatedEncoding(w) == encodingGzip && servePrecompressedFile(w, req, r.StaticDir, strings.TrimPrefix(req.URL.Path, "/static/")) {
+				return
+			}
 			staticHandler.ServeHTTP(w, req)
 		},
 		IsStatic:   true,
 		Middleware: NewMiddlewareChain(),
 	})
-	r.Logger.InfoLog.Printf("Static route registered: /static/ -> %s", r.StaticDir)
+	r.Logger.Infof("Static route registered: /static/ -> %s", r.StaticDir)
 }
 
 func (r *Router) createTemplateHandler(routePath string) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		stopDataTiming := ServerTimingFromContext(req.Context()).Start("data")
+
 		requestPath := normalizePath(req.URL.Path)
 		params := extractParamsFromRequest(requestPath, routePath)
 
 		data := map[string]interface{}{
 			"Params":     params,
-			"Config":     &AppConfig,
+			"Config":     r.Config,
 			"ServerTime": time.Now().Format(time.RFC1123),
 			"BuildTime":  time.Now().Format(time.RFC1123),
 			"Route":      routePath,
+			"Session":    SessionFromContext(req.Context()),
+			"User":       ClaimsFromContext(req.Context()),
 			"Request": map[string]interface{}{
 				"Path":   requestPath,
 				"Method": req.Method,
 				"Host":   req.Host,
 			},
 		}
-
-		if HasPageError(routePath) {
-			r.Logger.WarnLog.Printf("Rendering error page for route with known errors: %s", routePath)
+		stopDataTiming()
+
+		// A failing page gets the same breaker as an API route: it serves the
+		// error page while open and lets one render through after the
+		// cool-down to see whether the page has recovered.
+		breaker := r.Errors.PageCircuitBreaker(routePath)
+		if !breaker.Allow() {
+			r.Logger.Warnf("Page circuit open, rendering error page: %s", routePath)
+			if retryAfter := breaker.RetryAfter(); retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			}
 			r.RenderErrorPage(w, req, routePath)
 			return
 		}
@@ -397,25 +941,34 @@ func (r *Router) createTemplateHandler(routePath string) http.HandlerFunc {
 		r.Marley.mutex.RUnlock()
 
 		if hasErrors {
-			r.Logger.WarnLog.Printf("Skipping render of template with known errors: %s", routePath)
+			r.Logger.Warnf("Skipping render of template with known errors: %s", routePath)
+			breaker.RecordFailure()
 			r.RenderErrorPage(w, req, routePath)
 			return
 		}
 
-		err := r.Marley.RenderTemplate(w, routePath, data)
+		err := r.Marley.RenderTemplateContext(req.Context(), w, routePath, data)
 		if err != nil {
-			r.Logger.ErrorLog.Printf("Template rendering error for request %s (template %s): %v", requestPath, routePath, err)
+			r.Logger.Errorf("Template rendering error for request %s (template %s): %v", requestPath, routePath, err)
 			statusCode := http.StatusInternalServerError
 
 			if strings.Contains(err.Error(), "template not found") {
 				statusCode = http.StatusNotFound
 			}
 
-			RegisterPageError(routePath, err, statusCode)
+			r.Errors.RegisterPageError(routePath, err, statusCode)
+			if breaker.RecordFailure() {
+				r.Logger.Warnf("Page circuit opened: %s", routePath)
+			}
 
 			r.RenderErrorPage(w, req, routePath)
 			return
 		}
+
+		if breaker.RecordSuccess() {
+			r.Errors.ClearPageError(routePath)
+			r.Logger.Infof("Page circuit closed, page recovered: %s", routePath)
+		}
 	}
 }
 
@@ -448,22 +1001,25 @@ func (r *Router) serveErrorPage(w http.ResponseWriter, req *http.Request, status
 	r.Marley.mutex.RUnlock()
 
 	if tmpl, exists := r.Marley.Templates[errorTemplatePath]; exists && !hasErrors {
-		w.WriteHeader(status)
-		err := tmpl.ExecuteTemplate(w, "layout", map[string]interface{}{
+		var buffer strings.Builder
+		err := tmpl.ExecuteTemplate(&buffer, "layout", map[string]interface{}{
 			"Params": map[string]string{
 				"status":  fmt.Sprintf("%d", status),
 				"path":    req.URL.Path,
 				"error":   errorMessage,
 				"message": errorMessage,
 			},
-			"Config":  &AppConfig,
+			"Config":  r.Config,
 			"Route":   errorTemplatePath,
 			"Message": errorMessage,
 		})
 		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(status)
+			io.WriteString(w, fillPlaceholders(req.Context(), w, buffer.String()))
 			return
 		}
-		r.Logger.ErrorLog.Printf("Failed to execute error template %s: %v", errorTemplatePath, err)
+		r.Logger.Errorf("Failed to execute error template %s: %v", errorTemplatePath, err)
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -491,9 +1047,9 @@ func (r *Router) serveErrorPage(w http.ResponseWriter, req *http.Request, status
         <p><strong>%s</strong></p>
         <p>Path: %s</p>
     </div>
-    <a href="/" class="back-link">← Return to homepage</a>
+    <a href="%s" class="back-link">← Return to homepage</a>
 </body>
-</html>`, status, status, errorMessage, req.URL.Path)
+</html>`, status, status, errorMessage, req.URL.Path, template.HTMLEscapeString(r.Config.URL("/")))
 
 	io.WriteString(w, errorHTML)
 }
@@ -567,15 +1123,54 @@ func extractParamsFromRequest(requestPath, routePath string) map[string]string {
 	return params
 }
 
-func (r *Router) logRequest(req *http.Request, status int, duration time.Duration) {
-	logLevel := AppConfig.LogLevel
-	if logLevel == "debug" || logLevel == "info" {
-		statusCode := status
-		if statusCode == 0 {
-			statusCode = 200
-		}
-		r.Logger.InfoLog.Printf("Handled: %s %s -> %d (%v)", req.Method, req.URL.Path, statusCode, duration.Round(time.Microsecond))
-	} else if status >= 400 && logLevel != "error" {
-		r.Logger.WarnLog.Printf("Handled: %s %s -> %d (%v)", req.Method, req.URL.Path, status, duration.Round(time.Microsecond))
+// serveWithMiddleware runs handler behind chain inside a span that ends when
+// the handler is reached, so the span covers only the middleware itself.
+func serveWithMiddleware(chain *MiddlewareChain, spanName string, handler http.Handler, w http.ResponseWriter, req *http.Request) {
+	if len(chain.middlewares) == 0 {
+		handler.ServeHTTP(w, req)
+		return
+	}
+
+	_, span := StartSpan(req.Context(), spanName)
+	span.SetAttribute("middleware.count", len(chain.middlewares))
+	stopTiming := ServerTimingFromContext(req.Context()).Start(spanName)
+
+	reached := false
+	chain.Then(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		reached = true
+		stopTiming()
+		span.End()
+		handler.ServeHTTP(w, req)
+	})).ServeHTTP(w, req)
+
+	if !reached {
+		stopTiming()
+	}
+	span.End()
+}
+
+func labelOrUnmatched(route string) string {
+	if route == "" {
+		return unmatchedRouteLabel
+	}
+	return route
+}
+
+// logRequest logs a completed request at info, 4xx responses at warn and 5xx
+// responses at error.
+func logRequest(logger *AppLogger, req *http.Request, route string, status int, duration time.Duration) {
+	level := LevelInfo
+	switch {
+	case status >= http.StatusInternalServerError:
+		level = LevelError
+	case status >= http.StatusBadRequest:
+		level = LevelWarn
 	}
+
+	logger.Log(level, "Request handled",
+		"method", req.Method,
+		"path", req.URL.Path,
+		"route", labelOrUnmatched(route),
+		"status", status,
+		"duration_ms", float64(duration.Microseconds())/1000)
 }
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const unmatchedRouteLabel = "unmatched"
+
+// frameworkMetrics are the metrics Go on Airplanes records itself. A nil
+// *frameworkMetrics records nothing.
+type frameworkMetrics struct {
+	requests        *Counter
+	requestDuration *Histogram
+	renderDuration  *Histogram
+	renderCache     *Counter
+	ssgCache        *Counter
+}
+
+func newFrameworkMetrics(registry *MetricsRegistry) *frameworkMetrics {
+	fm := &frameworkMetrics{
+		requests: registry.NewCounter("goa_http_requests_total",
+			"HTTP requests handled by the router.", "route", "method", "status"),
+		requestDuration: registry.NewHistogram("goa_http_request_duration_seconds",
+			"Time spent handling HTTP requests.", nil, "route", "method", "status"),
+		renderDuration: registry.NewHistogram("goa_template_render_duration_seconds",
+			"Time spent executing page templates, excluding cache hits.", nil, "route"),
+		renderCache: registry.NewCounter("goa_render_cache_lookups_total",
+			"Rendered page cache lookups by result.", "result"),
+		ssgCache: registry.NewCounter("goa_ssg_cache_lookups_total",
+			"Static generation cache lookups for SSG pages by result.", "result"),
+	}
+
+	registry.NewGaugeFunc("goa_render_cache_hit_ratio",
+		"Share of rendered page cache lookups that were hits.", func() float64 {
+			return hitRatio(fm.renderCache)
+		})
+	registry.NewGaugeFunc("goa_ssg_cache_hit_ratio",
+		"Share of SSG cache lookups that were hits.", func() float64 {
+			return hitRatio(fm.ssgCache)
+		})
+
+	return fm
+}
+
+func (fm *frameworkMetrics) observeRequest(route, method string, status int, duration time.Duration) {
+	if fm == nil {
+		return
+	}
+	route = labelOrUnmatched(route)
+	statusLabel := strconv.Itoa(status)
+	fm.requests.Inc(route, method, statusLabel)
+	fm.requestDuration.Observe(duration.Seconds(), route, method, statusLabel)
+}
+
+func (fm *frameworkMetrics) observeRender(route string, duration time.Duration) {
+	if fm == nil {
+		return
+	}
+	fm.renderDuration.Observe(duration.Seconds(), route)
+}
+
+func (fm *frameworkMetrics) renderCacheLookup(hit bool) {
+	if fm == nil {
+		return
+	}
+	fm.renderCache.Inc(cacheResultLabel(hit))
+}
+
+func (fm *frameworkMetrics) ssgCacheLookup(hit bool) {
+	if fm == nil {
+		return
+	}
+	fm.ssgCache.Inc(cacheResultLabel(hit))
+}
+
+func cacheResultLabel(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
+
+func hitRatio(lookups *Counter) float64 {
+	hits := lookups.value("hit")
+	total := hits + lookups.value("miss")
+	if total == 0 {
+		return 0
+	}
+	return hits / total
+}
+
+// registerRouterMetrics adds the request, render, cache, WebSocket and Go
+// runtime metrics for r to r.Metrics.
+func (r *Router) registerRouterMetrics() {
+	r.metrics = newFrameworkMetrics(r.Metrics)
+	r.Marley.metrics = r.metrics
+
+	r.Metrics.NewGaugeFunc("goa_metadata_cache_entries",
+		"Page metadata entries held in the metadata cache.", func() float64 {
+			return float64(r.Marley.metadataCache.Len())
+		})
+
+	r.Metrics.newLabeledGaugeFunc("goa_websocket_connections",
+		"Open WebSocket connections by endpoint.", "endpoint", func() map[string]float64 {
+			connections := make(map[string]float64)
+			for _, endpoint := range r.SocketEndpoints() {
+				connections[endpoint.Path] = float64(endpoint.Count())
+			}
+			return connections
+		})
+
+	registerRuntimeMetrics(r.Metrics)
+}
+
+func registerRuntimeMetrics(registry *MetricsRegistry) {
+	registry.NewGaugeFunc("go_goroutines", "Number of goroutines that currently exist.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+
+	// One ReadMemStats per scrape: it stops the world, so the gauges below
+	// share the snapshot taken when the scrape starts.
+	var (
+		statsMutex sync.Mutex
+		stats      runtime.MemStats
+	)
+	registry.onScrape(func() {
+		statsMutex.Lock()
+		runtime.ReadMemStats(&stats)
+		statsMutex.Unlock()
+	})
+	memStat := func(read func(*runtime.MemStats) float64) func() float64 {
+		return func() float64 {
+			statsMutex.Lock()
+			defer statsMutex.Unlock()
+			return read(&stats)
+		}
+	}
+
+	registry.NewGaugeFunc("go_memstats_alloc_bytes", "Bytes of allocated heap objects.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.Alloc) }))
+	registry.NewGaugeFunc("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.HeapInuse) }))
+	registry.NewGaugeFunc("go_memstats_heap_objects", "Number of allocated heap objects.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.HeapObjects) }))
+	registry.NewGaugeFunc("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.Sys) }))
+	registry.newCounterFunc("go_memstats_gc_cycles_total", "Number of completed GC cycles.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.NumGC) }))
+	registry.newCounterFunc("go_memstats_gc_pause_seconds_total", "Cumulative GC stop-the-world pause time.",
+		memStat(func(s *runtime.MemStats) float64 { return time.Duration(s.PauseTotalNs).Seconds() }))
+	registry.NewGaugeFunc("go_memstats_last_gc_time_seconds", "Unix time of the last GC.",
+		memStat(func(s *runtime.MemStats) float64 { return float64(s.LastGC) / 1e9 }))
+}
@@ -0,0 +1,40 @@
+package core
+
+import (
+	"io"
+	"testing"
+)
+
+func TestScrapeHooksRunOncePerScrapeBeforeCollection(t *testing.T) {
+	registry := NewMetricsRegistry()
+
+	var reads, snapshot int
+	registry.onScrape(func() {
+		reads++
+		snapshot = reads * 10
+	})
+	for _, name := range []string{"a_total", "b_total", "c_total"} {
+		registry.newCounterFunc(name, "", func() float64 {
+			if snapshot != reads*10 {
+				t.Errorf("%s collected before the scrape hook ran", name)
+			}
+			return float64(snapshot)
+		})
+	}
+
+	for scrape := 1; scrape <= 3; scrape++ {
+		registry.WriteTo(io.Discard)
+		if reads != scrape {
+			t.Fatalf("after %d scrapes the hook ran %d times", scrape, reads)
+		}
+	}
+}
+
+func TestRuntimeMetricsShareOneSnapshot(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registerRuntimeMetrics(registry)
+
+	if len(registry.beforeScrape) != 1 {
+		t.Errorf("runtime metrics registered %d scrape hooks, want a single ReadMemStats", len(registry.beforeScrape))
+	}
+}
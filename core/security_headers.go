@@ -0,0 +1,208 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// securityHeaderOff in a route override removes a header the app sends.
+const securityHeaderOff = "off"
+
+// SecurityHeadersOptions configures the hardening headers sent with every
+// response. Empty values omit the header.
+type SecurityHeadersOptions struct {
+	// HSTSMaxAge enables Strict-Transport-Security on requests that arrived
+	// over TLS, directly or through a trusted proxy. Zero disables it.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// FrameAncestors is the CSP frame-ancestors source list, such as "'none'",
+	// "'self'" or "'self' https://partner.example". 'none' and 'self' are
+	// mirrored in X-Frame-Options for older browsers.
+	FrameAncestors string
+
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+
+	// TrustedProxies may report the original scheme in X-Forwarded-Proto.
+	TrustedProxies []string
+}
+
+// SecurityHeadersRoute overrides the app's headers for paths matching Path,
+// where a trailing "*" matches a prefix. Empty fields keep the app's value
+// and "off" removes the header.
+type SecurityHeadersRoute struct {
+	Path                      string
+	FrameAncestors            string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+}
+
+var DefaultSecurityHeaders = SecurityHeadersOptions{
+	HSTSMaxAge:                365 * 24 * time.Hour,
+	HSTSIncludeSubdomains:     true,
+	FrameAncestors:            "'none'",
+	ReferrerPolicy:            "strict-origin-when-cross-origin",
+	PermissionsPolicy:         "camera=(), microphone=(), geolocation=(), payment=()",
+	CrossOriginOpenerPolicy:   "same-origin",
+	CrossOriginResourcePolicy: "same-origin",
+}
+
+type SecurityHeaders struct {
+	options        SecurityHeadersOptions
+	hsts           string
+	trustedProxies []*net.IPNet
+	routes         []securityHeadersRoute
+}
+
+type securityHeadersRoute struct {
+	path    string
+	prefix  bool
+	options SecurityHeadersOptions
+}
+
+func NewSecurityHeaders(options SecurityHeadersOptions, routes ...SecurityHeadersRoute) *SecurityHeaders {
+	sh := &SecurityHeaders{options: options}
+	sh.trustedProxies, _ = ParseTrustedProxies(options.TrustedProxies)
+
+	if options.HSTSMaxAge > 0 {
+		sh.hsts = "max-age=" + strconv.FormatInt(int64(options.HSTSMaxAge/time.Second), 10)
+		if options.HSTSIncludeSubdomains {
+			sh.hsts += "; includeSubDomains"
+		}
+		if options.HSTSPreload {
+			sh.hsts += "; preload"
+		}
+	}
+
+	for _, route := range routes {
+		path, prefix := strings.CutSuffix(route.Path, "*")
+		if !prefix {
+			path = normalizePath(path)
+		}
+		sh.routes = append(sh.routes, securityHeadersRoute{path: path, prefix: prefix, options: route.apply(options)})
+	}
+	return sh
+}
+
+func (route SecurityHeadersRoute) apply(options SecurityHeadersOptions) SecurityHeadersOptions {
+	override := func(value *string, with string) {
+		if with == securityHeaderOff {
+			*value = ""
+		} else if with != "" {
+			*value = with
+		}
+	}
+	override(&options.FrameAncestors, route.FrameAncestors)
+	override(&options.ReferrerPolicy, route.ReferrerPolicy)
+	override(&options.PermissionsPolicy, route.PermissionsPolicy)
+	override(&options.CrossOriginOpenerPolicy, route.CrossOriginOpenerPolicy)
+	override(&options.CrossOriginEmbedderPolicy, route.CrossOriginEmbedderPolicy)
+	override(&options.CrossOriginResourcePolicy, route.CrossOriginResourcePolicy)
+	return options
+}
+
+// SecureHeadersMiddleware sends DefaultSecurityHeaders. The router sends the
+// headers configured in Config itself; use this for handlers served outside it.
+func SecureHeadersMiddleware() MiddlewareFunc {
+	return NewSecurityHeaders(DefaultSecurityHeaders).Middleware()
+}
+
+func (sh *SecurityHeaders) Middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sh.apply(w, r, normalizePath(r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (sh *SecurityHeaders) optionsFor(requestPath string) *SecurityHeadersOptions {
+	for i := range sh.routes {
+		route := &sh.routes[i]
+		if route.path == requestPath || (route.prefix && strings.HasPrefix(requestPath, route.path)) {
+			return &route.options
+		}
+	}
+	return &sh.options
+}
+
+func (sh *SecurityHeaders) apply(w http.ResponseWriter, r *http.Request, requestPath string) {
+	h := w.Header()
+	options := sh.optionsFor(requestPath)
+
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if sh.hsts != "" && sh.overTLS(r) {
+		h.Set("Strict-Transport-Security", sh.hsts)
+	}
+
+	if options.FrameAncestors != "" {
+		h.Add(cspHeader, "frame-ancestors "+options.FrameAncestors)
+		switch strings.TrimSpace(options.FrameAncestors) {
+		case "'none'":
+			h.Set("X-Frame-Options", "DENY")
+		case "'self'":
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+		}
+	}
+
+	setIf := func(name string, value string) {
+		if value != "" {
+			h.Set(name, value)
+		}
+	}
+	setIf("Referrer-Policy", options.ReferrerPolicy)
+	setIf("Permissions-Policy", options.PermissionsPolicy)
+	setIf("Cross-Origin-Opener-Policy", options.CrossOriginOpenerPolicy)
+	setIf("Cross-Origin-Embedder-Policy", options.CrossOriginEmbedderPolicy)
+	setIf("Cross-Origin-Resource-Policy", options.CrossOriginResourcePolicy)
+}
+
+// overTLS reports whether the client connected over HTTPS. X-Forwarded-Proto
+// is only believed from a trusted proxy; browsers ignore HSTS sent over plain
+// HTTP, and sending it there would pin a host that may not serve HTTPS.
+func (sh *SecurityHeaders) overTLS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if len(sh.trustedProxies) == 0 {
+		return false
+	}
+
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if !ipTrusted(net.ParseIP(peer), sh.trustedProxies) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// securityHeadersOptions returns the app's header settings.
+func (c *Config) securityHeadersOptions() SecurityHeadersOptions {
+	return SecurityHeadersOptions{
+		HSTSMaxAge:                c.HSTSMaxAge,
+		HSTSIncludeSubdomains:     c.HSTSIncludeSubdomains,
+		HSTSPreload:               c.HSTSPreload,
+		FrameAncestors:            c.FrameAncestors,
+		ReferrerPolicy:            c.ReferrerPolicy,
+		PermissionsPolicy:         c.PermissionsPolicy,
+		CrossOriginOpenerPolicy:   c.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: c.CrossOriginEmbedderPolicy,
+		CrossOriginResourcePolicy: c.CrossOriginResourcePolicy,
+		TrustedProxies:            c.TrustedProxies,
+	}
+}
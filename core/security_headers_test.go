@@ -0,0 +1,154 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDefaultSecurityHeaders(t *testing.T) {
+	app := newTestApp(t)
+
+	res := app.Get("/").
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-Content-Type-Options", "nosniff").
+		AssertHeader("X-Frame-Options", "DENY").
+		AssertHeader("Content-Security-Policy", "frame-ancestors 'none'").
+		AssertHeader("Referrer-Policy", "strict-origin-when-cross-origin").
+		AssertHeader("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()").
+		AssertHeader("Cross-Origin-Opener-Policy", "same-origin").
+		AssertHeader("Cross-Origin-Resource-Policy", "same-origin").
+		AssertHeader("Cross-Origin-Embedder-Policy", "").
+		AssertHeader("X-XSS-Protection", "")
+
+	// HSTS is only sent to clients that connected over TLS.
+	res.AssertHeader("Strict-Transport-Security", "")
+	app.Do(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)).
+		AssertHeader("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+
+	app.Get("/api/missing").AssertHeader("X-Frame-Options", "DENY")
+}
+
+func TestSecurityHeadersConfig(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.HSTSMaxAge = 2 * time.Hour
+		c.HSTSIncludeSubdomains = false
+		c.HSTSPreload = true
+		c.FrameAncestors = "'self'"
+		c.ReferrerPolicy = "no-referrer"
+		c.PermissionsPolicy = ""
+		c.CrossOriginEmbedderPolicy = "require-corp"
+		c.CrossOriginResourcePolicy = ""
+	}))
+
+	app.Get("/").
+		AssertHeader("X-Frame-Options", "SAMEORIGIN").
+		AssertHeader("Content-Security-Policy", "frame-ancestors 'self'").
+		AssertHeader("Referrer-Policy", "no-referrer").
+		AssertHeader("Permissions-Policy", "").
+		AssertHeader("Cross-Origin-Embedder-Policy", "require-corp").
+		AssertHeader("Cross-Origin-Resource-Policy", "")
+	app.Do(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)).
+		AssertHeader("Strict-Transport-Security", "max-age=7200; preload")
+
+	partner := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.FrameAncestors = "https://partner.example"
+	}))
+	partner.Get("/").
+		AssertHeader("Content-Security-Policy", "frame-ancestors https://partner.example").
+		AssertHeader("X-Frame-Options", "")
+
+	off := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.HSTSMaxAge = 0
+	}))
+	off.Do(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)).AssertHeader("Strict-Transport-Security", "")
+}
+
+func TestHSTSBehindTrustedProxy(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.TrustedProxies = []string{"192.0.2.0/24"}
+	}))
+
+	app.Request(http.MethodGet, "/", nil, "X-Forwarded-Proto", "https").
+		AssertHeader("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	app.Request(http.MethodGet, "/", nil, "X-Forwarded-Proto", "HTTPS, http").
+		AssertHeader("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	app.Request(http.MethodGet, "/", nil, "X-Forwarded-Proto", "http").
+		AssertHeader("Strict-Transport-Security", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:4000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	app.Do(req).AssertHeader("Strict-Transport-Security", "")
+
+	untrusting := newTestApp(t)
+	untrusting.Request(http.MethodGet, "/", nil, "X-Forwarded-Proto", "https").
+		AssertHeader("Strict-Transport-Security", "")
+}
+
+func TestSecurityHeadersRouteOverrides(t *testing.T) {
+	routes := []core.SecurityHeadersRoute{
+		{Path: "/links/", FrameAncestors: "'self' https://partner.example", CrossOriginOpenerPolicy: "off"},
+		{Path: "/api/public/*", CrossOriginResourcePolicy: "cross-origin", ReferrerPolicy: "off"},
+	}
+	configure := goatest.WithConfig(func(c *core.Config) {
+		c.SecurityHeaderRoutes = routes
+	})
+	ok := withAPI("/api/public/feed", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Success("ok", http.StatusOK)
+	})
+	app := newTestApp(t, configure, ok)
+
+	app.Get("/links").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Security-Policy", "frame-ancestors 'self' https://partner.example").
+		AssertHeader("X-Frame-Options", "").
+		AssertHeader("Cross-Origin-Opener-Policy", "").
+		AssertHeader("Referrer-Policy", "strict-origin-when-cross-origin").
+		AssertHeader("X-Content-Type-Options", "nosniff")
+
+	app.Get("/api/public/feed").
+		AssertHeader("Cross-Origin-Resource-Policy", "cross-origin").
+		AssertHeader("Referrer-Policy", "").
+		AssertHeader("X-Frame-Options", "DENY")
+
+	app.Get("/").AssertHeader("X-Frame-Options", "DENY").AssertHeader("Cross-Origin-Opener-Policy", "same-origin")
+
+	// Overrides match the path inside the app, not the mounted URL.
+	mounted := mountedApp(t, configure, ok)
+	mounted.Get("/portal/links").AssertHeader("X-Frame-Options", "")
+	mounted.Get("/portal/api/public/feed").AssertHeader("Cross-Origin-Resource-Policy", "cross-origin")
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SecurityHeadersEnabled = false
+	}))
+
+	app.Do(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)).
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-Content-Type-Options", "").
+		AssertHeader("X-Frame-Options", "").
+		AssertHeader("Content-Security-Policy", "").
+		AssertHeader("Strict-Transport-Security", "").
+		AssertHeader("Referrer-Policy", "")
+}
+
+func TestSecureHeadersMiddleware(t *testing.T) {
+	handler := core.SecureHeadersMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if rec.Header().Get("X-Frame-Options") != "DENY" || rec.Header().Get("Strict-Transport-Security") != "" || rec.Header().Get("X-XSS-Protection") != "" {
+		t.Errorf("plain HTTP headers = %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	if rec.Header().Get("Strict-Transport-Security") == "" {
+		t.Errorf("HTTPS headers = %v, want HSTS", rec.Header())
+	}
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerTiming collects the phases of one request for the Server-Timing
+// response header. A nil *ServerTiming records nothing.
+type ServerTiming struct {
+	start   time.Time
+	metrics []serverTimingMetric
+	mutex   sync.Mutex
+}
+
+type serverTimingMetric struct {
+	name     string
+	desc     string
+	duration time.Duration
+	timed    bool
+}
+
+type serverTimingContextKey struct{}
+
+func newServerTiming() *ServerTiming {
+	return &ServerTiming{start: time.Now()}
+}
+
+func withServerTiming(ctx context.Context, timing *ServerTiming) context.Context {
+	return context.WithValue(ctx, serverTimingContextKey{}, timing)
+}
+
+// ServerTimingFromContext returns the request's timing collector, or nil when
+// Server-Timing is disabled.
+func ServerTimingFromContext(ctx context.Context) *ServerTiming {
+	timing, _ := ctx.Value(serverTimingContextKey{}).(*ServerTiming)
+	return timing
+}
+
+// Add records a phase. Durations of phases with the same name are summed.
+func (st *ServerTiming) Add(name string, duration time.Duration, desc string) {
+	if st == nil {
+		return
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for i := range st.metrics {
+		if st.metrics[i].name == name {
+			st.metrics[i].duration += duration
+			st.metrics[i].timed = true
+			if desc != "" {
+				st.metrics[i].desc = desc
+			}
+			return
+		}
+	}
+	st.metrics = append(st.metrics, serverTimingMetric{name: name, desc: desc, duration: duration, timed: true})
+}
+
+// Mark records a phase without a duration, such as a cache result.
+func (st *ServerTiming) Mark(name, desc string) {
+	if st == nil {
+		return
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.metrics = append(st.metrics, serverTimingMetric{name: name, desc: desc})
+}
+
+// Start begins timing a phase; the first call of the returned func records it.
+func (st *ServerTiming) Start(name string) func() {
+	if st == nil {
+		return func() {}
+	}
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			st.Add(name, time.Since(start), "")
+		})
+	}
+}
+
+// header formats the recorded phases followed by the total time so far.
+func (st *ServerTiming) header() string {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	parts := make([]string, 0, len(st.metrics)+1)
+	for _, metric := range st.metrics {
+		parts = append(parts, formatServerTimingMetric(metric))
+	}
+	parts = append(parts, formatServerTimingMetric(serverTimingMetric{
+		name:     "total",
+		duration: time.Since(st.start),
+		timed:    true,
+	}))
+
+	return strings.Join(parts, ", ")
+}
+
+func formatServerTimingMetric(metric serverTimingMetric) string {
+	var b strings.Builder
+	b.WriteString(metric.name)
+	if metric.timed {
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(metric.duration.Microseconds())/1000, 'f', -1, 64))
+	}
+	if metric.desc != "" {
+		b.WriteString(`;desc="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(metric.desc))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+func (c *Config) serverTimingEnabled() bool {
+	return c.DevMode || c.ServerTiming
+}
@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timingPhases maps each Server-Timing entry name to the rest of its entry.
+func timingPhases(t *testing.T, header string) map[string]string {
+	t.Helper()
+
+	if header == "" {
+		t.Fatal("no Server-Timing header")
+	}
+	phases := make(map[string]string)
+	for _, entry := range strings.Split(header, ", ") {
+		name, params, _ := strings.Cut(entry, ";")
+		if _, seen := phases[name]; seen {
+			t.Errorf("phase %q listed twice in %q", name, header)
+		}
+		phases[name] = params
+	}
+	return phases
+}
+
+var timedPhase = regexp.MustCompile(`^dur=(\d+(\.\d+)?)`)
+
+// phaseMillis returns a phase's duration in milliseconds, or -1 when untimed.
+func phaseMillis(params string) float64 {
+	match := timedPhase.FindStringSubmatch(params)
+	if match == nil {
+		return -1
+	}
+	millis, _ := strconv.ParseFloat(match[1], 64)
+	return millis
+}
+
+func devTimingApp(t *testing.T, opts ...goatest.Option) *goatest.App {
+	t.Helper()
+
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.DevMode = true
+		c.LogFormat = core.LogFormatJSON
+	})}, opts...)
+	return newTestApp(t, opts...)
+}
+
+func TestServerTimingPagePhases(t *testing.T) {
+	app := devTimingApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.TemplateCache = true
+	}))
+	app.App.Router.GlobalMiddleware.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(2 * time.Millisecond)
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	phases := timingPhases(t, app.Get("/instance").AssertStatus(http.StatusOK).Header.Get("Server-Timing"))
+	for _, name := range []string{"middleware", "match", "data", "template", "js", "total"} {
+		if phaseMillis(phases[name]) < 0 {
+			t.Errorf("phase %q = %q, want a duration", name, phases[name])
+		}
+	}
+	if phases["cache"] != `desc="miss"` {
+		t.Errorf("cache = %q, want a miss on the first render", phases["cache"])
+	}
+	if !strings.HasSuffix(phases["template"], `;desc="/instance"`) {
+		t.Errorf("template = %q, want the template name", phases["template"])
+	}
+	if phaseMillis(phases["middleware"]) < 2 {
+		t.Errorf("middleware = %q, want at least the 2ms it slept", phases["middleware"])
+	}
+
+	phases = timingPhases(t, app.Get("/instance").Header.Get("Server-Timing"))
+	if phases["cache"] != `desc="hit-render"` {
+		t.Errorf("cache = %q, want a render cache hit", phases["cache"])
+	}
+	if _, ok := phases["template"]; ok {
+		t.Error("cached response reported template execution")
+	}
+}
+
+func TestServerTimingAPIPhases(t *testing.T) {
+	app := devTimingApp(t, withAPI("/api/orders", http.MethodGet, func(ctx *core.APIContext) {
+		timing := core.ServerTimingFromContext(ctx.Request.Context())
+		timing.Add("db", 3*time.Millisecond, `orders "open"`)
+		timing.Add("db", 2*time.Millisecond, "")
+		ctx.Success("ok", http.StatusOK)
+	}))
+
+	header := app.Get("/api/orders").AssertStatus(http.StatusOK).Header.Get("Server-Timing")
+	phases := timingPhases(t, header)
+	if phases["db"] != `dur=5;desc="orders \"open\""` {
+		t.Errorf("db = %q, want summed durations and an escaped description", phases["db"])
+	}
+	if phaseMillis(phases["match"]) < 0 || !strings.HasSuffix(header, phases["total"]) {
+		t.Errorf("header = %q, want match timed and total last", header)
+	}
+}
+
+func TestServerTimingOutsideDevMode(t *testing.T) {
+	newTestApp(t).Get("/instance").AssertHeader("Server-Timing", "")
+
+	enabled := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.ServerTiming = true
+	}))
+	timingPhases(t, enabled.Get("/instance").Header.Get("Server-Timing"))
+}
+
+func TestServerTimingNilIsSafe(t *testing.T) {
+	var timing *core.ServerTiming
+	timing.Add("db", time.Millisecond, "")
+	timing.Mark("cache", "miss")
+	timing.Start("work")()
+}
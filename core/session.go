@@ -0,0 +1,561 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SessionStoreCookie = "cookie"
+	SessionStoreMemory = "memory"
+	SessionStoreFile   = "file"
+
+	// sessionCookieLimit is the largest cookie browsers reliably accept.
+	sessionCookieLimit = 4096
+)
+
+var ErrSessionTooLarge = errors.New("session data does not fit in a cookie; use a memory or file store")
+
+type SessionOptions struct {
+	CookieName string
+
+	// Keys sign, and with Encrypt also encrypt, the session cookie. The first
+	// key is used for new cookies; the rest are accepted during rotation.
+	Keys    [][]byte
+	Encrypt bool
+
+	// Store keeps session data on the server. When nil the data travels in
+	// the cookie itself, which needs no shared state but means Destroy cannot
+	// revoke a copied cookie before it expires.
+	Store SessionStore
+
+	// IdleTimeout ends sessions that go unused for this long; MaxAge ends them
+	// this long after they started, however active. Zero disables either.
+	IdleTimeout time.Duration
+	MaxAge      time.Duration
+
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// SessionManager loads sessions from request cookies and writes them back
+// before the response headers are sent.
+type SessionManager struct {
+	options SessionOptions
+	codec   *CookieCodec
+	logger  *AppLogger
+}
+
+type sessionData struct {
+	ID        string                 `json:"id"`
+	Values    map[string]interface{} `json:"values"`
+	CreatedAt time.Time              `json:"created_at"`
+	LastSeen  time.Time              `json:"last_seen"`
+}
+
+// Session holds per-visitor values between requests. It is loaded from the
+// cookie the first time it is used, so requests that never touch it cost
+// nothing and set no cookie. Values round-trip through JSON: numbers come
+// back as float64 and structs as maps.
+//
+// A nil *Session, as seen when sessions are disabled, reads as empty and
+// ignores writes. So does a session whose request timed out: changes made by
+// a handler after its deadline are discarded.
+type Session struct {
+	manager *SessionManager
+	request *http.Request
+
+	mutex    sync.Mutex
+	isLoaded bool
+	data     sessionData
+	isNew    bool
+	dirty    bool
+	touched  bool
+
+	previousID string
+	destroyed  bool
+	sealed     bool
+}
+
+func NewSessionManager(options SessionOptions) (*SessionManager, error) {
+	codec, err := NewCookieCodec(options.Encrypt, options.Keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.CookieName == "" {
+		options.CookieName = "goa_session"
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.SameSite == 0 {
+		options.SameSite = http.SameSiteLaxMode
+	}
+
+	return &SessionManager{options: options, codec: codec}, nil
+}
+
+// newSessionManagerFromConfig builds the app's session manager. Keys come from
+// Config.SessionKeys or the comma-separated GOA_SESSION_KEYS variable; without
+// any, a random key is generated and sessions end when the process restarts.
+func newSessionManagerFromConfig(config *Config, logger *AppLogger) (*SessionManager, error) {
+	secrets := config.SessionKeys
+	if len(secrets) == 0 {
+		if env := os.Getenv("GOA_SESSION_KEYS"); env != "" {
+			secrets = strings.Split(env, ",")
+		}
+	}
+
+	var keys [][]byte
+	for _, secret := range secrets {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			keys = append(keys, []byte(secret))
+		}
+	}
+	if len(keys) == 0 {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		if !config.DevMode {
+			logger.Warn("No session keys configured; using a random key, so sessions end on restart")
+		}
+	}
+
+	var store SessionStore
+	switch config.SessionStore {
+	case "", SessionStoreCookie:
+	case SessionStoreMemory:
+		store = NewMemorySessionStore()
+	case SessionStoreFile:
+		fileStore, err := NewFileSessionStore(config.SessionDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create session directory: %w", err)
+		}
+		store = fileStore
+	default:
+		return nil, fmt.Errorf("unknown session store %q (use cookie, memory or file)", config.SessionStore)
+	}
+
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(config.SessionSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	manager, err := NewSessionManager(SessionOptions{
+		CookieName:  config.SessionCookieName,
+		Keys:        keys,
+		Encrypt:     config.SessionEncrypt,
+		Store:       store,
+		IdleTimeout: config.SessionIdleTimeout,
+		MaxAge:      config.SessionMaxAge,
+		Path:        normalizePath(config.BasePath + "/"),
+		Secure:      config.TLSEnabled || !config.DevMode || sameSite == http.SameSiteNoneMode,
+		SameSite:    sameSite,
+	})
+	if err != nil {
+		return nil, err
+	}
+	manager.logger = logger
+	return manager, nil
+}
+
+// session returns r's session without reading the cookie yet.
+func (m *SessionManager) session(r *http.Request) *Session {
+	return &Session{manager: m, request: r}
+}
+
+// Load returns the session carried by r's cookie, or a new empty session when
+// there is none or it has expired.
+func (m *SessionManager) Load(r *http.Request) *Session {
+	s := m.session(r)
+	s.lock()
+	s.mutex.Unlock()
+	return s
+}
+
+func (m *SessionManager) read(r *http.Request) (sessionData, bool) {
+	cookie, err := r.Cookie(m.options.CookieName)
+	if err != nil {
+		return sessionData{}, false
+	}
+
+	value, err := m.codec.Decode(m.options.CookieName, cookie.Value)
+	if err != nil {
+		return sessionData{}, false
+	}
+
+	raw := value
+	if m.options.Store != nil {
+		raw, err = m.options.Store.Load(string(value))
+		if err != nil {
+			if !errors.Is(err, ErrSessionNotFound) && m.logger != nil {
+				m.logger.Warn("Failed to load session", "error", err)
+			}
+			return sessionData{}, false
+		}
+	}
+
+	var data sessionData
+	if err := json.Unmarshal(raw, &data); err != nil || data.ID == "" {
+		return sessionData{}, false
+	}
+	if m.options.Store != nil && data.ID != string(value) {
+		return sessionData{}, false
+	}
+	if m.expired(data, time.Now()) {
+		if m.options.Store != nil {
+			m.options.Store.Delete(data.ID)
+		}
+		return sessionData{}, false
+	}
+	if data.Values == nil {
+		data.Values = make(map[string]interface{})
+	}
+
+	return data, true
+}
+
+func (m *SessionManager) expired(data sessionData, now time.Time) bool {
+	if m.options.IdleTimeout > 0 && now.Sub(data.LastSeen) > m.options.IdleTimeout {
+		return true
+	}
+	if m.options.MaxAge > 0 && now.Sub(data.CreatedAt) > m.options.MaxAge {
+		return true
+	}
+	return false
+}
+
+// Save writes s to its store and sets the session cookie on w. Sessions that
+// were never read, or are new and empty, are left alone.
+func (m *SessionManager) Save(w http.ResponseWriter, s *Session) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isLoaded {
+		return nil
+	}
+
+	if s.destroyed {
+		if m.options.Store != nil {
+			if s.previousID != "" {
+				m.options.Store.Delete(s.previousID)
+			}
+			m.options.Store.Delete(s.data.ID)
+		}
+		if !s.isNew || s.previousID != "" {
+			m.setCookie(w, "", -1)
+		}
+		return nil
+	}
+
+	if !s.dirty && !s.touched {
+		return nil
+	}
+	if s.isNew && len(s.data.Values) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	s.data.LastSeen = now
+
+	raw, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+
+	value := raw
+	if m.options.Store != nil {
+		if s.previousID != "" {
+			m.options.Store.Delete(s.previousID)
+		}
+		if err := m.options.Store.Save(s.data.ID, raw, m.storeExpiry(s.data, now)); err != nil {
+			return err
+		}
+		value = []byte(s.data.ID)
+	}
+
+	encoded, err := m.codec.Encode(m.options.CookieName, value)
+	if err != nil {
+		return err
+	}
+	if len(encoded)+len(m.options.CookieName) > sessionCookieLimit {
+		return ErrSessionTooLarge
+	}
+
+	maxAge := 0
+	if m.options.MaxAge > 0 {
+		maxAge = int(time.Until(s.data.CreatedAt.Add(m.options.MaxAge)).Seconds())
+		if maxAge <= 0 {
+			maxAge = -1
+		}
+	}
+	m.setCookie(w, encoded, maxAge)
+
+	s.dirty = false
+	s.touched = false
+	s.previousID = ""
+	return nil
+}
+
+// storeExpiry is when a server-side record can be discarded: the earlier of
+// the idle and absolute deadlines, or a day when neither is set.
+func (m *SessionManager) storeExpiry(data sessionData, now time.Time) time.Time {
+	expiry := now.Add(24 * time.Hour)
+	if m.options.IdleTimeout > 0 {
+		expiry = now.Add(m.options.IdleTimeout)
+	}
+	if m.options.MaxAge > 0 {
+		if absolute := data.CreatedAt.Add(m.options.MaxAge); absolute.Before(expiry) || m.options.IdleTimeout == 0 {
+			expiry = absolute
+		}
+	}
+	return expiry
+}
+
+func (m *SessionManager) setCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.options.CookieName,
+		Value:    value,
+		Path:     m.options.Path,
+		Domain:   m.options.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.options.Secure,
+		HttpOnly: true,
+		SameSite: m.options.SameSite,
+	})
+}
+
+func newSessionID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("session: failed to read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func validSessionID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// lock acquires the session's mutex, reading the cookie on first use.
+func (s *Session) lock() {
+	s.mutex.Lock()
+	if s.isLoaded {
+		return
+	}
+	s.isLoaded = true
+
+	now := time.Now()
+	data, ok := s.manager.read(s.request)
+	if !ok {
+		s.data = sessionData{
+			ID:        newSessionID(),
+			Values:    make(map[string]interface{}),
+			CreatedAt: now,
+			LastSeen:  now,
+		}
+		s.isNew = true
+		return
+	}
+
+	s.data = data
+	if now.Sub(data.LastSeen) > time.Minute {
+		s.touched = true
+	}
+}
+
+// loaded reports whether the session was used during the request.
+func (s *Session) loaded() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.isLoaded
+}
+
+func (s *Session) ID() string {
+	if s == nil {
+		return ""
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	return s.data.ID
+}
+
+// IsNew reports whether the session was started by this request.
+func (s *Session) IsNew() bool {
+	if s == nil {
+		return true
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	return s.isNew
+}
+
+func (s *Session) CreatedAt() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	return s.data.CreatedAt
+}
+
+func (s *Session) Get(key string) interface{} {
+	if s == nil {
+		return nil
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	return s.data.Values[key]
+}
+
+func (s *Session) GetString(key string) string {
+	value, _ := s.Get(key).(string)
+	return value
+}
+
+func (s *Session) Has(key string) bool {
+	if s == nil {
+		return false
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	_, ok := s.data.Values[key]
+	return ok
+}
+
+// Values returns a copy of everything stored in the session.
+func (s *Session) Values() map[string]interface{} {
+	values := make(map[string]interface{})
+	if s == nil {
+		return values
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	for k, v := range s.data.Values {
+		values[k] = v
+	}
+	return values
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	if s.sealed {
+		return
+	}
+	s.data.Values[key] = value
+	s.dirty = true
+}
+
+func (s *Session) Delete(key string) {
+	if s == nil {
+		return
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	if s.sealed {
+		return
+	}
+	if _, ok := s.data.Values[key]; ok {
+		delete(s.data.Values, key)
+		s.dirty = true
+	}
+}
+
+// Regenerate moves the session to a new id, keeping its values. Call it when
+// privileges change, such as on login, so an id planted by an attacker
+// before authentication becomes worthless.
+func (s *Session) Regenerate() {
+	if s == nil {
+		return
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	if s.sealed {
+		return
+	}
+	if !s.isNew && s.previousID == "" {
+		s.previousID = s.data.ID
+	}
+	s.data.ID = newSessionID()
+	s.data.CreatedAt = time.Now()
+	s.dirty = true
+}
+
+// Destroy discards the session and clears its cookie, as on logout.
+func (s *Session) Destroy() {
+	if s == nil {
+		return
+	}
+	s.lock()
+	defer s.mutex.Unlock()
+	if s.sealed {
+		return
+	}
+	s.data.Values = make(map[string]interface{})
+	s.destroyed = true
+}
+
+// seal makes later writes no-ops, for a request whose response is already
+// being sent without waiting for its handler.
+func (s *Session) seal() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sealed = true
+}
+
+type sessionContextKey struct{}
+
+func withSession(ctx context.Context, session *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the request's session, or nil when sessions are
+// disabled.
+func SessionFromContext(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return session
+}
+
+// sessionUsed reports whether the request's session was read, in which case
+// the rendered page depends on the visitor and must not be cached.
+func sessionUsed(ctx context.Context) bool {
+	session := SessionFromContext(ctx)
+	return session != nil && session.loaded()
+}
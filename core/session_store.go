@@ -0,0 +1,196 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionStore keeps session data on the server, keyed by session id. Load
+// returns ErrSessionNotFound for unknown or expired ids.
+type SessionStore interface {
+	Load(id string) ([]byte, error)
+	Save(id string, data []byte, expiry time.Time) error
+	Delete(id string) error
+}
+
+type memorySessionEntry struct {
+	data   []byte
+	expiry time.Time
+}
+
+type MemorySessionStore struct {
+	entries   map[string]memorySessionEntry
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		entries:   make(map[string]memorySessionEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemorySessionStore) Load(id string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok || time.Now().After(entry.expiry) {
+		return nil, ErrSessionNotFound
+	}
+	return entry.data, nil
+}
+
+func (s *MemorySessionStore) Save(id string, data []byte, expiry time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for key, entry := range s.entries {
+			if now.After(entry.expiry) {
+				delete(s.entries, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	s.entries[id] = memorySessionEntry{data: append([]byte(nil), data...), expiry: expiry}
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.entries, id)
+	return nil
+}
+
+// FileSessionStore keeps one file per session in a directory, so sessions
+// survive restarts of a single instance.
+type FileSessionStore struct {
+	dir       string
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+type fileSessionRecord struct {
+	Expiry time.Time       `json:"expiry"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func NewFileSessionStore(dir string) (*FileSessionStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{dir: dir, lastSweep: time.Now()}, nil
+}
+
+func (s *FileSessionStore) path(id string) (string, error) {
+	if !validSessionID(id) {
+		return "", ErrSessionNotFound
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+func (s *FileSessionStore) Load(id string) ([]byte, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record fileSessionRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, err
+	}
+	if time.Now().After(record.Expiry) {
+		os.Remove(path)
+		return nil, ErrSessionNotFound
+	}
+	return record.Data, nil
+}
+
+func (s *FileSessionStore) Save(id string, data []byte, expiry time.Time) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(fileSessionRecord{Expiry: expiry, Data: data})
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, id+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	s.sweep()
+	return nil
+}
+
+func (s *FileSessionStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// sweep removes expired session files at most once a minute.
+func (s *FileSessionStore) sweep() {
+	s.mutex.Lock()
+	now := time.Now()
+	if now.Sub(s.lastSweep) <= time.Minute {
+		s.mutex.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mutex.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !validSessionID(id) {
+			continue
+		}
+		s.Load(id)
+	}
+}
@@ -0,0 +1,339 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	sessionKey      = "session-key-0123456789abcdef0123456789"
+	rotatedKey      = "session-key-fedcba9876543210fedcba9876"
+	sessionUserName = "alice"
+)
+
+// sessionApp serves login, profile and logout endpoints backed by sessions.
+func sessionApp(t *testing.T, configure func(*core.Config)) *goatest.App {
+	t.Helper()
+
+	return newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SessionEnabled = true
+		c.SessionKeys = []string{sessionKey}
+		if configure != nil {
+			configure(c)
+		}
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/cart", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Session().Set("cart", "3 apples")
+			ctx.Success(ctx.Session().ID(), http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/login", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Session().Regenerate()
+			ctx.Session().Set("name", sessionUserName)
+			ctx.Success(ctx.Session().ID(), http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/me", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success(ctx.Session().Values(), http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/logout", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Session().Destroy()
+			ctx.Success("ok", http.StatusOK)
+		})
+		app.Router.RegisterAPIHandler("/api/ping", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success("pong", http.StatusOK)
+		})
+	}))
+}
+
+func sessionCookie(t *testing.T, res *goatest.Response) *http.Cookie {
+	t.Helper()
+
+	for _, cookie := range (&http.Response{Header: res.Header}).Cookies() {
+		if cookie.Name == "goa_session" {
+			return cookie
+		}
+	}
+	t.Fatalf("no session cookie in %v", res.Header.Values("Set-Cookie"))
+	return nil
+}
+
+func withCookie(app *goatest.App, method, path string, cookie *http.Cookie) *goatest.Response {
+	return app.Request(method, path, nil, "Cookie", cookie.Name+"="+cookie.Value)
+}
+
+func sessionValues(app *goatest.App, cookie *http.Cookie) map[string]interface{} {
+	var values map[string]interface{}
+	withCookie(app, http.MethodGet, "/api/me", cookie).AssertStatus(http.StatusOK).Data(&values)
+	return values
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	app := sessionApp(t, nil)
+
+	cookie := sessionCookie(t, app.PostJSON("/api/login", nil).AssertStatus(http.StatusOK))
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("cookie attributes = %+v, want HttpOnly, Secure, SameSite=Lax on /", cookie)
+	}
+	if cookie.MaxAge < 86300 || cookie.MaxAge > 86400 {
+		t.Errorf("MaxAge = %d, want the 24h absolute lifetime", cookie.MaxAge)
+	}
+	if strings.Contains(cookie.Value, sessionUserName) {
+		t.Error("session values readable in the encrypted cookie")
+	}
+
+	if values := sessionValues(app, cookie); values["name"] != sessionUserName {
+		t.Errorf("values = %v", values)
+	}
+	if values := sessionValues(app, &http.Cookie{Name: "goa_session", Value: cookie.Value[:len(cookie.Value)-2] + "xx"}); len(values) != 0 {
+		t.Errorf("tampered cookie loaded %v", values)
+	}
+
+	if res := app.Get("/api/ping"); len(res.Header.Values("Set-Cookie")) != 0 {
+		t.Error("a request that never used its session set a cookie")
+	}
+	if res := app.Get("/api/me"); len(res.Header.Values("Set-Cookie")) != 0 {
+		t.Error("an empty new session set a cookie")
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	old := sessionApp(t, nil)
+	cookie := sessionCookie(t, old.PostJSON("/api/login", nil))
+
+	rotating := sessionApp(t, func(c *core.Config) {
+		c.SessionKeys = []string{rotatedKey, sessionKey}
+	})
+	if values := sessionValues(rotating, cookie); values["name"] != sessionUserName {
+		t.Errorf("cookie signed with the previous key was rejected: %v", values)
+	}
+
+	rotated := sessionApp(t, func(c *core.Config) {
+		c.SessionKeys = []string{rotatedKey}
+	})
+	if values := sessionValues(rotated, cookie); len(values) != 0 {
+		t.Errorf("cookie signed with a retired key loaded %v", values)
+	}
+}
+
+func TestSessionRegenerateAndDestroyWithStore(t *testing.T) {
+	app := sessionApp(t, func(c *core.Config) {
+		c.SessionStore = core.SessionStoreMemory
+	})
+
+	var anonymousID, loggedInID string
+	res := app.PostJSON("/api/cart", nil)
+	res.Data(&anonymousID)
+	anonymous := sessionCookie(t, res)
+
+	res = withCookie(app, http.MethodPost, "/api/login", anonymous)
+	res.Data(&loggedInID)
+	loggedIn := sessionCookie(t, res)
+
+	if loggedInID == anonymousID {
+		t.Fatal("login kept the pre-authentication session id")
+	}
+	if values := sessionValues(app, loggedIn); values["cart"] != "3 apples" || values["name"] != sessionUserName {
+		t.Errorf("values after login = %v, want the cart carried over", values)
+	}
+	if values := sessionValues(app, anonymous); len(values) != 0 {
+		t.Errorf("the old session id still loads %v", values)
+	}
+
+	cleared := sessionCookie(t, withCookie(app, http.MethodPost, "/api/logout", loggedIn))
+	if cleared.MaxAge >= 0 || cleared.Value != "" {
+		t.Errorf("logout cookie = %+v, want it cleared", cleared)
+	}
+	if values := sessionValues(app, loggedIn); len(values) != 0 {
+		t.Errorf("a copied cookie outlived logout: %v", values)
+	}
+}
+
+func TestFileSessionStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	configure := func(c *core.Config) {
+		c.SessionStore = core.SessionStoreFile
+		c.SessionDir = dir
+	}
+
+	cookie := sessionCookie(t, sessionApp(t, configure).PostJSON("/api/login", nil))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("session dir holds %d entries, %v; want one record", len(entries), err)
+	}
+	if len(cookie.Value) > 200 {
+		t.Errorf("cookie is %d bytes, want only the signed id", len(cookie.Value))
+	}
+
+	restarted := sessionApp(t, configure)
+	if values := sessionValues(restarted, cookie); values["name"] != sessionUserName {
+		t.Errorf("values after restart = %v", values)
+	}
+}
+
+func TestSessionCookieDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*core.Config)
+		secure    bool
+		sameSite  http.SameSite
+	}{
+		{"dev mode", func(c *core.Config) { c.DevMode = true }, false, http.SameSiteLaxMode},
+		{"strict", func(c *core.Config) { c.SessionSameSite = "Strict" }, true, http.SameSiteStrictMode},
+		{"none forces secure", func(c *core.Config) {
+			c.DevMode = true
+			c.SessionSameSite = "none"
+		}, true, http.SameSiteNoneMode},
+	}
+
+	for _, tt := range tests {
+		cookie := sessionCookie(t, sessionApp(t, tt.configure).PostJSON("/api/login", nil))
+		if cookie.Secure != tt.secure || cookie.SameSite != tt.sameSite {
+			t.Errorf("%s: Secure %v SameSite %v, want %v %v", tt.name, cookie.Secure, cookie.SameSite, tt.secure, tt.sameSite)
+		}
+	}
+}
+
+func TestSessionInTemplates(t *testing.T) {
+	app := sessionApp(t, func(c *core.Config) {
+		c.TemplateCache = true
+	})
+	app.Get("/account").AssertStatus(http.StatusOK)
+	cookie := sessionCookie(t, app.PostJSON("/api/login", nil))
+
+	withCookie(app, http.MethodGet, "/account", cookie).AssertText("p.visitor", sessionUserName)
+
+	// Personalised renders are never served from the cache to others.
+	if text := app.Get("/account").First("p.visitor").Text(); text != "" {
+		t.Errorf("anonymous visitor saw %q", text)
+	}
+}
+
+func sessionManager(t *testing.T, options core.SessionOptions) *core.SessionManager {
+	t.Helper()
+
+	if options.Keys == nil {
+		options.Keys = [][]byte{[]byte(sessionKey)}
+	}
+	manager, err := core.NewSessionManager(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+// saveAndReload saves a session holding one value and returns the request that
+// carries its cookie.
+func saveAndReload(t *testing.T, manager *core.SessionManager, value string) *http.Request {
+	t.Helper()
+
+	session := manager.Load(httptest.NewRequest(http.MethodGet, "/", nil))
+	session.Set("value", value)
+	rec := httptest.NewRecorder()
+	if err := manager.Save(rec, session); err != nil {
+		t.Fatalf("Save = %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestSessionExpiry(t *testing.T) {
+	idle := sessionManager(t, core.SessionOptions{IdleTimeout: 50 * time.Millisecond})
+	req := saveAndReload(t, idle, "stale")
+	if session := idle.Load(req); session.IsNew() || session.GetString("value") != "stale" {
+		t.Fatal("session lost before its idle timeout")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if session := idle.Load(req); !session.IsNew() {
+		t.Error("idle session survived its timeout")
+	}
+
+	absolute := sessionManager(t, core.SessionOptions{MaxAge: 50 * time.Millisecond})
+	req = saveAndReload(t, absolute, "old")
+	time.Sleep(30 * time.Millisecond)
+	if session := absolute.Load(req); session.IsNew() {
+		t.Fatal("session expired early")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if session := absolute.Load(req); !session.IsNew() {
+		t.Error("session survived its absolute lifetime")
+	}
+}
+
+func TestCookieSessionTooLarge(t *testing.T) {
+	manager := sessionManager(t, core.SessionOptions{})
+
+	session := manager.Load(httptest.NewRequest(http.MethodGet, "/", nil))
+	session.Set("blob", strings.Repeat("x", 5000))
+	if err := manager.Save(httptest.NewRecorder(), session); err != core.ErrSessionTooLarge {
+		t.Errorf("Save = %v, want ErrSessionTooLarge", err)
+	}
+
+	stored := sessionManager(t, core.SessionOptions{Store: core.NewMemorySessionStore()})
+	session = stored.Load(httptest.NewRequest(http.MethodGet, "/", nil))
+	session.Set("blob", strings.Repeat("x", 5000))
+	if err := stored.Save(httptest.NewRecorder(), session); err != nil {
+		t.Errorf("Save with a server-side store = %v", err)
+	}
+}
+
+func TestInvalidSessionKeysFailInit(t *testing.T) {
+	config := core.DefaultConfig()
+	config.AppDir = "testdata/app"
+	config.SessionEnabled = true
+	config.SessionKeys = []string{"too-short"}
+
+	app := core.NewAppWithConfig(config)
+	app.Logger.SetOutput(io.Discard)
+	defer app.Shutdown(context.Background())
+
+	err := app.Init()
+	if !errors.Is(err, core.ErrCookieKeyLength) {
+		t.Fatalf("Init with a short session key = %v, want %v", err, core.ErrCookieKeyLength)
+	}
+}
+
+func TestNilSessionIsSafe(t *testing.T) {
+	var session *core.Session
+	session.Set("a", 1)
+	session.Regenerate()
+	session.Destroy()
+	if session.Get("a") != nil || session.Has("a") || !session.IsNew() || len(session.Values()) != 0 {
+		t.Error("nil session did not read as empty")
+	}
+}
+
+func TestCookieCodec(t *testing.T) {
+	if _, err := core.NewCookieCodec(true); err != core.ErrCookieNoKeys {
+		t.Errorf("no keys = %v", err)
+	}
+	if _, err := core.NewCookieCodec(true, []byte("short")); err != core.ErrCookieKeyLength {
+		t.Errorf("short key = %v", err)
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		codec, _ := core.NewCookieCodec(encrypt, []byte(sessionKey))
+		encoded, err := codec.Encode("prefs", []byte("dark"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded, err := codec.Decode("prefs", encoded); err != nil || string(decoded) != "dark" {
+			t.Errorf("encrypt %v: Decode = %q, %v", encrypt, decoded, err)
+		}
+		if _, err := codec.Decode("other", encoded); err != core.ErrCookieInvalid {
+			t.Errorf("encrypt %v: value moved to another cookie name decoded: %v", encrypt, err)
+		}
+	}
+}
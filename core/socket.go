@@ -0,0 +1,518 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kleeedolinux/socket.go/socket"
+	"github.com/kleeedolinux/socket.go/socket/transport"
+)
+
+// socketSendQueueSize is how many messages may wait for a connection before
+// the transport treats it as too slow and closes it.
+const socketSendQueueSize = 256
+
+var errSocketClosed = errors.New("socket closed")
+
+type SocketEventHandler func(ctx *SocketContext, data interface{})
+
+type SocketHandlers struct {
+	Authorize    func(r *http.Request) (interface{}, error)
+	CheckOrigin  func(r *http.Request) bool
+	OnConnect    func(ctx *SocketContext)
+	OnDisconnect func(ctx *SocketContext)
+	Events       map[string]SocketEventHandler
+}
+
+// SocketContext is one client connection. It is created when the upgrade
+// succeeds and lives until the client disconnects. User holds the upgrade
+// request's verified JWT claims, or what Authorize returned when it is set.
+type SocketContext struct {
+	Request  *http.Request
+	User     interface{}
+	Endpoint *SocketEndpoint
+
+	id        string
+	session   *Session
+	transport *transport.WebSocketServerTransport
+	values    map[string]interface{}
+	mutex     sync.RWMutex
+
+	// sendMutex orders writes into the transport's send queue, so everything
+	// sent to one client arrives in the order it was sent.
+	sendMutex sync.Mutex
+	closed    bool
+}
+
+type SocketEndpoint struct {
+	Path     string
+	handlers SocketHandlers
+	router   *Router
+
+	mutex       sync.RWMutex
+	connections map[string]*SocketContext
+	rooms       map[string]map[string]*SocketContext
+}
+
+// socketRegistry collects handlers registered from init() functions. Each
+// Router builds its own endpoints from it, so connections are never shared
+// between apps.
+var socketRegistry = make(map[string]SocketHandlers)
+var socketRegistryMutex sync.RWMutex
+
+func RegisterSocket(path string, handlers SocketHandlers) {
+	socketRegistryMutex.Lock()
+	defer socketRegistryMutex.Unlock()
+	socketRegistry[normalizePath(path)] = handlers
+}
+
+func defaultSocketHandlers() map[string]SocketHandlers {
+	socketRegistryMutex.RLock()
+	defer socketRegistryMutex.RUnlock()
+
+	handlers := make(map[string]SocketHandlers, len(socketRegistry))
+	for path, h := range socketRegistry {
+		handlers[path] = h
+	}
+	return handlers
+}
+
+func (r *Router) RegisterSocket(path string, handlers SocketHandlers) *SocketEndpoint {
+	r.socketsMutex.Lock()
+	defer r.socketsMutex.Unlock()
+
+	path = normalizePath(path)
+	endpoint := newSocketEndpoint(path, handlers, r)
+	r.sockets[path] = endpoint
+
+	return endpoint
+}
+
+func (r *Router) Socket(path string) *SocketEndpoint {
+	r.socketsMutex.RLock()
+	defer r.socketsMutex.RUnlock()
+	return r.sockets[normalizePath(path)]
+}
+
+func (r *Router) SocketEndpoints() []*SocketEndpoint {
+	r.socketsMutex.RLock()
+	defer r.socketsMutex.RUnlock()
+
+	endpoints := make([]*SocketEndpoint, 0, len(r.sockets))
+	for _, endpoint := range r.sockets {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Path < endpoints[j].Path
+	})
+	return endpoints
+}
+
+// serveSockets sends requests for a registered endpoint to it and everything
+// else to next. Endpoints are looked up per request, so ones registered after
+// the app's handler was built are served too.
+func (r *Router) serveSockets(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if endpoint := r.Socket(req.URL.Path); endpoint != nil {
+			endpoint.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func newSocketEndpoint(path string, handlers SocketHandlers, router *Router) *SocketEndpoint {
+	return &SocketEndpoint{
+		Path:        path,
+		handlers:    handlers,
+		router:      router,
+		connections: make(map[string]*SocketContext),
+		rooms:       make(map[string]map[string]*SocketContext),
+	}
+}
+
+// ServeHTTP upgrades the request and serves the connection until the client
+// goes away. The upgrade is done here rather than by the socket library's
+// server so each connection is bound to its own request and user up front.
+func (ep *SocketEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		RenderError(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	checkOrigin := ep.handlers.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = func(r *http.Request) bool {
+			return sameOriginOrAllowed(ep.router.Config, r)
+		}
+	}
+	if !checkOrigin(r) {
+		RenderError(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	r, session := ep.identify(r)
+
+	var user interface{}
+	if claims := ClaimsFromContext(r.Context()); claims != nil {
+		user = claims
+	}
+	if ep.handlers.Authorize != nil {
+		authorizedUser, err := ep.handlers.Authorize(r)
+		if err != nil {
+			RenderError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		user = authorizedUser
+	}
+
+	upgrader := transport.Upgrader
+	upgrader.EnableCompression = true
+	upgrader.ReadBufferSize = 4096
+	upgrader.WriteBufferSize = 4096
+	upgrader.CheckOrigin = func(*http.Request) bool { return true }
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	// The transport's read timeout is set once and never extended, which
+	// would drop every connection after it; dead peers are found by TCP
+	// keep-alives and failed writes instead.
+	transportConfig := transport.DefaultWebSocketServerConfig()
+	transportConfig.ReadTimeout = 0
+	transportConfig.BufferSize = socketSendQueueSize
+
+	id := newSocketID()
+	ctx := &SocketContext{
+		Request:   r,
+		User:      user,
+		Endpoint:  ep,
+		id:        id,
+		session:   session,
+		transport: transport.NewWebSocketServerTransport(id, conn, transportConfig),
+		values:    make(map[string]interface{}),
+	}
+
+	ep.mutex.Lock()
+	ep.connections[id] = ctx
+	ep.mutex.Unlock()
+
+	// Cleanup is deferred so a panicking OnConnect still takes the
+	// connection out of the endpoint and its rooms.
+	defer func() {
+		ep.remove(ctx)
+		ctx.markClosed()
+		ctx.transport.Close()
+
+		if ep.handlers.OnDisconnect != nil {
+			ep.handlers.OnDisconnect(ctx)
+		}
+	}()
+
+	if ep.handlers.OnConnect != nil {
+		ep.handlers.OnConnect(ctx)
+	}
+
+	ep.receive(ctx)
+}
+
+// identify loads the upgrade request's session and verifies its JWT the way
+// Router.ServeHTTP does, since socket endpoints are served outside it. Both
+// are added to the request's context, so Authorize can read them too.
+func (ep *SocketEndpoint) identify(r *http.Request) (*http.Request, *Session) {
+	router := ep.router
+	ctx := r.Context()
+
+	var session *Session
+	if router.Sessions != nil {
+		session = router.Sessions.Load(r)
+		ctx = withSession(ctx, session)
+	}
+
+	if router.Auth != nil {
+		if token := bearerToken(r, router.Config.JWTCookieName); token != "" {
+			claims, err := router.Auth.Verify(token)
+			if err != nil {
+				router.Logger.Debug("Rejected bearer token", "error", err, "socket", ep.Path)
+			} else {
+				ctx = WithClaims(ctx, claims)
+			}
+		}
+	}
+
+	return r.WithContext(ctx), session
+}
+
+// receive dispatches the client's events until the connection fails. Events
+// from one connection are handled one at a time, in the order they arrive.
+func (ep *SocketEndpoint) receive(ctx *SocketContext) {
+	for {
+		data, err := ctx.transport.Read()
+		if err != nil {
+			return
+		}
+
+		var message socket.Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			continue
+		}
+		if handler, ok := ep.handlers.Events[string(message.Event)]; ok {
+			ep.dispatch(ctx, string(message.Event), handler, message.Data)
+		}
+	}
+}
+
+// dispatch runs one event handler. A panic is logged and the message dropped,
+// so one bad message does not end the connection.
+func (ep *SocketEndpoint) dispatch(ctx *SocketContext, event string, handler SocketEventHandler, data interface{}) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			ep.router.Logger.Error("Socket event handler panic", "socket", ep.Path, "event", event, "panic", fmt.Sprint(rec))
+		}
+	}()
+	handler(ctx, data)
+}
+
+func (ep *SocketEndpoint) remove(ctx *SocketContext) {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	delete(ep.connections, ctx.id)
+	for room, members := range ep.rooms {
+		delete(members, ctx.id)
+		if len(members) == 0 {
+			delete(ep.rooms, room)
+		}
+	}
+}
+
+func newSocketID() string {
+	b := make([]byte, 12)
+	randomID(b)
+	return hex.EncodeToString(b)
+}
+
+func encodeSocketMessage(event string, data interface{}) ([]byte, error) {
+	return json.Marshal(socket.Message{Event: socket.Event(event), Data: data})
+}
+
+func (ep *SocketEndpoint) Broadcast(event string, data interface{}) {
+	payload, err := encodeSocketMessage(event, data)
+	if err != nil {
+		return
+	}
+
+	ep.mutex.RLock()
+	connections := make([]*SocketContext, 0, len(ep.connections))
+	for _, conn := range ep.connections {
+		connections = append(connections, conn)
+	}
+	ep.mutex.RUnlock()
+
+	for _, conn := range connections {
+		conn.enqueue(payload)
+	}
+}
+
+func (ep *SocketEndpoint) BroadcastToRoom(room string, event string, data interface{}) {
+	ep.broadcastToRoom(room, "", event, data)
+}
+
+func (ep *SocketEndpoint) broadcastToRoom(room string, exceptID string, event string, data interface{}) {
+	payload, err := encodeSocketMessage(event, data)
+	if err != nil {
+		return
+	}
+
+	ep.mutex.RLock()
+	members := make([]*SocketContext, 0, len(ep.rooms[room]))
+	for id, member := range ep.rooms[room] {
+		if id != exceptID {
+			members = append(members, member)
+		}
+	}
+	ep.mutex.RUnlock()
+
+	for _, member := range members {
+		member.enqueue(payload)
+	}
+}
+
+func (ep *SocketEndpoint) RoomSize(room string) int {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	return len(ep.rooms[room])
+}
+
+func (ep *SocketEndpoint) Count() int {
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+	return len(ep.connections)
+}
+
+// Shutdown closes every connection; each one's OnDisconnect runs as its
+// ServeHTTP returns.
+func (ep *SocketEndpoint) Shutdown(ctx context.Context) error {
+	ep.mutex.RLock()
+	connections := make([]*SocketContext, 0, len(ep.connections))
+	for _, conn := range ep.connections {
+		connections = append(connections, conn)
+	}
+	ep.mutex.RUnlock()
+
+	for _, conn := range connections {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conn.Close()
+	}
+	return nil
+}
+
+func (ctx *SocketContext) ID() string {
+	return ctx.id
+}
+
+// Session returns the session the client had when it connected, or nil when
+// sessions are disabled. A socket cannot set cookies, so changes made here
+// are not saved.
+func (ctx *SocketContext) Session() *Session {
+	return ctx.session
+}
+
+// Emit queues a message for this connection.
+func (ctx *SocketContext) Emit(event string, data interface{}) error {
+	payload, err := encodeSocketMessage(event, data)
+	if err != nil {
+		return err
+	}
+	return ctx.enqueue(payload)
+}
+
+// enqueue adds payload to the connection's send queue, which the transport
+// drains in order. A client that falls socketSendQueueSize messages behind is
+// disconnected by the transport.
+func (ctx *SocketContext) enqueue(payload []byte) error {
+	ctx.sendMutex.Lock()
+	defer ctx.sendMutex.Unlock()
+
+	if ctx.closed {
+		return errSocketClosed
+	}
+	return ctx.transport.Write(payload)
+}
+
+func (ctx *SocketContext) markClosed() {
+	ctx.sendMutex.Lock()
+	ctx.closed = true
+	ctx.sendMutex.Unlock()
+}
+
+func (ctx *SocketContext) Join(room string) {
+	ep := ctx.Endpoint
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if _, connected := ep.connections[ctx.id]; !connected {
+		return
+	}
+	members, ok := ep.rooms[room]
+	if !ok {
+		members = make(map[string]*SocketContext)
+		ep.rooms[room] = members
+	}
+	members[ctx.id] = ctx
+}
+
+func (ctx *SocketContext) Leave(room string) {
+	ep := ctx.Endpoint
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	if members, ok := ep.rooms[room]; ok {
+		delete(members, ctx.id)
+		if len(members) == 0 {
+			delete(ep.rooms, room)
+		}
+	}
+}
+
+func (ctx *SocketContext) Rooms() []string {
+	ep := ctx.Endpoint
+	ep.mutex.RLock()
+	defer ep.mutex.RUnlock()
+
+	var rooms []string
+	for room, members := range ep.rooms {
+		if _, ok := members[ctx.id]; ok {
+			rooms = append(rooms, room)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+func (ctx *SocketContext) Broadcast(event string, data interface{}) {
+	ctx.Endpoint.Broadcast(event, data)
+}
+
+// BroadcastToRoom sends to every member of room except the calling connection.
+func (ctx *SocketContext) BroadcastToRoom(room string, event string, data interface{}) {
+	ctx.Endpoint.broadcastToRoom(room, ctx.id, event, data)
+}
+
+func (ctx *SocketContext) Set(key string, value interface{}) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	ctx.values[key] = value
+}
+
+func (ctx *SocketContext) Get(key string) (interface{}, bool) {
+	ctx.mutex.RLock()
+	defer ctx.mutex.RUnlock()
+	value, ok := ctx.values[key]
+	return value, ok
+}
+
+// Close disconnects the client. Messages still queued are dropped.
+func (ctx *SocketContext) Close() error {
+	return ctx.transport.Close()
+}
+
+// sameOriginOrAllowed accepts same-origin upgrades and, with CORS enabled,
+// origins listed explicitly in AllowedOrigins. A bare "*" is not honoured:
+// browsers send cookies with WebSocket upgrades, so allowing any origin would
+// let any site act on a visitor's behalf.
+func sameOriginOrAllowed(config *Config, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+
+	if !config.EnableCORS {
+		return false
+	}
+
+	for _, allowed := range config.AllowedOrigins {
+		if allowed != "*" && matchOrigin(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
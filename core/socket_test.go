@@ -0,0 +1,391 @@
+package core_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+type socketMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// serveSocket registers handlers at /ws on a test app served over a real
+// listener, since a WebSocket upgrade needs a connection to hijack.
+func serveSocket(t *testing.T, handlers core.SocketHandlers, opts ...goatest.Option) (*goatest.App, *httptest.Server) {
+	t.Helper()
+
+	opts = append(opts, goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterSocket("/ws", handlers)
+	}))
+	app := newTestApp(t, opts...)
+	server := httptest.NewServer(app.Handler)
+	t.Cleanup(server.Close)
+	return app, server
+}
+
+func dialSocket(t *testing.T, server *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func sendEvent(t *testing.T, conn *websocket.Conn, event string, data interface{}) {
+	t.Helper()
+	if err := websocket.JSON.Send(conn, socketMessage{Event: event, Data: data}); err != nil {
+		t.Fatalf("send %s: %v", event, err)
+	}
+}
+
+func receiveEvent(t *testing.T, conn *websocket.Conn) socketMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var message socketMessage
+	if err := websocket.JSON.Receive(conn, &message); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	return message
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSocketEmitsToTheSender(t *testing.T) {
+	_, server := serveSocket(t, core.SocketHandlers{
+		OnConnect: func(ctx *core.SocketContext) {
+			ctx.Emit("welcome", ctx.ID())
+		},
+		Events: map[string]core.SocketEventHandler{
+			"ping": func(ctx *core.SocketContext, data interface{}) {
+				ctx.Emit("pong", data)
+			},
+		},
+	})
+	conn := dialSocket(t, server)
+
+	if welcome := receiveEvent(t, conn); welcome.Event != "welcome" || welcome.Data == "" {
+		t.Fatalf("first message = %+v, want a welcome with the connection id", welcome)
+	}
+
+	sendEvent(t, conn, "ping", "hello")
+	if pong := receiveEvent(t, conn); pong.Event != "pong" || pong.Data != "hello" {
+		t.Errorf("reply = %+v", pong)
+	}
+}
+
+func TestSocketRoomsAndDisconnect(t *testing.T) {
+	disconnected := make(chan string, 2)
+	app, server := serveSocket(t, core.SocketHandlers{
+		OnDisconnect: func(ctx *core.SocketContext) {
+			disconnected <- ctx.ID()
+		},
+		Events: map[string]core.SocketEventHandler{
+			"join": func(ctx *core.SocketContext, data interface{}) {
+				ctx.Join(fmt.Sprint(data))
+				ctx.Emit("joined", ctx.Rooms())
+			},
+			"say": func(ctx *core.SocketContext, data interface{}) {
+				ctx.BroadcastToRoom("lobby", "said", data)
+			},
+		},
+	})
+	endpoint := app.App.Router.Socket("/ws")
+
+	alice := dialSocket(t, server)
+	bob := dialSocket(t, server)
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		sendEvent(t, conn, "join", "lobby")
+		receiveEvent(t, conn)
+	}
+	if endpoint.Count() != 2 || endpoint.RoomSize("lobby") != 2 {
+		t.Fatalf("count = %d, lobby = %d", endpoint.Count(), endpoint.RoomSize("lobby"))
+	}
+
+	sendEvent(t, alice, "say", "hi bob")
+	if message := receiveEvent(t, bob); message.Event != "said" || message.Data != "hi bob" {
+		t.Errorf("bob got %+v", message)
+	}
+
+	endpoint.Broadcast("notice", "everyone")
+	if message := receiveEvent(t, alice); message.Event != "notice" {
+		t.Errorf("alice got %+v, want the broadcast and not her own room message", message)
+	}
+
+	bob.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect did not run")
+	}
+	if endpoint.Count() != 1 || endpoint.RoomSize("lobby") != 1 {
+		t.Errorf("after disconnect: count = %d, lobby = %d", endpoint.Count(), endpoint.RoomSize("lobby"))
+	}
+}
+
+func TestSocketSurvivesPanickingHandlers(t *testing.T) {
+	disconnected := make(chan struct{}, 1)
+	app, server := serveSocket(t, core.SocketHandlers{
+		OnConnect: func(ctx *core.SocketContext) {
+			ctx.Join("lobby")
+			if ctx.Request.URL.Query().Get("fail") != "" {
+				panic("connect failed")
+			}
+		},
+		OnDisconnect: func(ctx *core.SocketContext) {
+			disconnected <- struct{}{}
+		},
+		Events: map[string]core.SocketEventHandler{
+			"boom": func(ctx *core.SocketContext, data interface{}) {
+				panic("bad message")
+			},
+			"ping": func(ctx *core.SocketContext, data interface{}) {
+				ctx.Emit("pong", nil)
+			},
+		},
+	})
+	endpoint := app.App.Router.Socket("/ws")
+
+	conn := dialSocket(t, server)
+	sendEvent(t, conn, "boom", nil)
+	sendEvent(t, conn, "ping", nil)
+	if message := receiveEvent(t, conn); message.Event != "pong" {
+		t.Errorf("got %+v after a panicking event, want the connection to keep serving", message)
+	}
+
+	// A panic in OnConnect still removes the connection and runs OnDisconnect.
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?fail=1"
+	if failed, err := websocket.Dial(url, "", server.URL); err == nil {
+		defer failed.Close()
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect did not run after OnConnect panicked")
+	}
+	waitFor(t, "the failed connection to be removed", func() bool {
+		return endpoint.Count() == 1 && endpoint.RoomSize("lobby") == 1
+	})
+}
+
+func TestSocketMessagesArriveInOrder(t *testing.T) {
+	const total = 200
+	_, server := serveSocket(t, core.SocketHandlers{
+		Events: map[string]core.SocketEventHandler{
+			"burst": func(ctx *core.SocketContext, _ interface{}) {
+				for i := 0; i < total; i++ {
+					ctx.Emit("n", i)
+				}
+			},
+		},
+	})
+	conn := dialSocket(t, server)
+
+	sendEvent(t, conn, "burst", nil)
+	for i := 0; i < total; i++ {
+		message := receiveEvent(t, conn)
+		if message.Data != float64(i) {
+			t.Fatalf("message %d carried %v", i, message.Data)
+		}
+	}
+}
+
+func TestSocketAuthorizeBindsUser(t *testing.T) {
+	_, server := serveSocket(t, core.SocketHandlers{
+		Authorize: func(r *http.Request) (interface{}, error) {
+			if name := r.URL.Query().Get("user"); name != "" {
+				return name, nil
+			}
+			return nil, errors.New("sign in first")
+		},
+		OnConnect: func(ctx *core.SocketContext) {
+			ctx.Emit("hello", ctx.User)
+		},
+	})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?user=ada"
+	conn, err := websocket.Dial(url, "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if message := receiveEvent(t, conn); message.Data != "ada" {
+		t.Errorf("OnConnect saw user %v, want ada", message.Data)
+	}
+}
+
+func dialSocketWithHeader(t *testing.T, server *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header = header
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestSocketReadsTheHTTPSession(t *testing.T) {
+	app, server := serveSocket(t, core.SocketHandlers{
+		Events: map[string]core.SocketEventHandler{
+			"cart": func(ctx *core.SocketContext, data interface{}) {
+				ctx.Emit("cart", ctx.Session().GetString("cart"))
+			},
+		},
+	}, goatest.WithConfig(func(c *core.Config) {
+		c.SessionEnabled = true
+		c.SessionKeys = []string{sessionKey}
+	}), withAPI("/api/cart", http.MethodPost, func(ctx *core.APIContext) {
+		ctx.Session().Set("cart", "tea")
+		ctx.Success("ok", http.StatusOK)
+	}))
+
+	res := app.Post("/api/cart", "application/json", nil).AssertStatus(http.StatusOK)
+	cookie := sessionCookie(t, res)
+
+	conn := dialSocketWithHeader(t, server, http.Header{"Cookie": {cookie.Name + "=" + cookie.Value}})
+	sendEvent(t, conn, "cart", nil)
+	if message := receiveEvent(t, conn); message.Data != "tea" {
+		t.Errorf("socket handler saw cart %v, want the value set over HTTP", message.Data)
+	}
+}
+
+func TestSocketUserFromJWT(t *testing.T) {
+	_, server := serveSocket(t, core.SocketHandlers{
+		OnConnect: func(ctx *core.SocketContext) {
+			claims, _ := ctx.User.(core.Claims)
+			ctx.Emit("hello", claims.Subject())
+		},
+	}, goatest.WithConfig(func(c *core.Config) {
+		c.JWTEnabled = true
+		c.JWTSecret = jwtSecret
+	}))
+
+	conn := dialSocketWithHeader(t, server, http.Header{"Authorization": {bearer(t, claimsFor("ada"))}})
+	if message := receiveEvent(t, conn); message.Data != "ada" {
+		t.Errorf("OnConnect saw user %v, want the token's subject", message.Data)
+	}
+
+	anonymous := dialSocketWithHeader(t, server, http.Header{"Authorization": {"Bearer not-a-token"}})
+	if message := receiveEvent(t, anonymous); message.Data != "" {
+		t.Errorf("OnConnect saw user %v for an invalid token, want none", message.Data)
+	}
+}
+
+func upgradeRequest(app *goatest.App, origin string) *goatest.Response {
+	headers := []string{"Upgrade", "websocket", "Connection", "Upgrade", "Sec-WebSocket-Version", "13", "Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ=="}
+	if origin != "" {
+		headers = append(headers, "Origin", origin)
+	}
+	return app.Request(http.MethodGet, "http://app.test/ws", nil, headers...)
+}
+
+func TestSocketRejectsBeforeUpgrading(t *testing.T) {
+	handlers := core.SocketHandlers{
+		Authorize: func(r *http.Request) (interface{}, error) {
+			if r.Header.Get("Authorization") == "" {
+				return nil, errors.New("sign in first")
+			}
+			return "user", nil
+		},
+	}
+	app, _ := serveSocket(t, handlers, goatest.WithConfig(func(c *core.Config) {
+		c.EnableCORS = true
+		c.AllowedOrigins = []string{"*", "https://partner.example"}
+	}))
+
+	app.Get("/ws").AssertStatus(http.StatusBadRequest)
+
+	var data core.ResponseData
+	data = upgradeRequest(app, "https://evil.example").AssertStatus(http.StatusForbidden).Data(nil)
+	if !strings.Contains(data.Error, "Origin") {
+		t.Errorf("error = %q", data.Error)
+	}
+
+	data = upgradeRequest(app, "https://partner.example").AssertStatus(http.StatusUnauthorized).Data(nil)
+	if data.Error != "sign in first" {
+		t.Errorf("error = %q, want the Authorize error", data.Error)
+	}
+	upgradeRequest(app, "http://app.test").AssertStatus(http.StatusUnauthorized)
+}
+
+func TestSocketEndpointsArePerApp(t *testing.T) {
+	handlers := core.SocketHandlers{}
+	first, firstServer := serveSocket(t, handlers)
+	second, _ := serveSocket(t, handlers)
+
+	dialSocket(t, firstServer)
+	waitFor(t, "the connection to register", func() bool {
+		return first.App.Router.Socket("/ws").Count() == 1
+	})
+	if count := second.App.Router.Socket("/ws").Count(); count != 0 {
+		t.Errorf("second app sees %d connections", count)
+	}
+}
+
+func TestSocketRegisteredAfterStartIsServed(t *testing.T) {
+	app := newTestApp(t)
+	server := httptest.NewServer(app.Handler)
+	t.Cleanup(server.Close)
+
+	app.App.Router.RegisterSocket("/ws", core.SocketHandlers{
+		OnConnect: func(ctx *core.SocketContext) {
+			ctx.Emit("hello", "late")
+		},
+	})
+
+	conn := dialSocket(t, server)
+	if message := receiveEvent(t, conn); message.Data != "late" {
+		t.Errorf("got %+v from an endpoint registered after the handler was built", message)
+	}
+}
+
+func TestSocketMessagesAreJSON(t *testing.T) {
+	_, server := serveSocket(t, core.SocketHandlers{
+		OnConnect: func(ctx *core.SocketContext) {
+			ctx.Emit("state", map[string]int{"count": 3})
+		},
+	})
+	conn := dialSocket(t, server)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var raw string
+	if err := websocket.Message.Receive(conn, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil || decoded["event"] != "state" {
+		t.Errorf("frame = %s", raw)
+	}
+}
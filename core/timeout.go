@@ -0,0 +1,341 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// writeTimeoutGrace is how much longer than a request's timeout the server
+// gives itself to write the response, so timed-out requests still get
+// their 503 or 504 rather than a dropped connection.
+const writeTimeoutGrace = 5 * time.Second
+
+// WithTimeout sets how long an API route's handler may run before its context
+// is cancelled, in place of Config.RequestTimeout. A negative timeout disables
+// it, for routes that stream or run long jobs.
+func WithTimeout(timeout time.Duration) APIOption {
+	return func(o *APIRouteOptions) {
+		o.Timeout = timeout
+	}
+}
+
+// routeTimeout resolves a route's timeout, where zero means the app default
+// and a negative value means none. It returns 0 when there is no timeout.
+func (c *Config) routeTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		timeout = c.RequestTimeout
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+func (c *Config) timeoutStatus() int {
+	if c.TimeoutStatus == http.StatusGatewayTimeout {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusServiceUnavailable
+}
+
+// pageTimeout returns the timeout for a page, set by its timeout: directive
+// or Config.RequestTimeout, or 0 when it has none.
+func (r *Router) pageTimeout(routePath string) time.Duration {
+	r.Marley.mutex.RLock()
+	defer r.Marley.mutex.RUnlock()
+
+	var timeout time.Duration
+	if metadata, ok := r.Marley.PageMetadata[routePath]; ok {
+		timeout = metadata.Timeout
+	}
+	return r.Config.routeTimeout(timeout)
+}
+
+// serverWriteTimeout is http.Server's WriteTimeout: Config.RequestTimeout plus
+// writeTimeoutGrace. It returns 0, leaving writes unbounded, only when
+// RequestTimeout is off. Routes that need longer extend their own deadline
+// with extendWriteDeadline.
+func (c *Config) serverWriteTimeout() time.Duration {
+	timeout := c.routeTimeout(0)
+	if timeout == 0 {
+		return 0
+	}
+	return timeout + writeTimeoutGrace
+}
+
+// extendWriteDeadline lifts the connection's write deadline for a route whose
+// timeout outlasts the server's WriteTimeout, or removes it for a route with
+// no timeout, such as a stream. Other routes keep the server's deadline.
+func (r *Router) extendWriteDeadline(w http.ResponseWriter, timeout time.Duration) {
+	serverTimeout := r.Config.serverWriteTimeout()
+	if serverTimeout == 0 {
+		return
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		if timeout+writeTimeoutGrace <= serverTimeout {
+			return
+		}
+		deadline = time.Now().Add(timeout + writeTimeoutGrace)
+	}
+	if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		r.Logger.Warn("Could not extend write deadline", "error", err)
+	}
+}
+
+// serveWithTimeout runs serve with the request's context cancelled after
+// timeout. If serve has not returned by then, its buffered output is dropped
+// and onTimeout writes the response instead. It returns the context's error
+// when serve was abandoned: context.DeadlineExceeded on timeout, or
+// context.Canceled when the client went away. An abandoned serve keeps
+// running, so the request's session and CSRF state are sealed before its
+// context is cancelled; see sealRequestState. A panic in serve is raised
+// again on the calling goroutine, or logged once serve has been abandoned.
+func serveWithTimeout(w http.ResponseWriter, req *http.Request, timeout time.Duration, serve func(http.ResponseWriter, *http.Request), onTimeout func(http.ResponseWriter)) error {
+	parent := req.Context()
+	ctx := newTimeoutContext(parent, time.Now().Add(timeout))
+	defer ctx.cancel(context.Canceled)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	tw := newTimeoutWriter(w)
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				if tw.returned() {
+					if logger := LoggerFromContext(parent); logger != nil {
+						logger.Error("Handler panicked after its request timed out", "panic", fmt.Sprint(rec))
+					}
+					return
+				}
+				panicked <- rec
+			}
+		}()
+		serve(tw, req.WithContext(ctx))
+		tw.returned()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case rec := <-panicked:
+		panic(rec)
+	case <-done:
+		tw.finish()
+		return nil
+	case <-timer.C:
+		err = context.DeadlineExceeded
+	case <-parent.Done():
+		err = parent.Err()
+	}
+
+	// The handler may have returned just as the timer fired. abandon settles
+	// the race under the writer's lock, so a completed response is never
+	// replaced by a timeout.
+	committed, finished := tw.abandon()
+	if finished {
+		select {
+		case rec := <-panicked:
+			panic(rec)
+		case <-done:
+			tw.finish()
+			return nil
+		}
+	}
+	sealRequestState(parent)
+	ctx.cancel(err)
+	if err == context.DeadlineExceeded && !committed {
+		onTimeout(w)
+	}
+	return err
+}
+
+// timeoutContext is cancelled by serveWithTimeout rather than by its own
+// timer, so a handler only sees its deadline once its writer and session can
+// no longer change.
+type timeoutContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+func newTimeoutContext(parent context.Context, deadline time.Time) *timeoutContext {
+	if parentDeadline, ok := parent.Deadline(); ok && parentDeadline.Before(deadline) {
+		deadline = parentDeadline
+	}
+	return &timeoutContext{Context: parent, deadline: deadline, done: make(chan struct{})}
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *timeoutContext) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *timeoutContext) cancel(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// sealRequestState stops an abandoned handler from changing the session or
+// handing out new CSRF tokens: both are saved when the timeout response is
+// written, so anything the handler does afterwards would be lost or only half
+// applied. Batch items share their batch's session, which the batch saves
+// after every item has finished or timed out, so they are left alone.
+func sealRequestState(ctx context.Context) {
+	if isBatchItem(ctx) {
+		return
+	}
+	SessionFromContext(ctx).seal()
+	csrfStateFromContext(ctx).seal()
+}
+
+// timeoutWriter buffers a handler's response until the handler returns or
+// flushes, so a timeout response can still take its place. Once flushed,
+// writes stream straight through and a timeout can only cancel the context.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mutex     sync.Mutex
+	body      bytes.Buffer
+	status    int
+	committed bool
+	abandoned bool
+	finished  bool
+}
+
+func newTimeoutWriter(w http.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{w: w, header: w.Header().Clone()}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if tw.abandoned || tw.status != 0 {
+		return
+	}
+	tw.status = code
+	if tw.committed {
+		tw.w.WriteHeader(code)
+	}
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	if tw.committed {
+		return tw.w.Write(b)
+	}
+	return tw.body.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if tw.abandoned {
+		return
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.commitLocked()
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, so negotiatedEncoding can still find
+// the compression agreed for the response.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.w
+}
+
+// finish sends the buffered response once the handler has returned.
+func (tw *timeoutWriter) finish() {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	tw.commitLocked()
+}
+
+// returned records that the handler has returned or panicked and reports
+// whether it had already been abandoned, in which case nobody is waiting for
+// its outcome.
+func (tw *timeoutWriter) returned() bool {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	tw.finished = true
+	return tw.abandoned
+}
+
+// abandon makes further writes fail with http.ErrHandlerTimeout and reports
+// whether part of the response had already been sent. When the handler has
+// already returned it leaves the writer alone and reports finished instead.
+func (tw *timeoutWriter) abandon() (committed bool, finished bool) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.finished {
+		return tw.committed, true
+	}
+	tw.abandoned = true
+	return tw.committed, false
+}
+
+func (tw *timeoutWriter) commitLocked() {
+	if tw.committed {
+		return
+	}
+	tw.committed = true
+
+	dst := tw.w.Header()
+	for key := range dst {
+		delete(dst, key)
+	}
+	for key, values := range tw.header.Clone() {
+		dst[key] = values
+	}
+
+	if tw.status != 0 {
+		tw.w.WriteHeader(tw.status)
+	}
+	if tw.body.Len() > 0 {
+		tw.w.Write(tw.body.Bytes())
+		tw.body.Reset()
+	}
+}
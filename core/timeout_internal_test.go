@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deadlineRecorder records the write deadlines set through
+// http.ResponseController.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadlines []time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.deadlines = append(d.deadlines, deadline)
+	return nil
+}
+
+func TestServerWriteTimeoutFollowsRequestTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.RequestTimeout = 10 * time.Second
+	r := NewRouter(&config, NewLogger(io.Discard, LevelError, LogFormatJSON))
+	r.API.Clear()
+
+	noop := func(ctx *APIContext) {}
+	r.RegisterAPIHandler("/api/report", http.MethodGet, noop, WithTimeout(30*time.Second))
+	r.RegisterAPIHandler("/api/events", http.MethodGet, noop, WithTimeout(-1))
+	r.Marley.PageMetadata["/export"] = &PageMetadata{Timeout: -1}
+
+	if got, want := config.serverWriteTimeout(), 10*time.Second+writeTimeoutGrace; got != want {
+		t.Errorf("WriteTimeout = %v, want %v whatever the routes declare", got, want)
+	}
+
+	config.RequestTimeout = 0
+	if got := config.serverWriteTimeout(); got != 0 {
+		t.Errorf("WriteTimeout = %v with RequestTimeout off, want none", got)
+	}
+}
+
+func TestRoutesExtendTheirOwnWriteDeadline(t *testing.T) {
+	config := DefaultConfig()
+	config.RequestTimeout = 10 * time.Second
+	config.RateLimit = 0
+	r := NewRouter(&config, NewLogger(io.Discard, LevelError, LogFormatJSON))
+	r.API.Clear()
+
+	noop := func(ctx *APIContext) {}
+	r.RegisterAPIHandler("/api/quick", http.MethodGet, noop, WithTimeout(time.Second))
+	r.RegisterAPIHandler("/api/report", http.MethodGet, noop, WithTimeout(30*time.Second))
+	r.RegisterAPIHandler("/api/events", http.MethodGet, noop, WithTimeout(-1))
+
+	serve := func(path string) []time.Time {
+		rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.deadlines
+	}
+
+	if deadlines := serve("/api/quick"); len(deadlines) != 0 {
+		t.Errorf("a route within the server's WriteTimeout set deadlines %v", deadlines)
+	}
+
+	start := time.Now()
+	deadlines := serve("/api/report")
+	if len(deadlines) != 1 || deadlines[0].Before(start.Add(30*time.Second)) {
+		t.Errorf("a 30s route set deadlines %v, want one past its timeout", deadlines)
+	}
+
+	deadlines = serve("/api/events")
+	if len(deadlines) != 1 || !deadlines[0].IsZero() {
+		t.Errorf("a route without a timeout set deadlines %v, want it cleared", deadlines)
+	}
+
+	// Page timeouts are read per request, so a reloaded directive applies at once.
+	r.Marley.PageMetadata["/export"] = &PageMetadata{Timeout: time.Minute}
+	rec := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.extendWriteDeadline(rec, r.pageTimeout("/export"))
+	if len(rec.deadlines) != 1 || rec.deadlines[0].Before(start.Add(time.Minute)) {
+		t.Errorf("a one-minute page set deadlines %v", rec.deadlines)
+	}
+}
+
+func TestTimeoutKeepsAResponseThatFinishedWithTheTimer(t *testing.T) {
+	rec := httptest.NewRecorder()
+	tw := newTimeoutWriter(rec)
+	tw.WriteHeader(http.StatusCreated)
+	tw.Write([]byte("saved"))
+	tw.returned()
+
+	// The timer firing after the handler returned must not discard its work.
+	if _, finished := tw.abandon(); !finished {
+		t.Fatal("abandon took over a writer whose handler had returned")
+	}
+	tw.finish()
+	if rec.Code != http.StatusCreated || rec.Body.String() != "saved" {
+		t.Errorf("response = %d %q, want the handler's", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTimeoutLogsPanicsAfterTheTimeout(t *testing.T) {
+	var out safeBuffer
+	logger := NewLogger(&out, LevelError, LogFormatJSON)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(WithLogger(req.Context(), logger))
+
+	release := make(chan struct{})
+	err := serveWithTimeout(httptest.NewRecorder(), req, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		panic("late failure")
+	}, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	close(release)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("serveWithTimeout = %v, want a timeout", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), "late failure") {
+		if time.Now().After(deadline) {
+			t.Fatal("a panic after the timeout was not logged")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// safeBuffer is a bytes.Buffer safe for a logger and a test to share.
+type safeBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
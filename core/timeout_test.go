@@ -0,0 +1,204 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForDeadline blocks until ctx is cancelled, failing the test if that
+// takes more than a few seconds, and returns the context's error.
+func waitForDeadline(t *testing.T, ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		t.Error("context was never cancelled")
+		return nil
+	}
+}
+
+// slowPage holds the page at path for delay, or until its request is
+// cancelled, and reports the context's error on stopped.
+func slowPage(t *testing.T, app *goatest.App, path string, delay time.Duration, stopped chan<- error) {
+	t.Helper()
+
+	for _, route := range app.App.Router.Routes {
+		if route.Path == path {
+			route.Middleware.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					select {
+					case <-time.After(delay):
+					case <-r.Context().Done():
+					}
+					stopped <- r.Context().Err()
+					next.ServeHTTP(w, r)
+				})
+			})
+			return
+		}
+	}
+	t.Fatalf("no page route %s", path)
+}
+
+func TestAPITimeout(t *testing.T) {
+	var out bytes.Buffer
+	handlerErr := make(chan error, 1)
+	app := loggedApp(t, &out, withAPI("/api/report", http.MethodGet, func(ctx *core.APIContext) {
+		handlerErr <- waitForDeadline(t, ctx.Context())
+	}, core.WithTimeout(50*time.Millisecond)))
+
+	start := time.Now()
+	app.Get("/api/report").
+		AssertStatus(http.StatusServiceUnavailable).
+		AssertHeader("Content-Type", "application/json").
+		AssertContains("Request timed out")
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout answered after %v", elapsed)
+	}
+	if err := <-handlerErr; err != context.DeadlineExceeded {
+		t.Errorf("handler context ended with %v, want DeadlineExceeded", err)
+	}
+
+	record := findRecord(logRecords(t, &out), "API request timed out")
+	if record == nil || record["route"] != "/api/report" || record["method"] != http.MethodGet {
+		t.Errorf("timeout log = %v", record)
+	}
+}
+
+func TestRequestTimeoutDefaultsAndOverrides(t *testing.T) {
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.RequestTimeout = 50 * time.Millisecond
+		c.TimeoutStatus = http.StatusGatewayTimeout
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/slow", http.MethodGet, func(ctx *core.APIContext) {
+			waitForDeadline(t, ctx.Context())
+		})
+		app.Router.RegisterAPIHandler("/api/export", http.MethodGet, func(ctx *core.APIContext) {
+			time.Sleep(100 * time.Millisecond)
+			if ctx.Context().Err() != nil {
+				t.Error("route without a timeout was cancelled")
+			}
+			ctx.Success("done", http.StatusOK)
+		}, core.WithTimeout(-1))
+		app.Router.RegisterAPIHandler("/api/fast", http.MethodPost, func(ctx *core.APIContext) {
+			ctx.Writer.Header().Set("X-Order", "42")
+			ctx.Success("created", http.StatusCreated)
+		})
+	}))
+
+	app.Get("/api/slow").AssertStatus(http.StatusGatewayTimeout).AssertContains("Request timed out")
+	app.Get("/api/export").AssertStatus(http.StatusOK)
+	app.PostJSON("/api/fast", nil).
+		AssertStatus(http.StatusCreated).
+		AssertHeader("X-Order", "42").
+		AssertContains("created")
+}
+
+func TestTimeoutAfterFlushKeepsStream(t *testing.T) {
+	lateWrite := make(chan error, 1)
+	app := newTestApp(t, withAPI("/api/events", http.MethodGet, func(ctx *core.APIContext) {
+		ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(ctx.Writer, "data: first\n\n")
+		ctx.Writer.(http.Flusher).Flush()
+		waitForDeadline(t, ctx.Context())
+		_, err := io.WriteString(ctx.Writer, "data: late\n\n")
+		lateWrite <- err
+	}, core.WithTimeout(50*time.Millisecond)))
+
+	res := app.Get("/api/events").AssertStatus(http.StatusOK).AssertHeader("Content-Type", "text/event-stream")
+	if res.String() != "data: first\n\n" {
+		t.Errorf("body = %q, want only the flushed event", res.String())
+	}
+	if err := <-lateWrite; err != http.ErrHandlerTimeout {
+		t.Errorf("write after the deadline returned %v, want ErrHandlerTimeout", err)
+	}
+}
+
+func TestPageTimeoutDirective(t *testing.T) {
+	var out bytes.Buffer
+	app := loggedApp(t, &out, goatest.WithConfig(func(c *core.Config) {
+		c.RequestTimeout = 50 * time.Millisecond
+	}))
+
+	stopped := make(chan error, 2)
+	slowPage(t, app, "/slow", 5*time.Second, stopped)
+	slowPage(t, app, "/stream", 100*time.Millisecond, stopped)
+
+	res := app.Get("/slow").
+		AssertStatus(http.StatusServiceUnavailable).
+		AssertContains("The page took too long to respond")
+	if strings.Contains(res.String(), "<h1>Slow</h1>") {
+		t.Error("the abandoned page's content was sent")
+	}
+	if err := <-stopped; err != context.DeadlineExceeded {
+		t.Errorf("page context ended with %v, want DeadlineExceeded", err)
+	}
+	record := findRecord(logRecords(t, &out), "Page request timed out")
+	if record == nil || record["route"] != "/slow" {
+		t.Errorf("timeout log = %v", record)
+	}
+
+	// timeout:off outlasts the app's RequestTimeout.
+	app.Get("/stream").AssertStatus(http.StatusOK).AssertText("h1", "Stream")
+	if err := <-stopped; err != nil {
+		t.Errorf("page without a timeout was cancelled: %v", err)
+	}
+}
+
+func TestTimedOutRequestSealsSession(t *testing.T) {
+	handlerDone := make(chan struct{})
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SessionEnabled = true
+		c.SessionKeys = []string{sessionKey}
+	}), goatest.WithAPIHandlers(func(app *core.GonAirApp) {
+		app.Router.RegisterAPIHandler("/api/checkout", http.MethodPost, func(ctx *core.APIContext) {
+			defer close(handlerDone)
+			ctx.Session().Set("step", "started")
+			waitForDeadline(t, ctx.Context())
+			ctx.Session().Set("step", "paid")
+			ctx.Session().Set("late", true)
+			ctx.Session().Regenerate()
+		}, core.WithTimeout(50*time.Millisecond))
+		app.Router.RegisterAPIHandler("/api/me", http.MethodGet, func(ctx *core.APIContext) {
+			ctx.Success(ctx.Session().Values(), http.StatusOK)
+		})
+	}))
+
+	res := app.PostJSON("/api/checkout", nil).AssertStatus(http.StatusServiceUnavailable)
+	<-handlerDone
+
+	values := sessionValues(app, sessionCookie(t, res))
+	if values["step"] != "started" || values["late"] != nil {
+		t.Errorf("session = %v, want only the change made before the deadline", values)
+	}
+}
+
+func TestTimeoutKeepsPrecompressedPages(t *testing.T) {
+	ssgDir := t.TempDir()
+	app := newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.SSGEnabled = true
+		c.SSGCacheEnabled = true
+		c.SSGDir = ssgDir
+		c.RequestTimeout = time.Second
+	}))
+
+	gzipped, err := os.ReadFile(filepath.Join(ssgDir, "docs.html.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := app.Request(http.MethodGet, "/docs", nil, "Accept-Encoding", "gzip").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Encoding", "gzip")
+	if !bytes.Equal(res.Body, gzipped) {
+		t.Error("page under a timeout was compressed again instead of sent precompressed")
+	}
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	devCertFile     = "localhost.pem"
+	devKeyFile      = "localhost-key.pem"
+	devCertValidity = 365 * 24 * time.Hour
+)
+
+// parseTLSVersion accepts only TLS 1.2 and 1.3; 1.0 and 1.1 are deprecated by
+// RFC 8996.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.0", "1.1":
+		return 0, fmt.Errorf("TLS %s is deprecated (RFC 8996); use 1.2 or 1.3", version)
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q (use 1.2 or 1.3)", version)
+	}
+}
+
+// tlsFiles returns the certificate and key to serve. Without configured files a
+// cached self-signed localhost certificate is used in dev mode.
+func (app *GonAirApp) tlsFiles() (string, string, error) {
+	if app.Config.TLSCertFile != "" || app.Config.TLSKeyFile != "" {
+		if app.Config.TLSCertFile == "" || app.Config.TLSKeyFile == "" {
+			return "", "", fmt.Errorf("both TLS cert and key files must be set")
+		}
+		return app.Config.TLSCertFile, app.Config.TLSKeyFile, nil
+	}
+
+	if !app.Config.DevMode {
+		return "", "", fmt.Errorf("TLS is enabled but no cert/key files are configured")
+	}
+
+	certFile, keyFile, created, err := EnsureDevCertificate(app.Config.TLSDevCertDir)
+	if err != nil {
+		return "", "", err
+	}
+	if created {
+		app.Logger.Infof("Generated self-signed development certificate: %s", certFile)
+	}
+	app.Logger.Warnf("Serving a self-signed certificate - browsers will ask you to trust it")
+
+	return certFile, keyFile, nil
+}
+
+func (app *GonAirApp) tlsConfig() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(app.Config.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+	}, nil
+}
+
+// newRedirectServer answers plain HTTP on TLSRedirectPort with a permanent
+// redirect to the HTTPS listener.
+func (app *GonAirApp) newRedirectServer() *http.Server {
+	httpsPort := app.Config.Port
+
+	return &http.Server{
+		Addr: ":" + app.Config.TLSRedirectPort,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if httpsPort != "443" {
+				host = net.JoinHostPort(host, httpsPort)
+			}
+
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       30 * time.Second,
+	}
+}
+
+// EnsureDevCertificate returns a self-signed certificate for localhost,
+// 127.0.0.1 and ::1 stored in dir, generating a new one when it is missing or
+// about to expire. created reports whether a new certificate was written.
+func EnsureDevCertificate(dir string) (certFile string, keyFile string, created bool, err error) {
+	certFile = filepath.Join(dir, devCertFile)
+	keyFile = filepath.Join(dir, devKeyFile)
+
+	if validDevCertificate(certFile, keyFile) {
+		return certFile, keyFile, false, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", false, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Go on Airplanes development"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(devCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", false, fmt.Errorf("failed to write certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", false, fmt.Errorf("failed to write key: %w", err)
+	}
+
+	return certFile, keyFile, true, nil
+}
+
+func validDevCertificate(certFile, keyFile string) bool {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil || len(pair.Certificate) == 0 {
+		return false
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Add(7*24*time.Hour).Before(cert.NotAfter) && cert.VerifyHostname("localhost") == nil
+}
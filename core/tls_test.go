@@ -0,0 +1,188 @@
+package core_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnsureDevCertificate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "certs")
+
+	certFile, keyFile, created, err := core.EnsureDevCertificate(dir)
+	if err != nil || !created {
+		t.Fatalf("EnsureDevCertificate = %v, created %v", err, created)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("certificate not valid for %s: %v", host, err)
+		}
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	again, _, created, err := core.EnsureDevCertificate(dir)
+	if err != nil || created || again != certFile {
+		t.Errorf("second call = %s, created %v, %v; want the cached certificate", again, created, err)
+	}
+
+	os.WriteFile(certFile, []byte("not a certificate"), 0644)
+	if _, _, created, err := core.EnsureDevCertificate(dir); err != nil || !created {
+		t.Errorf("a corrupt certificate was not replaced: created %v, %v", created, err)
+	}
+}
+
+func tlsApp(t *testing.T, configure func(*core.Config)) *goatest.App {
+	t.Helper()
+
+	return newTestApp(t, goatest.WithConfig(func(c *core.Config) {
+		c.TLSEnabled = true
+		c.DevMode = true
+		c.TLSDevCertDir = filepath.Join(t.TempDir(), "certs")
+		c.Port = freePort(t)
+		if configure != nil {
+			configure(c)
+		}
+	}))
+}
+
+func TestStartServesTLS(t *testing.T) {
+	redirectPort := freePort(t)
+	app := tlsApp(t, func(c *core.Config) {
+		c.TLSRedirectHTTP = true
+		c.TLSRedirectPort = redirectPort
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- app.App.Start() }()
+
+	waitForListener(t, "127.0.0.1:"+app.App.Config.Port)
+	certPEM, err := os.ReadFile(filepath.Join(app.App.Config.TLSDevCertDir, "localhost.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	dial := func(maxVersion uint16) (*tls.ConnectionState, error) {
+		conn, err := tls.Dial("tcp", "127.0.0.1:"+app.App.Config.Port, &tls.Config{
+			RootCAs:    roots,
+			ServerName: "localhost",
+			MinVersion: tls.VersionTLS10,
+			MaxVersion: maxVersion,
+			NextProtos: []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		state := conn.ConnectionState()
+		return &state, nil
+	}
+
+	state, err := dial(tls.VersionTLS13)
+	if err != nil {
+		t.Fatalf("TLS handshake: %v", err)
+	}
+	if state.NegotiatedProtocol != "h2" {
+		t.Errorf("ALPN = %q, want h2 offered", state.NegotiatedProtocol)
+	}
+	if _, err := dial(tls.VersionTLS11); err == nil {
+		t.Error("server accepted TLS 1.1")
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, ServerName: "localhost"}, DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	res, err := client.Get("https://127.0.0.1:" + app.App.Config.Port + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.TLS == nil {
+		t.Errorf("HTTPS GET = %d", res.StatusCode)
+	}
+
+	waitForListener(t, "127.0.0.1:"+redirectPort)
+	res, err = client.Get("http://localhost:" + redirectPort + "/about?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	want := "https://localhost:" + app.App.Config.Port + "/about?x=1"
+	if res.StatusCode != http.StatusMovedPermanently || res.Header.Get("Location") != want {
+		t.Errorf("redirect = %d %s, want 301 %s", res.StatusCode, res.Header.Get("Location"), want)
+	}
+
+	app.App.Shutdown(context.Background())
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Shutdown")
+	}
+}
+
+func TestStartRejectsBadTLSSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*core.Config)
+		want      string
+	}{
+		{"deprecated version", func(c *core.Config) { c.TLSMinVersion = "1.1" }, "deprecated"},
+		{"unknown version", func(c *core.Config) { c.TLSMinVersion = "2.0" }, "unsupported TLS version"},
+		{"cert without key", func(c *core.Config) { c.TLSCertFile = "cert.pem" }, "both TLS cert and key"},
+		{"no files in production", func(c *core.Config) { c.DevMode = false }, "no cert/key files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tlsApp(t, tt.configure).App.Start()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Start = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// waitForListener blocks until something accepts connections on addr.
+func waitForListener(t *testing.T, addr string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing listening on %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,437 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header used to propagate traces.
+const TraceparentHeader = "traceparent"
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext identifies a span within a trace and is what crosses process
+// boundaries in the traceparent header.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats sc as a W3C traceparent header value, or "" when sc is
+// not valid.
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Inject sets the traceparent header on h so an outbound request continues the
+// trace.
+func (sc SpanContext) Inject(h http.Header) {
+	if value := sc.Traceparent(); value != "" {
+		h.Set(TraceparentHeader, value)
+	}
+}
+
+// ParseTraceparent parses a W3C traceparent header value. Unknown future
+// versions are accepted as long as the version 00 fields are well formed.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.DecodeString(version); err != nil {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if !decodeLowerHex(sc.TraceID[:], traceID) || !decodeLowerHex(sc.SpanID[:], spanID) {
+		return SpanContext{}, false
+	}
+
+	var flagByte [1]byte
+	if !decodeLowerHex(flagByte[:], flags) {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flagByte[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+func decodeLowerHex(dst []byte, src string) bool {
+	if strings.ToLower(src) != src {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+// Span is a timed operation within a trace. A nil *Span is valid and records
+// nothing, so callers never need to check whether tracing is enabled.
+type Span struct {
+	Name         string
+	Service      string
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Error        string
+
+	tracer *Tracer
+	ended  bool
+	mutex  sync.Mutex
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.Name = name
+	}
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.Attributes[key] = value
+	}
+}
+
+// RecordError marks the span as failed. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ended {
+		s.Error = err.Error()
+	}
+}
+
+// End finishes the span and hands it to the exporter. Only the first call has
+// any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mutex.Unlock()
+
+	if s.SpanContext.Sampled {
+		s.tracer.export(s)
+	}
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.SpanContext
+}
+
+func (s *Span) Duration() time.Duration {
+	return s.EndTime.Sub(s.StartTime)
+}
+
+// SpanExporter receives every sampled span once it ends. ExportSpan is called
+// on the request path, so exporters that do I/O should buffer.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer creates spans for one app. Without an exporter it creates no spans,
+// but incoming trace context is still propagated.
+type Tracer struct {
+	service    string
+	sampleRate float64
+	exporter   SpanExporter
+	mutex      sync.RWMutex
+}
+
+func NewTracer(service string, sampleRate float64) *Tracer {
+	return &Tracer{service: service, sampleRate: sampleRate}
+}
+
+func (t *Tracer) SetExporter(exporter SpanExporter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exporter = exporter
+}
+
+func (t *Tracer) Enabled() bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.exporter != nil
+}
+
+func (t *Tracer) export(span *Span) {
+	t.mutex.RLock()
+	exporter := t.exporter
+	t.mutex.RUnlock()
+
+	if exporter != nil {
+		exporter.ExportSpan(span)
+	}
+}
+
+// Shutdown flushes and stops the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mutex.RLock()
+	exporter := t.exporter
+	t.mutex.RUnlock()
+
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Shutdown(ctx)
+}
+
+// newTracerFromConfig installs the exporter named by config.TracingExporter
+// when tracing is enabled.
+func newTracerFromConfig(config *Config, logger *AppLogger) *Tracer {
+	tracer := NewTracer(config.AppName, config.TracingSampleRate)
+	if !config.TracingEnabled {
+		return tracer
+	}
+
+	switch config.TracingExporter {
+	case "", "stdout":
+		tracer.SetExporter(NewStdoutSpanExporter())
+	default:
+		logger.Warn("Unknown tracing exporter, spans will not be exported until one is set with Tracer.SetExporter",
+			"exporter", config.TracingExporter)
+	}
+
+	return tracer
+}
+
+// Start begins a span that is a child of the span in ctx, or of the remote
+// span context extracted from an incoming traceparent header. It returns ctx
+// unchanged and a nil span when tracing is disabled.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil || !t.Enabled() {
+		return ctx, nil
+	}
+
+	span := &Span{
+		Name:       name,
+		Service:    t.service,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]interface{}),
+		tracer:     t,
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.SpanContext.TraceID = parent.SpanContext.TraceID
+		span.SpanContext.Sampled = parent.SpanContext.Sampled
+		span.ParentSpanID = parent.SpanContext.SpanID
+	} else if remote, ok := remoteSpanContext(ctx); ok {
+		span.SpanContext.TraceID = remote.TraceID
+		span.SpanContext.Sampled = remote.Sampled
+		span.ParentSpanID = remote.SpanID
+	} else {
+		randomID(span.SpanContext.TraceID[:])
+		span.SpanContext.Sampled = t.sample(span.SpanContext.TraceID)
+	}
+	randomID(span.SpanContext.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// sample keeps a deterministic share of new traces based on the trace id.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRate >= 1 {
+		return true
+	}
+	if t.sampleRate <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/float64(1<<53) < t.sampleRate
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b[len(b)-8:], uint64(time.Now().UnixNano()))
+	}
+}
+
+type spanContextKey struct{}
+
+type remoteSpanContextKey struct{}
+
+// StartSpan begins a child of the span in ctx. Without a current span it
+// returns ctx unchanged and a nil span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the current span's context, falling back to
+// the incoming remote span context.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext
+	}
+	remote, _ := remoteSpanContext(ctx)
+	return remote
+}
+
+// ContextWithRemoteSpanContext records an incoming span context as the parent
+// for spans started from the returned context.
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanContextKey{}, sc)
+}
+
+func remoteSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(remoteSpanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
+
+// detachedSpanContext carries the span in ctx into a new context that is not
+// cancelled with ctx, for background work started by a request.
+func detachedSpanContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	if span := SpanFromContext(ctx); span != nil {
+		detached = context.WithValue(detached, spanContextKey{}, span)
+	}
+	if remote, ok := remoteSpanContext(ctx); ok {
+		detached = ContextWithRemoteSpanContext(detached, remote)
+	}
+	return detached
+}
+
+// JSONSpanExporter writes each span as one JSON object per line.
+type JSONSpanExporter struct {
+	out   io.Writer
+	mutex sync.Mutex
+}
+
+func NewJSONSpanExporter(out io.Writer) *JSONSpanExporter {
+	return &JSONSpanExporter{out: out}
+}
+
+func NewStdoutSpanExporter() *JSONSpanExporter {
+	return NewJSONSpanExporter(os.Stdout)
+}
+
+type jsonSpan struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentSpanID string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Service      string                 `json:"service,omitempty"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	DurationMs   float64                `json:"duration_ms"`
+	Status       string                 `json:"status"`
+	Error        string                 `json:"error,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+func (e *JSONSpanExporter) ExportSpan(span *Span) {
+	record := jsonSpan{
+		TraceID:    span.SpanContext.TraceID.String(),
+		SpanID:     span.SpanContext.SpanID.String(),
+		Name:       span.Name,
+		Service:    span.Service,
+		StartTime:  span.StartTime.UTC(),
+		EndTime:    span.EndTime.UTC(),
+		DurationMs: float64(span.Duration().Microseconds()) / 1000,
+		Status:     "ok",
+		Error:      span.Error,
+		Attributes: span.Attributes,
+	}
+	if span.ParentSpanID.IsValid() {
+		record.ParentSpanID = span.ParentSpanID.String()
+	}
+	if span.Error != "" {
+		record.Status = "error"
+	}
+
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		encoded, _ = json.Marshal(map[string]string{"error": fmt.Sprintf("span encoding failed: %v", err)})
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.out.Write(append(encoded, '\n'))
+}
+
+func (e *JSONSpanExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,255 @@
+package core_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"goonairplanes/core"
+	"goonairplanes/core/goatest"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// spanRecorder keeps every exported span in the order they ended.
+type spanRecorder struct {
+	spans []*core.Span
+	mutex sync.Mutex
+}
+
+func (r *spanRecorder) ExportSpan(span *core.Span) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func (r *spanRecorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func (r *spanRecorder) named(name string) *core.Span {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, span := range r.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func (r *spanRecorder) reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = nil
+}
+
+func tracedApp(t *testing.T, sampleRate float64, opts ...goatest.Option) (*goatest.App, *spanRecorder) {
+	t.Helper()
+
+	opts = append([]goatest.Option{goatest.WithConfig(func(c *core.Config) {
+		c.TracingEnabled = true
+		c.TracingSampleRate = sampleRate
+	})}, opts...)
+	app := newTestApp(t, opts...)
+
+	recorder := &spanRecorder{}
+	app.App.Router.Tracer.SetExporter(recorder)
+	return app, recorder
+}
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	var outbound http.Header
+	app, spans := tracedApp(t, 1, withAPI("/api/users/[id]", http.MethodGet, func(ctx *core.APIContext) {
+		outbound = http.Header{}
+		ctx.TraceContext().Inject(outbound)
+		ctx.Span().SetAttribute("user", ctx.Params["id"])
+		ctx.Success("ok", http.StatusOK)
+	}))
+
+	app.Request(http.MethodGet, "/api/users/7", nil, core.TraceparentHeader, incomingTraceparent).AssertStatus(http.StatusOK)
+
+	request := spans.named("GET /api/users/[id]")
+	if request == nil {
+		t.Fatalf("no request span named after the route in %d spans", len(spans.spans))
+	}
+	if got := request.SpanContext.TraceID.String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id = %s, want the incoming one", got)
+	}
+	if got := request.ParentSpanID.String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span id = %s, want the caller's span", got)
+	}
+	if request.Attributes["http.route"] != "/api/users/[id]" || request.Attributes["http.status_code"] != http.StatusOK {
+		t.Errorf("request span attributes = %v", request.Attributes)
+	}
+
+	handler := spans.named("api.handler")
+	if handler == nil || handler.ParentSpanID != request.SpanContext.SpanID {
+		t.Fatalf("api.handler span = %+v, want a child of the request span", handler)
+	}
+	if handler.Attributes["user"] != "7" {
+		t.Errorf("attribute set through ctx.Span() = %v", handler.Attributes["user"])
+	}
+	if match := spans.named("route.match"); match == nil || match.Attributes["http.route"] != "/api/users/[id]" {
+		t.Errorf("route.match span = %+v", match)
+	}
+
+	sc, ok := core.ParseTraceparent(outbound.Get(core.TraceparentHeader))
+	if !ok || sc.TraceID != request.SpanContext.TraceID || sc.SpanID != handler.SpanContext.SpanID || !sc.Sampled {
+		t.Errorf("injected traceparent = %q, want the handler span in the same trace", outbound.Get(core.TraceparentHeader))
+	}
+}
+
+func TestTracingStartsNewTraceForInvalidTraceparent(t *testing.T) {
+	app, spans := tracedApp(t, 1)
+
+	app.Request(http.MethodGet, "/", nil, core.TraceparentHeader, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+
+	request := spans.named("GET /")
+	if request == nil {
+		t.Fatal("no request span")
+	}
+	if !request.SpanContext.TraceID.IsValid() || request.ParentSpanID.IsValid() {
+		t.Errorf("span = trace %s parent %s, want a new root trace", request.SpanContext.TraceID, request.ParentSpanID)
+	}
+}
+
+func TestTracingPageRender(t *testing.T) {
+	var out bytes.Buffer
+	app, spans := tracedApp(t, 1, goatest.WithLogOutput(&out), goatest.WithConfig(func(c *core.Config) {
+		c.LogLevel = "info"
+	}))
+
+	app.Get("/instance").AssertStatus(http.StatusOK)
+
+	request := spans.named("GET /instance")
+	render := spans.named("render.template")
+	if request == nil || render == nil {
+		t.Fatalf("spans = %d, want the request and render spans", len(spans.spans))
+	}
+	if render.Attributes["template"] != "/instance" {
+		t.Errorf("render span template = %v", render.Attributes["template"])
+	}
+	if render.SpanContext.TraceID != request.SpanContext.TraceID {
+		t.Error("render span is in a different trace")
+	}
+
+	handled := findRecord(logRecords(t, &out), "Request handled")
+	if handled == nil || handled["trace_id"] != request.SpanContext.TraceID.String() {
+		t.Errorf("request log line = %v, want the trace id", handled)
+	}
+}
+
+func TestTracingSampleRate(t *testing.T) {
+	app, spans := tracedApp(t, 0)
+
+	app.Get("/")
+	if len(spans.spans) != 0 {
+		t.Errorf("exported %d spans at sample rate 0", len(spans.spans))
+	}
+
+	// A sampled caller's decision wins over the local rate.
+	app.Request(http.MethodGet, "/", nil, core.TraceparentHeader, incomingTraceparent)
+	if spans.named("GET /") == nil {
+		t.Error("sampled incoming trace was dropped")
+	}
+
+	spans.reset()
+	app.Request(http.MethodGet, "/", nil, core.TraceparentHeader, strings.TrimSuffix(incomingTraceparent, "01")+"00")
+	if len(spans.spans) != 0 {
+		t.Errorf("exported %d spans for an unsampled incoming trace", len(spans.spans))
+	}
+}
+
+func TestTracingDisabledPropagatesContext(t *testing.T) {
+	var sc core.SpanContext
+	var span *core.Span
+	app := newTestApp(t, withAPI("/api/ping", http.MethodGet, func(ctx *core.APIContext) {
+		sc = ctx.TraceContext()
+		span = ctx.Span()
+		span.SetAttribute("ignored", true)
+		ctx.Success("pong", http.StatusOK)
+	}))
+
+	if app.App.Router.Tracer.Enabled() {
+		t.Fatal("tracer enabled by default")
+	}
+	app.Request(http.MethodGet, "/api/ping", nil, core.TraceparentHeader, incomingTraceparent).AssertStatus(http.StatusOK)
+	if span != nil {
+		t.Error("span created with tracing disabled")
+	}
+	if sc.Traceparent() != incomingTraceparent {
+		t.Errorf("trace context = %q, want the incoming one passed through", sc.Traceparent())
+	}
+}
+
+func TestJSONSpanExporter(t *testing.T) {
+	var out bytes.Buffer
+	tracer := core.NewTracer("shop", 1)
+	tracer.SetExporter(core.NewJSONSpanExporter(&out))
+
+	ctx, parent := tracer.Start(context.Background(), "checkout")
+	_, child := core.StartSpan(ctx, "charge")
+	child.SetAttribute("amount", 42)
+	child.RecordError(context.DeadlineExceeded)
+	child.End()
+	child.End()
+	parent.End()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("exported %d lines, want one per span:\n%s", len(lines), out.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"name":           "charge",
+		"service":        "shop",
+		"trace_id":       parent.Context().TraceID.String(),
+		"parent_span_id": parent.Context().SpanID.String(),
+		"status":         "error",
+		"error":          "context deadline exceeded",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+	if attributes, _ := record["attributes"].(map[string]interface{}); attributes["amount"] != float64(42) {
+		t.Errorf("attributes = %v", record["attributes"])
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{incomingTraceparent, true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"", false, false},
+	}
+
+	for _, tt := range tests {
+		sc, ok := core.ParseTraceparent(tt.value)
+		if ok != tt.ok || sc.Sampled != tt.sampled {
+			t.Errorf("ParseTraceparent(%q) = sampled %v, %v; want sampled %v, %v", tt.value, sc.Sampled, ok, tt.sampled, tt.ok)
+		}
+		if ok && strings.HasPrefix(tt.value, "00-") && sc.Traceparent() != tt.value {
+			t.Errorf("Traceparent() = %q, want the parsed value %q", sc.Traceparent(), tt.value)
+		}
+	}
+}
@@ -24,8 +24,8 @@ type FileWatcher struct {
 }
 
 func NewFileWatcher(router *Router, logger *AppLogger) (*FileWatcher, error) {
-	if AppConfig.IsBuiltSystem {
-		logger.InfoLog.Printf("File watcher disabled: running on built system")
+	if router.Config.IsBuiltSystem {
+		logger.Infof("File watcher disabled: running on built system")
 		return &FileWatcher{
 			router:  router,
 			logger:  logger,
@@ -39,7 +39,7 @@ func NewFileWatcher(router *Router, logger *AppLogger) (*FileWatcher, error) {
 	}
 
 	var socketServer *socket.Server
-	if AppConfig.DevMode {
+	if router.Config.DevMode {
 
 		socketServer = socket.NewServer(
 			socket.WithCompression(true),
@@ -70,7 +70,7 @@ func NewFileWatcher(router *Router, logger *AppLogger) (*FileWatcher, error) {
 	return &FileWatcher{
 		router:       router,
 		watcher:      watcher,
-		dirs:         []string{AppConfig.AppDir, AppConfig.StaticDir},
+		dirs:         []string{router.Config.AppDir, router.Config.StaticDir},
 		logger:       logger,
 		socketServer: socketServer,
 		enabled:      true,
@@ -79,18 +79,18 @@ func NewFileWatcher(router *Router, logger *AppLogger) (*FileWatcher, error) {
 
 func (fw *FileWatcher) Start() {
 	if !fw.enabled {
-		fw.logger.InfoLog.Printf("File watcher is disabled, skipping start")
+		fw.logger.Infof("File watcher is disabled, skipping start")
 		return
 	}
 
-	fw.logger.InfoLog.Printf("Starting file watcher...")
+	fw.logger.Infof("Starting file watcher...")
 
 	for _, dir := range fw.dirs {
 		err := fw.watchDir(dir)
 		if err != nil {
-			fw.logger.ErrorLog.Printf("Error watching directory %s: %v", dir, err)
+			fw.logger.Errorf("Error watching directory %s: %v", dir, err)
 		} else {
-			fw.logger.InfoLog.Printf("Watching directory: %s", dir)
+			fw.logger.Infof("Watching directory: %s", dir)
 		}
 	}
 
@@ -102,17 +102,21 @@ func (fw *FileWatcher) Stop() {
 		return
 	}
 
+	if fw.debounceTimer != nil {
+		fw.debounceTimer.Stop()
+	}
+
 	if fw.watcher != nil {
 		fw.watcher.Close()
-		fw.logger.InfoLog.Printf("File watcher stopped")
+		fw.logger.Infof("File watcher stopped")
 	}
 
 	if fw.socketServer != nil {
-		fw.logger.InfoLog.Printf("Shutting down WebSocket server...")
+		fw.logger.Infof("Shutting down WebSocket server...")
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := fw.socketServer.Shutdown(ctx); err != nil {
-			fw.logger.ErrorLog.Printf("Error shutting down WebSocket server: %v", err)
+			fw.logger.Errorf("Error shutting down WebSocket server: %v", err)
 		}
 	}
 }
@@ -136,25 +140,25 @@ func (fw *FileWatcher) watchLoop() {
 					fw.debounceTimer.Stop()
 				}
 				fw.debounceTimer = time.AfterFunc(debounceTimeout, func() {
-					fw.logger.InfoLog.Printf("File change detected in %s, reloading...", event.Name)
+					fw.logger.Infof("File change detected in %s, reloading...", event.Name)
 
 					if fw.router.Marley != nil {
 						fw.router.Marley.InvalidateCache()
 
 						if err := fw.cleanGeneratedFiles(); err != nil {
-							fw.logger.ErrorLog.Printf("Error cleaning generated files: %v", err)
+							fw.logger.Errorf("Error cleaning generated files: %v", err)
 						} else {
-							fw.logger.InfoLog.Printf("Generated HTML files cleaned successfully")
+							fw.logger.Infof("Generated HTML files cleaned successfully")
 						}
 
-						fw.logger.InfoLog.Printf("Template cache invalidated")
+						fw.logger.Infof("Template cache invalidated")
 					}
 
 					err := fw.router.InitRoutes()
 					if err != nil {
-						fw.logger.ErrorLog.Printf("Failed to reload templates: %v", err)
+						fw.logger.Errorf("Failed to reload templates: %v", err)
 					} else {
-						fw.logger.InfoLog.Printf("Templates reloaded successfully")
+						fw.logger.Infof("Templates reloaded successfully")
 					}
 
 					if fw.socketServer != nil {
@@ -169,27 +173,27 @@ func (fw *FileWatcher) watchLoop() {
 			if !ok {
 				return
 			}
-			fw.logger.ErrorLog.Printf("Watcher error: %v", err)
+			fw.logger.Errorf("Watcher error: %v", err)
 		}
 	}
 }
 
 func (fw *FileWatcher) cleanGeneratedFiles() error {
-	if !AppConfig.SSGEnabled {
+	if !fw.router.Config.SSGEnabled {
 		return nil
 	}
 
-	return filepath.Walk(AppConfig.SSGDir, func(path string, info os.FileInfo, err error) error {
+	return filepath.Walk(fw.router.Config.SSGDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !info.IsDir() && strings.HasSuffix(strings.ToLower(path), ".html") {
+		if !info.IsDir() && (strings.HasSuffix(strings.ToLower(path), ".html") || strings.HasSuffix(strings.ToLower(path), ".html.gz")) {
 			if err := os.Remove(path); err != nil {
-				fw.logger.WarnLog.Printf("Failed to remove generated file %s: %v", path, err)
+				fw.logger.Warnf("Failed to remove generated file %s: %v", path, err)
 				return err
 			}
-			fw.logger.InfoLog.Printf("Removed generated file: %s", path)
+			fw.logger.Infof("Removed generated file: %s", path)
 		}
 
 		return nil
@@ -197,7 +201,7 @@ func (fw *FileWatcher) cleanGeneratedFiles() error {
 }
 
 func (fw *FileWatcher) watchDir(dir string) error {
-	if strings.Contains(dir, AppConfig.SSGDir) {
+	if strings.Contains(dir, fw.router.Config.SSGDir) {
 		return nil
 	}
 
@@ -223,14 +227,14 @@ func (fw *FileWatcher) RegisterSocketHandler(mux *http.ServeMux) {
 		return
 	}
 
-	if fw.socketServer != nil && AppConfig.DevMode {
-		fw.logger.InfoLog.Printf("Registering WebSocket handler at /socket endpoint for live reload")
+	if fw.socketServer != nil && fw.router.Config.DevMode {
+		fw.logger.Infof("Registering WebSocket handler at /socket endpoint for live reload")
 		mux.HandleFunc("/socket", fw.socketServer.HandleHTTP)
 	} else {
-		if !AppConfig.DevMode {
-			fw.logger.WarnLog.Printf("WebSocket handler not registered: not in development mode")
+		if !fw.router.Config.DevMode {
+			fw.logger.Warnf("WebSocket handler not registered: not in development mode")
 		} else if fw.socketServer == nil {
-			fw.logger.WarnLog.Printf("WebSocket handler not registered: socket server is nil")
+			fw.logger.Warnf("WebSocket handler not registered: socket server is nil")
 		}
 	}
 }
@@ -5,6 +5,7 @@ go 1.20
 require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/kleeedolinux/socket.go v0.2.3
+	golang.org/x/net v0.17.0
 )
 
 require (
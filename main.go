@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	_ "goonairplanes/app/api/test"
 	_ "goonairplanes/app/api/users"
@@ -16,13 +17,27 @@ import (
 
 type Configuration struct {
 	Server struct {
-		Port           string   `json:"port"`
-		DevMode        bool     `json:"devMode"`
-		IsBuiltSystem  bool     `json:"isBuiltSystem"`
-		LiveReload     bool     `json:"liveReload"`
-		EnableCORS     bool     `json:"enableCORS"`
-		AllowedOrigins []string `json:"allowedOrigins"`
-		RateLimit      int      `json:"rateLimit"`
+		Port                   string   `json:"port"`
+		BasePath               string   `json:"basePath"`
+		ShutdownTimeoutSeconds int      `json:"shutdownTimeoutSeconds"`
+		DevMode                bool     `json:"devMode"`
+		IsBuiltSystem          bool     `json:"isBuiltSystem"`
+		LiveReload             bool     `json:"liveReload"`
+		EnableCORS             bool     `json:"enableCORS"`
+		AllowedOrigins         []string `json:"allowedOrigins"`
+		RateLimit              int      `json:"rateLimit"`
+		TrustedProxies         []string `json:"trustedProxies"`
+		ServerTiming           bool     `json:"serverTiming"`
+		MaxBodyBytes           int64    `json:"maxBodyBytes"`
+		TLS                    struct {
+			Enabled      bool   `json:"enabled"`
+			CertFile     string `json:"certFile"`
+			KeyFile      string `json:"keyFile"`
+			MinVersion   string `json:"minVersion"`
+			RedirectHTTP bool   `json:"redirectHTTP"`
+			RedirectPort string `json:"redirectPort"`
+			DevCertDir   string `json:"devCertDir"`
+		} `json:"tls"`
 	} `json:"server"`
 	Directories struct {
 		AppDir       string `json:"appDir"`
@@ -43,6 +58,107 @@ type Configuration struct {
 		AppName         string            `json:"appName"`
 		DefaultMetaTags map[string]string `json:"defaultMetaTags"`
 	} `json:"meta"`
+	Resilience struct {
+		ErrorThreshold  float64 `json:"errorThreshold"`
+		MinRequests     int     `json:"minRequests"`
+		WindowSeconds   int     `json:"windowSeconds"`
+		CooldownSeconds int     `json:"cooldownSeconds"`
+
+		RequestTimeoutSeconds int `json:"requestTimeoutSeconds"`
+		TimeoutStatus         int `json:"timeoutStatus"`
+	} `json:"resilience"`
+	Session struct {
+		Enabled            bool     `json:"enabled"`
+		Store              string   `json:"store"`
+		Directory          string   `json:"directory"`
+		CookieName         string   `json:"cookieName"`
+		Keys               []string `json:"keys"`
+		Encrypt            *bool    `json:"encrypt"`
+		IdleTimeoutMinutes int      `json:"idleTimeoutMinutes"`
+		MaxAgeHours        int      `json:"maxAgeHours"`
+		SameSite           string   `json:"sameSite"`
+	} `json:"session"`
+	JWT struct {
+		Enabled            bool     `json:"enabled"`
+		Algorithms         []string `json:"algorithms"`
+		Secret             string   `json:"secret"`
+		KeyFile            string   `json:"keyFile"`
+		JWKSURL            string   `json:"jwksUrl"`
+		JWKSRefreshMinutes int      `json:"jwksRefreshMinutes"`
+		Issuer             string   `json:"issuer"`
+		Audience           []string `json:"audience"`
+		LeewaySeconds      int      `json:"leewaySeconds"`
+		CookieName         string   `json:"cookieName"`
+		LoginPath          string   `json:"loginPath"`
+	} `json:"jwt"`
+	CORS struct {
+		AllowedMethods   []string `json:"allowedMethods"`
+		AllowedHeaders   []string `json:"allowedHeaders"`
+		ExposedHeaders   []string `json:"exposedHeaders"`
+		AllowCredentials bool     `json:"allowCredentials"`
+		MaxAgeSeconds    int      `json:"maxAgeSeconds"`
+	} `json:"cors"`
+	Security struct {
+		CSP struct {
+			Enabled    bool              `json:"enabled"`
+			Directives map[string]string `json:"directives"`
+			ReportOnly bool              `json:"reportOnly"`
+			ReportPath string            `json:"reportPath"`
+		} `json:"csp"`
+		Headers struct {
+			Enabled                   *bool  `json:"enabled"`
+			HSTSMaxAgeDays            int    `json:"hstsMaxAgeDays"`
+			HSTSIncludeSubdomains     *bool  `json:"hstsIncludeSubdomains"`
+			HSTSPreload               bool   `json:"hstsPreload"`
+			FrameAncestors            string `json:"frameAncestors"`
+			ReferrerPolicy            string `json:"referrerPolicy"`
+			PermissionsPolicy         string `json:"permissionsPolicy"`
+			CrossOriginOpenerPolicy   string `json:"crossOriginOpenerPolicy"`
+			CrossOriginEmbedderPolicy string `json:"crossOriginEmbedderPolicy"`
+			CrossOriginResourcePolicy string `json:"crossOriginResourcePolicy"`
+			Routes                    []struct {
+				Path                      string `json:"path"`
+				FrameAncestors            string `json:"frameAncestors"`
+				ReferrerPolicy            string `json:"referrerPolicy"`
+				PermissionsPolicy         string `json:"permissionsPolicy"`
+				CrossOriginOpenerPolicy   string `json:"crossOriginOpenerPolicy"`
+				CrossOriginEmbedderPolicy string `json:"crossOriginEmbedderPolicy"`
+				CrossOriginResourcePolicy string `json:"crossOriginResourcePolicy"`
+			} `json:"routes"`
+		} `json:"headers"`
+	} `json:"security"`
+	CSRF struct {
+		Enabled bool     `json:"enabled"`
+		Exempt  []string `json:"exempt"`
+	} `json:"csrf"`
+	Compression struct {
+		Enabled      *bool    `json:"enabled"`
+		Level        int      `json:"level"`
+		MinSize      int      `json:"minSize"`
+		ContentTypes []string `json:"contentTypes"`
+	} `json:"compression"`
+	Health struct {
+		Enabled   *bool  `json:"enabled"`
+		Path      string `json:"path"`
+		ReadyPath string `json:"readyPath"`
+	} `json:"health"`
+	Logging struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	} `json:"logging"`
+	Tracing struct {
+		Enabled    bool    `json:"enabled"`
+		Exporter   string  `json:"exporter"`
+		SampleRate float64 `json:"sampleRate"`
+	} `json:"tracing"`
+	Metrics struct {
+		Enabled bool   `json:"enabled"`
+		Path    string `json:"path"`
+	} `json:"metrics"`
+	Batch struct {
+		Enabled  bool `json:"enabled"`
+		MaxItems int  `json:"maxItems"`
+	} `json:"batch"`
 	CDN struct {
 		UseCDN    bool   `json:"useCDN"`
 		Tailwind  string `json:"tailwind"`
@@ -70,12 +186,35 @@ func loadConfig(path string) (*Configuration, error) {
 
 func applyConfigToApp(config *Configuration) {
 	core.AppConfig.Port = config.Server.Port
+	core.AppConfig.BasePath = config.Server.BasePath
+	if config.Server.ShutdownTimeoutSeconds > 0 {
+		core.AppConfig.ShutdownTimeout = time.Duration(config.Server.ShutdownTimeoutSeconds) * time.Second
+	}
 	core.AppConfig.DevMode = config.Server.DevMode
 	core.AppConfig.IsBuiltSystem = config.Server.IsBuiltSystem
 	core.AppConfig.LiveReload = config.Server.LiveReload
 	core.AppConfig.EnableCORS = config.Server.EnableCORS
 	core.AppConfig.AllowedOrigins = config.Server.AllowedOrigins
 	core.AppConfig.RateLimit = config.Server.RateLimit
+	core.AppConfig.TrustedProxies = config.Server.TrustedProxies
+	core.AppConfig.ServerTiming = config.Server.ServerTiming
+	if config.Server.MaxBodyBytes > 0 {
+		core.AppConfig.MaxBodyBytes = config.Server.MaxBodyBytes
+	}
+
+	core.AppConfig.TLSEnabled = config.Server.TLS.Enabled
+	core.AppConfig.TLSCertFile = config.Server.TLS.CertFile
+	core.AppConfig.TLSKeyFile = config.Server.TLS.KeyFile
+	core.AppConfig.TLSRedirectHTTP = config.Server.TLS.RedirectHTTP
+	if config.Server.TLS.MinVersion != "" {
+		core.AppConfig.TLSMinVersion = config.Server.TLS.MinVersion
+	}
+	if config.Server.TLS.RedirectPort != "" {
+		core.AppConfig.TLSRedirectPort = config.Server.TLS.RedirectPort
+	}
+	if config.Server.TLS.DevCertDir != "" {
+		core.AppConfig.TLSDevCertDir = config.Server.TLS.DevCertDir
+	}
 
 	core.AppConfig.AppDir = config.Directories.AppDir
 	core.AppConfig.StaticDir = config.Directories.StaticDir
@@ -92,6 +231,184 @@ func applyConfigToApp(config *Configuration) {
 	core.AppConfig.AppName = config.Meta.AppName
 	core.AppConfig.DefaultMetaTags = config.Meta.DefaultMetaTags
 
+	if config.Resilience.ErrorThreshold > 0 {
+		core.AppConfig.CircuitErrorThreshold = config.Resilience.ErrorThreshold
+	}
+	if config.Resilience.MinRequests > 0 {
+		core.AppConfig.CircuitMinRequests = config.Resilience.MinRequests
+	}
+	if config.Resilience.WindowSeconds > 0 {
+		core.AppConfig.CircuitWindow = time.Duration(config.Resilience.WindowSeconds) * time.Second
+	}
+	if config.Resilience.CooldownSeconds > 0 {
+		core.AppConfig.CircuitOpenDuration = time.Duration(config.Resilience.CooldownSeconds) * time.Second
+	}
+	if config.Resilience.RequestTimeoutSeconds > 0 {
+		core.AppConfig.RequestTimeout = time.Duration(config.Resilience.RequestTimeoutSeconds) * time.Second
+	} else if config.Resilience.RequestTimeoutSeconds < 0 {
+		core.AppConfig.RequestTimeout = 0
+	}
+	if config.Resilience.TimeoutStatus != 0 {
+		core.AppConfig.TimeoutStatus = config.Resilience.TimeoutStatus
+	}
+
+	core.AppConfig.SessionEnabled = config.Session.Enabled
+	if config.Session.Store != "" {
+		core.AppConfig.SessionStore = config.Session.Store
+	}
+	if config.Session.Directory != "" {
+		core.AppConfig.SessionDir = config.Session.Directory
+	}
+	if config.Session.CookieName != "" {
+		core.AppConfig.SessionCookieName = config.Session.CookieName
+	}
+	if len(config.Session.Keys) > 0 {
+		core.AppConfig.SessionKeys = config.Session.Keys
+	}
+	if config.Session.Encrypt != nil {
+		core.AppConfig.SessionEncrypt = *config.Session.Encrypt
+	}
+	if config.Session.IdleTimeoutMinutes > 0 {
+		core.AppConfig.SessionIdleTimeout = time.Duration(config.Session.IdleTimeoutMinutes) * time.Minute
+	}
+	if config.Session.MaxAgeHours > 0 {
+		core.AppConfig.SessionMaxAge = time.Duration(config.Session.MaxAgeHours) * time.Hour
+	}
+	if config.Session.SameSite != "" {
+		core.AppConfig.SessionSameSite = config.Session.SameSite
+	}
+
+	if len(config.CORS.AllowedMethods) > 0 {
+		core.AppConfig.CORSAllowedMethods = config.CORS.AllowedMethods
+	}
+	if len(config.CORS.AllowedHeaders) > 0 {
+		core.AppConfig.CORSAllowedHeaders = config.CORS.AllowedHeaders
+	}
+	if len(config.CORS.ExposedHeaders) > 0 {
+		core.AppConfig.CORSExposedHeaders = config.CORS.ExposedHeaders
+	}
+	core.AppConfig.CORSAllowCredentials = config.CORS.AllowCredentials
+	if config.CORS.MaxAgeSeconds > 0 {
+		core.AppConfig.CORSMaxAge = time.Duration(config.CORS.MaxAgeSeconds) * time.Second
+	}
+
+	core.AppConfig.JWTEnabled = config.JWT.Enabled
+	if len(config.JWT.Algorithms) > 0 {
+		core.AppConfig.JWTAlgorithms = config.JWT.Algorithms
+	}
+	core.AppConfig.JWTSecret = config.JWT.Secret
+	core.AppConfig.JWTKeyFile = config.JWT.KeyFile
+	core.AppConfig.JWTJWKSURL = config.JWT.JWKSURL
+	if config.JWT.JWKSRefreshMinutes > 0 {
+		core.AppConfig.JWTJWKSRefresh = time.Duration(config.JWT.JWKSRefreshMinutes) * time.Minute
+	}
+	core.AppConfig.JWTIssuer = config.JWT.Issuer
+	if len(config.JWT.Audience) > 0 {
+		core.AppConfig.JWTAudience = config.JWT.Audience
+	}
+	if config.JWT.LeewaySeconds > 0 {
+		core.AppConfig.JWTLeeway = time.Duration(config.JWT.LeewaySeconds) * time.Second
+	}
+	core.AppConfig.JWTCookieName = config.JWT.CookieName
+	core.AppConfig.AuthLoginPath = config.JWT.LoginPath
+
+	core.AppConfig.CSPEnabled = config.Security.CSP.Enabled
+	if len(config.Security.CSP.Directives) > 0 {
+		core.AppConfig.CSPDirectives = config.Security.CSP.Directives
+	}
+	core.AppConfig.CSPReportOnly = config.Security.CSP.ReportOnly
+	if config.Security.CSP.ReportPath != "" {
+		core.AppConfig.CSPReportPath = config.Security.CSP.ReportPath
+	}
+
+	headers := config.Security.Headers
+	if headers.Enabled != nil {
+		core.AppConfig.SecurityHeadersEnabled = *headers.Enabled
+	}
+	if headers.HSTSMaxAgeDays > 0 {
+		core.AppConfig.HSTSMaxAge = time.Duration(headers.HSTSMaxAgeDays) * 24 * time.Hour
+	} else if headers.HSTSMaxAgeDays < 0 {
+		core.AppConfig.HSTSMaxAge = 0
+	}
+	if headers.HSTSIncludeSubdomains != nil {
+		core.AppConfig.HSTSIncludeSubdomains = *headers.HSTSIncludeSubdomains
+	}
+	core.AppConfig.HSTSPreload = headers.HSTSPreload
+	// An empty value keeps the default and "off" omits the header.
+	headerValue := func(target *string, value string) {
+		if value == "off" {
+			*target = ""
+		} else if value != "" {
+			*target = value
+		}
+	}
+	headerValue(&core.AppConfig.FrameAncestors, headers.FrameAncestors)
+	headerValue(&core.AppConfig.ReferrerPolicy, headers.ReferrerPolicy)
+	headerValue(&core.AppConfig.PermissionsPolicy, headers.PermissionsPolicy)
+	headerValue(&core.AppConfig.CrossOriginOpenerPolicy, headers.CrossOriginOpenerPolicy)
+	headerValue(&core.AppConfig.CrossOriginEmbedderPolicy, headers.CrossOriginEmbedderPolicy)
+	headerValue(&core.AppConfig.CrossOriginResourcePolicy, headers.CrossOriginResourcePolicy)
+	for _, route := range headers.Routes {
+		core.AppConfig.SecurityHeaderRoutes = append(core.AppConfig.SecurityHeaderRoutes, core.SecurityHeadersRoute{
+			Path:                      route.Path,
+			FrameAncestors:            route.FrameAncestors,
+			ReferrerPolicy:            route.ReferrerPolicy,
+			PermissionsPolicy:         route.PermissionsPolicy,
+			CrossOriginOpenerPolicy:   route.CrossOriginOpenerPolicy,
+			CrossOriginEmbedderPolicy: route.CrossOriginEmbedderPolicy,
+			CrossOriginResourcePolicy: route.CrossOriginResourcePolicy,
+		})
+	}
+
+	core.AppConfig.CSRFEnabled = config.CSRF.Enabled
+	core.AppConfig.CSRFExempt = config.CSRF.Exempt
+
+	if config.Compression.Enabled != nil {
+		core.AppConfig.CompressionEnabled = *config.Compression.Enabled
+	}
+	if config.Compression.Level != 0 {
+		core.AppConfig.CompressionLevel = config.Compression.Level
+	}
+	if config.Compression.MinSize > 0 {
+		core.AppConfig.CompressionMinSize = config.Compression.MinSize
+	}
+	if len(config.Compression.ContentTypes) > 0 {
+		core.AppConfig.CompressionContentTypes = config.Compression.ContentTypes
+	}
+
+	if config.Health.Enabled != nil {
+		core.AppConfig.HealthEnabled = *config.Health.Enabled
+	}
+	if config.Health.Path != "" {
+		core.AppConfig.HealthPath = config.Health.Path
+	}
+	if config.Health.ReadyPath != "" {
+		core.AppConfig.ReadyPath = config.Health.ReadyPath
+	}
+
+	if config.Logging.Level != "" {
+		core.AppConfig.LogLevel = config.Logging.Level
+	}
+	core.AppConfig.LogFormat = config.Logging.Format
+
+	core.AppConfig.TracingEnabled = config.Tracing.Enabled
+	if config.Tracing.Exporter != "" {
+		core.AppConfig.TracingExporter = config.Tracing.Exporter
+	}
+	if config.Tracing.SampleRate > 0 {
+		core.AppConfig.TracingSampleRate = config.Tracing.SampleRate
+	}
+
+	core.AppConfig.MetricsEnabled = config.Metrics.Enabled
+	if config.Metrics.Path != "" {
+		core.AppConfig.MetricsPath = config.Metrics.Path
+	}
+
+	core.AppConfig.BatchEnabled = config.Batch.Enabled
+	if config.Batch.MaxItems > 0 {
+		core.AppConfig.BatchMaxItems = config.Batch.MaxItems
+	}
+
 	core.AppConfig.DefaultCDNs = config.CDN.UseCDN
 	core.AppConfig.TailwindCDN = config.CDN.Tailwind
 	core.AppConfig.JQueryCDN = config.CDN.JQuery